@@ -160,6 +160,7 @@ export function GitProvider({ children }: GitProviderProps) {
                 authorAvatar: avatarUrl,
                 createdAt: issue.createdAt || new Date().toISOString(),
                 commentCount: issue.commentCount || 0,
+                version: issue.version || 0,
               };
             });
             
@@ -264,6 +265,7 @@ export function GitProvider({ children }: GitProviderProps) {
             authorAvatar: avatarUrl,
             createdAt: issue.createdAt || new Date().toISOString(),
             commentCount: issue.commentCount || 0,
+            version: issue.version || 0,
           };
         });
         
@@ -332,6 +334,7 @@ export function GitProvider({ children }: GitProviderProps) {
             authorAvatar: avatarUrl, // Use initials avatar (unisex)
             createdAt: issue.createdAt || new Date().toISOString(),
             commentCount: issue.commentCount || 0,
+            version: issue.version || 0,
           };
           return {
             ...repo,
@@ -360,8 +363,11 @@ export function GitProvider({ children }: GitProviderProps) {
     try {
       console.log('GitContext: Toggling issue status', repoId, issueId);
       
-      // Call API to toggle issue status
-      const updatedIssue = await api.toggleIssueStatus(repoId, issueId);
+      // Call API to toggle issue status, based on the version we last saw
+      const current = repositories
+        .find(repo => repo.id === repoId)
+        ?.issues.find(issue => issue.id === issueId);
+      const updatedIssue = await api.toggleIssueStatus(repoId, issueId, current?.version ?? 0);
       setApiStatus('connected');
       setApiError(null);
       
@@ -372,7 +378,7 @@ export function GitProvider({ children }: GitProviderProps) {
             ...repo,
             issues: repo.issues.map(issue => 
               issue.id === issueId 
-                ? { ...issue, status: updatedIssue.status as IssueStatus }
+                ? { ...issue, status: updatedIssue.status as IssueStatus, version: updatedIssue.version }
                 : issue
             ),
           };
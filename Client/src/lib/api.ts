@@ -87,6 +87,7 @@ export interface RepoListItem {
   name: string;
   description?: string;
   currentBranch: string;
+  defaultBranch?: string;
   branchCount: number;
   commitCount: number;
   lastUpdated?: string;
@@ -95,6 +96,9 @@ export interface RepoListItem {
 export interface Branch {
   name: string;
   createdAt: string;
+  tipCommitId: number | null; // null for a branch with no commits
+  tipMessage?: string;
+  tipDate?: string;
 }
 
 export interface Commit {
@@ -102,6 +106,8 @@ export interface Commit {
   message: string;
   author: string;
   date: string;
+  committer: string;
+  committerDate: string;
 }
 
 export interface Repository {
@@ -109,6 +115,7 @@ export interface Repository {
   name: string;
   description?: string;
   currentBranch: string;
+  defaultBranch: string;
   branches: Branch[];
   commits: Commit[];
   issues: any[];
@@ -147,19 +154,26 @@ export const api = {
     return data;
   },
 
-  async createRepo(name: string, description?: string): Promise<RepoListItem> {
+  async createRepo(name: string, description?: string, initialBranch?: string): Promise<RepoListItem> {
     return fetchJSON<RepoListItem>('/api/repos', {
       method: 'POST',
-      body: JSON.stringify({ name, description }),
+      body: JSON.stringify({ name, description, initialBranch }),
+    });
+  },
+
+  async validateRepo(name: string, initialBranch?: string): Promise<{ valid: boolean; available: boolean; error?: string }> {
+    return fetchJSON<{ valid: boolean; available: boolean; error?: string }>('/api/repos/validate', {
+      method: 'POST',
+      body: JSON.stringify({ name, initialBranch }),
     });
   },
 
   async getRepo(repoId: string): Promise<Repository> {
-    return fetchJSON<Repository>(`/api/repos/${repoId}`);
+    return fetchJSON<Repository>(`/api/repos/${encodeURIComponent(repoId)}`);
   },
 
   async getBranches(repoId: string): Promise<Branch[]> {
-    return fetchJSON<Branch[]>(`/api/repos/${repoId}/branches`);
+    return fetchJSON<Branch[]>(`/api/repos/${encodeURIComponent(repoId)}/branches`);
   },
 
   async getCommits(repoId: string, branch?: string, limit?: number): Promise<Commit[]> {
@@ -171,12 +185,12 @@ export const api = {
       params.append('limit', limit.toString());
     }
     const queryString = params.toString();
-    const url = `/api/repos/${repoId}/commits${queryString ? `?${queryString}` : ''}`;
+    const url = `/api/repos/${encodeURIComponent(repoId)}/commits${queryString ? `?${queryString}` : ''}`;
     return fetchJSON<Commit[]>(url);
   },
 
   async checkout(repoId: string, branch: string): Promise<void> {
-    await fetchJSON(`/api/repos/${repoId}/checkout`, {
+    await fetchJSON(`/api/repos/${encodeURIComponent(repoId)}/checkout`, {
       method: 'POST',
       body: JSON.stringify({ branch }),
     });
@@ -187,58 +201,178 @@ export const api = {
     await this.checkout(repoId, branchName);
   },
 
+  async pruneMissingRepos(): Promise<string[]> {
+    const response = await fetchJSON<{ pruned: string[] }>('/api/repos/prune', { method: 'POST' });
+    return response?.pruned || [];
+  },
+
+  async scanRepos(): Promise<string[]> {
+    const response = await fetchJSON<{ registered: string[] }>('/api/repos/scan', { method: 'POST' });
+    return response?.registered || [];
+  },
+
+  async refreshRepo(repoId: string): Promise<RepoListItem> {
+    return fetchJSON<RepoListItem>(`/api/repos/${encodeURIComponent(repoId)}/refresh`, { method: 'POST' });
+  },
+
+  async setDefaultBranch(repoId: string, branch: string): Promise<void> {
+    await fetchJSON(`/api/repos/${encodeURIComponent(repoId)}/default-branch`, {
+      method: 'PUT',
+      body: JSON.stringify({ branch }),
+    });
+  },
+
+  async getBranchProtection(repoId: string, branch: string): Promise<{ branch: string; protected: boolean }> {
+    return fetchJSON<{ branch: string; protected: boolean }>(`/api/repos/${encodeURIComponent(repoId)}/branches/${encodeURIComponent(branch)}/protection`);
+  },
+
+  async setBranchProtection(repoId: string, branch: string, isProtected: boolean): Promise<{ branch: string; protected: boolean }> {
+    return fetchJSON<{ branch: string; protected: boolean }>(`/api/repos/${encodeURIComponent(repoId)}/branches/${encodeURIComponent(branch)}/protection`, {
+      method: 'PUT',
+      body: JSON.stringify({ protected: isProtected }),
+    });
+  },
+
   async add(repoId: string, path: string): Promise<{ stagedCount: number; stagedPaths: string[] }> {
-    const response = await fetchJSON<{ stagedCount: number; stagedPaths: string[] }>(`/api/repos/${repoId}/add`, {
+    const response = await fetchJSON<{ stagedCount: number; stagedPaths: string[] }>(`/api/repos/${encodeURIComponent(repoId)}/add`, {
       method: 'POST',
       body: JSON.stringify({ path }),
     });
     return response || { stagedCount: 0, stagedPaths: [] };
   },
 
-  async commit(repoId: string, message: string): Promise<void> {
-    await fetchJSON(`/api/repos/${repoId}/commit`, {
+  async getStagedDiff(repoId: string): Promise<{ added: string[]; modified: string[]; deleted: string[] }> {
+    return fetchJSON<{ added: string[]; modified: string[]; deleted: string[] }>(`/api/repos/${encodeURIComponent(repoId)}/diff/staged`);
+  },
+
+  async commit(repoId: string, message: string, options?: { keepIndex?: boolean; paths?: string[]; parent?: string }): Promise<void> {
+    await fetchJSON(`/api/repos/${encodeURIComponent(repoId)}/commit`, {
       method: 'POST',
-      body: JSON.stringify({ message }),
+      body: JSON.stringify({ message, ...options }),
     });
   },
 
-  async push(repoId: string, remote: string, branch: string): Promise<void> {
-    await fetchJSON(`/api/repos/${repoId}/push`, {
+  async getGraph(
+    repoId: string,
+    branch?: string,
+    limit?: number
+  ): Promise<{ nodes: { id: string; message: string; date: string; branch: string }[]; edges: { from: string; to: string }[] }> {
+    const params = new URLSearchParams();
+    if (branch) {
+      params.append('branch', branch);
+    }
+    if (limit) {
+      params.append('limit', limit.toString());
+    }
+    const queryString = params.toString();
+    const url = `/api/repos/${encodeURIComponent(repoId)}/graph${queryString ? `?${queryString}` : ''}`;
+    return fetchJSON(url);
+  },
+
+  async getHead(
+    repoId: string,
+    branch?: string
+  ): Promise<{ branch: string; tipCommitId: number | null; tipMessage?: string; tipDate?: string; commitCount: number }> {
+    const query = branch ? `?branch=${encodeURIComponent(branch)}` : '';
+    return fetchJSON(`/api/repos/${encodeURIComponent(repoId)}/head${query}`);
+  },
+
+  async push(repoId: string, remote: string, branch: string, force = false, override = false): Promise<void> {
+    const params = new URLSearchParams();
+    if (force) params.set('force', 'true');
+    if (override) params.set('override', 'true');
+    const query = params.toString() ? `?${params}` : '';
+    await fetchJSON(`/api/repos/${encodeURIComponent(repoId)}/push${query}`, {
       method: 'POST',
       body: JSON.stringify({ remote, branch }),
     });
   },
 
-  async merge(repoId: string, branch: string): Promise<{ message: string; type?: string }> {
-    return fetchJSON<{ message: string; type?: string }>(`/api/repos/${repoId}/merge`, {
+  async rollbackPush(repoId: string, branch: string, override = false): Promise<{ message: string; hash: string }> {
+    const params = new URLSearchParams({ branch });
+    if (override) params.set('override', 'true');
+    return fetchJSON<{ message: string; hash: string }>(`/api/repos/${encodeURIComponent(repoId)}/push/rollback?${params}`, {
+      method: 'POST',
+    });
+  },
+
+  async merge(repoId: string, branch: string): Promise<{ message: string; type?: string; hash?: string }> {
+    return fetchJSON<{ message: string; type?: string; hash?: string }>(`/api/repos/${encodeURIComponent(repoId)}/merge`, {
       method: 'POST',
       body: JSON.stringify({ branch }),
     });
   },
 
+  async mergeBase(repoId: string, a: string, b: string): Promise<string | null> {
+    const params = new URLSearchParams({ a, b });
+    const response = await fetchJSON<{ mergeBase: string | null }>(`/api/repos/${encodeURIComponent(repoId)}/merge-base?${params}`);
+    return response?.mergeBase ?? null;
+  },
+
+  async getCommitBranches(repoId: string, hash: string): Promise<string[]> {
+    const response = await fetchJSON<{ branches: string[] }>(`/api/repos/${encodeURIComponent(repoId)}/commits/${encodeURIComponent(hash)}/branches`);
+    return response?.branches ?? [];
+  },
+
   async createIssue(repoId: string, title: string, body: string, priority: string, labels: any[], author?: string): Promise<any> {
-    return fetchJSON<any>(`/api/repos/${repoId}/issues`, {
+    return fetchJSON<any>(`/api/repos/${encodeURIComponent(repoId)}/issues`, {
       method: 'POST',
       body: JSON.stringify({ title, body, priority, labels, author }),
     });
   },
 
   async getIssues(repoId: string): Promise<any[]> {
-    return fetchJSON<any[]>(`/api/repos/${repoId}/issues`);
+    return fetchJSON<any[]>(`/api/repos/${encodeURIComponent(repoId)}/issues`);
   },
 
-  async toggleIssueStatus(repoId: string, issueId: string): Promise<any> {
-    return fetchJSON<any>(`/api/repos/${repoId}/issues/${issueId}`, {
+  async toggleIssueStatus(repoId: string, issueId: string, version: number): Promise<any> {
+    return fetchJSON<any>(`/api/repos/${encodeURIComponent(repoId)}/issues/${issueId}`, {
       method: 'PATCH',
-      body: JSON.stringify({}),
+      body: JSON.stringify({ version }),
     });
   },
 
-  async createOrEditFile(repoId: string, path: string, content: string): Promise<{ message: string; path: string }> {
-    return fetchJSON<{ message: string; path: string }>(`/api/repos/${repoId}/files`, {
+  async getFile(
+    repoId: string,
+    path: string,
+    options: { commit?: string; staged?: boolean } = {}
+  ): Promise<{ path: string; blobId: string; content: string; encoding: 'utf-8' | 'base64'; staged: boolean }> {
+    const params = new URLSearchParams({ path });
+    if (options.commit) {
+      params.append('commit', options.commit);
+    }
+    if (options.staged) {
+      params.append('staged', 'true');
+    }
+    return fetchJSON<{ path: string; blobId: string; content: string; encoding: 'utf-8' | 'base64'; staged: boolean }>(
+      `/api/repos/${encodeURIComponent(repoId)}/files?${params}`
+    );
+  },
+
+  async createOrEditFile(repoId: string, path: string, content: string, autoStage = false): Promise<{ message: string; path: string; staged: boolean }> {
+    return fetchJSON<{ message: string; path: string; staged: boolean }>(`/api/repos/${encodeURIComponent(repoId)}/files`, {
       method: 'POST',
-      body: JSON.stringify({ path, content }),
+      body: JSON.stringify({ path, content, autoStage }),
     });
   },
+
+  async createOrEditFiles(
+    repoId: string,
+    files: { path: string; content: string; autoStage?: boolean }[]
+  ): Promise<{ path: string; ok: boolean; staged: boolean; error?: string }[]> {
+    return fetchJSON<{ path: string; ok: boolean; staged: boolean; error?: string }[]>(`/api/repos/${encodeURIComponent(repoId)}/files/bulk`, {
+      method: 'POST',
+      body: JSON.stringify(files),
+    });
+  },
+
+  async getAudit(repoId?: string): Promise<{ time: string; method: string; path: string; repoId?: string; actor?: string; status: number }[]> {
+    const query = repoId ? `?${new URLSearchParams({ repo: repoId })}` : '';
+    return fetchJSON<{ time: string; method: string; path: string; repoId?: string; actor?: string; status: number }[]>(`/api/audit${query}`);
+  },
+
+  async getVersion(): Promise<{ version: string; features: string[]; schemaVersion: number }> {
+    return fetchJSON<{ version: string; features: string[]; schemaVersion: number }>('/api/version');
+  },
 };
 
@@ -25,6 +25,7 @@ export interface Issue {
   authorAvatar: string;
   createdAt: string;
   commentCount: number;
+  version?: number;
 }
 
 export interface Commit {
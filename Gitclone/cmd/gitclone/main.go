@@ -30,13 +30,19 @@ func printHelp() {
 	fmt.Println("gitclone - mini git implementation")
 	fmt.Println()
 	fmt.Println("Usage:")
-	fmt.Println("  gitclone init [--bare]          Initialize a new repository")
+	fmt.Println("  gitclone init [--bare]          Initialize a new repository (-b <branch> names the first branch)")
+	fmt.Println("  gitclone clone <src> <dest>     Copy a repository; its branches become origin/<branch>")
 	fmt.Println("  gitclone add <path>             Stage files for commit")
+	fmt.Println("  gitclone rm <path>              Remove a file and stage the deletion")
+	fmt.Println("  gitclone status                 Show staged, modified and untracked files")
 	fmt.Println("  gitclone checkout <branch>      Switch branch (updates .gitclone/HEAD)")
-	fmt.Println("  gitclone commit -m <msg>        Create a commit")
+	fmt.Println("  gitclone commit -m <msg>        Create a commit (--keep-index leaves files staged; --amend [--force] rewrites the last one)")
 	fmt.Println("  gitclone merge <branch>         Merge branch into current branch")
-	fmt.Println("  gitclone log                    Show commit history")
-	fmt.Println("  gitclone show <id>              Show a single commit")
+	fmt.Println("  gitclone push [branch]          Fast-forward origin/<branch> to the branch (--force overwrites it)")
+	fmt.Println("  gitclone pull [branch]          Fast-forward the branch to origin/<branch>")
+	fmt.Println("  gitclone log [-n <count>]       Show commit history (--since/--until <time>)")
+	fmt.Println("  gitclone config [name [value]] Read or set a repo setting (merge.ff)")
+	fmt.Println("  gitclone show <id>              Show a commit and the files it changed (--name-only)")
 }
 
 func main() {
@@ -65,6 +71,12 @@ func main() {
 			case "add":
 				commands.Add(args)
 				return
+			case "rm":
+				commands.Rm(args)
+				return
+			case "status":
+				commands.Status(args)
+				return
 			case "commit":
 				commands.Commit(args)
 				return
@@ -74,12 +86,21 @@ func main() {
 			case "merge":
 				commands.Merge(args)
 				return
+			case "push":
+				commands.Push(args)
+				return
+			case "pull":
+				commands.Pull(args)
+				return
 			case "log":
 				commands.Log(args)
 				return
 			case "show":
 				commands.Show(args)
 				return
+			case "config":
+				commands.Config(args)
+				return
 			case "init":
 				commands.Init(args)
 				return
@@ -103,9 +124,18 @@ func main() {
 	case "init":
 		commands.Init(args)
 
+	case "clone":
+		commands.Clone(args)
+
 	case "add":
 		commands.Add(args)
 
+	case "rm":
+		commands.Rm(args)
+
+	case "status":
+		commands.Status(args)
+
 	case "checkout":
 		commands.Checkout(args)
 
@@ -115,12 +145,21 @@ func main() {
 	case "merge":
 		commands.Merge(args)
 
+	case "push":
+		commands.Push(args)
+
+	case "pull":
+		commands.Pull(args)
+
 	case "log":
 		commands.Log(args)
 
 	case "show":
 		commands.Show(args)
 
+	case "config":
+		commands.Config(args)
+
 	default:
 		fmt.Println("Unknown command:", cmd)
 		printHelp()
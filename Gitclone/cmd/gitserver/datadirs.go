@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// validateDataDirs checks the repository base and metadata DB directories
+// before the server starts: each must exist or be creatable and be writable,
+// and neither may lie inside the other, where repositories and the metadata
+// log would mix. Both paths must be absolute.
+func validateDataDirs(repoBase, dbPath string) error {
+	if within(repoBase, dbPath) || within(dbPath, repoBase) {
+		return fmt.Errorf("repo base %s and metadata DB path %s must not be nested in each other", repoBase, dbPath)
+	}
+	if err := ensureWritableDir(repoBase); err != nil {
+		return fmt.Errorf("repo base: %w", err)
+	}
+	if err := ensureWritableDir(dbPath); err != nil {
+		return fmt.Errorf("metadata DB path: %w", err)
+	}
+	return nil
+}
+
+// within reports whether path is dir or lies below it
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// ensureWritableDir creates dir if missing and checks a file can be written
+// in it
+func ensureWritableDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("cannot create %s: %w", dir, err)
+	}
+	probe, err := os.CreateTemp(dir, ".gitstore-write-check-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
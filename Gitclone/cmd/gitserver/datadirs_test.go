@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestValidateDataDirs accepts the default sibling layout and rejects nested
+// directories and a base that can't be created or written
+func TestValidateDataDirs(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-datadirs-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repoBase := filepath.Join(tmpDir, "data", "repos")
+	dbPath := filepath.Join(tmpDir, "data", "db")
+	if err := validateDataDirs(repoBase, dbPath); err != nil {
+		t.Fatalf("Expected the default layout to be valid: %v", err)
+	}
+	if _, err := os.Stat(repoBase); err != nil {
+		t.Errorf("Expected the repo base to be created: %v", err)
+	}
+
+	if err := validateDataDirs(repoBase, filepath.Join(repoBase, "db")); err == nil {
+		t.Errorf("Expected a DB path inside the repo base to be rejected")
+	}
+	if err := validateDataDirs(filepath.Join(dbPath, "repos"), dbPath); err == nil {
+		t.Errorf("Expected a repo base inside the DB path to be rejected")
+	}
+	if err := validateDataDirs(dbPath, dbPath); err == nil {
+		t.Errorf("Expected the same directory for both to be rejected")
+	}
+
+	// A base under a regular file can't be created
+	file := filepath.Join(tmpDir, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := validateDataDirs(filepath.Join(file, "repos"), dbPath); err == nil {
+		t.Errorf("Expected a repo base under a file to be rejected")
+	}
+
+	// Permissions don't stop root, so the read-only case needs another user
+	if os.Geteuid() == 0 {
+		t.Skip("running as root; skipping the read-only directory case")
+	}
+	readOnly := filepath.Join(tmpDir, "readonly")
+	if err := os.Mkdir(readOnly, 0555); err != nil {
+		t.Fatalf("Failed to create read-only dir: %v", err)
+	}
+	defer os.Chmod(readOnly, 0755)
+	if err := validateDataDirs(readOnly, dbPath); err == nil {
+		t.Errorf("Expected a read-only repo base to be rejected")
+	}
+}
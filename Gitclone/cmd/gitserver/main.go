@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"time"
 
+	"gitclone/internal/app/compaction"
+	"gitclone/internal/app/events"
 	"gitclone/internal/metadata"
 	httptransport "gitclone/internal/transport/http"
 )
@@ -44,6 +49,11 @@ func main() {
 	}
 	dbPath = dbPathAbs
 
+	// Fail fast on a misconfigured layout rather than on the first request
+	if err := validateDataDirs(repoBase, dbPath); err != nil {
+		log.Fatalf("Invalid data directories: %v", err)
+	}
+
 	// Initialize metadata store
 	metaStore, err := metadata.NewStore(dbPath)
 	if err != nil {
@@ -54,6 +64,85 @@ func main() {
 	// Create server instance
 	server := httptransport.NewServer(repoBase, metaStore)
 
+	// Optional outbound webhook for commit/push/merge events
+	if webhookURL := os.Getenv("GITSTORE_WEBHOOK_URL"); webhookURL != "" {
+		server.SetEventPublisher(events.NewWebhook(webhookURL))
+		log.Printf("Webhook events enabled: %s", webhookURL)
+	}
+
+	// Comma-separated CORS allowlist; unset allows any origin (development only)
+	if origins := httptransport.ParseAllowedOrigins(os.Getenv("GITSTORE_CORS_ORIGINS")); len(origins) > 0 {
+		server.SetAllowedOrigins(origins)
+		log.Printf("CORS allowed origins: %v", origins)
+	} else {
+		log.Printf("WARNING: GITSTORE_CORS_ORIGINS not set, allowing any origin")
+	}
+
+	// Optional quotas for shared deployments; unset means unlimited
+	var quotas httptransport.Quotas
+	if value := os.Getenv("GITSTORE_MAX_REPOS"); value != "" {
+		maxRepos, err := strconv.Atoi(value)
+		if err != nil || maxRepos < 0 {
+			log.Fatalf("Invalid GITSTORE_MAX_REPOS %q: expected a non-negative integer", value)
+		}
+		quotas.MaxRepos = maxRepos
+	}
+	if value := os.Getenv("GITSTORE_MAX_REPO_BYTES"); value != "" {
+		maxBytes, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || maxBytes < 0 {
+			log.Fatalf("Invalid GITSTORE_MAX_REPO_BYTES %q: expected a non-negative integer", value)
+		}
+		quotas.MaxRepoBytes = maxBytes
+	}
+	server.SetQuotas(quotas)
+
+	// Optional Prometheus metrics at GET /metrics
+	if value := os.Getenv("GITSTORE_METRICS"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			log.Fatalf("Invalid GITSTORE_METRICS %q: expected true or false", value)
+		}
+		if enabled {
+			server.EnableMetrics()
+			log.Printf("Metrics enabled at /metrics")
+		}
+	}
+	// Optional admin token, which the debug routes require
+	if value := os.Getenv("GITSTORE_ADMIN_TOKEN"); value != "" {
+		server.SetAdminToken(value)
+		log.Printf("Debug routes enabled for requests with the admin token")
+	}
+	// Optional limit on how long one request may run
+	if value := os.Getenv("GITSTORE_REQUEST_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout < 0 {
+			log.Fatalf("Invalid GITSTORE_REQUEST_TIMEOUT %q: expected a duration such as 30s", value)
+		}
+		server.SetRequestTimeout(timeout)
+		log.Printf("Request timeout: %s (0 is none)", timeout)
+	}
+	// Optional background compaction of repository logs
+	if value := os.Getenv("GITSTORE_COMPACT_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval < 0 {
+			log.Fatalf("Invalid GITSTORE_COMPACT_INTERVAL %q: expected a duration such as 10m", value)
+		}
+		options := compaction.Options{Interval: interval, Threshold: compaction.DefaultThreshold}
+		if value := os.Getenv("GITSTORE_COMPACT_THRESHOLD"); value != "" {
+			threshold, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || threshold <= 0 {
+				log.Fatalf("Invalid GITSTORE_COMPACT_THRESHOLD %q: expected a positive integer", value)
+			}
+			options.Threshold = threshold
+		}
+		if interval > 0 {
+			scheduler := compaction.NewScheduler(repoBase, metaStore, server.RepoLocks(), options)
+			go scheduler.Run(context.Background())
+			log.Printf("Compaction enabled: every %s, threshold %d bytes", interval, options.Threshold)
+		}
+	}
+	log.Printf("Quotas: max repos %d, max repo bytes %d (0 is unlimited)", quotas.MaxRepos, quotas.MaxRepoBytes)
+
 	log.Printf("Repository base directory (absolute): %s", repoBase)
 	log.Printf("Metadata database path (absolute): %s", dbPath)
 
@@ -1,22 +1,31 @@
 package branches
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"path/filepath"
 	"strings"
-	"time"
 
 	"GitDb"
 	"gitclone/internal/infra/storage"
 	"gitclone/internal/metadata"
 	repostorage "gitclone/internal/storage"
+	"gitclone/internal/timefmt"
 )
 
+// ErrBranchNotFound is returned when an operation names a branch the
+// repository doesn't have
+var ErrBranchNotFound = errors.New("branch not found")
+
 // Branch represents a git branch
 type Branch struct {
 	Name      string
 	CreatedAt string
+	// Tip of the branch; nil for a branch with no commits yet
+	TipCommitID *int
+	TipMessage  string
+	TipDate     string // RFC3339 UTC, from the tip commit's timestamp
 }
 
 // Service handles branch operations
@@ -42,11 +51,17 @@ func (s *Service) ListBranches(repoID string) ([]Branch, error) {
 	}
 	defer repoStore.Close()
 
+	return s.ListBranchesFromStore(repoStore)
+}
+
+// ListBranchesFromStore returns all branches in an open store, such as a
+// RepoStore snapshot
+func (s *Service) ListBranchesFromStore(repoStore *storage.RepoStore) ([]Branch, error) {
 	// Debug: log repo info
 	repoPath := repoStore.RepoPath()
 	dbPath := filepath.Join(repoPath, ".gitclone", "db")
 	log.Printf("DEBUG ListBranches: repoID=%s, repoBase=%s, repoPath=%s, dbPath=%s", 
-		repoID, s.repoBase, repoPath, dbPath)
+		repoStore.RepoID(), s.repoBase, repoPath, dbPath)
 
 	branchNames, err := repostorage.ListBranchesFromStore(repoStore)
 	if err != nil {
@@ -81,15 +96,49 @@ func (s *Service) ListBranches(repoID string) ([]Branch, error) {
 
 	branches := make([]Branch, 0, len(uniqueNames))
 	for _, name := range uniqueNames {
-		branches = append(branches, Branch{
+		branch := Branch{
 			Name:      name,
-			CreatedAt: time.Now().Format(time.RFC3339), // TODO: get actual creation time
-		})
+			CreatedAt: timefmt.Format(timefmt.Now()), // TODO: get actual creation time
+		}
+		if err := readTip(repoStore, &branch); err != nil {
+			return nil, err
+		}
+		branches = append(branches, branch)
 	}
 
 	return branches, nil
 }
 
+// readTip fills in the tip commit of branch. Empty branches keep a nil tip.
+func readTip(repoStore *storage.RepoStore, branch *Branch) error {
+	tip, err := repostorage.ReadHeadRefMaybeFromStore(repoStore, branch.Name)
+	if err != nil {
+		return err
+	}
+	if tip == nil {
+		return nil
+	}
+	commit, err := repostorage.ReadCommitObjectFromStore(repoStore, *tip)
+	if err != nil {
+		return fmt.Errorf("branch %s: read tip commit %d: %w", branch.Name, *tip, err)
+	}
+	branch.TipCommitID = tip
+	branch.TipMessage = commit.Message
+	branch.TipDate = timefmt.FormatUnix(commit.Timestamp)
+	return nil
+}
+
+// ListRefs returns every ref in the repository (heads, remotes, tags) mapped to its value
+func (s *Service) ListRefs(repoID string) (map[string]string, error) {
+	repoStore, err := storage.NewRepoStore(s.repoBase, repoID)
+	if err != nil {
+		return nil, err
+	}
+	defer repoStore.Close()
+
+	return repostorage.ListAllRefs(repoStore)
+}
+
 // Checkout switches to a branch, creating it if it doesn't exist atomically
 func (s *Service) Checkout(repoID, branchName string) error {
 	// Open per-repo store
@@ -126,8 +175,9 @@ func (s *Service) Checkout(repoID, branchName string) error {
 	batch := repoStore.NewWriteBatch()
 
 	// Ensure target branch ref exists in batch (create empty ref if new)
-	// This is critical: even if branch is new and repo is empty, we must create the ref
-	if targetTip == nil {
+	// This is critical: even if branch is new and repo is empty, we must create the ref.
+	// An existing branch with an empty ref has no commits yet and stays empty.
+	if targetTip == nil && !repostorage.HeadRefExistsFromStore(repoStore, branchName) {
 		// Branch doesn't exist yet - create it
 		// First, try to copy current branch's tip if it exists
 		currentTip, err := repostorage.ReadHeadRefMaybeFromStore(repoStore, currentBranch)
@@ -146,6 +196,8 @@ func (s *Service) Checkout(repoID, branchName string) error {
 			batch.Put(key, []byte(""))
 			log.Printf("DEBUG Checkout: creating new branch %s with empty ref (no commits yet)", branchName)
 		}
+	} else if targetTip == nil {
+		log.Printf("DEBUG Checkout: branch %s already exists with no commits", branchName)
 	} else {
 		log.Printf("DEBUG Checkout: branch %s already exists with tip %d", branchName, *targetTip)
 	}
@@ -169,7 +221,7 @@ func (s *Service) Checkout(repoID, branchName string) error {
 		branches, _ := s.ListBranches(repoID)
 		meta.CurrentBranch = branchName
 		meta.BranchCount = len(branches)
-		meta.UpdatedAt = time.Now()
+		meta.UpdatedAt = timefmt.Now()
 		if err := s.metaStore.UpdateRepo(*meta); err != nil {
 			// Log but don't fail the operation
 		}
@@ -178,3 +230,72 @@ func (s *Service) Checkout(repoID, branchName string) error {
 	return nil
 }
 
+// SetDefaultBranch makes branchName the repository's default branch. The branch
+// must already exist, though it may have no commits yet.
+func (s *Service) SetDefaultBranch(repoID, branchName string) error {
+	repoStore, err := storage.NewRepoStore(s.repoBase, repoID)
+	if err != nil {
+		return err
+	}
+	defer repoStore.Close()
+
+	if !repostorage.HeadRefExistsFromStore(repoStore, branchName) {
+		return fmt.Errorf("%w: %s", ErrBranchNotFound, branchName)
+	}
+
+	batch := repoStore.NewWriteBatch()
+	if err := repostorage.WriteDefaultBranchToBatch(batch, branchName); err != nil {
+		return err
+	}
+	if err := batch.Commit(); err != nil {
+		return fmt.Errorf("failed to commit default branch: %w", err)
+	}
+
+	meta, err := s.metaStore.GetRepo(repoID)
+	if err == nil {
+		meta.DefaultBranch = branchName
+		meta.UpdatedAt = timefmt.Now()
+		if err := s.metaStore.UpdateRepo(*meta); err != nil {
+			log.Printf("Warning: failed to update metadata after setting default branch: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// BranchProtection returns whether branchName is protected
+func (s *Service) BranchProtection(repoID, branchName string) (bool, error) {
+	repoStore, err := storage.NewRepoStore(s.repoBase, repoID)
+	if err != nil {
+		return false, err
+	}
+	defer repoStore.Close()
+
+	if !repostorage.HeadRefExistsFromStore(repoStore, branchName) {
+		return false, fmt.Errorf("%w: %s", ErrBranchNotFound, branchName)
+	}
+	return repostorage.IsBranchProtectedFromStore(repoStore, branchName)
+}
+
+// SetBranchProtection protects or unprotects branchName, which must exist.
+// A protected branch can't be force-pushed or rolled back without an override.
+func (s *Service) SetBranchProtection(repoID, branchName string, protected bool) error {
+	repoStore, err := storage.NewRepoStore(s.repoBase, repoID)
+	if err != nil {
+		return err
+	}
+	defer repoStore.Close()
+
+	if !repostorage.HeadRefExistsFromStore(repoStore, branchName) {
+		return fmt.Errorf("%w: %s", ErrBranchNotFound, branchName)
+	}
+
+	batch := repoStore.NewWriteBatch()
+	if err := repostorage.WriteBranchProtectionToBatch(batch, branchName, protected); err != nil {
+		return err
+	}
+	if err := batch.Commit(); err != nil {
+		return fmt.Errorf("failed to commit branch protection: %w", err)
+	}
+	return nil
+}
@@ -1,9 +1,11 @@
 package branches
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"GitDb"
 	"gitclone/internal/infra/storage"
@@ -258,7 +260,7 @@ func TestBranchPersistsAfterFileOperations(t *testing.T) {
 		t.Fatalf("Failed to open RepoStore: %v", err)
 	}
 
-	if err := repostorage.AddToIndexFromStore(repoStore, "test.txt"); err != nil {
+	if _, err := repostorage.AddToIndexFromStore(context.Background(), repoStore, "test.txt"); err != nil {
 		t.Fatalf("Failed to stage file: %v", err)
 	}
 	repoStore.Close()
@@ -420,3 +422,72 @@ func dumpHEAD(t *testing.T, repoPath string) {
 		t.Logf("=== HEAD value: %q ===", string(headData))
 	}
 }
+
+// TestListBranchesReportsTip verifies that a branch with commits reports its tip
+// commit, message and date, and an empty branch reports no tip
+func TestListBranchesReportsTip(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-branch-tip-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repoBase := filepath.Join(tmpDir, "repos")
+	repoID := "test-repo"
+	repoPath := filepath.Join(repoBase, repoID)
+	if err := os.MkdirAll(repoPath, 0755); err != nil {
+		t.Fatalf("Failed to create repo dir: %v", err)
+	}
+
+	options := repostorage.InitOptions{Bare: false}
+	if err := repostorage.InitRepo(repoPath, options); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+	commit := repostorage.Commit{ID: 0, Message: "Initial commit", Branch: "master", Timestamp: 1700000000}
+	if err := repostorage.WriteCommitObject(repoPath, options, commit); err != nil {
+		t.Fatalf("Failed to write commit: %v", err)
+	}
+	if err := repostorage.WriteHeadRef(repoPath, options, "master", 0); err != nil {
+		t.Fatalf("Failed to write master ref: %v", err)
+	}
+	if err := repostorage.EnsureHeadRefExists(repoPath, options, "empty"); err != nil {
+		t.Fatalf("Failed to create empty branch: %v", err)
+	}
+
+	metaStore, err := metadata.NewStore(filepath.Join(tmpDir, "db"))
+	if err != nil {
+		t.Fatalf("Failed to create metadata store: %v", err)
+	}
+	defer metaStore.Close()
+
+	branches, err := NewService(repoBase, metaStore).ListBranches(repoID)
+	if err != nil {
+		t.Fatalf("Failed to list branches: %v", err)
+	}
+	byName := make(map[string]Branch)
+	for _, b := range branches {
+		byName[b.Name] = b
+	}
+
+	master, ok := byName["master"]
+	if !ok {
+		t.Fatalf("Expected master in %+v", branches)
+	}
+	if master.TipCommitID == nil || *master.TipCommitID != 0 {
+		t.Errorf("Expected master tip 0, got %v", master.TipCommitID)
+	}
+	if master.TipMessage != "Initial commit" {
+		t.Errorf("Expected master tip message %q, got %q", "Initial commit", master.TipMessage)
+	}
+	if want := time.Unix(1700000000, 0).Format(time.RFC3339); master.TipDate != want {
+		t.Errorf("Expected master tip date %s, got %s", want, master.TipDate)
+	}
+
+	empty, ok := byName["empty"]
+	if !ok {
+		t.Fatalf("Expected empty branch in %+v", branches)
+	}
+	if empty.TipCommitID != nil || empty.TipMessage != "" || empty.TipDate != "" {
+		t.Errorf("Expected no tip for the empty branch, got %+v", empty)
+	}
+}
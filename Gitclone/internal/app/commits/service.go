@@ -1,50 +1,152 @@
 package commits
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"GitDb"
+	"gitclone/internal/app/events"
 	"gitclone/internal/infra/storage"
 	"gitclone/internal/metadata"
 	repostorage "gitclone/internal/storage"
+	"gitclone/internal/timefmt"
 )
 
-// Commit represents a git commit
+// ErrAlreadyPushed is returned when amending a commit that has been pushed,
+// unless the amend is forced
+var ErrAlreadyPushed = errors.New("commit has already been pushed")
+
+// ErrNonFastForward is returned when a push would drop commits from the
+// remote branch, unless the push is forced
+var ErrNonFastForward = errors.New("non-fast-forward push rejected")
+
+// ErrNothingToCommit is returned when committing with nothing staged
+var ErrNothingToCommit = errors.New("Nothing to commit")
+
+// ErrNothingToPush is returned when pushing a branch with no commits
+var ErrNothingToPush = errors.New("no commits to push")
+
+// ErrNoPushToRollback is returned when rolling back a push whose reflog has
+// no earlier remote tip to return to
+var ErrNoPushToRollback = errors.New("no earlier pushed tip to roll back to")
+
+// Commit represents a git commit. Date and Timestamp are the author date.
 type Commit struct {
-	Hash    string
-	Message string
-	Author  string
-	Date    string
+	Hash          string
+	Message       string
+	Author        string
+	Date          string
+	Timestamp     int64
+	Committer     string
+	CommitterDate string
 }
 
 // Service handles commit operations
 type Service struct {
 	repoBase  string
 	metaStore *metadata.Store
+	publisher events.Publisher
+	opener    StoreOpener
+	locks     *storage.RepoLocks // held by commit, amend and push
 }
 
+// StoreOpener opens the RepoStore of a repository
+type StoreOpener func(repoID string) (*storage.RepoStore, error)
+
 // NewService creates a new commits service
 func NewService(repoBase string, metaStore *metadata.Store) *Service {
 	return &Service{
 		repoBase:  repoBase,
 		metaStore: metaStore,
+		locks:     storage.NewRepoLocks(),
 	}
 }
 
-// ListCommits returns commits for a repository branch
-func (s *Service) ListCommits(repoID, branchName string, limit int) ([]Commit, error) {
+// SetLocks sets the per-repo locks commits, amends and pushes hold, so they
+// can be shared with other writers such as merge
+func (s *Service) SetLocks(locks *storage.RepoLocks) {
+	s.locks = locks
+}
+
+// SetStoreOpener sets how repositories are opened, for example over an
+// in-memory KV in tests (nil opens each repository's store under repoBase)
+func (s *Service) SetStoreOpener(opener StoreOpener) {
+	s.opener = opener
+}
+
+// openStore opens repoID's RepoStore
+func (s *Service) openStore(repoID string) (*storage.RepoStore, error) {
+	if s.opener != nil {
+		return s.opener(repoID)
+	}
+	return storage.NewRepoStore(s.repoBase, repoID)
+}
+
+// SetPublisher sets where commit and push events are sent (nil disables events)
+func (s *Service) SetPublisher(publisher events.Publisher) {
+	s.publisher = publisher
+}
+
+// publish sends an event if a publisher is configured
+func (s *Service) publish(eventType, repoID, branch string, commitID int) {
+	if s.publisher != nil {
+		s.publisher.Publish(events.NewEvent(eventType, repoID, branch, commitID))
+	}
+}
+
+// ListCommits returns commits for a repository branch. The walk stops with
+// ctx's error once ctx is done.
+func (s *Service) ListCommits(ctx context.Context, repoID, branchName string, limit int) ([]Commit, error) {
 	// Open per-repo store
-	repoStore, err := storage.NewRepoStore(s.repoBase, repoID)
+	repoStore, err := s.openStore(repoID)
 	if err != nil {
 		return nil, err
 	}
 	defer repoStore.Close()
 
+	return s.ListCommitsFromStore(ctx, repoStore, branchName, limit)
+}
+
+// ListCommitsFromStore is ListCommits on an open store, such as a RepoStore
+// snapshot
+func (s *Service) ListCommitsFromStore(ctx context.Context, repoStore *storage.RepoStore, branchName string, limit int) ([]Commit, error) {
+	commits := []Commit{}
+	err := s.walkCommitsFromStore(ctx, repoStore, branchName, limit, func(commit Commit) error {
+		commits = append(commits, commit)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return commits, nil
+}
+
+// WalkCommits calls fn for each commit ListCommits would return, in the same
+// order, as it reads them, so a caller can send a long history without
+// holding all of it. An error from fn, or ctx being done, stops the walk and
+// is returned.
+func (s *Service) WalkCommits(ctx context.Context, repoID, branchName string, limit int, fn func(Commit) error) error {
+	repoStore, err := s.openStore(repoID)
+	if err != nil {
+		return err
+	}
+	defer repoStore.Close()
+
+	return s.walkCommitsFromStore(ctx, repoStore, branchName, limit, fn)
+}
+
+// walkCommitsFromStore is WalkCommits on an open store
+func (s *Service) walkCommitsFromStore(ctx context.Context, repoStore *storage.RepoStore, branchName string, limit int, fn func(Commit) error) error {
+	repoID := repoStore.RepoID()
+
 	// Use provided branch name, or default to current branch
 	var targetBranch string
 	if branchName != "" {
@@ -53,7 +155,7 @@ func (s *Service) ListCommits(repoID, branchName string, limit int) ([]Commit, e
 		var err error
 		targetBranch, err = repostorage.ReadHEADBranchFromStore(repoStore)
 		if err != nil {
-			return []Commit{}, nil
+			return nil
 		}
 	}
 
@@ -72,34 +174,38 @@ func (s *Service) ListCommits(repoID, branchName string, limit int) ([]Commit, e
 	tipPtr, err := repostorage.ReadRemoteRefFromStore(repoStore, targetBranch)
 	if err != nil {
 		log.Printf("DEBUG ListCommits: error reading remote ref: %v", err)
-		return []Commit{}, err
+		return err
 	}
 	if tipPtr == nil {
 		// Branch hasn't been pushed yet - no commits to show
 		log.Printf("DEBUG ListCommits: refs/remotes/origin/%s = (empty) - returning empty commits list", targetBranch)
-		return []Commit{}, nil
+		return nil
 	}
 	
 	log.Printf("DEBUG ListCommits: refs/remotes/origin/%s = %d - will walk from this commit", targetBranch, *tipPtr)
 
 	// Walk commit history from remote ref tip
-	var commits []Commit
 	id := *tipPtr
 	count := 0
+	seen := make(map[int]bool)
 
 	for count < limit {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if seen[id] {
+			return fmt.Errorf("%w at commit %d", repostorage.ErrCommitCycle, id)
+		}
+		seen[id] = true
 		c, err := repostorage.ReadCommitObjectFromStore(repoStore, id)
 		if err != nil {
 			break
 		}
 
 		// All commits from remote ref are pushed commits
-		commits = append(commits, Commit{
-			Hash:    fmt.Sprintf("%d", c.ID),
-			Message: c.Message,
-			Author:  "system", // TODO: get from commit
-			Date:    time.Unix(c.Timestamp, 0).Format(time.RFC3339),
-		})
+		if err := fn(toCommit(c)); err != nil {
+			return err
+		}
 		count++
 
 		if c.Parent == nil {
@@ -108,15 +214,353 @@ func (s *Service) ListCommits(repoID, branchName string, limit int) ([]Commit, e
 		id = *c.Parent
 	}
 
+	return nil
+}
+
+// toCommit converts a stored commit to the service representation
+func toCommit(c repostorage.Commit) Commit {
+	commit := Commit{
+		Hash:      fmt.Sprintf("%d", c.ID),
+		Message:   c.Message,
+		Author:    c.Author,
+		Date:      timefmt.FormatUnix(c.Timestamp),
+		Timestamp: c.Timestamp,
+	}
+	// Commits from before committers were recorded were committed by their
+	// author
+	commit.Committer, commit.CommitterDate = commit.Author, commit.Date
+	if c.Committer != "" {
+		commit.Committer = c.Committer
+		commit.CommitterDate = timefmt.FormatUnix(c.CommitterDate)
+	}
+	return commit
+}
+
+// Head is the pushed tip of a branch and the length of its history
+type Head struct {
+	Branch      string
+	TipCommitID *int   // nil if the branch hasn't been pushed
+	TipMessage  string
+	TipDate     string // RFC3339 UTC author date
+	CommitCount int    // commits ListCommits lists without a limit
+}
+
+// Head returns the pushed tip of branchName (the current branch if empty) and
+// its commit count, reading one commit object for the tip rather than
+// converting the whole history as ListCommits does
+func (s *Service) Head(ctx context.Context, repoID, branchName string) (Head, error) {
+	repoStore, err := s.openStore(repoID)
+	if err != nil {
+		return Head{}, err
+	}
+	defer repoStore.Close()
+
+	head := Head{Branch: branchName}
+	if head.Branch == "" {
+		if head.Branch, err = repostorage.ReadHEADBranchFromStore(repoStore); err != nil {
+			return Head{}, fmt.Errorf("failed to read HEAD: %w", err)
+		}
+	}
+
+	tipPtr, err := repostorage.ReadRemoteRefFromStore(repoStore, head.Branch)
+	if err != nil || tipPtr == nil {
+		return head, err
+	}
+	tip, err := repostorage.ReadCommitObjectFromStore(repoStore, *tipPtr)
+	if err != nil {
+		// A dangling remote ref lists no commits either
+		return head, nil
+	}
+	head.TipCommitID = tipPtr
+	head.TipMessage = tip.Message
+	head.TipDate = timefmt.FormatUnix(tip.Timestamp)
+	if head.CommitCount, err = countCommits(ctx, repoStore, tip); err != nil {
+		return Head{}, err
+	}
+	return head, nil
+}
+
+// CountCommits returns how many commits ListCommits would list for branchName
+// without a limit
+func (s *Service) CountCommits(ctx context.Context, repoID, branchName string) (int, error) {
+	head, err := s.Head(ctx, repoID, branchName)
+	return head.CommitCount, err
+}
+
+// countCommits counts tip and its first-parent ancestors, stopping at a
+// missing commit like ListCommits' walk
+func countCommits(ctx context.Context, repoStore *storage.RepoStore, tip repostorage.Commit) (int, error) {
+	seen := map[int]bool{tip.ID: true}
+	for c := tip; c.Parent != nil; {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		if seen[*c.Parent] {
+			return 0, fmt.Errorf("%w at commit %d", repostorage.ErrCommitCycle, *c.Parent)
+		}
+		seen[*c.Parent] = true
+		next, err := repostorage.ReadCommitObjectFromStore(repoStore, *c.Parent)
+		if err != nil {
+			break
+		}
+		c = next
+	}
+	return len(seen), nil
+}
+
+// ListCommitsByTimestamp returns the same commits as ListCommits, sorted by
+// their stored timestamp (newest first) instead of parent-chain order.
+// Commits with equal timestamps keep their topological order.
+func (s *Service) ListCommitsByTimestamp(ctx context.Context, repoID, branchName string, limit int) ([]Commit, error) {
+	commits, err := s.ListCommits(ctx, repoID, branchName, limit)
+	if err != nil {
+		return commits, err
+	}
+	SortByTimestamp(commits)
 	return commits, nil
 }
 
+// FileHistory returns the pushed commits on a branch (newest first) in which
+// the file at filePath was added, modified or removed relative to the commit's
+// first parent. offset skips that many matching commits; at most limit are returned.
+func (s *Service) FileHistory(ctx context.Context, repoID, branchName, filePath string, limit, offset int) ([]Commit, error) {
+	repoStore, err := s.openStore(repoID)
+	if err != nil {
+		return nil, err
+	}
+	defer repoStore.Close()
+
+	targetBranch := branchName
+	if targetBranch == "" {
+		targetBranch, err = repostorage.ReadHEADBranchFromStore(repoStore)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read current branch: %w", err)
+		}
+	}
+
+	// Same history as ListCommits: the pushed state of the branch
+	tipPtr, err := repostorage.ReadRemoteRefFromStore(repoStore, targetBranch)
+	if err != nil {
+		return nil, err
+	}
+
+	filePath = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(filePath)), "/")
+	history := []Commit{}
+	seen := make(map[int]bool)
+	for id := tipPtr; id != nil && len(history) < limit; {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if seen[*id] {
+			return nil, fmt.Errorf("%w at commit %d", repostorage.ErrCommitCycle, *id)
+		}
+		seen[*id] = true
+		c, err := repostorage.ReadCommitObjectFromStore(repoStore, *id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read commit %d: %w", *id, err)
+		}
+
+		tree, err := repostorage.ReadTreeMaybeFromStore(repoStore, c.ID)
+		if err != nil {
+			return nil, err
+		}
+		var parentTree []repostorage.TreeEntry
+		if c.Parent != nil {
+			if parentTree, err = repostorage.ReadTreeMaybeFromStore(repoStore, *c.Parent); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, change := range repostorage.DiffTrees(parentTree, tree) {
+			if change.Path != filePath {
+				continue
+			}
+			if offset > 0 {
+				offset--
+			} else {
+				history = append(history, toCommit(c))
+			}
+			break
+		}
+
+		id = c.Parent
+	}
+
+	return history, nil
+}
+
+// SortByTimestamp sorts commits by Timestamp descending, keeping the original
+// relative order of commits that share a timestamp.
+func SortByTimestamp(commits []Commit) {
+	sort.SliceStable(commits, func(i, j int) bool {
+		return commits[i].Timestamp > commits[j].Timestamp
+	})
+}
+
+// GraphNode is a commit in a commit graph. Branch names the first branch
+// whose history the commit was found in.
+type GraphNode struct {
+	ID      string
+	Message string
+	Date    string
+	Branch  string
+}
+
+// GraphEdge links a parent commit (From) to its child (To); a merge commit has
+// two incoming edges
+type GraphEdge struct {
+	From string
+	To   string
+}
+
+// Graph is the commit DAG of one or more branches
+type Graph struct {
+	Nodes []GraphNode
+	Edges []GraphEdge
+}
+
+// Graph returns the pushed commit DAG of branchName, or of every branch when
+// branchName is empty, following both parents of merge commits. It keeps the
+// limit newest commits (commit IDs are allocated in order) and the edges
+// between them. Branches are walked default branch first, so shared history
+// is labelled with it.
+func (s *Service) Graph(ctx context.Context, repoID, branchName string, limit int) (Graph, error) {
+	repoStore, err := s.openStore(repoID)
+	if err != nil {
+		return Graph{}, err
+	}
+	defer repoStore.Close()
+
+	branchNames := []string{branchName}
+	if branchName == "" {
+		all, err := repostorage.ListBranchesFromStore(repoStore)
+		if err != nil {
+			return Graph{}, fmt.Errorf("failed to list branches: %w", err)
+		}
+		defaultBranch := repostorage.ReadDefaultBranchFromStore(repoStore)
+		branchNames = []string{defaultBranch}
+		for _, b := range all {
+			if b != defaultBranch {
+				branchNames = append(branchNames, b)
+			}
+		}
+	}
+
+	// Walk each pushed tip, labelling commits with the first branch to
+	// reach them
+	commits := map[int]repostorage.Commit{}
+	labels := map[int]string{}
+	for _, branch := range branchNames {
+		tip, err := repostorage.ReadRemoteRefFromStore(repoStore, branch)
+		if err != nil {
+			return Graph{}, err
+		}
+		if tip == nil {
+			continue
+		}
+		queue := []int{*tip}
+		for len(queue) > 0 {
+			if err := ctx.Err(); err != nil {
+				return Graph{}, err
+			}
+			id := queue[0]
+			queue = queue[1:]
+			if _, ok := labels[id]; ok {
+				continue
+			}
+			c, err := repostorage.ReadCommitObjectFromStore(repoStore, id)
+			if err != nil {
+				continue
+			}
+			commits[id] = c
+			labels[id] = branch
+			for _, parent := range []*int{c.Parent, c.Parent2} {
+				if parent != nil {
+					queue = append(queue, *parent)
+				}
+			}
+		}
+	}
+
+	parents := make(map[int][]int, len(commits))
+	ids := make([]int, 0, len(commits))
+	for id, c := range commits {
+		ids = append(ids, id)
+		for _, parent := range []*int{c.Parent, c.Parent2} {
+			if parent != nil {
+				parents[id] = append(parents[id], *parent)
+			}
+		}
+	}
+	if id, ok := repostorage.FindCycle(parents); ok {
+		return Graph{}, fmt.Errorf("%w at commit %d", repostorage.ErrCommitCycle, id)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(ids)))
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	kept := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		kept[id] = true
+	}
+
+	graph := Graph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	for _, id := range ids {
+		c := toCommit(commits[id])
+		graph.Nodes = append(graph.Nodes, GraphNode{ID: c.Hash, Message: c.Message, Date: c.Date, Branch: labels[id]})
+		for _, parent := range []*int{commits[id].Parent, commits[id].Parent2} {
+			if parent != nil && kept[*parent] {
+				graph.Edges = append(graph.Edges, GraphEdge{From: fmt.Sprintf("%d", *parent), To: c.Hash})
+			}
+		}
+	}
+	return graph, nil
+}
+
+// CommitStats describes a newly created commit and the changes it records
+type CommitStats struct {
+	CommitID     int
+	FilesChanged int
+	Insertions   int
+	Deletions    int
+}
+
 // CreateCommit creates a new commit with the given message atomically
-func (s *Service) CreateCommit(repoID, message string) error {
+func (s *Service) CreateCommit(ctx context.Context, repoID, message string) error {
+	_, err := s.CreateCommitWithInfo(ctx, repoID, message)
+	return err
+}
+
+// CommitOptions controls which staged entries a commit records and what it
+// does with the index
+type CommitOptions struct {
+	KeepIndex bool     // leave the committed entries staged; by default they are cleared
+	Paths     []string // commit only the entries at or under these paths; others stay staged
+	Parent    *int     // graft the commit onto this commit instead of the branch tip
+}
+
+// CreateCommitWithInfo creates a commit like CreateCommit and returns its ID
+// along with the files and lines it changed relative to its parent
+func (s *Service) CreateCommitWithInfo(ctx context.Context, repoID, message string) (CommitStats, error) {
+	return s.CreateCommitWithOptions(ctx, repoID, message, CommitOptions{})
+}
+
+// CreateCommitWithOptions creates a commit like CreateCommitWithInfo. With
+// options.Paths the commit's tree is the parent's plus only the staged entries
+// at or under those paths. The committed entries are cleared from the index in
+// the same batch unless options.KeepIndex is set. With options.Parent the
+// commit's parent, and the tree the staged entries are applied to, is that
+// commit rather than the branch tip; the branch still moves to the new commit,
+// leaving its old tip's history behind unless the parent is in it. If ctx is
+// done before the commit is written, nothing is written and ctx's error is
+// returned.
+func (s *Service) CreateCommitWithOptions(ctx context.Context, repoID, message string, options CommitOptions) (CommitStats, error) {
+	defer s.locks.Lock(repoID)()
+
 	// Open per-repo store
-	repoStore, err := storage.NewRepoStore(s.repoBase, repoID)
+	repoStore, err := s.openStore(repoID)
 	if err != nil {
-		return err
+		return CommitStats{}, err
 	}
 	defer repoStore.Close()
 
@@ -134,7 +578,7 @@ func (s *Service) CreateCommit(repoID, message string) error {
 	entries, err := repostorage.GetIndexEntriesFromStore(repoStore)
 	if err != nil {
 		log.Printf("DEBUG CreateCommit: error getting index entries: %v", err)
-		return fmt.Errorf("failed to check staged entries: %w", err)
+		return CommitStats{}, fmt.Errorf("failed to check staged entries: %w", err)
 	}
 	
 	stagedCount := len(entries)
@@ -198,26 +642,38 @@ func (s *Service) CreateCommit(repoID, message string) error {
 	
 	hasStaged := stagedCount > 0
 	if !hasStaged {
-		return fmt.Errorf("Nothing to commit. Stage changes first with 'git add <path>' or 'gitclone add <path>'")
+		return CommitStats{}, fmt.Errorf("%w. Stage changes first with 'git add <path>' or 'gitclone add <path>'", ErrNothingToCommit)
 	}
-
-	// Get current branch
-	currentBranch, err := repostorage.ReadHEADBranchFromStore(repoStore)
-	if err != nil {
-		return fmt.Errorf("failed to read current branch: %w", err)
+	if len(options.Paths) > 0 {
+		entries = repostorage.SelectIndexEntries(entries, options.Paths)
+		if len(entries) == 0 {
+			return CommitStats{}, fmt.Errorf("%w: no staged changes under %s", ErrNothingToCommit, strings.Join(options.Paths, ", "))
+		}
 	}
 
-	// Get current branch tip for parent
-	parentPtr, err := repostorage.ReadHeadRefMaybeFromStore(repoStore, currentBranch)
+	// Get current branch and its tip for parent
+	parentPtr, currentBranch, err := repostorage.ResolveHead(repoStore)
 	if err != nil {
-		return fmt.Errorf("failed to read branch tip: %w", err)
+		return CommitStats{}, fmt.Errorf("failed to read HEAD: %w", err)
+	}
+	if currentBranch == "" {
+		return CommitStats{}, fmt.Errorf("cannot commit: %w", repostorage.ErrDetachedHead)
+	}
+	if options.Parent != nil {
+		if _, err := repostorage.ReadCommitObjectFromStore(repoStore, *options.Parent); errors.Is(err, GitDb.ErrNotFound) {
+			return CommitStats{}, fmt.Errorf("cannot graft onto %d: %w", *options.Parent, repostorage.ErrCommitNotFound)
+		} else if err != nil {
+			return CommitStats{}, fmt.Errorf("failed to read parent commit: %w", err)
+		}
+		parent := *options.Parent
+		parentPtr = &parent
 	}
 
 	// Allocate commit ID (this needs to be done before batch)
 	// For now, we'll read it directly - in a real system this should be atomic too
 	commitID, err := repostorage.NextCommitIDFromStore(repoStore)
 	if err != nil {
-		return fmt.Errorf("failed to allocate commit ID: %w", err)
+		return CommitStats{}, fmt.Errorf("failed to allocate commit ID: %w", err)
 	}
 
 	// Create commit object
@@ -229,59 +685,252 @@ func (s *Service) CreateCommit(repoID, message string) error {
 		Parent:    parentPtr,
 	}
 
+	// Build the commit's tree from the parent's tree plus staged changes
+	// (commit ID doubles as tree ID)
+	var parentTree []repostorage.TreeEntry
+	if parentPtr != nil {
+		parentTree, err = repostorage.ReadTreeMaybeFromStore(repoStore, *parentPtr)
+		if err != nil {
+			return CommitStats{}, fmt.Errorf("failed to read parent tree: %w", err)
+		}
+	}
+	tree := repostorage.ApplyIndexToTree(parentTree, entries)
+
+	diffStat, err := repostorage.DiffStatFromStore(repoStore, repostorage.DiffTrees(parentTree, tree))
+	if err != nil {
+		return CommitStats{}, fmt.Errorf("failed to compute commit stats: %w", err)
+	}
+
 	// Create write batch for atomic operation
 	batch := repoStore.NewWriteBatch()
 
 	// Add all writes to batch:
-	// 1. Commit object
-	if err := repostorage.WriteCommitObjectToBatch(batch, commit); err != nil {
-		return fmt.Errorf("failed to add commit to batch: %w", err)
+	// 1. Commit object and its tree
+	if err := repostorage.WriteCommitObjectToBatch(batch, commit, tree); err != nil {
+		return CommitStats{}, fmt.Errorf("failed to add commit to batch: %w", err)
+	}
+	if err := repostorage.WriteTreeToBatch(batch, commitID, tree); err != nil {
+		return CommitStats{}, fmt.Errorf("failed to add tree to batch: %w", err)
 	}
 
 	// 2. Update branch ref
 	if err := repostorage.WriteHeadRefToBatch(batch, currentBranch, commitID); err != nil {
-		return fmt.Errorf("failed to add ref update to batch: %w", err)
+		return CommitStats{}, fmt.Errorf("failed to add ref update to batch: %w", err)
 	}
 
-	// 3. Clear index
-	if err := repostorage.ClearIndexToBatch(batch, repoStore); err != nil {
-		return fmt.Errorf("failed to add index clear to batch: %w", err)
+	// 3. Clear the committed entries from the index
+	if !options.KeepIndex {
+		committed := make([]string, 0, len(entries))
+		for path := range entries {
+			committed = append(committed, path)
+		}
+		if err := repostorage.ClearIndexEntriesToBatch(batch, committed); err != nil {
+			return CommitStats{}, fmt.Errorf("failed to add index clear to batch: %w", err)
+		}
 	}
 
-	// Commit batch atomically
+	// Commit batch atomically, unless the caller has given up meanwhile
+	if err := ctx.Err(); err != nil {
+		return CommitStats{}, err
+	}
 	if err := batch.Commit(); err != nil {
-		return fmt.Errorf("failed to commit batch: %w", err)
+		return CommitStats{}, fmt.Errorf("failed to commit batch: %w", err)
+	}
+	if !options.KeepIndex {
+		compactIndex(repoStore)
 	}
 
-	return nil
+	s.publish(events.TypeCommit, repoID, currentBranch, commitID)
+
+	return CommitStats{
+		CommitID:     commitID,
+		FilesChanged: diffStat.FilesChanged,
+		Insertions:   diffStat.Insertions,
+		Deletions:    diffStat.Deletions,
+	}, nil
+}
+
+// compactIndex deletes the entries a commit cleared from the index. The
+// commit is already written, so a failure is only logged; the next commit
+// retries it.
+func compactIndex(repoStore *storage.RepoStore) {
+	if _, err := repostorage.CompactIndex(repoStore); err != nil {
+		log.Printf("WARNING: failed to compact index of %s: %v", repoStore.RepoID(), err)
+	}
+}
+
+// AmendCommit replaces the tip of the current branch with a new commit that
+// has the same parents and author, the tip's tree plus any staged changes, and
+// message (or the tip's message if message is empty). The branch moves to the
+// new commit and the old one is left unreferenced. A tip that has been pushed
+// is only amended if force is set, and replacing it on the remote then takes
+// a forced push.
+func (s *Service) AmendCommit(repoID, message string, force bool) (CommitStats, error) {
+	defer s.locks.Lock(repoID)()
+
+	repoStore, err := s.openStore(repoID)
+	if err != nil {
+		return CommitStats{}, err
+	}
+	defer repoStore.Close()
+
+	tipPtr, currentBranch, err := repostorage.ResolveHead(repoStore)
+	if err != nil {
+		return CommitStats{}, fmt.Errorf("failed to read HEAD: %w", err)
+	}
+	if currentBranch == "" {
+		return CommitStats{}, fmt.Errorf("cannot amend: %w", repostorage.ErrDetachedHead)
+	}
+	if tipPtr == nil {
+		return CommitStats{}, fmt.Errorf("nothing to amend: branch %s has no commits", currentBranch)
+	}
+	tip, err := repostorage.ReadCommitObjectFromStore(repoStore, *tipPtr)
+	if err != nil {
+		return CommitStats{}, fmt.Errorf("failed to read commit %d: %w", *tipPtr, err)
+	}
+
+	if !force {
+		remoteTip, err := repostorage.ReadRemoteRefFromStore(repoStore, currentBranch)
+		if err != nil {
+			return CommitStats{}, fmt.Errorf("failed to read remote ref: %w", err)
+		}
+		if remoteTip != nil {
+			pushed, err := repostorage.ReachableCommits(repoStore, *remoteTip)
+			if err != nil {
+				return CommitStats{}, fmt.Errorf("failed to walk remote history: %w", err)
+			}
+			if pushed[tip.ID] {
+				return CommitStats{}, fmt.Errorf("%w: %d is on origin/%s", ErrAlreadyPushed, tip.ID, currentBranch)
+			}
+		}
+	}
+
+	if message == "" {
+		message = tip.Message
+	}
+
+	entries, err := repostorage.GetIndexEntriesFromStore(repoStore)
+	if err != nil {
+		return CommitStats{}, fmt.Errorf("failed to check staged entries: %w", err)
+	}
+	tipTree, err := repostorage.ReadTreeMaybeFromStore(repoStore, tip.ID)
+	if err != nil {
+		return CommitStats{}, fmt.Errorf("failed to read commit tree: %w", err)
+	}
+	tree := repostorage.ApplyIndexToTree(tipTree, entries)
+
+	// Stats describe the replacement against its parent, as for a new commit
+	var parentTree []repostorage.TreeEntry
+	if tip.Parent != nil {
+		parentTree, err = repostorage.ReadTreeMaybeFromStore(repoStore, *tip.Parent)
+		if err != nil {
+			return CommitStats{}, fmt.Errorf("failed to read parent tree: %w", err)
+		}
+	}
+	diffStat, err := repostorage.DiffStatFromStore(repoStore, repostorage.DiffTrees(parentTree, tree))
+	if err != nil {
+		return CommitStats{}, fmt.Errorf("failed to compute commit stats: %w", err)
+	}
+
+	commitID, err := repostorage.NextCommitIDFromStore(repoStore)
+	if err != nil {
+		return CommitStats{}, fmt.Errorf("failed to allocate commit ID: %w", err)
+	}
+	// The amended commit keeps the tip's author and author date; the amend
+	// itself is recorded as the committer
+	commit := repostorage.Commit{
+		ID:            commitID,
+		Message:       message,
+		Author:        tip.Author,
+		Committer:     repostorage.DefaultAuthor,
+		CommitterDate: time.Now().Unix(),
+		Branch:        currentBranch,
+		Timestamp:     tip.Timestamp,
+		Parent:        tip.Parent,
+		Parent2:       tip.Parent2,
+	}
+
+	batch := repoStore.NewWriteBatch()
+	if err := repostorage.WriteCommitObjectToBatch(batch, commit, tree); err != nil {
+		return CommitStats{}, fmt.Errorf("failed to add commit to batch: %w", err)
+	}
+	if err := repostorage.WriteTreeToBatch(batch, commitID, tree); err != nil {
+		return CommitStats{}, fmt.Errorf("failed to add tree to batch: %w", err)
+	}
+	if err := repostorage.WriteHeadRefToBatch(batch, currentBranch, commitID); err != nil {
+		return CommitStats{}, fmt.Errorf("failed to add ref update to batch: %w", err)
+	}
+	if len(entries) > 0 {
+		if err := repostorage.ClearIndexToBatch(batch, repoStore); err != nil {
+			return CommitStats{}, fmt.Errorf("failed to add index clear to batch: %w", err)
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		return CommitStats{}, fmt.Errorf("failed to commit batch: %w", err)
+	}
+	if len(entries) > 0 {
+		compactIndex(repoStore)
+	}
+
+	s.publish(events.TypeCommit, repoID, currentBranch, commitID)
+
+	return CommitStats{
+		CommitID:     commitID,
+		FilesChanged: diffStat.FilesChanged,
+		Insertions:   diffStat.Insertions,
+		Deletions:    diffStat.Deletions,
+	}, nil
 }
 
 // PushCommits pushes commits to remote
-// Returns the number of commits pushed, or 0 if already up to date
-func (s *Service) PushCommits(repoID, branch string) (int, error) {
+// Returns the number of commits pushed, or 0 if already up to date.
+// A push must fast-forward origin/<branch>: unless force is set, it fails
+// with ErrNonFastForward if the remote has commits the branch doesn't. A
+// forced push of a protected branch fails with ErrProtectedBranch.
+func (s *Service) PushCommits(ctx context.Context, repoID, branch string, force bool) (int, error) {
+	pushed, err := s.PushCommitsWithInfo(ctx, repoID, branch, PushOptions{Force: force})
+	return len(pushed), err
+}
+
+// PushOptions controls a push that doesn't fast-forward the remote branch
+type PushOptions struct {
+	Force    bool // overwrite a remote branch the local one has diverged from
+	Override bool // allow Force on a protected branch
+}
+
+// PushCommitsWithInfo pushes like PushCommits and returns the IDs of the
+// commits pushed, newest first (empty if already up to date). Every update of
+// origin/<branch> is recorded in its reflog, including the tip a forced push
+// overwrites. If ctx is done before the remote ref is written, nothing is
+// pushed and ctx's error is returned.
+func (s *Service) PushCommitsWithInfo(ctx context.Context, repoID, branch string, options PushOptions) ([]int, error) {
+	defer s.locks.Lock(repoID)()
+
 	// Open per-repo store
-	repoStore, err := storage.NewRepoStore(s.repoBase, repoID)
+	repoStore, err := s.openStore(repoID)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	defer repoStore.Close()
 
-	// Determine branch
+	// Get the branch tip (refs/heads/<branch>), defaulting to HEAD's branch
+	var headTipPtr *int
 	if branch == "" {
-		currentBranch, err := repostorage.ReadHEADBranchFromStore(repoStore)
+		headTipPtr, branch, err = repostorage.ResolveHead(repoStore)
+		if err == nil && branch == "" {
+			err = repostorage.ErrDetachedHead
+		}
 		if err != nil {
-			branch = "main"
-		} else {
-			branch = currentBranch
+			return nil, fmt.Errorf("no branch to push: %w", err)
 		}
+	} else {
+		headTipPtr, err = repostorage.ReadHeadRefMaybeFromStore(repoStore, branch)
 	}
 
 	log.Printf("DEBUG PushCommits: repoID=%s, branch=%s", repoID, branch)
 
-	// Get current branch tip (refs/heads/<branch>)
-	headTipPtr, err := repostorage.ReadHeadRefMaybeFromStore(repoStore, branch)
 	if err != nil || headTipPtr == nil {
-		return 0, fmt.Errorf("no commits to push")
+		return nil, ErrNothingToPush
 	}
 	headTip := *headTipPtr
 	log.Printf("DEBUG PushCommits: refs/heads/%s = %d", branch, headTip)
@@ -289,7 +938,7 @@ func (s *Service) PushCommits(repoID, branch string) (int, error) {
 	// Get current remote ref (refs/remotes/origin/<branch>)
 	remoteTipPtr, err := repostorage.ReadRemoteRefFromStore(repoStore, branch)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get remote ref: %w", err)
+		return nil, fmt.Errorf("failed to get remote ref: %w", err)
 	}
 	if remoteTipPtr != nil {
 		log.Printf("DEBUG PushCommits: refs/remotes/origin/%s = %d", branch, *remoteTipPtr)
@@ -303,57 +952,180 @@ func (s *Service) PushCommits(repoID, branch string) (int, error) {
 	// Check if already up to date
 	if remoteTipPtr != nil && *remoteTipPtr == headTip {
 		log.Printf("DEBUG PushCommits: already up to date, no push needed")
-		return 0, nil // Already up to date
+		return nil, nil // Already up to date
 	}
 
-	// Count commits to push (walk from head tip to remote tip or root)
-	var commitsToPush []int
-	currentID := headTip
+	// The commits to push are those reachable from the head tip, through
+	// either parent of a merge, that the remote doesn't have yet
+	local, err := repostorage.ReachableCommits(repoStore, headTip)
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk history: %w", err)
+	}
+	// The remote tip must be the head tip or one of its ancestors unless
+	// the push is forced
+	forced := remoteTipPtr != nil && !local[*remoteTipPtr]
+	if forced && !options.Force {
+		return nil, fmt.Errorf("%w: origin/%s has commits that %s doesn't", ErrNonFastForward, branch, branch)
+	}
+	if forced && !options.Override {
+		if err := checkUnprotected(repoStore, branch); err != nil {
+			return nil, err
+		}
+	}
 
-	for {
-		// Stop if we've reached the remote tip (if it exists)
-		if remoteTipPtr != nil && currentID == *remoteTipPtr {
-			break
+	remote := map[int]bool{}
+	if remoteTipPtr != nil {
+		if remote, err = repostorage.ReachableCommits(repoStore, *remoteTipPtr); err != nil {
+			return nil, fmt.Errorf("failed to walk remote history: %w", err)
+		}
+	}
+	var commitsToPush []int
+	for id := range local {
+		if !remote[id] {
+			commitsToPush = append(commitsToPush, id)
 		}
+	}
+	// Commit IDs are allocated in order, so this is newest first
+	sort.Sort(sort.Reverse(sort.IntSlice(commitsToPush)))
 
-		commitsToPush = append(commitsToPush, currentID)
+	// A forced push may only move the remote back, pushing nothing
+	if len(commitsToPush) == 0 && !forced {
+		return nil, nil // Already up to date
+	}
 
-		c, err := repostorage.ReadCommitObjectFromStore(repoStore, currentID)
-		if err != nil {
-			break
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Push: set remote ref to head ref and log the update (atomic write)
+	batch := repoStore.NewWriteBatch()
+	if err := repostorage.WriteRemoteRefToBatch(batch, branch, headTip); err != nil {
+		return nil, fmt.Errorf("failed to add remote ref to batch: %w", err)
+	}
+	entry := repostorage.ReflogEntry{Old: remoteTipPtr, New: headTip, Timestamp: time.Now().Unix(), Message: "push"}
+	if forced {
+		entry.Message = "push: forced update"
+	}
+	if err := repostorage.AppendReflogToBatch(batch, repostorage.RemoteRefName(branch), entry); err != nil {
+		return nil, fmt.Errorf("failed to add reflog entry to batch: %w", err)
+	}
+	if err := batch.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit push: %w", err)
+	}
+	log.Printf("DEBUG PushCommits: pushed %d commits, updated refs/remotes/origin/%s to %d", len(commitsToPush), branch, headTip)
+
+	s.publish(events.TypePush, repoID, branch, headTip)
+	s.updatePushedCount(repoID, branch)
+
+	return commitsToPush, nil
+}
+
+// RollbackPush undoes the latest push of branch (HEAD's branch if empty) that
+// hasn't been rolled back yet, resetting origin/<branch> to the tip that push
+// replaced, and returns that tip. Each rollback is itself recorded in the
+// reflog, so calling it again undoes the push before. It fails with
+// ErrNoPushToRollback when that push created the remote branch, or there was
+// no push, and with ErrProtectedBranch on a protected branch unless override
+// is set.
+func (s *Service) RollbackPush(repoID, branch string, override bool) (int, error) {
+	defer s.locks.Lock(repoID)()
+
+	repoStore, err := s.openStore(repoID)
+	if err != nil {
+		return 0, err
+	}
+	defer repoStore.Close()
+
+	if branch == "" {
+		if branch, err = repostorage.ReadHEADBranchFromStore(repoStore); err != nil {
+			return 0, fmt.Errorf("no branch to roll back: %w", err)
 		}
+	}
 
-		if c.Parent == nil {
-			break
+	if !override {
+		if err := checkUnprotected(repoStore, branch); err != nil {
+			return 0, err
+		}
+	}
+
+	ref := repostorage.RemoteRefName(branch)
+	reflog, err := repostorage.ReadReflogFromStore(repoStore, ref)
+	if err != nil {
+		return 0, err
+	}
+
+	// Walk back from the newest entry; each rollback cancels the push before it
+	var target *repostorage.ReflogEntry
+	undone := 0
+	for i := len(reflog) - 1; i >= 0 && target == nil; i-- {
+		switch {
+		case reflog[i].Message == rollbackReflogMessage:
+			undone++
+		case undone > 0:
+			undone--
+		default:
+			target = &reflog[i]
 		}
-		currentID = *c.Parent
 	}
+	if target == nil || target.Old == nil {
+		return 0, fmt.Errorf("%w: origin/%s", ErrNoPushToRollback, branch)
+	}
+	previous := *target.Old
 
-	if len(commitsToPush) == 0 {
-		return 0, nil // Already up to date
+	current, err := repostorage.ReadRemoteRefFromStore(repoStore, branch)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get remote ref: %w", err)
 	}
 
-	// Push: set remote ref to head ref (atomic write)
 	batch := repoStore.NewWriteBatch()
-	if err := repostorage.WriteRemoteRefToBatch(batch, branch, headTip); err != nil {
+	if err := repostorage.WriteRemoteRefToBatch(batch, branch, previous); err != nil {
 		return 0, fmt.Errorf("failed to add remote ref to batch: %w", err)
 	}
+	entry := repostorage.ReflogEntry{Old: current, New: previous, Timestamp: time.Now().Unix(), Message: rollbackReflogMessage}
+	if err := repostorage.AppendReflogToBatch(batch, ref, entry); err != nil {
+		return 0, fmt.Errorf("failed to add reflog entry to batch: %w", err)
+	}
 	if err := batch.Commit(); err != nil {
-		return 0, fmt.Errorf("failed to commit push: %w", err)
+		return 0, fmt.Errorf("failed to commit rollback: %w", err)
 	}
-	log.Printf("DEBUG PushCommits: pushed %d commits, updated refs/remotes/origin/%s to %d", len(commitsToPush), branch, headTip)
 
-	// Update metadata commit count (using global store for repo registry)
+	s.publish(events.TypePush, repoID, branch, previous)
+	s.updatePushedCount(repoID, branch)
+
+	return previous, nil
+}
+
+// checkUnprotected returns ErrProtectedBranch if branch is protected
+func checkUnprotected(repoStore *storage.RepoStore, branch string) error {
+	protected, err := repostorage.IsBranchProtectedFromStore(repoStore, branch)
+	if err != nil {
+		return err
+	}
+	if protected {
+		return fmt.Errorf("%w: %s", repostorage.ErrProtectedBranch, branch)
+	}
+	return nil
+}
+
+// rollbackReflogMessage marks the reflog entries written by RollbackPush
+const rollbackReflogMessage = "push: rollback"
+
+// updatePushedCount refreshes the repo's commit count in the metadata store
+// after origin/<branch> moved. Failures are ignored; the count is advisory.
+// The ref has already moved, so the count is refreshed even if the request
+// that moved it has been cancelled. The CLI's service has no metadata store.
+func (s *Service) updatePushedCount(repoID, branch string) {
+	if s.metaStore == nil {
+		return
+	}
 	meta, err := s.metaStore.GetRepo(repoID)
 	if err == nil {
-		commits, _ := s.ListCommits(repoID, branch, 100)
+		commits, _ := s.ListCommits(context.Background(), repoID, branch, 100)
 		meta.CommitCount = len(commits)
-		meta.UpdatedAt = time.Now()
+		meta.UpdatedAt = timefmt.Now()
 		if err := s.metaStore.UpdateRepo(*meta); err != nil {
 			// Log but don't fail the operation
 		}
 	}
-
-	return len(commitsToPush), nil
 }
 
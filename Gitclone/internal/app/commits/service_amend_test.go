@@ -0,0 +1,214 @@
+package commits
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"GitDb"
+	"gitclone/internal/infra/storage"
+	"gitclone/internal/metadata"
+	repostorage "gitclone/internal/storage"
+)
+
+// TestAmendCommit amends the tip's message, then amends it again to include a
+// newly staged file, and checks amending a pushed commit needs force
+func TestAmendCommit(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-amend-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repoBase := filepath.Join(tmpDir, "repos")
+	repoID := "test-repo"
+	repoPath := filepath.Join(repoBase, repoID)
+	if err := os.MkdirAll(repoPath, 0755); err != nil {
+		t.Fatalf("Failed to create repo dir: %v", err)
+	}
+	if err := repostorage.InitRepo(repoPath, repostorage.InitOptions{Bare: false}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	metaStore, err := metadata.NewStore(filepath.Join(tmpDir, "db"))
+	if err != nil {
+		t.Fatalf("Failed to create metadata store: %v", err)
+	}
+	defer metaStore.Close()
+
+	commitSvc := NewService(repoBase, metaStore)
+
+	stage := func(name, content string) {
+		t.Helper()
+		repoStore, err := storage.NewRepoStore(repoBase, repoID)
+		if err != nil {
+			t.Fatalf("Failed to open RepoStore: %v", err)
+		}
+		defer repoStore.Close()
+		if err := os.WriteFile(filepath.Join(repoPath, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		if _, err := repostorage.AddToIndexFromStore(context.Background(), repoStore, name); err != nil {
+			t.Fatalf("Failed to stage %s: %v", name, err)
+		}
+	}
+	readTip := func() (repostorage.Commit, []repostorage.TreeEntry) {
+		t.Helper()
+		repoStore, err := storage.NewRepoStore(repoBase, repoID)
+		if err != nil {
+			t.Fatalf("Failed to open RepoStore: %v", err)
+		}
+		defer repoStore.Close()
+		tip, err := repostorage.ReadHeadRefMaybeFromStore(repoStore, "master")
+		if err != nil || tip == nil {
+			t.Fatalf("Failed to read master tip: %v", err)
+		}
+		commit, err := repostorage.ReadCommitObjectFromStore(repoStore, *tip)
+		if err != nil {
+			t.Fatalf("Failed to read tip commit: %v", err)
+		}
+		tree, err := repostorage.ReadTreeMaybeFromStore(repoStore, *tip)
+		if err != nil {
+			t.Fatalf("Failed to read tip tree: %v", err)
+		}
+		return commit, tree
+	}
+
+	if _, err := commitSvc.AmendCommit(repoID, "nothing yet", false); err == nil {
+		t.Errorf("Expected amending an empty branch to fail")
+	}
+
+	stage("a.txt", "a\n")
+	first, err := commitSvc.CreateCommitWithInfo(context.Background(), repoID, "Initial commit")
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	stage("b.txt", "b\n")
+	if _, err := commitSvc.CreateCommitWithInfo(context.Background(), repoID, "Add b, tpyo"); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	// Message only
+	if _, err := commitSvc.AmendCommit(repoID, "Add b", false); err != nil {
+		t.Fatalf("Failed to amend message: %v", err)
+	}
+	tip, tree := readTip()
+	if tip.Message != "Add b" || tip.Parent == nil || *tip.Parent != first.CommitID {
+		t.Errorf("Expected message %q on top of %d, got %+v", "Add b", first.CommitID, tip)
+	}
+	if len(tree) != 2 {
+		t.Errorf("Expected the amended tree to keep a.txt and b.txt, got %+v", tree)
+	}
+
+	// A forgotten file, keeping the message
+	stage("c.txt", "c\n")
+	stats, err := commitSvc.AmendCommit(repoID, "", false)
+	if err != nil {
+		t.Fatalf("Failed to amend with a staged file: %v", err)
+	}
+	if stats.FilesChanged != 2 || stats.Insertions != 2 {
+		t.Errorf("Expected the amended commit to add b.txt and c.txt, got %+v", stats)
+	}
+	tip, tree = readTip()
+	if tip.Message != "Add b" || *tip.Parent != first.CommitID || len(tree) != 3 {
+		t.Errorf("Expected c.txt added to %q on top of %d, got %+v with tree %+v", "Add b", first.CommitID, tip, tree)
+	}
+	repoStore, err := storage.NewRepoStore(repoBase, repoID)
+	if err != nil {
+		t.Fatalf("Failed to open RepoStore: %v", err)
+	}
+	staged, _ := repostorage.GetStagedFilesFromStore(repoStore)
+	repoStore.Close()
+	if len(staged) != 0 {
+		t.Errorf("Expected the index to be cleared after amending, got %v", staged)
+	}
+
+	// Pushed commits need force
+	if _, err := commitSvc.PushCommits(context.Background(), repoID, "master", false); err != nil {
+		t.Fatalf("Failed to push: %v", err)
+	}
+	if _, err := commitSvc.AmendCommit(repoID, "Rewrite history", false); !errors.Is(err, ErrAlreadyPushed) {
+		t.Fatalf("Expected ErrAlreadyPushed, got %v", err)
+	}
+	if _, err := commitSvc.AmendCommit(repoID, "Rewrite history", true); err != nil {
+		t.Fatalf("Failed to force amend: %v", err)
+	}
+	if tip, _ := readTip(); tip.Message != "Rewrite history" {
+		t.Errorf("Expected the forced amend to move master, got %+v", tip)
+	}
+}
+
+// TestAmendKeepsAuthor checks that a new commit is committed by its author,
+// and that amending keeps the author and author date but records a new
+// committer and committer date
+func TestAmendKeepsAuthor(t *testing.T) {
+	repoID := "author-repo"
+	kv := GitDb.NewMemDB()
+	open := func(id string) (*storage.RepoStore, error) {
+		return storage.NewRepoStoreWithKV(id, "/nonexistent/"+id, kv)
+	}
+	repoStore, err := open(repoID)
+	if err != nil {
+		t.Fatalf("Failed to open in-memory store: %v", err)
+	}
+	if err := repostorage.InitRepoStore(repoStore, repostorage.InitOptions{}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+	commitSvc := NewService("", metadata.NewStoreWithKV(GitDb.NewMemDB()))
+	commitSvc.SetStoreOpener(open)
+
+	if err := repostorage.StageContentFromStore(repoStore, "a.txt", []byte("a\n")); err != nil {
+		t.Fatalf("Failed to stage: %v", err)
+	}
+	stats, err := commitSvc.CreateCommitWithInfo(context.Background(), repoID, "Add a")
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	original, err := repostorage.ReadCommitObjectFromStore(repoStore, stats.CommitID)
+	if err != nil {
+		t.Fatalf("Failed to read commit: %v", err)
+	}
+	if original.Committer != original.Author || original.CommitterDate != original.Timestamp {
+		t.Errorf("Expected a new commit to be committed by its author, got %+v", original)
+	}
+
+	// Make the commit look like someone else's, written a while ago
+	original.Author, original.Timestamp, original.Committer = "alice", 1000, ""
+	tree, err := repostorage.ReadTreeFromStore(repoStore, original.ID)
+	if err != nil {
+		t.Fatalf("Failed to read tree: %v", err)
+	}
+	batch := repoStore.NewWriteBatch()
+	if err := repostorage.WriteCommitObjectToBatch(batch, original, tree); err != nil {
+		t.Fatalf("Failed to rewrite commit: %v", err)
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("Failed to rewrite commit: %v", err)
+	}
+
+	before := time.Now().Unix()
+	amended, err := commitSvc.AmendCommit(repoID, "Add a, reworded", false)
+	if err != nil {
+		t.Fatalf("Failed to amend: %v", err)
+	}
+	commit, err := repostorage.ReadCommitObjectFromStore(repoStore, amended.CommitID)
+	if err != nil {
+		t.Fatalf("Failed to read amended commit: %v", err)
+	}
+	if commit.Author != "alice" || commit.Timestamp != 1000 {
+		t.Errorf("Expected the amend to keep author alice at 1000, got %q at %d", commit.Author, commit.Timestamp)
+	}
+	if commit.Committer != repostorage.DefaultAuthor || commit.CommitterDate < before {
+		t.Errorf("Expected a new committer and committer date, got %q at %d", commit.Committer, commit.CommitterDate)
+	}
+	amendedTree, err := repostorage.ReadTreeFromStore(repoStore, amended.CommitID)
+	if err != nil {
+		t.Fatalf("Failed to read amended tree: %v", err)
+	}
+	if err := repostorage.VerifyCommit(commit, amendedTree); err != nil {
+		t.Errorf("Expected the amended commit to verify: %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package commits
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"GitDb"
+	"gitclone/internal/infra/storage"
+	"gitclone/internal/metadata"
+	repostorage "gitclone/internal/storage"
+)
+
+// TestCancelledContext cancels a context partway through walking a long
+// pushed history and checks the walk stops at once with the context's error,
+// and that a commit or push started with a done context writes nothing
+func TestCancelledContext(t *testing.T) {
+	repoID := "cancel-repo"
+	kv := GitDb.NewMemDB()
+	open := func(id string) (*storage.RepoStore, error) {
+		return storage.NewRepoStoreWithKV(id, "/nonexistent/"+id, kv)
+	}
+
+	repoStore, err := open(repoID)
+	if err != nil {
+		t.Fatalf("Failed to open in-memory store: %v", err)
+	}
+	if err := repostorage.InitRepoStore(repoStore, repostorage.InitOptions{}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	commitSvc := NewService("", metadata.NewStoreWithKV(GitDb.NewMemDB()))
+	commitSvc.SetStoreOpener(open)
+
+	const history = 50
+	for i := 0; i < history; i++ {
+		if err := repostorage.StageContentFromStore(repoStore, "log.txt", []byte(fmt.Sprintf("%d\n", i))); err != nil {
+			t.Fatalf("Failed to stage: %v", err)
+		}
+		if err := commitSvc.CreateCommit(context.Background(), repoID, fmt.Sprintf("Commit %d", i)); err != nil {
+			t.Fatalf("Failed to commit %d: %v", i, err)
+		}
+	}
+	if _, err := commitSvc.PushCommits(context.Background(), repoID, "master", false); err != nil {
+		t.Fatalf("Failed to push: %v", err)
+	}
+
+	// Cancel after the tenth commit: the walk must not read an eleventh
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	walked := 0
+	start := time.Now()
+	err = commitSvc.WalkCommits(ctx, repoID, "master", history, func(Commit) error {
+		walked++
+		if walked == 10 {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the walk to fail with context.Canceled, got %v", err)
+	}
+	if walked != 10 {
+		t.Errorf("Expected the walk to stop after 10 commits, it read %d", walked)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Cancelled walk took %s", elapsed)
+	}
+
+	// The other walks stop on a done context too
+	if _, err := commitSvc.ListCommits(ctx, repoID, "master", history); !errors.Is(err, context.Canceled) {
+		t.Errorf("ListCommits: expected context.Canceled, got %v", err)
+	}
+	if _, err := commitSvc.Head(ctx, repoID, "master"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Head: expected context.Canceled, got %v", err)
+	}
+	if _, err := commitSvc.Graph(ctx, repoID, "master", history); !errors.Is(err, context.Canceled) {
+		t.Errorf("Graph: expected context.Canceled, got %v", err)
+	}
+	if _, err := commitSvc.FileHistory(ctx, repoID, "master", "log.txt", history, 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("FileHistory: expected context.Canceled, got %v", err)
+	}
+
+	// A cancelled commit leaves the branch and the index as they were
+	tipBefore, err := repostorage.ReadHeadRefMaybeFromStore(repoStore, "master")
+	if err != nil || tipBefore == nil {
+		t.Fatalf("Failed to read branch tip: %v", err)
+	}
+	if err := repostorage.StageContentFromStore(repoStore, "log.txt", []byte("unpushed\n")); err != nil {
+		t.Fatalf("Failed to stage: %v", err)
+	}
+	if _, err := commitSvc.CreateCommitWithInfo(ctx, repoID, "Cancelled"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("CreateCommit: expected context.Canceled, got %v", err)
+	}
+	if tip, err := repostorage.ReadHeadRefMaybeFromStore(repoStore, "master"); err != nil || tip == nil || *tip != *tipBefore {
+		t.Errorf("Expected the branch to stay at %d after a cancelled commit, got %v (err %v)", *tipBefore, tip, err)
+	}
+	if entries, err := repostorage.GetIndexEntriesFromStore(repoStore); err != nil || len(entries) != 1 {
+		t.Errorf("Expected the change to stay staged after a cancelled commit, got %v (err %v)", entries, err)
+	}
+
+	// A cancelled push leaves the remote branch where it was
+	if err := commitSvc.CreateCommit(context.Background(), repoID, "Unpushed"); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if _, err := commitSvc.PushCommits(ctx, repoID, "master", false); !errors.Is(err, context.Canceled) {
+		t.Fatalf("PushCommits: expected context.Canceled, got %v", err)
+	}
+	if remote, err := repostorage.ReadRemoteRefFromStore(repoStore, "master"); err != nil || remote == nil || *remote != *tipBefore {
+		t.Errorf("Expected origin/master to stay at %d after a cancelled push, got %v (err %v)", *tipBefore, remote, err)
+	}
+}
@@ -0,0 +1,208 @@
+package commits
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"GitDb"
+	"gitclone/internal/infra/storage"
+	"gitclone/internal/metadata"
+	repostorage "gitclone/internal/storage"
+)
+
+// TestCommitKeepIndex checks that a commit clears the index by default and
+// leaves the committed entries staged with KeepIndex
+func TestCommitKeepIndex(t *testing.T) {
+	repoID := "keep-index-repo"
+	kv := GitDb.NewMemDB()
+	open := func(id string) (*storage.RepoStore, error) {
+		return storage.NewRepoStoreWithKV(id, "/nonexistent/"+id, kv)
+	}
+
+	repoStore, err := open(repoID)
+	if err != nil {
+		t.Fatalf("Failed to open in-memory store: %v", err)
+	}
+	if err := repostorage.InitRepoStore(repoStore, repostorage.InitOptions{}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	metaStore := metadata.NewStoreWithKV(GitDb.NewMemDB())
+	if err := metaStore.CreateRepo(metadata.RepoMeta{ID: repoID, Name: repoID, CurrentBranch: "master"}); err != nil {
+		t.Fatalf("Failed to create metadata: %v", err)
+	}
+	commitSvc := NewService("", metaStore)
+	commitSvc.SetStoreOpener(open)
+
+	staged := func() []string {
+		t.Helper()
+		files, err := repostorage.GetStagedFilesFromStore(repoStore)
+		if err != nil {
+			t.Fatalf("Failed to read index: %v", err)
+		}
+		return files
+	}
+
+	if err := repostorage.StageContentFromStore(repoStore, "a.txt", []byte("one")); err != nil {
+		t.Fatalf("Failed to stage: %v", err)
+	}
+	if _, err := commitSvc.CreateCommitWithInfo(context.Background(), repoID, "Add a"); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if files := staged(); len(files) != 0 {
+		t.Errorf("Expected the index cleared by default, got %v", files)
+	}
+
+	if err := repostorage.StageContentFromStore(repoStore, "b.txt", []byte("two")); err != nil {
+		t.Fatalf("Failed to stage: %v", err)
+	}
+	stats, err := commitSvc.CreateCommitWithOptions(context.Background(), repoID, "Add b", CommitOptions{KeepIndex: true})
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if stats.FilesChanged != 1 {
+		t.Errorf("Expected the commit to change 1 file, got %+v", stats)
+	}
+	if files := staged(); len(files) != 1 || files[0] != "b.txt" {
+		t.Errorf("Expected b.txt to stay staged, got %v", files)
+	}
+	tree, err := repostorage.ReadTreeMaybeFromStore(repoStore, stats.CommitID)
+	if err != nil {
+		t.Fatalf("Failed to read tree: %v", err)
+	}
+	if len(tree) != 2 {
+		t.Errorf("Expected the commit to record a.txt and b.txt, got %+v", tree)
+	}
+}
+
+// TestCommitPaths stages two files and commits only one: the other stays
+// staged and out of the commit
+func TestCommitPaths(t *testing.T) {
+	repoID := "commit-paths-repo"
+	kv := GitDb.NewMemDB()
+	open := func(id string) (*storage.RepoStore, error) {
+		return storage.NewRepoStoreWithKV(id, "/nonexistent/"+id, kv)
+	}
+
+	repoStore, err := open(repoID)
+	if err != nil {
+		t.Fatalf("Failed to open in-memory store: %v", err)
+	}
+	if err := repostorage.InitRepoStore(repoStore, repostorage.InitOptions{}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	metaStore := metadata.NewStoreWithKV(GitDb.NewMemDB())
+	if err := metaStore.CreateRepo(metadata.RepoMeta{ID: repoID, Name: repoID, CurrentBranch: "master"}); err != nil {
+		t.Fatalf("Failed to create metadata: %v", err)
+	}
+	commitSvc := NewService("", metaStore)
+	commitSvc.SetStoreOpener(open)
+
+	for path, content := range map[string]string{"docs/a.txt": "one\n", "b.txt": "two\n"} {
+		if err := repostorage.StageContentFromStore(repoStore, path, []byte(content)); err != nil {
+			t.Fatalf("Failed to stage %s: %v", path, err)
+		}
+	}
+
+	if _, err := commitSvc.CreateCommitWithOptions(context.Background(), repoID, "Nothing", CommitOptions{Paths: []string{"c.txt"}}); !errors.Is(err, ErrNothingToCommit) {
+		t.Fatalf("Expected ErrNothingToCommit for a path with nothing staged, got %v", err)
+	}
+
+	stats, err := commitSvc.CreateCommitWithOptions(context.Background(), repoID, "Add docs", CommitOptions{Paths: []string{"docs"}})
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if stats.FilesChanged != 1 || stats.Insertions != 1 {
+		t.Errorf("Expected the commit to add docs/a.txt only, got %+v", stats)
+	}
+	tree, err := repostorage.ReadTreeMaybeFromStore(repoStore, stats.CommitID)
+	if err != nil {
+		t.Fatalf("Failed to read tree: %v", err)
+	}
+	if len(tree) != 1 || tree[0].Path != "docs/a.txt" {
+		t.Errorf("Expected the commit to record only docs/a.txt, got %+v", tree)
+	}
+	staged, err := repostorage.GetStagedFilesFromStore(repoStore)
+	if err != nil {
+		t.Fatalf("Failed to read index: %v", err)
+	}
+	if len(staged) != 1 || staged[0] != "b.txt" {
+		t.Errorf("Expected b.txt to stay staged, got %v", staged)
+	}
+}
+
+// TestCommitParent grafts a commit onto the first of two commits: its parent
+// and tree come from that commit and the branch moves to it
+func TestCommitParent(t *testing.T) {
+	repoID := "graft-repo"
+	kv := GitDb.NewMemDB()
+	open := func(id string) (*storage.RepoStore, error) {
+		return storage.NewRepoStoreWithKV(id, "/nonexistent/"+id, kv)
+	}
+
+	repoStore, err := open(repoID)
+	if err != nil {
+		t.Fatalf("Failed to open in-memory store: %v", err)
+	}
+	if err := repostorage.InitRepoStore(repoStore, repostorage.InitOptions{}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	metaStore := metadata.NewStoreWithKV(GitDb.NewMemDB())
+	if err := metaStore.CreateRepo(metadata.RepoMeta{ID: repoID, Name: repoID, CurrentBranch: "master"}); err != nil {
+		t.Fatalf("Failed to create metadata: %v", err)
+	}
+	commitSvc := NewService("", metaStore)
+	commitSvc.SetStoreOpener(open)
+
+	var ids []int
+	for _, path := range []string{"a.txt", "b.txt"} {
+		if err := repostorage.StageContentFromStore(repoStore, path, []byte(path)); err != nil {
+			t.Fatalf("Failed to stage: %v", err)
+		}
+		stats, err := commitSvc.CreateCommitWithInfo(context.Background(), repoID, "Add "+path)
+		if err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+		ids = append(ids, stats.CommitID)
+	}
+
+	if err := repostorage.StageContentFromStore(repoStore, "c.txt", []byte("c.txt")); err != nil {
+		t.Fatalf("Failed to stage: %v", err)
+	}
+	missing := 999
+	if _, err := commitSvc.CreateCommitWithOptions(context.Background(), repoID, "Add c", CommitOptions{Parent: &missing}); !errors.Is(err, repostorage.ErrCommitNotFound) {
+		t.Fatalf("Expected ErrCommitNotFound for an unknown parent, got %v", err)
+	}
+
+	stats, err := commitSvc.CreateCommitWithOptions(context.Background(), repoID, "Add c", CommitOptions{Parent: &ids[0]})
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	commit, err := repostorage.ReadCommitObjectFromStore(repoStore, stats.CommitID)
+	if err != nil {
+		t.Fatalf("Failed to read commit: %v", err)
+	}
+	if commit.Parent == nil || *commit.Parent != ids[0] {
+		t.Errorf("Expected the commit's parent to be %d, got %v", ids[0], commit.Parent)
+	}
+	if tip, _, err := repostorage.ResolveHead(repoStore); err != nil || tip == nil || *tip != stats.CommitID {
+		t.Errorf("Expected master to move to %d, got %v, %v", stats.CommitID, tip, err)
+	}
+	tree, err := repostorage.ReadTreeMaybeFromStore(repoStore, stats.CommitID)
+	if err != nil {
+		t.Fatalf("Failed to read tree: %v", err)
+	}
+	var paths []string
+	for _, entry := range tree {
+		paths = append(paths, entry.Path)
+	}
+	if len(paths) != 2 || paths[0] != "a.txt" || paths[1] != "c.txt" {
+		t.Errorf("Expected the parent's a.txt plus c.txt, got %v", paths)
+	}
+	if stats.FilesChanged != 1 {
+		t.Errorf("Expected 1 file changed relative to the parent, got %+v", stats)
+	}
+}
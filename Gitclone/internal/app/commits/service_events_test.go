@@ -0,0 +1,94 @@
+package commits
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gitclone/internal/app/events"
+	"gitclone/internal/infra/storage"
+	"gitclone/internal/metadata"
+	repostorage "gitclone/internal/storage"
+)
+
+// TestPushSendsWebhookEvent verifies that a push delivers a push event with the
+// pushed commit ID to the configured webhook
+func TestPushSendsWebhookEvent(t *testing.T) {
+	received := make(chan events.Event, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event events.Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("webhook received invalid JSON: %v", err)
+		}
+		received <- event
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer hook.Close()
+
+	tmpDir, err := os.MkdirTemp("", "gitstore-webhook-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repoBase := filepath.Join(tmpDir, "repos")
+	repoID := "test-repo"
+	repoPath := filepath.Join(repoBase, repoID)
+
+	if err := os.MkdirAll(repoPath, 0755); err != nil {
+		t.Fatalf("Failed to create repo dir: %v", err)
+	}
+	if err := repostorage.InitRepo(repoPath, repostorage.InitOptions{Bare: false}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	metaStore, err := metadata.NewStore(filepath.Join(tmpDir, "db"))
+	if err != nil {
+		t.Fatalf("Failed to create metadata store: %v", err)
+	}
+	defer metaStore.Close()
+
+	commitSvc := NewService(repoBase, metaStore)
+	commitSvc.SetPublisher(events.NewWebhook(hook.URL))
+
+	if err := os.WriteFile(filepath.Join(repoPath, "file1.txt"), []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	repoStore, err := storage.NewRepoStore(repoBase, repoID)
+	if err != nil {
+		t.Fatalf("Failed to open RepoStore: %v", err)
+	}
+	if _, err := repostorage.AddToIndexFromStore(context.Background(), repoStore, "file1.txt"); err != nil {
+		t.Fatalf("Failed to stage file: %v", err)
+	}
+	repoStore.Close()
+
+	if err := commitSvc.CreateCommit(context.Background(), repoID, "Initial commit"); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if _, err := commitSvc.PushCommits(context.Background(), repoID, "master", false); err != nil {
+		t.Fatalf("Failed to push: %v", err)
+	}
+
+	// Events are delivered asynchronously; the commit event may arrive first
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-received:
+			if event.Type != events.TypePush {
+				continue
+			}
+			if event.RepoID != repoID || event.Branch != "master" || event.CommitID != 0 {
+				t.Errorf("Unexpected push event: %+v", event)
+			}
+			return
+		case <-timeout:
+			t.Fatal("Timed out waiting for push event")
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package commits
+
+import (
+	"context"
+	"testing"
+
+	"GitDb"
+	"gitclone/internal/infra/storage"
+	"gitclone/internal/metadata"
+	repostorage "gitclone/internal/storage"
+)
+
+// TestGraph builds master 1-2 and feature 1-3, merged by commit 4 on master,
+// and checks the graph's labels and edges, with and without a branch and limit
+func TestGraph(t *testing.T) {
+	repoID := "graph-repo"
+	kv := GitDb.NewMemDB()
+	open := func(id string) (*storage.RepoStore, error) {
+		return storage.NewRepoStoreWithKV(id, "/nonexistent/"+id, kv)
+	}
+
+	repoStore, err := open(repoID)
+	if err != nil {
+		t.Fatalf("Failed to open in-memory store: %v", err)
+	}
+	if err := repostorage.InitRepoStore(repoStore, repostorage.InitOptions{}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	intp := func(n int) *int { return &n }
+	batch := repoStore.NewWriteBatch()
+	for _, c := range []repostorage.Commit{
+		{ID: 1, Message: "Initial commit", Branch: "master"},
+		{ID: 2, Message: "Work on master", Branch: "master", Parent: intp(1)},
+		{ID: 3, Message: "Work on feature", Branch: "feature", Parent: intp(1)},
+		{ID: 4, Message: "Merge feature", Branch: "master", Parent: intp(2), Parent2: intp(3)},
+	} {
+		if err := repostorage.WriteCommitObjectToBatch(batch, c, nil); err != nil {
+			t.Fatalf("Failed to write commit %d: %v", c.ID, err)
+		}
+	}
+	for branch, tip := range map[string]int{"master": 4, "feature": 3} {
+		if err := repostorage.WriteHeadRefToBatch(batch, branch, tip); err != nil {
+			t.Fatalf("Failed to write %s: %v", branch, err)
+		}
+		if err := repostorage.WriteRemoteRefToBatch(batch, branch, tip); err != nil {
+			t.Fatalf("Failed to write origin/%s: %v", branch, err)
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("Failed to commit batch: %v", err)
+	}
+
+	commitSvc := NewService("", metadata.NewStoreWithKV(GitDb.NewMemDB()))
+	commitSvc.SetStoreOpener(open)
+
+	graph, err := commitSvc.Graph(context.Background(), repoID, "", 100)
+	if err != nil {
+		t.Fatalf("Failed to build graph: %v", err)
+	}
+	if len(graph.Nodes) != 4 || len(graph.Edges) != 4 {
+		t.Fatalf("Expected 4 nodes and 4 edges, got %+v", graph)
+	}
+	incoming := map[string][]string{}
+	for _, e := range graph.Edges {
+		incoming[e.To] = append(incoming[e.To], e.From)
+	}
+	if len(incoming["4"]) != 2 {
+		t.Errorf("Expected the merge commit to have two incoming edges, got %v", incoming["4"])
+	}
+	// Commit 3 is reachable from master through the merge, the default branch
+	for _, n := range graph.Nodes {
+		if n.Branch != "master" {
+			t.Errorf("Expected %s labelled master, got %q", n.ID, n.Branch)
+		}
+	}
+
+	graph, err = commitSvc.Graph(context.Background(), repoID, "feature", 100)
+	if err != nil {
+		t.Fatalf("Failed to build feature graph: %v", err)
+	}
+	if len(graph.Nodes) != 2 || len(graph.Edges) != 1 || graph.Nodes[0].ID != "3" || graph.Nodes[0].Branch != "feature" {
+		t.Errorf("Expected feature's graph to be 1 -> 3, got %+v", graph)
+	}
+
+	// A limit keeps the newest commits and only the edges between them
+	graph, err = commitSvc.Graph(context.Background(), repoID, "", 2)
+	if err != nil {
+		t.Fatalf("Failed to build limited graph: %v", err)
+	}
+	if len(graph.Nodes) != 2 || graph.Nodes[0].ID != "4" || graph.Nodes[1].ID != "3" || len(graph.Edges) != 1 {
+		t.Errorf("Expected commits 4 and 3 with one edge, got %+v", graph)
+	}
+}
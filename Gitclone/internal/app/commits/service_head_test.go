@@ -0,0 +1,90 @@
+package commits
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"GitDb"
+	"gitclone/internal/infra/storage"
+	"gitclone/internal/metadata"
+	repostorage "gitclone/internal/storage"
+)
+
+// TestHead checks that Head agrees with the first entry of ListCommits and
+// with CountCommits, ignoring an unpushed local commit, and that an unpushed
+// branch has no tip
+func TestHead(t *testing.T) {
+	repoID := "head-repo"
+	kv := GitDb.NewMemDB()
+	open := func(id string) (*storage.RepoStore, error) {
+		return storage.NewRepoStoreWithKV(id, "/nonexistent/"+id, kv)
+	}
+
+	repoStore, err := open(repoID)
+	if err != nil {
+		t.Fatalf("Failed to open in-memory store: %v", err)
+	}
+	if err := repostorage.InitRepoStore(repoStore, repostorage.InitOptions{}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	intp := func(n int) *int { return &n }
+	batch := repoStore.NewWriteBatch()
+	for _, c := range []repostorage.Commit{
+		{ID: 1, Message: "Initial commit", Branch: "master", Timestamp: 100},
+		{ID: 2, Message: "Second", Branch: "master", Timestamp: 200, Parent: intp(1)},
+		{ID: 3, Message: "Third", Branch: "master", Timestamp: 300, Parent: intp(2)},
+		{ID: 4, Message: "Not pushed", Branch: "master", Timestamp: 400, Parent: intp(3)},
+	} {
+		if err := repostorage.WriteCommitObjectToBatch(batch, c, nil); err != nil {
+			t.Fatalf("Failed to write commit %d: %v", c.ID, err)
+		}
+	}
+	if err := repostorage.WriteHeadRefToBatch(batch, "master", 4); err != nil {
+		t.Fatalf("Failed to write master: %v", err)
+	}
+	if err := repostorage.WriteRemoteRefToBatch(batch, "master", 3); err != nil {
+		t.Fatalf("Failed to write origin/master: %v", err)
+	}
+	if err := repostorage.WriteHeadRefToBatch(batch, "feature", 4); err != nil {
+		t.Fatalf("Failed to write feature: %v", err)
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("Failed to commit batch: %v", err)
+	}
+
+	commitSvc := NewService("", metadata.NewStoreWithKV(GitDb.NewMemDB()))
+	commitSvc.SetStoreOpener(open)
+
+	head, err := commitSvc.Head(context.Background(), repoID, "")
+	if err != nil {
+		t.Fatalf("Head failed: %v", err)
+	}
+	list, err := commitSvc.ListCommits(context.Background(), repoID, "master", 1000)
+	if err != nil {
+		t.Fatalf("ListCommits failed: %v", err)
+	}
+	count, err := commitSvc.CountCommits(context.Background(), repoID, "master")
+	if err != nil {
+		t.Fatalf("CountCommits failed: %v", err)
+	}
+
+	if head.Branch != "master" || head.TipCommitID == nil {
+		t.Fatalf("Expected a tip on master, got %+v", head)
+	}
+	if strconv.Itoa(*head.TipCommitID) != list[0].Hash || head.TipMessage != list[0].Message || head.TipDate != list[0].Date {
+		t.Errorf("Expected head to match the first listed commit %+v, got %+v", list[0], head)
+	}
+	if head.CommitCount != 3 || count != 3 || len(list) != 3 {
+		t.Errorf("Expected 3 commits, got head %d, CountCommits %d, ListCommits %d", head.CommitCount, count, len(list))
+	}
+
+	head, err = commitSvc.Head(context.Background(), repoID, "feature")
+	if err != nil {
+		t.Fatalf("Head(feature) failed: %v", err)
+	}
+	if head.TipCommitID != nil || head.CommitCount != 0 {
+		t.Errorf("Expected an unpushed branch to have no tip, got %+v", head)
+	}
+}
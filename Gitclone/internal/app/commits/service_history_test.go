@@ -0,0 +1,88 @@
+package commits
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gitclone/internal/metadata"
+	repostorage "gitclone/internal/storage"
+)
+
+// TestFileHistory verifies that only commits changing the file are returned,
+// and that limit/offset page through them
+func TestFileHistory(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-file-history-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repoBase := filepath.Join(tmpDir, "repos")
+	repoID := "test-repo"
+	repoPath := filepath.Join(repoBase, repoID)
+	if err := os.MkdirAll(repoPath, 0755); err != nil {
+		t.Fatalf("Failed to create repo dir: %v", err)
+	}
+
+	options := repostorage.InitOptions{Bare: false}
+	if err := repostorage.InitRepo(repoPath, options); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	metaStore, err := metadata.NewStore(repoBase)
+	if err != nil {
+		t.Fatalf("Failed to create metadata store: %v", err)
+	}
+	defer metaStore.Close()
+
+	// a.txt changes in commits 1 and 3; commit 2 only touches b.txt
+	trees := map[int][]repostorage.TreeEntry{
+		1: {{Path: "a.txt", BlobID: "a1", Mode: repostorage.ModeFile, Type: "blob"}},
+		2: {
+			{Path: "a.txt", BlobID: "a1", Mode: repostorage.ModeFile, Type: "blob"},
+			{Path: "b.txt", BlobID: "b1", Mode: repostorage.ModeFile, Type: "blob"},
+		},
+		3: {
+			{Path: "a.txt", BlobID: "a2", Mode: repostorage.ModeFile, Type: "blob"},
+			{Path: "b.txt", BlobID: "b1", Mode: repostorage.ModeFile, Type: "blob"},
+		},
+	}
+	for id := 1; id <= 3; id++ {
+		commit := repostorage.Commit{ID: id, Message: "commit", Branch: "master", Timestamp: int64(id)}
+		if id > 1 {
+			parent := id - 1
+			commit.Parent = &parent
+		}
+		if err := repostorage.WriteCommitObject(repoPath, options, commit); err != nil {
+			t.Fatalf("Failed to write commit %d: %v", id, err)
+		}
+		if err := repostorage.WriteTree(repoPath, options, id, trees[id]); err != nil {
+			t.Fatalf("Failed to write tree %d: %v", id, err)
+		}
+	}
+	if err := repostorage.WriteRemoteRef(repoPath, options, "master", 3); err != nil {
+		t.Fatalf("Failed to write remote ref: %v", err)
+	}
+
+	commitSvc := NewService(repoBase, metaStore)
+
+	history, err := commitSvc.FileHistory(context.Background(), repoID, "master", "a.txt", 10, 0)
+	if err != nil {
+		t.Fatalf("FileHistory failed: %v", err)
+	}
+	assertHashes(t, "a.txt", history, []string{"3", "1"})
+
+	history, err = commitSvc.FileHistory(context.Background(), repoID, "", "./b.txt", 10, 0)
+	if err != nil {
+		t.Fatalf("FileHistory failed: %v", err)
+	}
+	assertHashes(t, "b.txt", history, []string{"2"})
+
+	page, err := commitSvc.FileHistory(context.Background(), repoID, "master", "a.txt", 1, 1)
+	if err != nil {
+		t.Fatalf("FileHistory(page 2) failed: %v", err)
+	}
+	assertHashes(t, "a.txt page 2", page, []string{"1"})
+}
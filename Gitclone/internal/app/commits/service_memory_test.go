@@ -0,0 +1,63 @@
+package commits
+
+import (
+	"context"
+	"testing"
+
+	"GitDb"
+	"gitclone/internal/infra/storage"
+	"gitclone/internal/metadata"
+	repostorage "gitclone/internal/storage"
+)
+
+// TestServiceInMemory runs the commits service over GitDb.MemDB stores, with
+// no temp dirs or log files: commit, push and list
+func TestServiceInMemory(t *testing.T) {
+	repoID := "memory-repo"
+	kv := GitDb.NewMemDB()
+	open := func(id string) (*storage.RepoStore, error) {
+		return storage.NewRepoStoreWithKV(id, "/nonexistent/"+id, kv)
+	}
+
+	repoStore, err := open(repoID)
+	if err != nil {
+		t.Fatalf("Failed to open in-memory store: %v", err)
+	}
+	if err := repostorage.InitRepoStore(repoStore, repostorage.InitOptions{}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	metaStore := metadata.NewStoreWithKV(GitDb.NewMemDB())
+	if err := metaStore.CreateRepo(metadata.RepoMeta{ID: repoID, Name: repoID, CurrentBranch: "master"}); err != nil {
+		t.Fatalf("Failed to create metadata: %v", err)
+	}
+	commitSvc := NewService("", metaStore)
+	commitSvc.SetStoreOpener(open)
+
+	for i, content := range []string{"one\n", "one\ntwo\n"} {
+		if err := repostorage.StageContentFromStore(repoStore, "notes.txt", []byte(content)); err != nil {
+			t.Fatalf("Failed to stage: %v", err)
+		}
+		stats, err := commitSvc.CreateCommitWithInfo(context.Background(), repoID, "Edit notes")
+		if err != nil {
+			t.Fatalf("Failed to commit %d: %v", i, err)
+		}
+		if stats.Insertions != 1 {
+			t.Errorf("Commit %d: expected 1 insertion, got %+v", i, stats)
+		}
+	}
+
+	if _, err := commitSvc.PushCommits(context.Background(), repoID, "master", false); err != nil {
+		t.Fatalf("Failed to push: %v", err)
+	}
+	commits, err := commitSvc.ListCommits(context.Background(), repoID, "master", 100)
+	if err != nil {
+		t.Fatalf("Failed to list commits: %v", err)
+	}
+	if len(commits) != 2 {
+		t.Errorf("Expected 2 commits listed, got %+v", commits)
+	}
+	if meta, err := metaStore.GetRepo(repoID); err != nil || meta.CommitCount != 2 {
+		t.Errorf("Expected the in-memory metadata to count 2 commits, got %+v (err %v)", meta, err)
+	}
+}
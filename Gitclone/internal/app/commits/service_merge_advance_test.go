@@ -1,6 +1,7 @@
 package commits
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -74,17 +75,17 @@ func TestMergeAdvancesMasterTip(t *testing.T) {
 		t.Fatalf("Failed to open RepoStore: %v", err)
 	}
 
-	if err := repostorage.AddToIndexFromStore(repoStore, "file1.txt"); err != nil {
+	if _, err := repostorage.AddToIndexFromStore(context.Background(), repoStore, "file1.txt"); err != nil {
 		t.Fatalf("Failed to stage file1: %v", err)
 	}
 	repoStore.Close()
 
-	if err := commitSvc.CreateCommit(repoID, "Initial commit on master"); err != nil {
+	if err := commitSvc.CreateCommit(context.Background(), repoID, "Initial commit on master"); err != nil {
 		t.Fatalf("Failed to create initial commit: %v", err)
 	}
 
 	// Push master
-	pushCount, err := commitSvc.PushCommits(repoID, "master")
+	pushCount, err := commitSvc.PushCommits(context.Background(), repoID, "master", false)
 	if err != nil {
 		t.Fatalf("Failed to push master: %v", err)
 	}
@@ -108,17 +109,17 @@ func TestMergeAdvancesMasterTip(t *testing.T) {
 		t.Fatalf("Failed to open RepoStore: %v", err)
 	}
 
-	if err := repostorage.AddToIndexFromStore(repoStore2, "file2.txt"); err != nil {
+	if _, err := repostorage.AddToIndexFromStore(context.Background(), repoStore2, "file2.txt"); err != nil {
 		t.Fatalf("Failed to stage file2: %v", err)
 	}
 	repoStore2.Close()
 
-	if err := commitSvc.CreateCommit(repoID, "Commit on feature branch"); err != nil {
+	if err := commitSvc.CreateCommit(context.Background(), repoID, "Commit on feature branch"); err != nil {
 		t.Fatalf("Failed to create commit on feature: %v", err)
 	}
 
 	// Push feature
-	pushCount2, err := commitSvc.PushCommits(repoID, "feature")
+	pushCount2, err := commitSvc.PushCommits(context.Background(), repoID, "feature", false)
 	if err != nil {
 		t.Fatalf("Failed to push feature: %v", err)
 	}
@@ -184,7 +185,7 @@ func TestMergeAdvancesMasterTip(t *testing.T) {
 
 	// Write merge commit and update master ref atomically
 	batch := repoStore4.NewWriteBatch()
-	if err := repostorage.WriteCommitObjectToBatch(batch, mergeCommit); err != nil {
+	if err := repostorage.WriteCommitObjectToBatch(batch, mergeCommit, nil); err != nil {
 		t.Fatalf("Failed to add merge commit to batch: %v", err)
 	}
 	if err := repostorage.WriteHeadRefToBatch(batch, "master", mergeID); err != nil {
@@ -217,7 +218,7 @@ func TestMergeAdvancesMasterTip(t *testing.T) {
 	t.Logf("Master tip after merge: %d (expected: %d)", *masterTipAfter, mergeID)
 
 	// Step 8: Push master to update remote ref
-	pushCount3, err := commitSvc.PushCommits(repoID, "master")
+	pushCount3, err := commitSvc.PushCommits(context.Background(), repoID, "master", false)
 	if err != nil {
 		t.Fatalf("Failed to push master after merge: %v", err)
 	}
@@ -273,7 +274,7 @@ func TestMergeAdvancesMasterTip(t *testing.T) {
 		repoStore7.Close()
 	}
 	
-	commits, err := commitSvc.ListCommits(repoID, "master", 10)
+	commits, err := commitSvc.ListCommits(context.Background(), repoID, "master", 10)
 	if err != nil {
 		t.Fatalf("Failed to list commits: %v", err)
 	}
@@ -1,6 +1,7 @@
 package commits
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -73,17 +74,17 @@ func TestMergeUpdatesMasterLatestCommit(t *testing.T) {
 	}
 
 	// Stage and commit file1 on master
-	if err := repostorage.AddToIndexFromStore(repoStore, "file1.txt"); err != nil {
+	if _, err := repostorage.AddToIndexFromStore(context.Background(), repoStore, "file1.txt"); err != nil {
 		t.Fatalf("Failed to stage file1: %v", err)
 	}
 	repoStore.Close()
 
-	if err := commitSvc.CreateCommit(repoID, "Initial commit on master"); err != nil {
+	if err := commitSvc.CreateCommit(context.Background(), repoID, "Initial commit on master"); err != nil {
 		t.Fatalf("Failed to create initial commit: %v", err)
 	}
 
 	// Push master
-	pushCount, err := commitSvc.PushCommits(repoID, "master")
+	pushCount, err := commitSvc.PushCommits(context.Background(), repoID, "master", false)
 	if err != nil {
 		t.Fatalf("Failed to push master: %v", err)
 	}
@@ -109,17 +110,17 @@ func TestMergeUpdatesMasterLatestCommit(t *testing.T) {
 	}
 
 	// Stage and commit file2 on feature
-	if err := repostorage.AddToIndexFromStore(repoStore3, "file2.txt"); err != nil {
+	if _, err := repostorage.AddToIndexFromStore(context.Background(), repoStore3, "file2.txt"); err != nil {
 		t.Fatalf("Failed to stage file2: %v", err)
 	}
 	repoStore3.Close()
 
-	if err := commitSvc.CreateCommit(repoID, "Commit on feature branch"); err != nil {
+	if err := commitSvc.CreateCommit(context.Background(), repoID, "Commit on feature branch"); err != nil {
 		t.Fatalf("Failed to create commit on feature: %v", err)
 	}
 
 	// Push feature
-	pushCount2, err := commitSvc.PushCommits(repoID, "feature")
+	pushCount2, err := commitSvc.PushCommits(context.Background(), repoID, "feature", false)
 	if err != nil {
 		t.Fatalf("Failed to push feature: %v", err)
 	}
@@ -176,7 +177,7 @@ func TestMergeUpdatesMasterLatestCommit(t *testing.T) {
 
 	// Write merge commit and update master ref atomically
 	batch := repoStoreMerge.NewWriteBatch()
-	if err := repostorage.WriteCommitObjectToBatch(batch, mergeCommit); err != nil {
+	if err := repostorage.WriteCommitObjectToBatch(batch, mergeCommit, nil); err != nil {
 		t.Fatalf("Failed to add merge commit to batch: %v", err)
 	}
 	if err := repostorage.WriteHeadRefToBatch(batch, "master", mergeID); err != nil {
@@ -188,7 +189,7 @@ func TestMergeUpdatesMasterLatestCommit(t *testing.T) {
 	repoStoreMerge.Close()
 
 	// Step 5: Push master after merge
-	pushCount3, err := commitSvc.PushCommits(repoID, "master")
+	pushCount3, err := commitSvc.PushCommits(context.Background(), repoID, "master", false)
 	if err != nil {
 		t.Fatalf("Failed to push master after merge: %v", err)
 	}
@@ -197,7 +198,7 @@ func TestMergeUpdatesMasterLatestCommit(t *testing.T) {
 	}
 
 	// Step 6: Verify ListCommits returns the merge/newest commit as first item
-	commits, err := commitSvc.ListCommits(repoID, "master", 10)
+	commits, err := commitSvc.ListCommits(context.Background(), repoID, "master", 10)
 	if err != nil {
 		t.Fatalf("Failed to list commits: %v", err)
 	}
@@ -0,0 +1,88 @@
+package commits
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gitclone/internal/metadata"
+	repostorage "gitclone/internal/storage"
+)
+
+// TestListCommitsByTimestamp verifies that the timestamp-sorted listing reorders
+// commits whose timestamps don't follow the parent chain, while the default
+// listing keeps topological order.
+func TestListCommitsByTimestamp(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-commit-order-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repoBase := filepath.Join(tmpDir, "repos")
+	repoID := "test-repo"
+	repoPath := filepath.Join(repoBase, repoID)
+
+	if err := os.MkdirAll(repoPath, 0755); err != nil {
+		t.Fatalf("Failed to create repo dir: %v", err)
+	}
+
+	options := repostorage.InitOptions{Bare: false}
+	if err := repostorage.InitRepo(repoPath, options); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	metaStore, err := metadata.NewStore(repoBase)
+	if err != nil {
+		t.Fatalf("Failed to create metadata store: %v", err)
+	}
+	defer metaStore.Close()
+
+	// Chain 0 <- 1 <- 2, where commit 1 (e.g. brought in by a merge) is the oldest
+	timestamps := []int64{2000, 1000, 3000}
+	for id, ts := range timestamps {
+		commit := repostorage.Commit{
+			ID:        id,
+			Message:   "commit",
+			Branch:    "master",
+			Timestamp: ts,
+		}
+		if id > 0 {
+			parent := id - 1
+			commit.Parent = &parent
+		}
+		if err := repostorage.WriteCommitObject(repoPath, options, commit); err != nil {
+			t.Fatalf("Failed to write commit %d: %v", id, err)
+		}
+	}
+	if err := repostorage.WriteRemoteRef(repoPath, options, "master", 2); err != nil {
+		t.Fatalf("Failed to write remote ref: %v", err)
+	}
+
+	commitSvc := NewService(repoBase, metaStore)
+
+	topo, err := commitSvc.ListCommits(context.Background(), repoID, "master", 10)
+	if err != nil {
+		t.Fatalf("ListCommits failed: %v", err)
+	}
+	assertHashes(t, "topological", topo, []string{"2", "1", "0"})
+
+	sorted, err := commitSvc.ListCommitsByTimestamp(context.Background(), repoID, "master", 10)
+	if err != nil {
+		t.Fatalf("ListCommitsByTimestamp failed: %v", err)
+	}
+	assertHashes(t, "by timestamp", sorted, []string{"2", "0", "1"})
+}
+
+func assertHashes(t *testing.T, label string, commits []Commit, want []string) {
+	t.Helper()
+	if len(commits) != len(want) {
+		t.Fatalf("%s: expected %d commits, got %d", label, len(want), len(commits))
+	}
+	for i, c := range commits {
+		if c.Hash != want[i] {
+			t.Errorf("%s: position %d: expected commit %s, got %s", label, i, want[i], c.Hash)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package commits
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"GitDb"
+	"gitclone/internal/infra/storage"
+	"gitclone/internal/metadata"
+	repostorage "gitclone/internal/storage"
+)
+
+// TestForcePush diverges master from origin/master and checks that a push is
+// rejected until forced, and that the forced update logs the overwritten tip
+func TestForcePush(t *testing.T) {
+	repoID := "force-push-repo"
+	kv := GitDb.NewMemDB()
+	open := func(id string) (*storage.RepoStore, error) {
+		return storage.NewRepoStoreWithKV(id, "/nonexistent/"+id, kv)
+	}
+
+	repoStore, err := open(repoID)
+	if err != nil {
+		t.Fatalf("Failed to open in-memory store: %v", err)
+	}
+	if err := repostorage.InitRepoStore(repoStore, repostorage.InitOptions{}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	metaStore := metadata.NewStoreWithKV(GitDb.NewMemDB())
+	if err := metaStore.CreateRepo(metadata.RepoMeta{ID: repoID, Name: repoID, CurrentBranch: "master"}); err != nil {
+		t.Fatalf("Failed to create metadata: %v", err)
+	}
+	commitSvc := NewService("", metaStore)
+	commitSvc.SetStoreOpener(open)
+
+	commit := func(content string) int {
+		if err := repostorage.StageContentFromStore(repoStore, "notes.txt", []byte(content)); err != nil {
+			t.Fatalf("Failed to stage: %v", err)
+		}
+		if _, err := commitSvc.CreateCommitWithInfo(context.Background(), repoID, "Edit notes"); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+		tip, err := repostorage.ReadHeadRefMaybeFromStore(repoStore, "master")
+		if err != nil || tip == nil {
+			t.Fatalf("Failed to read master: %v", err)
+		}
+		return *tip
+	}
+
+	first := commit("one\n")
+	pushedTip := commit("one\ntwo\n")
+	if _, err := commitSvc.PushCommits(context.Background(), repoID, "master", false); err != nil {
+		t.Fatalf("Failed to push: %v", err)
+	}
+
+	// Move master back to the first commit and commit on top of it
+	batch := repoStore.NewWriteBatch()
+	if err := repostorage.WriteHeadRefToBatch(batch, "master", first); err != nil {
+		t.Fatalf("Failed to reset master: %v", err)
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("Failed to reset master: %v", err)
+	}
+	divergedTip := commit("one\nthree\n")
+
+	if _, err := commitSvc.PushCommits(context.Background(), repoID, "master", false); !errors.Is(err, ErrNonFastForward) {
+		t.Fatalf("Expected ErrNonFastForward for a diverged push, got %v", err)
+	}
+	if remote, _ := repostorage.ReadRemoteRefFromStore(repoStore, "master"); remote == nil || *remote != pushedTip {
+		t.Errorf("Expected a rejected push to leave origin/master at %d, got %v", pushedTip, remote)
+	}
+
+	pushed, err := commitSvc.PushCommits(context.Background(), repoID, "master", true)
+	if err != nil {
+		t.Fatalf("Failed to force push: %v", err)
+	}
+	if pushed != 1 {
+		t.Errorf("Expected 1 commit pushed, got %d", pushed)
+	}
+	if remote, _ := repostorage.ReadRemoteRefFromStore(repoStore, "master"); remote == nil || *remote != divergedTip {
+		t.Errorf("Expected origin/master at %d after a forced push, got %v", divergedTip, remote)
+	}
+
+	reflog, err := repostorage.ReadReflogFromStore(repoStore, repostorage.RemoteRefName("master"))
+	if err != nil {
+		t.Fatalf("Failed to read reflog: %v", err)
+	}
+	if len(reflog) != 2 {
+		t.Fatalf("Expected 2 reflog entries, got %+v", reflog)
+	}
+	if reflog[0].Old != nil || reflog[0].New != pushedTip || reflog[0].Message != "push" {
+		t.Errorf("Unexpected first reflog entry: %+v", reflog[0])
+	}
+	last := reflog[1]
+	if last.Old == nil || *last.Old != pushedTip || last.New != divergedTip || last.Message != "push: forced update" {
+		t.Errorf("Expected the forced update to log %d -> %d, got %+v", pushedTip, divergedTip, last)
+	}
+}
+
+// TestCyclicHistory gives master a corrupt history in which commit 1 names
+// commit 3 as its parent, and checks that pushing and listing it fail with
+// ErrCommitCycle instead of looping
+func TestCyclicHistory(t *testing.T) {
+	repoID := "cyclic-repo"
+	kv := GitDb.NewMemDB()
+	open := func(id string) (*storage.RepoStore, error) {
+		return storage.NewRepoStoreWithKV(id, "/nonexistent/"+id, kv)
+	}
+
+	repoStore, err := open(repoID)
+	if err != nil {
+		t.Fatalf("Failed to open in-memory store: %v", err)
+	}
+	if err := repostorage.InitRepoStore(repoStore, repostorage.InitOptions{}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	intp := func(n int) *int { return &n }
+	batch := repoStore.NewWriteBatch()
+	for _, c := range []repostorage.Commit{
+		{ID: 1, Message: "one", Branch: "master", Parent: intp(3)},
+		{ID: 2, Message: "two", Branch: "master", Parent: intp(1)},
+		{ID: 3, Message: "three", Branch: "master", Parent: intp(2)},
+	} {
+		if err := repostorage.WriteCommitObjectToBatch(batch, c, nil); err != nil {
+			t.Fatalf("Failed to write commit %d: %v", c.ID, err)
+		}
+	}
+	if err := repostorage.WriteHeadRefToBatch(batch, "master", 3); err != nil {
+		t.Fatalf("Failed to write master: %v", err)
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("Failed to commit batch: %v", err)
+	}
+
+	commitSvc := NewService("", metadata.NewStoreWithKV(GitDb.NewMemDB()))
+	commitSvc.SetStoreOpener(open)
+
+	if _, err := commitSvc.PushCommits(context.Background(), repoID, "master", false); !errors.Is(err, repostorage.ErrCommitCycle) {
+		t.Fatalf("Expected push to fail with ErrCommitCycle, got %v", err)
+	}
+
+	// Point origin at the cycle directly, as a corrupt push would have
+	if err := repostorage.WriteRemoteRefFromStore(repoStore, "master", 3); err != nil {
+		t.Fatalf("Failed to write origin/master: %v", err)
+	}
+	if _, err := commitSvc.ListCommits(context.Background(), repoID, "master", 100); !errors.Is(err, repostorage.ErrCommitCycle) {
+		t.Errorf("Expected ListCommits to fail with ErrCommitCycle, got %v", err)
+	}
+	if _, err := commitSvc.CountCommits(context.Background(), repoID, "master"); !errors.Is(err, repostorage.ErrCommitCycle) {
+		t.Errorf("Expected CountCommits to fail with ErrCommitCycle, got %v", err)
+	}
+	if _, err := commitSvc.Graph(context.Background(), repoID, "master", 100); !errors.Is(err, repostorage.ErrCommitCycle) {
+		t.Errorf("Expected Graph to fail with ErrCommitCycle, got %v", err)
+	}
+}
+
+// TestRollbackPush pushes three times and rolls back twice, checking that each
+// rollback returns origin/master to the tip before the latest push not yet
+// undone, and that a rollback past the first push is refused
+func TestRollbackPush(t *testing.T) {
+	repoID := "rollback-repo"
+	kv := GitDb.NewMemDB()
+	open := func(id string) (*storage.RepoStore, error) {
+		return storage.NewRepoStoreWithKV(id, "/nonexistent/"+id, kv)
+	}
+
+	repoStore, err := open(repoID)
+	if err != nil {
+		t.Fatalf("Failed to open in-memory store: %v", err)
+	}
+	if err := repostorage.InitRepoStore(repoStore, repostorage.InitOptions{}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	metaStore := metadata.NewStoreWithKV(GitDb.NewMemDB())
+	if err := metaStore.CreateRepo(metadata.RepoMeta{ID: repoID, Name: repoID, CurrentBranch: "master"}); err != nil {
+		t.Fatalf("Failed to create metadata: %v", err)
+	}
+	commitSvc := NewService("", metaStore)
+	commitSvc.SetStoreOpener(open)
+
+	if _, err := commitSvc.RollbackPush(repoID, "master", false); !errors.Is(err, ErrNoPushToRollback) {
+		t.Fatalf("Expected ErrNoPushToRollback before any push, got %v", err)
+	}
+
+	var tips []int
+	for _, content := range []string{"one\n", "two\n", "three\n"} {
+		if err := repostorage.StageContentFromStore(repoStore, "notes.txt", []byte(content)); err != nil {
+			t.Fatalf("Failed to stage: %v", err)
+		}
+		if _, err := commitSvc.CreateCommitWithInfo(context.Background(), repoID, "Edit notes"); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+		if _, err := commitSvc.PushCommits(context.Background(), repoID, "master", false); err != nil {
+			t.Fatalf("Failed to push: %v", err)
+		}
+		tip, err := repostorage.ReadRemoteRefFromStore(repoStore, "master")
+		if err != nil || tip == nil {
+			t.Fatalf("Failed to read origin/master: %v", err)
+		}
+		tips = append(tips, *tip)
+	}
+
+	for _, want := range []int{tips[1], tips[0]} {
+		got, err := commitSvc.RollbackPush(repoID, "", false)
+		if err != nil {
+			t.Fatalf("Rollback failed: %v", err)
+		}
+		remote, _ := repostorage.ReadRemoteRefFromStore(repoStore, "master")
+		if got != want || remote == nil || *remote != want {
+			t.Fatalf("Expected origin/master rolled back to %d, got %d (ref %v)", want, got, remote)
+		}
+	}
+
+	// The first push created origin/master: there is nothing before it
+	if _, err := commitSvc.RollbackPush(repoID, "master", false); !errors.Is(err, ErrNoPushToRollback) {
+		t.Fatalf("Expected ErrNoPushToRollback past the first push, got %v", err)
+	}
+	if remote, _ := repostorage.ReadRemoteRefFromStore(repoStore, "master"); remote == nil || *remote != tips[0] {
+		t.Errorf("Expected a refused rollback to leave origin/master at %d, got %v", tips[0], remote)
+	}
+
+	reflog, err := repostorage.ReadReflogFromStore(repoStore, repostorage.RemoteRefName("master"))
+	if err != nil {
+		t.Fatalf("Failed to read reflog: %v", err)
+	}
+	if last := reflog[len(reflog)-1]; last.Old == nil || *last.Old != tips[1] || last.New != tips[0] {
+		t.Errorf("Expected the last reflog entry to record %d -> %d, got %+v", tips[1], tips[0], last)
+	}
+}
+
+// TestPushFollowsMergeParents merges a feature branch that was never pushed
+// into master and pushes master: the feature commits, reachable only through
+// the merge's second parent, are pushed with it
+func TestPushFollowsMergeParents(t *testing.T) {
+	repoID := "merge-parents-repo"
+	kv := GitDb.NewMemDB()
+	open := func(id string) (*storage.RepoStore, error) {
+		return storage.NewRepoStoreWithKV(id, "/nonexistent/"+id, kv)
+	}
+
+	repoStore, err := open(repoID)
+	if err != nil {
+		t.Fatalf("Failed to open in-memory store: %v", err)
+	}
+	if err := repostorage.InitRepoStore(repoStore, repostorage.InitOptions{}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	metaStore := metadata.NewStoreWithKV(GitDb.NewMemDB())
+	if err := metaStore.CreateRepo(metadata.RepoMeta{ID: repoID, Name: repoID, CurrentBranch: "master"}); err != nil {
+		t.Fatalf("Failed to create metadata: %v", err)
+	}
+	commitSvc := NewService("", metaStore)
+	commitSvc.SetStoreOpener(open)
+
+	// writeCommit stores a commit with the given parents and moves branch to it
+	writeCommit := func(branch, message string, parent, parent2 *int) int {
+		id, err := repostorage.NextCommitIDFromStore(repoStore)
+		if err != nil {
+			t.Fatalf("Failed to allocate a commit ID: %v", err)
+		}
+		batch := repoStore.NewWriteBatch()
+		commit := repostorage.Commit{ID: id, Message: message, Branch: branch, Timestamp: int64(id), Parent: parent, Parent2: parent2}
+		if err := repostorage.WriteCommitObjectToBatch(batch, commit, nil); err != nil {
+			t.Fatalf("Failed to write commit: %v", err)
+		}
+		if err := repostorage.WriteHeadRefToBatch(batch, branch, id); err != nil {
+			t.Fatalf("Failed to move %s: %v", branch, err)
+		}
+		if err := batch.Commit(); err != nil {
+			t.Fatalf("Failed to commit batch: %v", err)
+		}
+		return id
+	}
+
+	base := writeCommit("master", "Base", nil, nil)
+	if _, err := commitSvc.PushCommits(context.Background(), repoID, "master", false); err != nil {
+		t.Fatalf("Failed to push master: %v", err)
+	}
+	feature1 := writeCommit("feature", "Feature one", &base, nil)
+	feature2 := writeCommit("feature", "Feature two", &feature1, nil)
+	mainline := writeCommit("master", "Mainline", &base, nil)
+	merge := writeCommit("master", "Merge feature", &mainline, &feature2)
+
+	pushed, err := commitSvc.PushCommitsWithInfo(context.Background(), repoID, "master", PushOptions{})
+	if err != nil {
+		t.Fatalf("Failed to push the merge: %v", err)
+	}
+	// Newest first, by commit ID
+	want := []int{merge, mainline, feature2, feature1}
+	if len(pushed) != len(want) {
+		t.Fatalf("Expected pushed commits %v, got %v", want, pushed)
+	}
+	for i := range want {
+		if pushed[i] != want[i] {
+			t.Fatalf("Expected pushed commits %v, got %v", want, pushed)
+		}
+	}
+
+	if remote, _ := repostorage.ReadRemoteRefFromStore(repoStore, "feature"); remote != nil {
+		t.Errorf("Expected origin/feature to stay unset, got %d", *remote)
+	}
+}
@@ -1,6 +1,7 @@
 package commits
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -78,18 +79,18 @@ func TestRemoteRefVisibilityAfterPush_Regression(t *testing.T) {
 		t.Fatalf("Failed to open RepoStore: %v", err)
 	}
 
-	if err := repostorage.AddToIndexFromStore(repoStore1, "file1.txt"); err != nil {
+	if _, err := repostorage.AddToIndexFromStore(context.Background(), repoStore1, "file1.txt"); err != nil {
 		t.Fatalf("Failed to stage file1: %v", err)
 	}
 	repoStore1.Close()
 
-	if err := commitSvc.CreateCommit(repoID, "Initial commit"); err != nil {
+	if err := commitSvc.CreateCommit(context.Background(), repoID, "Initial commit"); err != nil {
 		t.Fatalf("Failed to create initial commit: %v", err)
 	}
 
 	// Step 2: Push master (this writes refs/remotes/origin/master)
 	// PushCommits opens its own RepoStore, writes the remote ref, and closes it.
-	pushCount, err := commitSvc.PushCommits(repoID, "master")
+	pushCount, err := commitSvc.PushCommits(context.Background(), repoID, "master", false)
 	if err != nil {
 		t.Fatalf("Failed to push master: %v", err)
 	}
@@ -101,7 +102,7 @@ func TestRemoteRefVisibilityAfterPush_Regression(t *testing.T) {
 	// This should see the remote ref that was just written by PushCommits.
 	// Before the fix, this would fail because the previous RepoStore's Close()
 	// would truncate the log file, dropping the remote ref record.
-	commits, err := commitSvc.ListCommits(repoID, "master", 10)
+	commits, err := commitSvc.ListCommits(context.Background(), repoID, "master", 10)
 	if err != nil {
 		t.Fatalf("Failed to list commits: %v", err)
 	}
@@ -204,15 +205,15 @@ func TestRemoteRefVisibility_MultiplePushes(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to open RepoStore: %v", err)
 	}
-	if err := repostorage.AddToIndexFromStore(repoStore, "file1.txt"); err != nil {
+	if _, err := repostorage.AddToIndexFromStore(context.Background(), repoStore, "file1.txt"); err != nil {
 		t.Fatalf("Failed to stage file1: %v", err)
 	}
 	repoStore.Close()
 
-	if err := commitSvc.CreateCommit(repoID, "Commit 1"); err != nil {
+	if err := commitSvc.CreateCommit(context.Background(), repoID, "Commit 1"); err != nil {
 		t.Fatalf("Failed to create commit 1: %v", err)
 	}
-	if _, err := commitSvc.PushCommits(repoID, "master"); err != nil {
+	if _, err := commitSvc.PushCommits(context.Background(), repoID, "master", false); err != nil {
 		t.Fatalf("Failed to push commit 1: %v", err)
 	}
 
@@ -226,20 +227,20 @@ func TestRemoteRefVisibility_MultiplePushes(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to open RepoStore: %v", err)
 	}
-	if err := repostorage.AddToIndexFromStore(repoStore2, "file2.txt"); err != nil {
+	if _, err := repostorage.AddToIndexFromStore(context.Background(), repoStore2, "file2.txt"); err != nil {
 		t.Fatalf("Failed to stage file2: %v", err)
 	}
 	repoStore2.Close()
 
-	if err := commitSvc.CreateCommit(repoID, "Commit 2"); err != nil {
+	if err := commitSvc.CreateCommit(context.Background(), repoID, "Commit 2"); err != nil {
 		t.Fatalf("Failed to create commit 2: %v", err)
 	}
-	if _, err := commitSvc.PushCommits(repoID, "master"); err != nil {
+	if _, err := commitSvc.PushCommits(context.Background(), repoID, "master", false); err != nil {
 		t.Fatalf("Failed to push commit 2: %v", err)
 	}
 
 	// Verify both commits are visible
-	commits, err := commitSvc.ListCommits(repoID, "master", 10)
+	commits, err := commitSvc.ListCommits(context.Background(), repoID, "master", 10)
 	if err != nil {
 		t.Fatalf("Failed to list commits: %v", err)
 	}
@@ -0,0 +1,93 @@
+package commits
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gitclone/internal/infra/storage"
+	"gitclone/internal/metadata"
+	repostorage "gitclone/internal/storage"
+)
+
+// TestCommitAndPushStats verifies the file and line counts reported for a
+// known set of staged changes, and the commit IDs reported by push
+func TestCommitAndPushStats(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-commit-stats-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repoBase := filepath.Join(tmpDir, "repos")
+	repoID := "test-repo"
+	repoPath := filepath.Join(repoBase, repoID)
+	if err := os.MkdirAll(repoPath, 0755); err != nil {
+		t.Fatalf("Failed to create repo dir: %v", err)
+	}
+	if err := repostorage.InitRepo(repoPath, repostorage.InitOptions{Bare: false}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	metaStore, err := metadata.NewStore(filepath.Join(tmpDir, "db"))
+	if err != nil {
+		t.Fatalf("Failed to create metadata store: %v", err)
+	}
+	defer metaStore.Close()
+
+	commitSvc := NewService(repoBase, metaStore)
+
+	stage := func(files map[string]string) {
+		t.Helper()
+		repoStore, err := storage.NewRepoStore(repoBase, repoID)
+		if err != nil {
+			t.Fatalf("Failed to open RepoStore: %v", err)
+		}
+		defer repoStore.Close()
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(repoPath, name), []byte(content), 0644); err != nil {
+				t.Fatalf("Failed to write %s: %v", name, err)
+			}
+			if _, err := repostorage.AddToIndexFromStore(context.Background(), repoStore, name); err != nil {
+				t.Fatalf("Failed to stage %s: %v", name, err)
+			}
+		}
+	}
+
+	// Two new files: 3 + 2 lines added
+	stage(map[string]string{"a.txt": "one\ntwo\nthree\n", "b.txt": "x\ny\n"})
+	stats, err := commitSvc.CreateCommitWithInfo(context.Background(), repoID, "Add a and b")
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if stats.FilesChanged != 2 || stats.Insertions != 5 || stats.Deletions != 0 {
+		t.Errorf("First commit: expected 2 files, +5 -0, got %+v", stats)
+	}
+
+	// One line replaced and one appended in a.txt; b.txt restaged unchanged
+	stage(map[string]string{"a.txt": "one\nTWO\nthree\nfour\n", "b.txt": "x\ny\n"})
+	stats2, err := commitSvc.CreateCommitWithInfo(context.Background(), repoID, "Edit a")
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if stats2.FilesChanged != 1 || stats2.Insertions != 2 || stats2.Deletions != 1 {
+		t.Errorf("Second commit: expected 1 file, +2 -1, got %+v", stats2)
+	}
+
+	pushed, err := commitSvc.PushCommitsWithInfo(context.Background(), repoID, "master", PushOptions{})
+	if err != nil {
+		t.Fatalf("Failed to push: %v", err)
+	}
+	if len(pushed) != 2 || pushed[0] != stats2.CommitID || pushed[1] != stats.CommitID {
+		t.Errorf("Expected pushed commits [%d %d], got %v", stats2.CommitID, stats.CommitID, pushed)
+	}
+
+	pushed, err = commitSvc.PushCommitsWithInfo(context.Background(), repoID, "master", PushOptions{})
+	if err != nil {
+		t.Fatalf("Failed to push again: %v", err)
+	}
+	if len(pushed) != 0 {
+		t.Errorf("Expected nothing to push, got %v", pushed)
+	}
+}
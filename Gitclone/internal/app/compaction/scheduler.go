@@ -0,0 +1,113 @@
+package compaction
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	storage "gitclone/internal/infra/storage"
+	"gitclone/internal/metadata"
+)
+
+// DefaultThreshold is the reclaimable bytes at which a repository is
+// compacted unless Options says otherwise
+const DefaultThreshold int64 = 1 << 20
+
+// Options configures a Scheduler
+type Options struct {
+	Interval  time.Duration // time between passes over the repositories
+	Threshold int64         // reclaimable bytes at which a repository is compacted; zero means DefaultThreshold
+}
+
+// Scheduler compacts the logs of registered repositories in the background.
+// Every log is append-only, so ref updates and re-staged files grow it
+// forever; once enough of a log is overwritten records, the scheduler
+// rewrites it while holding the repository's lock.
+type Scheduler struct {
+	repoBase  string
+	metaStore *metadata.Store
+	locks     *storage.RepoLocks
+	options   Options
+}
+
+// NewScheduler creates a scheduler for the repositories registered in
+// metaStore. locks must be the lock set the server's writers share.
+func NewScheduler(repoBase string, metaStore *metadata.Store, locks *storage.RepoLocks, options Options) *Scheduler {
+	if options.Threshold <= 0 {
+		options.Threshold = DefaultThreshold
+	}
+	return &Scheduler{
+		repoBase:  repoBase,
+		metaStore: metaStore,
+		locks:     locks,
+		options:   options,
+	}
+}
+
+// Run makes a pass every interval until ctx is done
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.options.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.CompactAll()
+		}
+	}
+}
+
+// CompactAll makes one pass, compacting each registered repository with at
+// least the threshold of reclaimable bytes. It returns the IDs of the
+// repositories it compacted. Failures are logged and the repository is
+// retried on the next pass.
+func (s *Scheduler) CompactAll() []string {
+	metas, err := s.metaStore.ListRepos()
+	if err != nil {
+		log.Printf("Compaction: failed to list repositories: %v", err)
+		return nil
+	}
+
+	var compacted []string
+	for _, meta := range metas {
+		if meta.Missing {
+			continue
+		}
+		ok, err := s.compactRepo(meta.ID)
+		if err != nil {
+			log.Printf("Compaction: repoID=%s: %v", meta.ID, err)
+			continue
+		}
+		if ok {
+			compacted = append(compacted, meta.ID)
+		}
+	}
+	return compacted
+}
+
+// compactRepo compacts repoID if it has reached the threshold, and reports
+// whether it did
+func (s *Scheduler) compactRepo(repoID string) (bool, error) {
+	defer s.locks.Lock(repoID)()
+
+	repoStore, err := storage.NewRepoStore(s.repoBase, repoID)
+	if err != nil {
+		return false, err
+	}
+	defer repoStore.Close()
+
+	stats, err := repoStore.Stats()
+	if err != nil {
+		return false, fmt.Errorf("failed to read log stats: %w", err)
+	}
+	if stats.ReclaimableBytes == 0 || stats.ReclaimableBytes < s.options.Threshold {
+		return false, nil
+	}
+	if err := repoStore.Compact(); err != nil {
+		return false, fmt.Errorf("failed to compact: %w", err)
+	}
+	log.Printf("Compaction: repoID=%s freed %d of %d bytes", repoID, stats.ReclaimableBytes, stats.LogBytes)
+	return true, nil
+}
@@ -0,0 +1,83 @@
+package compaction
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"GitDb"
+	storage "gitclone/internal/infra/storage"
+	"gitclone/internal/metadata"
+	repostorage "gitclone/internal/storage"
+)
+
+// churn overwrites one key n times in repoID, as repeated ref updates do
+func churn(t *testing.T, repoBase, repoID string, n int) {
+	t.Helper()
+	repoStore, err := storage.NewRepoStore(repoBase, repoID)
+	if err != nil {
+		t.Fatalf("Failed to open repo: %v", err)
+	}
+	defer repoStore.Close()
+	for i := 0; i < n; i++ {
+		if err := repoStore.DB().Put("churn", []byte(fmt.Sprintf("value %04d", i))); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+}
+
+// TestCompactAll checks a repository is left alone below the threshold and
+// compacted, with its data intact, once it is crossed
+func TestCompactAll(t *testing.T) {
+	repoBase := t.TempDir()
+	repoID := "demo"
+	repoPath := filepath.Join(repoBase, repoID)
+	if err := os.MkdirAll(repoPath, 0755); err != nil {
+		t.Fatalf("Failed to create repo dir: %v", err)
+	}
+	if err := repostorage.InitRepo(repoPath, repostorage.InitOptions{Bare: false}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+	metaStore := metadata.NewStoreWithKV(GitDb.NewMemDB())
+	if err := metaStore.CreateRepo(metadata.RepoMeta{ID: repoID, Name: repoID}); err != nil {
+		t.Fatalf("Failed to register repo: %v", err)
+	}
+	// A registered repo whose folder is gone is skipped
+	if err := metaStore.CreateRepo(metadata.RepoMeta{ID: "gone", Name: "gone", Missing: true}); err != nil {
+		t.Fatalf("Failed to register repo: %v", err)
+	}
+
+	// Each overwrite leaves a 23-byte record behind
+	scheduler := NewScheduler(repoBase, metaStore, storage.NewRepoLocks(), Options{Threshold: 2700})
+	logPath := filepath.Join(repoPath, ".gitclone", "db", "log")
+	churn(t, repoBase, repoID, 50)
+	if compacted := scheduler.CompactAll(); len(compacted) != 0 {
+		t.Fatalf("Expected no compaction below the threshold, got %v", compacted)
+	}
+
+	churn(t, repoBase, repoID, 100)
+	before, _ := os.Stat(logPath)
+	if compacted := scheduler.CompactAll(); len(compacted) != 1 || compacted[0] != repoID {
+		t.Fatalf("Expected %s compacted once over the threshold, got %v", repoID, compacted)
+	}
+	after, _ := os.Stat(logPath)
+	if after.Size() >= before.Size()-2700 {
+		t.Errorf("Expected the log to shrink by at least the threshold, went from %d to %d bytes", before.Size(), after.Size())
+	}
+
+	repoStore, err := storage.NewRepoStore(repoBase, repoID)
+	if err != nil {
+		t.Fatalf("Failed to open repo after compaction: %v", err)
+	}
+	defer repoStore.Close()
+	if got, err := repoStore.DB().Get("churn"); err != nil || string(got) != "value 0099" {
+		t.Errorf("Expected the latest value after compaction, got %q, %v", got, err)
+	}
+	if branch, err := repostorage.ReadHEADBranchFromStore(repoStore); err != nil || branch == "" {
+		t.Errorf("Expected HEAD intact after compaction, got %q, %v", branch, err)
+	}
+	if compacted := scheduler.CompactAll(); len(compacted) != 0 {
+		t.Errorf("Expected nothing left to compact, got %v", compacted)
+	}
+}
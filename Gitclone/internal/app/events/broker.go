@@ -0,0 +1,80 @@
+package events
+
+import "sync"
+
+// subscriberBuffer is how many events a slow subscriber may lag behind before
+// further events are dropped for it
+const subscriberBuffer = 16
+
+// Broker is an in-process pub/sub that fans events out to per-repo subscribers
+type Broker struct {
+	mu   sync.Mutex
+	subs map[string]map[chan Event]struct{}
+}
+
+// NewBroker creates an empty broker
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[string]map[chan Event]struct{})}
+}
+
+// Subscribe returns a channel of events for repoID and a function that
+// unsubscribes and closes the channel
+func (b *Broker) Subscribe(repoID string) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.subs[repoID] == nil {
+		b.subs[repoID] = make(map[chan Event]struct{})
+	}
+	b.subs[repoID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs[repoID], ch)
+			if len(b.subs[repoID]) == 0 {
+				delete(b.subs, repoID)
+			}
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+	return ch, unsubscribe
+}
+
+// Publish delivers the event to every subscriber of its repo without blocking;
+// subscribers whose buffer is full miss the event
+func (b *Broker) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs[event.RepoID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// multiPublisher forwards each event to several publishers
+type multiPublisher []Publisher
+
+// Multi returns a Publisher that forwards to every non-nil publisher given
+func Multi(publishers ...Publisher) Publisher {
+	var m multiPublisher
+	for _, p := range publishers {
+		if p != nil {
+			m = append(m, p)
+		}
+	}
+	return m
+}
+
+// Publish forwards the event to each publisher in order
+func (m multiPublisher) Publish(event Event) {
+	for _, p := range m {
+		p.Publish(event)
+	}
+}
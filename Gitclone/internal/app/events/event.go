@@ -0,0 +1,40 @@
+package events
+
+import (
+	"time"
+
+	"gitclone/internal/timefmt"
+)
+
+// Event types published by the services
+const (
+	TypeCommit = "commit"
+	TypePush   = "push"
+	TypeMerge  = "merge"
+)
+
+// Event describes a repository change
+type Event struct {
+	Type      string    `json:"type"`
+	RepoID    string    `json:"repoID"`
+	Branch    string    `json:"branch"`
+	CommitID  int       `json:"commitId"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Publisher receives events after the change they describe has been persisted.
+// Publish must not block the caller.
+type Publisher interface {
+	Publish(Event)
+}
+
+// NewEvent creates an event stamped with the current time
+func NewEvent(eventType, repoID, branch string, commitID int) Event {
+	return Event{
+		Type:      eventType,
+		RepoID:    repoID,
+		Branch:    branch,
+		CommitID:  commitID,
+		Timestamp: timefmt.Now(),
+	}
+}
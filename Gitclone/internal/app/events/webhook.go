@@ -0,0 +1,69 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	webhookMaxAttempts = 3
+	webhookTimeout     = 5 * time.Second
+	webhookBackoff     = 500 * time.Millisecond
+)
+
+// Webhook POSTs events as JSON to a fixed URL
+type Webhook struct {
+	url     string
+	client  *http.Client
+	backoff time.Duration
+}
+
+// NewWebhook creates a webhook publisher for url
+func NewWebhook(url string) *Webhook {
+	return &Webhook{
+		url:     url,
+		client:  &http.Client{Timeout: webhookTimeout},
+		backoff: webhookBackoff,
+	}
+}
+
+// Publish delivers the event in the background so a slow endpoint never
+// blocks the request that produced it
+func (w *Webhook) Publish(event Event) {
+	go func() {
+		if err := w.deliver(event); err != nil {
+			log.Printf("webhook: failed to deliver %s event for %s: %v", event.Type, event.RepoID, err)
+		}
+	}()
+}
+
+// deliver POSTs the event, retrying a bounded number of times on failure
+func (w *Webhook) deliver(event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= webhookMaxAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(w.backoff * time.Duration(attempt-1))
+		}
+
+		resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+		lastErr = fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return fmt.Errorf("giving up after %d attempts: %w", webhookMaxAttempts, lastErr)
+}
@@ -1,18 +1,53 @@
 package files
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"gitclone/internal/infra/storage"
 	repostorage "gitclone/internal/storage"
 )
 
+// ErrCommitNotFound is returned when a requested commit doesn't exist
+var ErrCommitNotFound = errors.New("commit not found")
+
+// ErrFileNotFound is returned when a path has no file in the requested
+// version: the commit or, for the staged version, the index
+var ErrFileNotFound = errors.New("file not found")
+
+// ErrInvalidPath is returned when a file path is absolute, leaves the repo or
+// points into its .gitclone directory
+var ErrInvalidPath = errors.New("invalid file path")
+
+// ErrQuotaExceeded is returned when a write would take a repository over its
+// size quota
+var ErrQuotaExceeded = errors.New("repository size quota exceeded")
+
+// TreeEntry represents a file or directory in a commit's tree
+type TreeEntry struct {
+	Path   string
+	BlobID string
+	Mode   string
+	Type   string // "blob" or "tree"
+}
+
+// StagedDiff lists the paths the next commit would change relative to HEAD
+type StagedDiff struct {
+	Added    []string
+	Modified []string
+	Deleted  []string
+}
+
 // Service handles file operations
 type Service struct {
-	repoBase string
+	repoBase     string
+	maxRepoBytes int64 // size quota per repository; 0 means no limit
 }
 
 // NewService creates a new files service
@@ -22,14 +57,23 @@ func NewService(repoBase string) *Service {
 	}
 }
 
+// SetMaxRepoBytes sets the size quota WriteFile enforces: the bytes a
+// repository's directory, .gitclone included, may hold after a write. Zero
+// means no limit.
+func (s *Service) SetMaxRepoBytes(maxBytes int64) {
+	s.maxRepoBytes = maxBytes
+}
+
 // StageFiles stages files for commit (legacy method, kept for compatibility)
-func (s *Service) StageFiles(repoID, path string) error {
-	_, _, err := s.StageFilesWithInfo(repoID, path)
+func (s *Service) StageFiles(ctx context.Context, repoID, path string) error {
+	_, _, err := s.StageFilesWithInfo(ctx, repoID, path)
 	return err
 }
 
-// StageFilesWithInfo stages files and returns staged entries info
-func (s *Service) StageFilesWithInfo(repoID, path string) (int, []string, error) {
+// StageFilesWithInfo stages files and returns staged entries info. Staging a
+// directory stops with ctx's error once ctx is done, leaving the files staged
+// so far in the index.
+func (s *Service) StageFilesWithInfo(ctx context.Context, repoID, path string) (int, []string, error) {
 	// Open per-repo store
 	repoStore, err := storage.NewRepoStore(s.repoBase, repoID)
 	if err != nil {
@@ -39,16 +83,6 @@ func (s *Service) StageFilesWithInfo(repoID, path string) (int, []string, error)
 
 	repoPath := repoStore.RepoPath()
 
-	oldDir, err := os.Getwd()
-	if err != nil {
-		return 0, nil, err
-	}
-	defer os.Chdir(oldDir)
-
-	if err := os.Chdir(repoPath); err != nil {
-		return 0, nil, err
-	}
-
 	// Debug: log repo info - verify DB path
 	dbPath := filepath.Join(repoPath, ".gitclone", "db")
 	log.Printf("DEBUG StageFiles: repoID=%s, repoBase=%s, repoPath=%s, dbPath=%s, stagingPath=%s", 
@@ -85,7 +119,8 @@ func (s *Service) StageFilesWithInfo(repoID, path string) (int, []string, error)
 
 	// Add to index (handles both single files and directories)
 	// This writes directly to the DB instance, so writes are immediately visible
-	if err := repostorage.AddToIndexFromStore(repoStore, path); err != nil {
+	if _, err := repostorage.AddToIndexFromStore(ctx, repoStore, path); err != nil {
+		repoStore.Close()
 		return 0, nil, fmt.Errorf("failed to stage files: %w", err)
 	}
 
@@ -163,27 +198,276 @@ func (s *Service) StageFilesWithInfo(repoID, path string) (int, []string, error)
 
 // WriteFile writes content to a file in the repository
 func (s *Service) WriteFile(repoID, filePath string, content []byte) error {
+	_, err := s.WriteFileWithInfo(repoID, filePath, content, false)
+	return err
+}
+
+// WriteFileWithInfo writes content to a file in the repository and, with
+// autoStage, stages it in the same store session. It reports whether the file
+// is staged afterwards.
+func (s *Service) WriteFileWithInfo(repoID, filePath string, content []byte, autoStage bool) (bool, error) {
 	// Open per-repo store (to validate repo exists)
 	repoStore, err := storage.NewRepoStore(s.repoBase, repoID)
 	if err != nil {
-		return err
+		return false, err
 	}
 	defer repoStore.Close()
 
-	repoPath := repoStore.RepoPath()
-	fullPath := filepath.Join(repoPath, filePath)
+	relPath, err := cleanWorktreePath(filePath)
+	if err != nil {
+		return false, err
+	}
+	// Existing symlinks in the worktree would redirect the write
+	if err := repostorage.CheckWorktreePath(repoStore.RepoPath(), relPath); err != nil {
+		return false, fmt.Errorf("%w: %q: %v", ErrInvalidPath, filePath, err)
+	}
+	fullPath := filepath.Join(repoStore.RepoPath(), relPath)
+
+	if err := s.checkRepoSize(repoStore.RepoPath(), fullPath, int64(len(content))); err != nil {
+		return false, err
+	}
 
 	// Ensure directory exists
 	dir := filepath.Dir(fullPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
+		return false, fmt.Errorf("failed to create directory: %w", err)
 	}
 
 	// Write file
 	if err := os.WriteFile(fullPath, content, 0644); err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+		return false, fmt.Errorf("failed to write file: %w", err)
 	}
 
+	if autoStage {
+		// One file is staged in one step, with nothing to cancel
+		if _, err := repostorage.AddToIndexFromStore(context.Background(), repoStore, relPath); err != nil {
+			return false, fmt.Errorf("failed to stage file: %w", err)
+		}
+	}
+
+	entries, err := repostorage.GetIndexEntriesFromStore(repoStore)
+	if err != nil {
+		return false, err
+	}
+	_, staged := entries[repostorage.NormalizeIndexPath(relPath)]
+	return staged, nil
+}
+
+// checkRepoSize fails with ErrQuotaExceeded if replacing fullPath with
+// newSize bytes would take the repository at repoPath over the size quota.
+// Blobs that staging the file adds to .gitclone aren't counted until the next
+// write.
+func (s *Service) checkRepoSize(repoPath, fullPath string, newSize int64) error {
+	if s.maxRepoBytes <= 0 {
+		return nil
+	}
+
+	var size int64
+	err := filepath.Walk(repoPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil // Skip files removed during the walk
+		}
+		if info.Mode().IsRegular() && path != fullPath {
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to measure repository size: %w", err)
+	}
+
+	if size+newSize > s.maxRepoBytes {
+		return fmt.Errorf("%w: the write would make the repository %d bytes, limit is %d", ErrQuotaExceeded, size+newSize, s.maxRepoBytes)
+	}
 	return nil
 }
 
+// cleanWorktreePath cleans a repo-relative file path, rejecting absolute
+// paths, paths that climb out of the repo and anything under .gitclone
+func cleanWorktreePath(filePath string) (string, error) {
+	if filepath.IsAbs(filePath) || strings.HasPrefix(filePath, "/") || strings.HasPrefix(filePath, "\\") {
+		return "", fmt.Errorf("%w: %q is absolute", ErrInvalidPath, filePath)
+	}
+
+	cleaned := filepath.Clean(filepath.FromSlash(filePath))
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %q is outside the repository", ErrInvalidPath, filePath)
+	}
+	for _, part := range strings.Split(cleaned, string(filepath.Separator)) {
+		// Case-insensitive filesystems would map .GITCLONE onto .gitclone
+		if strings.EqualFold(part, repostorage.RepoDir) {
+			return "", fmt.Errorf("%w: %q is inside %s", ErrInvalidPath, filePath, repostorage.RepoDir)
+		}
+	}
+	return cleaned, nil
+}
+
+// ListTree lists the tree of a commit under dir, one level deep or, with
+// recursive, every file below it. A nil commitID uses the commit HEAD is at;
+// a branch without commits has an empty tree.
+func (s *Service) ListTree(repoID string, commitID *int, dir string, recursive bool) ([]TreeEntry, error) {
+	repoStore, err := storage.NewRepoStore(s.repoBase, repoID)
+	if err != nil {
+		return nil, err
+	}
+	defer repoStore.Close()
+
+	if commitID == nil {
+		commitID, _, err = repostorage.ResolveHead(repoStore)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read HEAD: %w", err)
+		}
+		if commitID == nil {
+			return []TreeEntry{}, nil
+		}
+	}
+
+	if _, err := repostorage.ReadCommitObjectFromStore(repoStore, *commitID); err != nil {
+		return nil, fmt.Errorf("%w: %d", ErrCommitNotFound, *commitID)
+	}
+
+	// Trees share their commit's ID
+	tree, err := repostorage.ReadTreeMaybeFromStore(repoStore, *commitID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tree: %w", err)
+	}
+
+	listed := repostorage.ListTreeDir(tree, dir, recursive)
+	entries := make([]TreeEntry, len(listed))
+	for i, e := range listed {
+		entries[i] = TreeEntry{
+			Path:   e.Path,
+			BlobID: e.BlobID,
+			Mode:   e.Mode,
+			Type:   e.Type,
+		}
+	}
+	return entries, nil
+}
+
+// ReadFile returns the content of filePath and its blob ID. With staged it
+// reads the version staged in the index; otherwise the version in commitID,
+// or in the commit HEAD is at if commitID is nil. It fails with
+// ErrFileNotFound if that version has no such file, including a file staged
+// for removal.
+func (s *Service) ReadFile(repoID, filePath string, commitID *int, staged bool) ([]byte, string, error) {
+	repoStore, err := storage.NewRepoStore(s.repoBase, repoID)
+	if err != nil {
+		return nil, "", err
+	}
+	defer repoStore.Close()
+
+	blobID, err := fileBlobID(repoStore, filePath, commitID, staged)
+	if err != nil {
+		return nil, "", err
+	}
+	content, err := repostorage.GetBlobContentFromStore(repoStore, blobID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read blob %s: %w", blobID, err)
+	}
+	return content, blobID, nil
+}
+
+// OpenFile is ReadFile for streaming: it returns a reader over the content,
+// the content's size and the blob ID. The caller must close the reader.
+func (s *Service) OpenFile(repoID, filePath string, commitID *int, staged bool) (io.ReadCloser, int64, string, error) {
+	repoStore, err := storage.NewRepoStore(s.repoBase, repoID)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	blobID, err := fileBlobID(repoStore, filePath, commitID, staged)
+	if err != nil {
+		repoStore.Close()
+		return nil, 0, "", err
+	}
+	reader, size, err := repostorage.BlobReader(repoStore, blobID)
+	if err != nil {
+		repoStore.Close()
+		return nil, 0, "", err
+	}
+	return &storeReader{ReadCloser: reader, store: repoStore}, size, blobID, nil
+}
+
+// storeReader is a blob reader that also closes the store it reads from
+type storeReader struct {
+	io.ReadCloser
+	store *storage.RepoStore
+}
+
+// Close closes the reader, then the store
+func (r *storeReader) Close() error {
+	err := r.ReadCloser.Close()
+	if closeErr := r.store.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// fileBlobID returns the blob ID of filePath in the version ReadFile reads
+func fileBlobID(repoStore *storage.RepoStore, filePath string, commitID *int, staged bool) (string, error) {
+	relPath, err := cleanWorktreePath(filePath)
+	if err != nil {
+		return "", err
+	}
+	path := repostorage.NormalizeIndexPath(relPath)
+
+	if staged {
+		entry, ok := repostorage.ReadIndexEntryFromStore(repoStore, path)
+		if !ok || entry.Deleted {
+			return "", fmt.Errorf("%w: %s isn't staged", ErrFileNotFound, path)
+		}
+		return entry.BlobID, nil
+	}
+
+	if commitID == nil {
+		commitID, _, err = repostorage.ResolveHead(repoStore)
+		if err != nil {
+			return "", fmt.Errorf("failed to read HEAD: %w", err)
+		}
+		if commitID == nil {
+			return "", fmt.Errorf("%w: %s (no commits yet)", ErrFileNotFound, path)
+		}
+	}
+	if _, err := repostorage.ReadCommitObjectFromStore(repoStore, *commitID); err != nil {
+		return "", fmt.Errorf("%w: %d", ErrCommitNotFound, *commitID)
+	}
+	tree, err := repostorage.ReadTreeMaybeFromStore(repoStore, *commitID)
+	if err != nil {
+		return "", fmt.Errorf("failed to read tree: %w", err)
+	}
+	for _, entry := range tree {
+		if entry.Path == path {
+			return entry.BlobID, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s in commit %d", ErrFileNotFound, path, *commitID)
+}
+
+// StagedDiff compares the index with the HEAD commit's tree, as the next
+// commit would: staged files new to HEAD are added, staged edits modified and
+// staged removals deleted. Each list is sorted.
+func (s *Service) StagedDiff(repoID string) (StagedDiff, error) {
+	repoStore, err := storage.NewRepoStore(s.repoBase, repoID)
+	if err != nil {
+		return StagedDiff{}, err
+	}
+	defer repoStore.Close()
+
+	changes, err := repostorage.StagedChangesFromStore(repoStore)
+	if err != nil {
+		return StagedDiff{}, err
+	}
+	diff := StagedDiff{Added: []string{}, Modified: []string{}, Deleted: []string{}}
+	for _, change := range changes {
+		switch change.Status {
+		case repostorage.ChangeAdded:
+			diff.Added = append(diff.Added, change.Path)
+		case repostorage.ChangeModified:
+			diff.Modified = append(diff.Modified, change.Path)
+		case repostorage.ChangeRemoved:
+			diff.Deleted = append(diff.Deleted, change.Path)
+		}
+	}
+	return diff, nil
+}
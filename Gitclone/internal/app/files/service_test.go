@@ -1,6 +1,9 @@
 package files
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -49,7 +52,7 @@ func TestStageThenCommit(t *testing.T) {
 	service := NewService(repoBase)
 
 	// Stage the file
-	if err := service.StageFiles(repoID, "test.txt"); err != nil {
+	if err := service.StageFiles(context.Background(), repoID, "test.txt"); err != nil {
 		t.Fatalf("Failed to stage file: %v", err)
 	}
 
@@ -84,3 +87,130 @@ func TestStageThenCommit(t *testing.T) {
 		t.Error("HasStagedEntries should return true after staging")
 	}
 }
+
+// TestWriteFileRejectsUnsafePaths checks WriteFile refuses paths that would
+// land outside the worktree or inside .gitclone, and writes nothing for them
+func TestWriteFileRejectsUnsafePaths(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-write-path-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repoBase := filepath.Join(tmpDir, "repos")
+	repoPath := filepath.Join(repoBase, "test-repo")
+	if err := os.MkdirAll(repoPath, 0755); err != nil {
+		t.Fatalf("Failed to create repo dir: %v", err)
+	}
+	if err := repostorage.InitRepo(repoPath, repostorage.InitOptions{Bare: false}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+	service := NewService(repoBase)
+
+	for _, path := range []string{
+		"../escape.txt",
+		"docs/../../escape.txt",
+		filepath.Join(tmpDir, "absolute.txt"),
+		".gitclone/db/log",
+		"docs/.gitclone/x",
+		"..",
+	} {
+		if err := service.WriteFile("test-repo", path, []byte("x")); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("WriteFile(%q): expected ErrInvalidPath, got %v", path, err)
+		}
+	}
+	for _, path := range []string{filepath.Join(repoBase, "escape.txt"), filepath.Join(tmpDir, "absolute.txt")} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected %s not to be written, got %v", path, err)
+		}
+	}
+
+	// Paths that only look unusual stay allowed
+	if err := service.WriteFile("test-repo", "docs/./notes/../readme.gitclone", []byte("x")); err != nil {
+		t.Fatalf("Failed to write a safe path: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(repoPath, "docs", "readme.gitclone")); err != nil {
+		t.Errorf("Expected docs/readme.gitclone to be written: %v", err)
+	}
+}
+
+// TestWriteFileAutoStage checks autoStage leaves the written file in the index
+// and a plain write leaves it unstaged
+func TestWriteFileAutoStage(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-write-stage-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repoBase := filepath.Join(tmpDir, "repos")
+	repoPath := filepath.Join(repoBase, "test-repo")
+	if err := os.MkdirAll(repoPath, 0755); err != nil {
+		t.Fatalf("Failed to create repo dir: %v", err)
+	}
+	if err := repostorage.InitRepo(repoPath, repostorage.InitOptions{Bare: false}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+	service := NewService(repoBase)
+
+	staged, err := service.WriteFileWithInfo("test-repo", "plain.txt", []byte("plain"), false)
+	if err != nil || staged {
+		t.Fatalf("Expected plain.txt written but not staged, got staged=%v err=%v", staged, err)
+	}
+	staged, err = service.WriteFileWithInfo("test-repo", "src/staged.txt", []byte("staged"), true)
+	if err != nil || !staged {
+		t.Fatalf("Expected src/staged.txt written and staged, got staged=%v err=%v", staged, err)
+	}
+
+	repoStore, err := storage.NewRepoStore(repoBase, "test-repo")
+	if err != nil {
+		t.Fatalf("Failed to open RepoStore: %v", err)
+	}
+	defer repoStore.Close()
+	entries, err := repostorage.GetIndexEntriesFromStore(repoStore)
+	if err != nil {
+		t.Fatalf("Failed to read index: %v", err)
+	}
+	if _, ok := entries["src/staged.txt"]; !ok || len(entries) != 1 {
+		t.Errorf("Expected only src/staged.txt in the index, got %v", entries)
+	}
+}
+
+// TestWriteFileSizeQuota checks that a write that would take the repository
+// over its size quota fails and leaves the file alone, and that overwriting a
+// file only counts the difference
+func TestWriteFileSizeQuota(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-write-quota-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repoBase := filepath.Join(tmpDir, "repos")
+	repoPath := filepath.Join(repoBase, "test-repo")
+	if err := os.MkdirAll(repoPath, 0755); err != nil {
+		t.Fatalf("Failed to create repo dir: %v", err)
+	}
+	if err := repostorage.InitRepo(repoPath, repostorage.InitOptions{Bare: false}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+	service := NewService(repoBase)
+	service.SetMaxRepoBytes(64 * 1024)
+
+	big := bytes.Repeat([]byte("x"), 40*1024)
+	if err := service.WriteFile("test-repo", "big.txt", big); err != nil {
+		t.Fatalf("Expected a write under the quota to succeed: %v", err)
+	}
+	// Replacing big.txt with content of the same size stays under the quota
+	if err := service.WriteFile("test-repo", "big.txt", bytes.ToUpper(big)); err != nil {
+		t.Fatalf("Expected overwriting big.txt to succeed: %v", err)
+	}
+
+	err = service.WriteFile("test-repo", "another.txt", big)
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("Expected ErrQuotaExceeded, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(repoPath, "another.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected the rejected file not to be written, got %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package files
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	repostorage "gitclone/internal/storage"
+)
+
+// TestListTree_Recursive verifies that recursive listing returns every leaf of
+// a nested tree, while the default lists one directory level
+func TestListTree_Recursive(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-tree-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repoBase := filepath.Join(tmpDir, "repos")
+	repoID := "test-repo"
+	repoPath := filepath.Join(repoBase, repoID)
+	if err := os.MkdirAll(repoPath, 0755); err != nil {
+		t.Fatalf("Failed to create repo dir: %v", err)
+	}
+
+	options := repostorage.InitOptions{Bare: false}
+	if err := repostorage.InitRepo(repoPath, options); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	tree := []repostorage.TreeEntry{
+		{Path: "README.md", BlobID: "b1", Mode: repostorage.ModeFile, Type: "blob"},
+		{Path: "docs/guide.md", BlobID: "b2", Mode: repostorage.ModeFile, Type: "blob"},
+		{Path: "src/main.go", BlobID: "b3", Mode: repostorage.ModeFile, Type: "blob"},
+		{Path: "src/pkg/util/strings.go", BlobID: "b4", Mode: repostorage.ModeFile, Type: "blob"},
+		{Path: "src/pkg/util/run.sh", BlobID: "b5", Mode: repostorage.ModeExecutable, Type: "blob"},
+	}
+	if err := repostorage.WriteCommitObject(repoPath, options, repostorage.Commit{ID: 0, Message: "nested", Branch: "master"}); err != nil {
+		t.Fatalf("Failed to write commit: %v", err)
+	}
+	if err := repostorage.WriteTree(repoPath, options, 0, tree); err != nil {
+		t.Fatalf("Failed to write tree: %v", err)
+	}
+	if err := repostorage.WriteHeadRef(repoPath, options, "master", 0); err != nil {
+		t.Fatalf("Failed to write head ref: %v", err)
+	}
+
+	service := NewService(repoBase)
+	commitID := 0
+
+	all, err := service.ListTree(repoID, &commitID, "", true)
+	if err != nil {
+		t.Fatalf("ListTree(recursive) failed: %v", err)
+	}
+	assertTree(t, "recursive", all, []string{"README.md", "docs/guide.md", "src/main.go", "src/pkg/util/run.sh", "src/pkg/util/strings.go"})
+	for _, e := range all {
+		if e.Type != "blob" || e.BlobID == "" {
+			t.Errorf("recursive: expected blob with ID, got %+v", e)
+		}
+	}
+
+	// Default (HEAD tip), one level
+	top, err := service.ListTree(repoID, nil, "", false)
+	if err != nil {
+		t.Fatalf("ListTree failed: %v", err)
+	}
+	assertTree(t, "top level", top, []string{"README.md", "docs", "src"})
+
+	src, err := service.ListTree(repoID, &commitID, "src/", false)
+	if err != nil {
+		t.Fatalf("ListTree(src) failed: %v", err)
+	}
+	assertTree(t, "src", src, []string{"src/main.go", "src/pkg"})
+
+	nested, err := service.ListTree(repoID, &commitID, "src/pkg", true)
+	if err != nil {
+		t.Fatalf("ListTree(src/pkg, recursive) failed: %v", err)
+	}
+	assertTree(t, "src/pkg recursive", nested, []string{"src/pkg/util/run.sh", "src/pkg/util/strings.go"})
+
+	missing := 42
+	if _, err := service.ListTree(repoID, &missing, "", true); !errors.Is(err, ErrCommitNotFound) {
+		t.Errorf("Expected ErrCommitNotFound, got %v", err)
+	}
+}
+
+func assertTree(t *testing.T, label string, entries []TreeEntry, want []string) {
+	t.Helper()
+	if len(entries) != len(want) {
+		t.Fatalf("%s: expected %d entries, got %d (%+v)", label, len(want), len(entries), entries)
+	}
+	for i, e := range entries {
+		if e.Path != want[i] {
+			t.Errorf("%s: position %d: expected %s, got %s", label, i, want[i], e.Path)
+		}
+	}
+}
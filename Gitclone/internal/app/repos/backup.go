@@ -0,0 +1,68 @@
+package repos
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	infrastorage "gitclone/internal/infra/storage"
+	"gitclone/internal/storage"
+)
+
+// ErrRepoExists is returned when restoring into a repository ID that is already taken.
+var ErrRepoExists = errors.New("repository already exists")
+
+// ErrInvalidRepoID is returned when a repository ID cannot be used as a directory name.
+var ErrInvalidRepoID = infrastorage.ErrInvalidRepoID
+
+// BackupPath returns the path of the repository's raw GitDb log file.
+func BackupPath(repoBase, repoID string) (string, error) {
+	repoPath, err := ResolveRepoPath(repoBase, repoID)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(repoPath, storage.RepoDir, "db", "log"), nil
+}
+
+// OpenBackup opens the repository's GitDb log for streaming.
+// The caller must close the returned file.
+func OpenBackup(repoBase, repoID string) (*os.File, error) {
+	logPath, err := BackupPath(repoBase, repoID)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(logPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repository log: %w", err)
+	}
+	return f, nil
+}
+
+// Restore creates repository repoID from a GitDb log produced by OpenBackup.
+// Only the database is restored; the working tree starts out empty.
+func Restore(repoBase, repoID string, log []byte) error {
+	if err := infrastorage.ValidateRepoID(repoID); err != nil {
+		return err
+	}
+
+	repoPath, err := filepath.Abs(filepath.Join(repoBase, repoID))
+	if err != nil {
+		return fmt.Errorf("failed to resolve absolute path for repo %s: %w", repoID, err)
+	}
+	if _, err := os.Stat(repoPath); err == nil {
+		return fmt.Errorf("%w: %s", ErrRepoExists, repoID)
+	}
+	if err := CheckNamespace(repoBase, repoID); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(repoPath, 0755); err != nil {
+		return fmt.Errorf("failed to create repository directory: %w", err)
+	}
+	if err := storage.RestoreRepo(repoPath, storage.InitOptions{Bare: false}, log); err != nil {
+		os.RemoveAll(repoPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package repos
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"gitclone/internal/app/branches"
+	"gitclone/internal/app/commits"
+	infrastorage "gitclone/internal/infra/storage"
+	"gitclone/internal/metadata"
+	"gitclone/internal/storage"
+)
+
+// TestBackupRestore verifies that a repository restored from its backup log
+// has the same branches and commits as the original.
+func TestBackupRestore(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-backup-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repoBase := filepath.Join(tmpDir, "repos")
+	repoID := "test-repo"
+	repoPath := filepath.Join(repoBase, repoID)
+
+	if err := os.MkdirAll(repoPath, 0755); err != nil {
+		t.Fatalf("Failed to create repo dir: %v", err)
+	}
+	if err := storage.InitRepo(repoPath, storage.InitOptions{Bare: false}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	metaStore, err := metadata.NewStore(filepath.Join(tmpDir, "db"))
+	if err != nil {
+		t.Fatalf("Failed to create metadata store: %v", err)
+	}
+	defer metaStore.Close()
+
+	commitSvc := commits.NewService(repoBase, metaStore)
+	branchSvc := branches.NewService(repoBase, metaStore)
+
+	// Commit and push on master, then create a second branch
+	if err := os.WriteFile(filepath.Join(repoPath, "file1.txt"), []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	repoStore, err := infrastorage.NewRepoStore(repoBase, repoID)
+	if err != nil {
+		t.Fatalf("Failed to open RepoStore: %v", err)
+	}
+	if _, err := storage.AddToIndexFromStore(context.Background(), repoStore, "file1.txt"); err != nil {
+		t.Fatalf("Failed to stage file: %v", err)
+	}
+	repoStore.Close()
+
+	if err := commitSvc.CreateCommit(context.Background(), repoID, "Initial commit"); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if _, err := commitSvc.PushCommits(context.Background(), repoID, "master", false); err != nil {
+		t.Fatalf("Failed to push: %v", err)
+	}
+	if err := branchSvc.Checkout(repoID, "feature"); err != nil {
+		t.Fatalf("Failed to checkout feature: %v", err)
+	}
+
+	// Back up
+	f, err := OpenBackup(repoBase, repoID)
+	if err != nil {
+		t.Fatalf("OpenBackup failed: %v", err)
+	}
+	backup, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		t.Fatalf("Failed to read backup: %v", err)
+	}
+
+	// Restore into a new repo ID
+	restoredID := "restored-repo"
+	if err := Restore(repoBase, restoredID, backup); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	wantBranches := branchNames(t, branchSvc, repoID)
+	gotBranches := branchNames(t, branchSvc, restoredID)
+	if len(gotBranches) != len(wantBranches) {
+		t.Fatalf("Branch mismatch: original=%v restored=%v", wantBranches, gotBranches)
+	}
+	for i := range wantBranches {
+		if gotBranches[i] != wantBranches[i] {
+			t.Fatalf("Branch mismatch: original=%v restored=%v", wantBranches, gotBranches)
+		}
+	}
+
+	wantCommits, err := commitSvc.ListCommits(context.Background(), repoID, "master", 100)
+	if err != nil {
+		t.Fatalf("ListCommits(original) failed: %v", err)
+	}
+	gotCommits, err := commitSvc.ListCommits(context.Background(), restoredID, "master", 100)
+	if err != nil {
+		t.Fatalf("ListCommits(restored) failed: %v", err)
+	}
+	if len(wantCommits) == 0 || len(gotCommits) != len(wantCommits) {
+		t.Fatalf("Commit count mismatch: original=%d restored=%d", len(wantCommits), len(gotCommits))
+	}
+	for i := range wantCommits {
+		if gotCommits[i].Hash != wantCommits[i].Hash || gotCommits[i].Message != wantCommits[i].Message {
+			t.Errorf("Commit %d mismatch: original=%+v restored=%+v", i, wantCommits[i], gotCommits[i])
+		}
+	}
+
+	// Restoring over an existing repo is rejected
+	if err := Restore(repoBase, restoredID, backup); !errors.Is(err, ErrRepoExists) {
+		t.Errorf("Expected ErrRepoExists, got %v", err)
+	}
+
+	// A truncated log is rejected and leaves nothing behind
+	if err := Restore(repoBase, "truncated", backup[:len(backup)-1]); !errors.Is(err, storage.ErrInvalidBackup) {
+		t.Errorf("Expected ErrInvalidBackup, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(repoBase, "truncated")); !os.IsNotExist(err) {
+		t.Errorf("Expected failed restore to be cleaned up, stat err: %v", err)
+	}
+}
+
+func branchNames(t *testing.T, svc *branches.Service, repoID string) []string {
+	t.Helper()
+	list, err := svc.ListBranches(repoID)
+	if err != nil {
+		t.Fatalf("ListBranches(%s) failed: %v", repoID, err)
+	}
+	names := make([]string, 0, len(list))
+	for _, b := range list {
+		names = append(names, b.Name)
+	}
+	sort.Strings(names)
+	return names
+}
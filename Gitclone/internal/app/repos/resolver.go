@@ -1,18 +1,35 @@
 package repos
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
+	infrastorage "gitclone/internal/infra/storage"
 	"gitclone/internal/storage"
 )
 
+// ErrRepoNotFound is returned when a repository ID has no repository on disk.
+var ErrRepoNotFound = infrastorage.ErrRepoNotFound
+
+// ErrNotARepo is returned when a repository ID's directory exists but isn't a
+// gitclone repository.
+var ErrNotARepo = infrastorage.ErrNotARepo
+
 // ResolveRepoPath resolves a repository ID to an absolute path and validates
 // that the repository exists and contains a .gitclone/ directory.
 // Returns the absolute path to the repository root on success, or an error
 // if the repository doesn't exist or is invalid.
 func ResolveRepoPath(repoBase, repoID string) (string, error) {
+	// Reject IDs that could escape the repo base (same rules as NewRepoStore)
+	if err := infrastorage.ValidateRepoID(repoID); err != nil {
+		return "", err
+	}
+
 	// Construct absolute path
 	repoPath := filepath.Join(repoBase, repoID)
 	absPath, err := filepath.Abs(repoPath)
@@ -24,19 +41,120 @@ func ResolveRepoPath(repoBase, repoID string) (string, error) {
 	info, err := os.Stat(absPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return "", fmt.Errorf("repository not found: %s", repoID)
+			return "", fmt.Errorf("%w: %s", ErrRepoNotFound, repoID)
 		}
 		return "", fmt.Errorf("failed to stat repository path: %w", err)
 	}
 	if !info.IsDir() {
-		return "", fmt.Errorf("repository path is not a directory: %s", repoID)
+		return "", fmt.Errorf("%w: %s is not a directory", ErrNotARepo, repoID)
 	}
 
 	// Validate that it contains .gitclone/
 	if !storage.InRepo(absPath, storage.InitOptions{Bare: false}) {
-		return "", fmt.Errorf("repository does not contain .gitclone/: %s", repoID)
+		return "", fmt.Errorf("%w: %s does not contain .gitclone/", ErrNotARepo, repoID)
 	}
 
 	return absPath, nil
 }
 
+
+// ErrNamespaceIsRepo is returned when the namespace of a namespaced repo ID is
+// itself a repository.
+var ErrNamespaceIsRepo = errors.New("namespace is an existing repository")
+
+// CheckNamespace returns ErrNamespaceIsRepo if repoID is namespaced and its
+// namespace directory is a repository, since a repo created there would sit
+// inside that repository's working tree.
+func CheckNamespace(repoBase, repoID string) error {
+	namespace, _, ok := strings.Cut(repoID, infrastorage.RepoNamespaceSep)
+	if !ok {
+		return nil
+	}
+	if storage.InRepo(filepath.Join(repoBase, namespace), storage.InitOptions{Bare: false}) {
+		return fmt.Errorf("%w: %s", ErrNamespaceIsRepo, namespace)
+	}
+	return nil
+}
+
+// Discover returns the IDs of the repositories under repoBase, sorted: each
+// directory holding a .gitclone/ directory, either directly under the base
+// ("name") or one level down in a namespace ("namespace/name"). A symlink to
+// a repository counts as one, but namespaces aren't followed through
+// symlinks. Entries that aren't repositories are skipped and logged, as are
+// entries that can't be read; the number of those is returned as failed.
+func Discover(repoBase string) (ids []string, failed int, err error) {
+	entries, err := os.ReadDir(repoBase)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read repo base: %w", err)
+	}
+
+	options := storage.InitOptions{Bare: false}
+	ids = make([]string, 0)
+	for _, entry := range entries {
+		dir := filepath.Join(repoBase, entry.Name())
+		if infrastorage.ValidateRepoID(entry.Name()) != nil {
+			log.Printf("DEBUG Discover: skipping %s: not a valid repo ID", dir)
+			continue
+		}
+		isDir, err := followDir(dir, entry)
+		if err != nil {
+			log.Printf("DEBUG Discover: skipping %s: %v", dir, err)
+			failed++
+			continue
+		}
+		if !isDir {
+			log.Printf("DEBUG Discover: skipping %s: not a directory", dir)
+			continue
+		}
+		if storage.InRepo(dir, options) {
+			ids = append(ids, entry.Name())
+			continue
+		}
+		if entry.Type()&os.ModeSymlink != 0 {
+			log.Printf("DEBUG Discover: skipping %s: symlink to a directory that isn't a repository", dir)
+			continue
+		}
+
+		// Not a repository itself, so possibly a namespace
+		children, err := os.ReadDir(dir)
+		if err != nil {
+			log.Printf("DEBUG Discover: skipping namespace %s: %v", dir, err)
+			failed++
+			continue
+		}
+		for _, child := range children {
+			childDir := filepath.Join(dir, child.Name())
+			id := entry.Name() + infrastorage.RepoNamespaceSep + child.Name()
+			if infrastorage.ValidateRepoID(id) != nil {
+				log.Printf("DEBUG Discover: skipping %s: not a valid repo ID", childDir)
+				continue
+			}
+			isDir, err := followDir(childDir, child)
+			if err != nil {
+				log.Printf("DEBUG Discover: skipping %s: %v", childDir, err)
+				failed++
+				continue
+			}
+			if !isDir || !storage.InRepo(childDir, options) {
+				log.Printf("DEBUG Discover: skipping %s: not a repository", childDir)
+				continue
+			}
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, failed, nil
+}
+
+// followDir reports whether entry, found at path, is a directory or a
+// symlink to one
+func followDir(path string, entry os.DirEntry) (bool, error) {
+	if entry.Type()&os.ModeSymlink == 0 {
+		return entry.IsDir(), nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to follow symlink: %w", err)
+	}
+	return info.IsDir(), nil
+}
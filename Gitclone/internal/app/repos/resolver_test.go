@@ -0,0 +1,161 @@
+package repos
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	infrastorage "gitclone/internal/infra/storage"
+	"gitclone/internal/storage"
+)
+
+// TestRepoIDValidationConsistent verifies that ResolveRepoPath and NewRepoStore
+// accept and reject the same repo IDs
+func TestRepoIDValidationConsistent(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-resolve-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repoBase := filepath.Join(tmpDir, "repos")
+	for _, id := range []string{"a", "b", "org/a"} {
+		repoPath := filepath.Join(repoBase, id)
+		if err := os.MkdirAll(repoPath, 0755); err != nil {
+			t.Fatalf("Failed to create repo dir: %v", err)
+		}
+		if err := storage.InitRepo(repoPath, storage.InitOptions{Bare: false}); err != nil {
+			t.Fatalf("Failed to init repo: %v", err)
+		}
+	}
+	// A repo at the base itself, so "." would resolve to something valid if allowed
+	if err := storage.InitRepo(repoBase, storage.InitOptions{Bare: false}); err != nil {
+		t.Fatalf("Failed to init base repo: %v", err)
+	}
+
+	tests := []struct {
+		id    string
+		valid bool
+	}{
+		{"a", true},
+		{"b", true},
+		{"missing", false},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"a/../b", false},
+		{"/a", false},
+		{"a/", false},
+		{"a\\b", false},
+		{" a", false},
+		{"org/a", true},
+		{"org/missing", false},
+		{"org", false},
+		{"org/a/b", false},
+		{"org//a", false},
+		{"org/..", false},
+	}
+
+	for _, tt := range tests {
+		_, resolveErr := ResolveRepoPath(repoBase, tt.id)
+
+		store, storeErr := infrastorage.NewRepoStore(repoBase, tt.id)
+		if store != nil {
+			store.Close()
+		}
+
+		if (resolveErr == nil) != (storeErr == nil) {
+			t.Errorf("id %q: ResolveRepoPath err=%v, NewRepoStore err=%v disagree", tt.id, resolveErr, storeErr)
+		}
+		if (resolveErr == nil) != tt.valid {
+			t.Errorf("id %q: expected valid=%v, got err=%v", tt.id, tt.valid, resolveErr)
+		}
+	}
+}
+
+// TestResolveRepoPathErrors checks that a missing repository and a directory
+// that isn't one are told apart, by ResolveRepoPath and NewRepoStore alike
+func TestResolveRepoPathErrors(t *testing.T) {
+	repoBase := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repoBase, "plain"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	tests := []struct {
+		id   string
+		want error
+	}{
+		{"missing", ErrRepoNotFound},
+		{"plain", ErrNotARepo},
+	}
+	for _, tt := range tests {
+		if _, err := ResolveRepoPath(repoBase, tt.id); !errors.Is(err, tt.want) {
+			t.Errorf("ResolveRepoPath(%q): expected %v, got %v", tt.id, tt.want, err)
+		}
+		store, err := infrastorage.NewRepoStore(repoBase, tt.id)
+		if store != nil {
+			store.Close()
+		}
+		if !errors.Is(err, tt.want) {
+			t.Errorf("NewRepoStore(%q): expected %v, got %v", tt.id, tt.want, err)
+		}
+		if tt.want == ErrNotARepo && errors.Is(err, ErrRepoNotFound) {
+			t.Errorf("NewRepoStore(%q): %v also reports the repository as missing", tt.id, err)
+		}
+	}
+}
+
+// TestDiscoverSymlinks checks that symlinked repositories are discovered, at
+// the base and in a namespace, that namespaces aren't followed through
+// symlinks, and that a broken symlink is counted as a failure
+func TestDiscoverSymlinks(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-discover-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repoBase := filepath.Join(tmpDir, "repos")
+	outside := filepath.Join(tmpDir, "elsewhere")
+	for _, dir := range []string{filepath.Join(repoBase, "plain"), filepath.Join(repoBase, "org"), filepath.Join(outside, "a"), filepath.Join(outside, "b"), filepath.Join(outside, "ns", "c")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	for _, dir := range []string{filepath.Join(repoBase, "plain"), filepath.Join(outside, "a"), filepath.Join(outside, "b"), filepath.Join(outside, "ns", "c")} {
+		if err := storage.InitRepo(dir, storage.InitOptions{Bare: false}); err != nil {
+			t.Fatalf("Failed to init %s: %v", dir, err)
+		}
+	}
+	for link, target := range map[string]string{
+		filepath.Join(repoBase, "linked"):   filepath.Join(outside, "a"),
+		filepath.Join(repoBase, "org", "b"): filepath.Join(outside, "b"),
+		filepath.Join(repoBase, "ns"):       filepath.Join(outside, "ns"),
+		filepath.Join(repoBase, "broken"):   filepath.Join(outside, "missing"),
+	} {
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatalf("Failed to create symlink %s: %v", link, err)
+		}
+	}
+
+	ids, failed, err := Discover(repoBase)
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	want := []string{"linked", "org/b", "plain"}
+	if len(ids) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, ids)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("Expected %v, got %v", want, ids)
+		}
+	}
+	if failed != 1 {
+		t.Errorf("Expected the broken symlink counted as 1 failure, got %d", failed)
+	}
+	if _, err := ResolveRepoPath(repoBase, "linked"); err != nil {
+		t.Errorf("Expected the symlinked repo to resolve, got %v", err)
+	}
+}
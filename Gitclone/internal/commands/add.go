@@ -23,30 +23,29 @@ func Add(args []string) {
 
 	options := storage.InitOptions{Bare: false}
 
-	// Get count of staged entries before adding
+	// Get staged entries before adding
 	entriesBefore, err := storage.GetIndexEntries(cwd, options)
 	if err != nil {
 		fmt.Println("Error:", err)
 		return
 	}
-	countBefore := len(entriesBefore)
 
-	// Stage the file(s)
-	if err := storage.AddToIndex(cwd, options, path); err != nil {
+	// Stage the file(s), and the removal of tracked files deleted from disk
+	changed, err := storage.AddToIndex(cwd, options, path)
+	if err != nil {
 		fmt.Println("Error:", err)
 		return
 	}
 
-	// Verify staging succeeded by checking entries after
+	// Read entries after to list the newly staged ones
 	entriesAfter, err := storage.GetIndexEntries(cwd, options)
 	if err != nil {
 		fmt.Println("Error:", err)
 		return
 	}
-	countAfter := len(entriesAfter)
 
 	// Check if anything was actually staged
-	if countAfter == countBefore {
+	if changed == 0 {
 		// Nothing was staged - this is an error
 		if path == "." {
 			fmt.Println("Error: No changes to stage. No files found or all files are already staged.")
@@ -58,7 +57,7 @@ func Add(args []string) {
 	}
 
 	// Success - show accurate staging information
-	stagedCount := countAfter - countBefore
+	stagedCount := changed
 	if stagedCount == 1 {
 		// Find the newly staged entry
 		for p := range entriesAfter {
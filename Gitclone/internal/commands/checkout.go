@@ -69,5 +69,13 @@ func Checkout(args []string) {
 		return
 	}
 
+	// Update the working tree to the target branch's files
+	// (tree ID equals commit ID)
+	if targetTip != nil {
+		if err := storage.MaterializeTree(cwd, options, *targetTip); err != nil {
+			fmt.Println("Warning: failed to update working tree:", err)
+		}
+	}
+
 	fmt.Printf("Switched to branch %s\n", targetBranch)
 }
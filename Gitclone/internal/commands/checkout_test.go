@@ -0,0 +1,86 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gitclone/internal/storage"
+)
+
+// TestCheckout_RestoresFileModes stages an executable and a regular file,
+// commits them, disturbs the working copies and checks the commit out again:
+// the executable comes back 0755 and the regular file 0644
+func TestCheckout_RestoresFileModes(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-cli-checkout-modes-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repoPath := filepath.Join(tmpDir, "cli-repo")
+	if err := os.MkdirAll(repoPath, 0755); err != nil {
+		t.Fatalf("Failed to create repo dir: %v", err)
+	}
+	options := storage.InitOptions{Bare: false}
+	if err := storage.InitRepo(repoPath, options); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	oldDir, _ := os.Getwd()
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoPath); err != nil {
+		t.Fatalf("Failed to chdir: %v", err)
+	}
+
+	scriptPath := filepath.Join(repoPath, "run.sh")
+	notesPath := filepath.Join(repoPath, "notes.txt")
+	if err := os.WriteFile(scriptPath, []byte("#!/bin/sh\necho hi\n"), 0755); err != nil {
+		t.Fatalf("Failed to write run.sh: %v", err)
+	}
+	if err := os.Chmod(scriptPath, 0755); err != nil {
+		t.Fatalf("Failed to chmod run.sh: %v", err)
+	}
+	if err := os.WriteFile(notesPath, []byte("notes\n"), 0644); err != nil {
+		t.Fatalf("Failed to write notes.txt: %v", err)
+	}
+	Add([]string{"."})
+	Commit([]string{"-m", "Add script and notes"})
+
+	tip, err := storage.ReadHeadRef(repoPath, options, "master")
+	if err != nil {
+		t.Fatalf("Failed to read master: %v", err)
+	}
+	tree, err := storage.ReadTree(repoPath, options, tip)
+	if err != nil {
+		t.Fatalf("Failed to read tree: %v", err)
+	}
+	modes := make(map[string]string)
+	for _, entry := range tree {
+		modes[entry.Path] = entry.Mode
+	}
+	if modes["run.sh"] != storage.ModeExecutable || modes["notes.txt"] != storage.ModeFile {
+		t.Fatalf("Expected run.sh %s and notes.txt %s in the tree, got %v", storage.ModeExecutable, storage.ModeFile, modes)
+	}
+
+	// Leave master, delete the script and make the notes executable
+	Checkout([]string{"feature"})
+	if err := os.Remove(scriptPath); err != nil {
+		t.Fatalf("Failed to remove run.sh: %v", err)
+	}
+	if err := os.Chmod(notesPath, 0755); err != nil {
+		t.Fatalf("Failed to chmod notes.txt: %v", err)
+	}
+
+	Checkout([]string{"master"})
+
+	for path, want := range map[string]os.FileMode{scriptPath: 0755, notesPath: 0644} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("%s not restored: %v", filepath.Base(path), err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("Expected %s restored as %v, got %v", filepath.Base(path), want, got)
+		}
+	}
+}
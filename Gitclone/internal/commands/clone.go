@@ -0,0 +1,102 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gitclone/internal/storage"
+)
+
+// Clone copies a repository into a new directory
+// Usage: gitclone clone <source repo path> <destination>
+func Clone(args []string) {
+	if len(args) != 2 {
+		fmt.Println("usage: gitclone clone <source repo path> <destination>")
+		return
+	}
+
+	branch, err := clone(args[0], args[1])
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	fmt.Printf("Cloned %s into %s, on branch %s\n", args[0], args[1], branch)
+}
+
+// clone creates a repository at dest from a copy of src's database. Every
+// branch of src becomes origin/<branch> in the clone, the index starts out
+// empty and the default branch is checked out. It returns that branch.
+func clone(src, dest string) (string, error) {
+	options := storage.InitOptions{Bare: false}
+	if !storage.InRepo(src, options) {
+		return "", fmt.Errorf("%s is not a gitclone repository", src)
+	}
+	if entries, err := os.ReadDir(dest); err == nil && len(entries) > 0 {
+		return "", fmt.Errorf("destination %s already exists and is not empty", dest)
+	} else if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	log, err := os.ReadFile(filepath.Join(src, storage.RepoDir, "db", "log"))
+	if err != nil {
+		return "", fmt.Errorf("failed to read source repository: %w", err)
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return "", fmt.Errorf("failed to create destination: %w", err)
+	}
+	branch, err := setUpClone(dest, options, log)
+	if err != nil {
+		// Leave nothing half-cloned behind
+		os.RemoveAll(filepath.Join(dest, storage.RepoDir))
+		return "", err
+	}
+	return branch, nil
+}
+
+// setUpClone writes the copied log to dest and turns it into a fresh clone
+func setUpClone(dest string, options storage.InitOptions, log []byte) (string, error) {
+	if err := storage.RestoreRepo(dest, options, log); err != nil {
+		return "", err
+	}
+
+	branches, err := storage.ListBranches(dest, options)
+	if err != nil {
+		return "", err
+	}
+	for _, branch := range branches {
+		tip, err := storage.ReadHeadRefMaybe(dest, options, branch)
+		if err != nil {
+			return "", err
+		}
+		if tip == nil {
+			continue
+		}
+		if err := storage.WriteRemoteRef(dest, options, branch, *tip); err != nil {
+			return "", err
+		}
+	}
+
+	// Changes staged in the source aren't part of its history
+	if err := storage.ClearIndex(dest, options); err != nil {
+		return "", err
+	}
+
+	branch, err := storage.ReadDefaultBranch(dest, options)
+	if err != nil {
+		return "", err
+	}
+	if err := storage.WriteHEADBranch(dest, options, branch); err != nil {
+		return "", err
+	}
+	tip, err := storage.ReadHeadRefMaybe(dest, options, branch)
+	if err != nil {
+		return "", err
+	}
+	if tip != nil {
+		if err := storage.MaterializeTree(dest, options, *tip); err != nil {
+			return "", fmt.Errorf("failed to check out %s: %w", branch, err)
+		}
+	}
+	return branch, nil
+}
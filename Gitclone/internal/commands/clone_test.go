@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gitclone/internal/storage"
+)
+
+// TestClone clones a repository with two commits and a staged change: the
+// clone has the same commits, origin refs at the source's branches, the
+// default branch's files checked out and nothing staged
+func TestClone(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-clone-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	srcPath := filepath.Join(tmpDir, "src")
+	if err := os.MkdirAll(srcPath, 0755); err != nil {
+		t.Fatalf("Failed to create repo dir: %v", err)
+	}
+	options := storage.InitOptions{Bare: false}
+	if err := storage.InitRepo(srcPath, options); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	oldDir, _ := os.Getwd()
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(srcPath); err != nil {
+		t.Fatalf("Failed to chdir: %v", err)
+	}
+	for _, file := range []struct{ name, content string }{{"a.txt", "one\n"}, {"docs/b.txt", "two\n"}} {
+		if err := os.MkdirAll(filepath.Dir(file.name), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(file.name, []byte(file.content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", file.name, err)
+		}
+		Add([]string{file.name})
+		Commit([]string{"-m", "Add " + file.name})
+	}
+	if err := os.WriteFile("staged.txt", []byte("wip\n"), 0644); err != nil {
+		t.Fatalf("Failed to write staged.txt: %v", err)
+	}
+	Add([]string{"staged.txt"})
+	if err := os.Chdir(oldDir); err != nil {
+		t.Fatalf("Failed to chdir: %v", err)
+	}
+
+	srcTip, err := storage.ReadHeadRef(srcPath, options, "master")
+	if err != nil {
+		t.Fatalf("Failed to read source master: %v", err)
+	}
+
+	if _, err := clone(filepath.Join(tmpDir, "missing"), filepath.Join(tmpDir, "nowhere")); err == nil {
+		t.Errorf("Expected cloning a non-repository to fail")
+	}
+
+	destPath := filepath.Join(tmpDir, "dest")
+	branch, err := clone(srcPath, destPath)
+	if err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+	if branch != "master" {
+		t.Errorf("Expected master checked out, got %s", branch)
+	}
+	if _, err := clone(srcPath, destPath); err == nil {
+		t.Errorf("Expected cloning into a non-empty directory to fail")
+	}
+
+	if tip, _ := storage.ReadHeadRefMaybe(destPath, options, "master"); tip == nil || *tip != srcTip {
+		t.Errorf("Expected master at %d, got %v", srcTip, tip)
+	}
+	if remote, _ := storage.ReadRemoteRef(destPath, options, "master"); remote == nil || *remote != srcTip {
+		t.Errorf("Expected origin/master at %d, got %v", srcTip, remote)
+	}
+	commit, err := storage.ReadCommitObject(destPath, options, srcTip)
+	if err != nil {
+		t.Fatalf("Failed to read the cloned tip: %v", err)
+	}
+	if commit.Parent == nil {
+		t.Fatalf("Expected the cloned tip to have a parent")
+	}
+	if _, err := storage.ReadCommitObject(destPath, options, *commit.Parent); err != nil {
+		t.Errorf("Expected the first commit in the clone: %v", err)
+	}
+
+	for name, want := range map[string]string{"a.txt": "one\n", "docs/b.txt": "two\n"} {
+		got, err := os.ReadFile(filepath.Join(destPath, name))
+		if err != nil || string(got) != want {
+			t.Errorf("Expected %s checked out as %q, got %q (%v)", name, want, got, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(destPath, "staged.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected the source's staged file not to be checked out, got %v", err)
+	}
+	if staged, err := storage.HasStagedEntries(destPath, options); err != nil || staged {
+		t.Errorf("Expected an empty index in the clone, got staged=%v (%v)", staged, err)
+	}
+}
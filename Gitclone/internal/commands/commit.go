@@ -1,23 +1,38 @@
 package commands
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
+	"gitclone/internal/app/commits"
+	infrastorage "gitclone/internal/infra/storage"
 	"gitclone/internal/storage"
 )
 
+// Commit records the staged changes as a new commit on the current branch
+// Usage: gitclone commit -m "message" [--keep-index] or gitclone commit --amend [-m "message"] [--force]
+// The index is cleared after committing unless --keep-index is given.
 func Commit(args []string) {
 	msg := ""
+	amend, force, keepIndex := false, false, false
 
 	//Check for message tag
 	for i := 0; i < len(args); i++ {
-		if args[i] == "-m" && i+1 < len(args) {
+		switch {
+		case args[i] == "-m" && i+1 < len(args):
 			msg = args[i+1]
+		case args[i] == "--amend":
+			amend = true
+		case args[i] == "--force":
+			force = true
+		case args[i] == "--keep-index":
+			keepIndex = true
 		}
 	}
-	if msg == "" {
+	if msg == "" && !amend {
 		fmt.Println("usage: gitclone commit -m \"message\"")
 		return
 	}
@@ -28,10 +43,20 @@ func Commit(args []string) {
 		return
 	}
 
-	options := storage.InitOptions{Bare: false}
+	if amend {
+		amendCommit(cwd, msg, force)
+		return
+	}
+
+	repoStore, err := infrastorage.NewRepoStore(filepath.Dir(cwd), filepath.Base(cwd))
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	defer repoStore.Close()
 
 	// Check if there are staged entries
-	hasStaged, err := storage.HasStagedEntries(cwd, options)
+	hasStaged, err := storage.HasStagedEntriesFromStore(repoStore)
 	if err != nil {
 		fmt.Println("Error:", err)
 		return
@@ -41,35 +66,48 @@ func Commit(args []string) {
 		return
 	}
 
-	branch, err := storage.ReadHEADBranch(cwd, options)
+	branch, id, err := commitStaged(repoStore, msg, keepIndex)
 	if err != nil {
 		fmt.Println("Error:", err)
 		return
 	}
 
-	// Read current branch tip to determine parent commit
-	parentPtr, err := storage.ReadHeadRefMaybe(cwd, options, branch)
+	fmt.Printf("[%s %d] %s\n", branch, id, msg)
+}
+
+// commitStaged records the staged changes as a new commit on the current
+// branch. The commit object, its tree, the branch ref and the cleared index
+// are written in one batch, so a failure part way leaves the branch and the
+// index as they were. Only the allocated commit ID is lost. With keepIndex
+// the index is left as it is.
+func commitStaged(repoStore *infrastorage.RepoStore, msg string, keepIndex bool) (string, int, error) {
+	parentPtr, branch, err := storage.ResolveHead(repoStore)
 	if err != nil {
-		fmt.Println("Error:", err)
-		return
+		return "", 0, err
+	}
+	if branch == "" {
+		return "", 0, fmt.Errorf("cannot commit: %w", storage.ErrDetachedHead)
 	}
 
-	// Allocate new commit ID
-	id, err := storage.NextCommitID(cwd, options)
+	entries, err := storage.GetIndexEntriesFromStore(repoStore)
 	if err != nil {
-		fmt.Println("Error:", err)
-		return
+		return "", 0, err
 	}
 
-	// Build tree from index (use commit ID as tree ID for simplicity)
-	if err := storage.BuildTreeFromIndex(cwd, options, id); err != nil {
-		fmt.Println("Error:", err)
-		return
+	// Build tree from index on top of the parent's tree
+	var parentTree []storage.TreeEntry
+	if parentPtr != nil {
+		if parentTree, err = storage.ReadTreeMaybeFromStore(repoStore, *parentPtr); err != nil {
+			return "", 0, err
+		}
 	}
+	tree := storage.ApplyIndexToTree(parentTree, entries)
 
-	// Create commit object
-	// Note: In a full implementation, commit would reference the tree ID
-	// For now, we use the commit ID as the tree ID
+	// Allocate new commit ID (use commit ID as tree ID for simplicity)
+	id, err := storage.NextCommitIDFromStore(repoStore)
+	if err != nil {
+		return "", 0, err
+	}
 	commit := storage.Commit{
 		ID:        id,
 		Message:   msg,
@@ -78,22 +116,54 @@ func Commit(args []string) {
 		Parent:    parentPtr,
 	}
 
-	// Write commit object to disk
-	if err := storage.WriteCommitObject(cwd, options, commit); err != nil {
+	batch := repoStore.NewWriteBatch()
+	if err := storage.WriteCommitObjectToBatch(batch, commit, tree); err != nil {
+		return "", 0, err
+	}
+	if err := storage.WriteTreeToBatch(batch, id, tree); err != nil {
+		return "", 0, err
+	}
+	if err := storage.WriteHeadRefToBatch(batch, branch, id); err != nil {
+		return "", 0, err
+	}
+	if !keepIndex {
+		if err := storage.ClearIndexToBatch(batch, repoStore); err != nil {
+			return "", 0, err
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		return "", 0, err
+	}
+	if !keepIndex {
+		// The commit is written; cleared entries left behind are removed by
+		// the next commit
+		if _, err := storage.CompactIndex(repoStore); err != nil {
+			fmt.Println("Warning: failed to compact index:", err)
+		}
+	}
+	return branch, id, nil
+}
+
+// amendCommit replaces the current branch's tip with the staged changes and
+// msg added, using the same code path as the server
+func amendCommit(cwd, msg string, force bool) {
+	svc := commits.NewService(filepath.Dir(cwd), nil)
+	stats, err := svc.AmendCommit(filepath.Base(cwd), msg, force)
+	if errors.Is(err, commits.ErrAlreadyPushed) {
 		fmt.Println("Error:", err)
+		fmt.Println("Use --force to amend it anyway; it then takes gitclone push --force to replace it on origin.")
 		return
 	}
-
-	// Update branch ref to point to new commit
-	if err := storage.WriteHeadRef(cwd, options, branch, id); err != nil {
+	if err != nil {
 		fmt.Println("Error:", err)
 		return
 	}
 
-	// Clear index after successful commit
-	if err := storage.ClearIndex(cwd, options); err != nil {
-		fmt.Printf("Warning: failed to clear index: %v\n", err)
+	branch, _ := storage.ReadHEADBranch(cwd, storage.InitOptions{Bare: false})
+	commit, err := storage.ReadCommitObject(cwd, storage.InitOptions{Bare: false}, stats.CommitID)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
 	}
-
-	fmt.Printf("[%s %d] %s\n", branch, id, msg)
+	fmt.Printf("[%s %d] %s (amended)\n", branch, stats.CommitID, commit.Message)
 }
@@ -0,0 +1,183 @@
+package commands
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"GitDb"
+	infrastorage "gitclone/internal/infra/storage"
+	"gitclone/internal/storage"
+)
+
+// errInjected is the write failure faultyKV injects
+var errInjected = errors.New("injected write failure")
+
+// faultyKV fails writes to keys with prefix once armed
+type faultyKV struct {
+	GitDb.KV
+	armed  bool
+	prefix string
+}
+
+func (kv *faultyKV) Put(key string, value []byte) error {
+	if kv.armed && strings.HasPrefix(key, kv.prefix) {
+		return errInjected
+	}
+	return kv.KV.Put(key, value)
+}
+
+// TestCommitStaged_FailureLeavesRefAndIndex verifies that when a commit fails
+// after its tree has been written, the branch ref and the staged index are
+// unchanged
+func TestCommitStaged_FailureLeavesRefAndIndex(t *testing.T) {
+	kv := &faultyKV{KV: GitDb.NewMemDB(), prefix: "refs/heads/"}
+	store, err := infrastorage.NewRepoStoreWithKV("cli-repo", "/nonexistent/cli-repo", kv)
+	if err != nil {
+		t.Fatalf("Failed to open RepoStore: %v", err)
+	}
+	if err := storage.InitRepoStore(store, storage.InitOptions{}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	if err := storage.StageContentFromStore(store, "a.txt", []byte("one")); err != nil {
+		t.Fatalf("Failed to stage a.txt: %v", err)
+	}
+	_, first, err := commitStaged(store, "first", false)
+	if err != nil {
+		t.Fatalf("First commit failed: %v", err)
+	}
+
+	if err := storage.StageContentFromStore(store, "b.txt", []byte("two")); err != nil {
+		t.Fatalf("Failed to stage b.txt: %v", err)
+	}
+	kv.armed = true
+	if _, _, err := commitStaged(store, "second", false); !errors.Is(err, errInjected) {
+		t.Fatalf("Expected the injected failure, got %v", err)
+	}
+	kv.armed = false
+
+	tip, err := storage.ReadHeadRefMaybeFromStore(store, "master")
+	if err != nil {
+		t.Fatalf("Failed to read master: %v", err)
+	}
+	if tip == nil || *tip != first {
+		t.Errorf("Expected master to stay at %d, got %v", first, tip)
+	}
+	staged, err := storage.GetStagedFilesFromStore(store)
+	if err != nil {
+		t.Fatalf("Failed to read index: %v", err)
+	}
+	if len(staged) != 1 || staged[0] != "b.txt" {
+		t.Errorf("Expected b.txt to stay staged, got %v", staged)
+	}
+}
+
+// TestCommitStaged_KeepIndex checks that keepIndex leaves the committed
+// entries staged
+func TestCommitStaged_KeepIndex(t *testing.T) {
+	store, err := infrastorage.NewRepoStoreWithKV("cli-repo", "/nonexistent/cli-repo", GitDb.NewMemDB())
+	if err != nil {
+		t.Fatalf("Failed to open RepoStore: %v", err)
+	}
+	if err := storage.InitRepoStore(store, storage.InitOptions{}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	if err := storage.StageContentFromStore(store, "a.txt", []byte("one")); err != nil {
+		t.Fatalf("Failed to stage a.txt: %v", err)
+	}
+	if _, _, err := commitStaged(store, "first", true); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	staged, err := storage.GetStagedFilesFromStore(store)
+	if err != nil {
+		t.Fatalf("Failed to read index: %v", err)
+	}
+	if len(staged) != 1 || staged[0] != "a.txt" {
+		t.Errorf("Expected a.txt to stay staged, got %v", staged)
+	}
+}
+
+// TestCommitStaged_DeletedOnDisk deletes committed files on disk and checks
+// add stages their removal, for the whole repository and for a directory
+func TestCommitStaged_DeletedOnDisk(t *testing.T) {
+	repoBase := t.TempDir()
+	repoPath := filepath.Join(repoBase, "cli-repo")
+	if err := os.MkdirAll(filepath.Join(repoPath, "dir"), 0755); err != nil {
+		t.Fatalf("Failed to create repo dir: %v", err)
+	}
+	options := storage.InitOptions{Bare: false}
+	if err := storage.InitRepo(repoPath, options); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+	for _, path := range []string{"a.txt", "keep.txt", "dir/b.txt"} {
+		if err := os.WriteFile(filepath.Join(repoPath, path), []byte(path), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	// add, then commit through a fresh store as `gitclone commit` does
+	addAndCommit := func(path, message string) []string {
+		t.Helper()
+		if _, err := storage.AddToIndex(repoPath, options, path); err != nil {
+			t.Fatalf("Failed to add %s: %v", path, err)
+		}
+		store, err := infrastorage.NewRepoStore(repoBase, "cli-repo")
+		if err != nil {
+			t.Fatalf("Failed to open RepoStore: %v", err)
+		}
+		defer store.Close()
+		_, id, err := commitStaged(store, message, false)
+		if err != nil {
+			t.Fatalf("Commit %q failed: %v", message, err)
+		}
+		tree, err := storage.ReadTreeMaybeFromStore(store, id)
+		if err != nil {
+			t.Fatalf("Failed to read tree: %v", err)
+		}
+		var paths []string
+		for _, entry := range tree {
+			if entry.Type != "tree" {
+				paths = append(paths, entry.Path)
+			}
+		}
+		sort.Strings(paths)
+		return paths
+	}
+
+	addAndCommit(".", "Add files")
+
+	// A file staged but never committed is simply unstaged
+	newPath := filepath.Join(repoPath, "new.txt")
+	if err := os.WriteFile(newPath, []byte("new"), 0644); err != nil {
+		t.Fatalf("Failed to write new.txt: %v", err)
+	}
+	if _, err := storage.AddToIndex(repoPath, options, "new.txt"); err != nil {
+		t.Fatalf("Failed to add new.txt: %v", err)
+	}
+	if err := os.Remove(newPath); err != nil {
+		t.Fatalf("Failed to delete new.txt: %v", err)
+	}
+	if err := os.Remove(filepath.Join(repoPath, "a.txt")); err != nil {
+		t.Fatalf("Failed to delete a.txt: %v", err)
+	}
+	if paths := addAndCommit(".", "Delete a"); strings.Join(paths, ",") != "dir/b.txt,keep.txt" {
+		t.Errorf("Expected a.txt gone from the tree, got %v", paths)
+	}
+
+	if err := os.RemoveAll(filepath.Join(repoPath, "dir")); err != nil {
+		t.Fatalf("Failed to delete dir: %v", err)
+	}
+	if paths := addAndCommit("dir", "Delete dir"); strings.Join(paths, ",") != "keep.txt" {
+		t.Errorf("Expected dir gone from the tree, got %v", paths)
+	}
+
+	// Nothing is tracked there any more
+	if _, err := storage.AddToIndex(repoPath, options, "dir"); err == nil {
+		t.Errorf("Expected adding a path that was never there to fail")
+	}
+}
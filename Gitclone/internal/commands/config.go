@@ -0,0 +1,61 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	infrastorage "gitclone/internal/infra/storage"
+	"gitclone/internal/storage"
+)
+
+// Config reads or sets a repository setting
+// Usage: gitclone config [<name> [<value>]]
+// With no arguments it prints every setting.
+func Config(args []string) {
+	if len(args) > 2 {
+		fmt.Println("usage: gitclone config [<name> [<value>]]")
+		return
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	repoStore, err := infrastorage.NewRepoStore(filepath.Dir(cwd), filepath.Base(cwd))
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	defer repoStore.Close()
+
+	switch len(args) {
+	case 0:
+		for _, name := range storage.ConfigSettings() {
+			value, err := storage.ReadConfigFromStore(repoStore, name)
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			fmt.Printf("%s=%s\n", name, value)
+		}
+	case 1:
+		value, err := storage.ReadConfigFromStore(repoStore, args[0])
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		fmt.Println(value)
+	case 2:
+		batch := repoStore.NewWriteBatch()
+		if err := storage.WriteConfigToBatch(batch, args[0], args[1]); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if err := batch.Commit(); err != nil {
+			fmt.Println("Error:", err)
+		}
+	}
+}
@@ -0,0 +1,7 @@
+// Package commands implements the gitclone CLI subcommands.
+//
+// Commands operate on the repository in the process working directory and
+// report to stdout, so they are not safe for concurrent use and must not be
+// called from the HTTP server, whose handlers run in parallel. Server code
+// goes through the app services, which take repository paths explicitly.
+package commands
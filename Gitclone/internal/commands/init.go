@@ -3,14 +3,16 @@ package commands
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"gitclone/internal/storage"
 )
 
-// It supports an optional `--bare`
+// It supports an optional `--bare` and `--initial-branch <name>` (or `-b <name>`)
 
 // gitclone init
 // gitclone init --bare
+// gitclone init --initial-branch main
 func Init(args []string) {
 	cwd, err := os.Getwd()
 	if err != nil {
@@ -21,9 +23,19 @@ func Init(args []string) {
 	options := storage.InitOptions{Bare: false}
 
 	// if "--bare" is present, set Bare = true.
-	for _, a := range args {
-		if a == "--bare" {
+	for i := 0; i < len(args); i++ {
+		switch a := args[i]; {
+		case a == "--bare":
 			options.Bare = true
+		case a == "--initial-branch" || a == "-b":
+			if i+1 >= len(args) {
+				fmt.Println("usage: gitclone init [--bare] [--initial-branch <name>]")
+				return
+			}
+			i++
+			options.InitialBranch = args[i]
+		case strings.HasPrefix(a, "--initial-branch="):
+			options.InitialBranch = strings.TrimPrefix(a, "--initial-branch=")
 		}
 	}
 
@@ -2,73 +2,174 @@ package commands
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"gitclone/internal/storage"
 )
 
+// maxLogWalk bounds how many commits a single log invocation will read
+const maxLogWalk = 10000
+
+// logOptions holds the parsed flags for the log command
+type logOptions struct {
+	limit int   // max commits to print; 0 means no limit
+	since int64 // only commits at or after this unix time; 0 means no bound
+	until int64 // only commits at or before this unix time; 0 means no bound
+}
+
+// Log prints the history of the current branch
+// Usage: gitclone log [-n <count>] [--since <time>] [--until <time>]
+// Times are unix seconds, YYYY-MM-DD or RFC3339.
 func Log(args []string) {
-	cwd, err := os.Getwd()
+	opts, err := parseLogArgs(args)
 	if err != nil {
 		fmt.Println("Error:", err)
+		fmt.Println("usage: gitclone log [-n <count>] [--since <time>] [--until <time>]")
 		return
 	}
 
-	opts := storage.InitOptions{Bare: false}
-
-	branch, err := storage.ReadHEADBranch(cwd, opts)
+	cwd, err := os.Getwd()
 	if err != nil {
 		fmt.Println("Error:", err)
 		return
 	}
 
-	tipPtr, err := storage.ReadHeadRefMaybe(cwd, opts, branch)
-	if err != nil {
+	if err := printLog(os.Stdout, cwd, opts); err != nil {
 		fmt.Println("Error:", err)
-		return
+	}
+}
+
+// parseLogArgs parses the log command flags
+func parseLogArgs(args []string) (logOptions, error) {
+	var opts logOptions
+	for i := 0; i < len(args); i++ {
+		if i+1 >= len(args) {
+			return opts, fmt.Errorf("missing value for %s", args[i])
+		}
+		value := args[i+1]
+		switch args[i] {
+		case "-n":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return opts, fmt.Errorf("-n must be a positive number")
+			}
+			opts.limit = n
+		case "--since":
+			t, err := parseLogTime(value)
+			if err != nil {
+				return opts, err
+			}
+			opts.since = t
+		case "--until":
+			t, err := parseLogTime(value)
+			if err != nil {
+				return opts, err
+			}
+			opts.until = t
+		default:
+			return opts, fmt.Errorf("unknown flag: %s", args[i])
+		}
+		i++
+	}
+	return opts, nil
+}
+
+// parseLogTime accepts unix seconds, YYYY-MM-DD or RFC3339
+func parseLogTime(value string) (int64, error) {
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return n, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.Unix(), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t.Unix(), nil
+	}
+	return 0, fmt.Errorf("invalid time: %q", value)
+}
+
+// printLog writes the current branch's history to w, honoring opts
+func printLog(w io.Writer, cwd string, opts logOptions) error {
+	storeOpts := storage.InitOptions{Bare: false}
+
+	branch, err := storage.ReadHEADBranch(cwd, storeOpts)
+	if err != nil {
+		return err
+	}
+
+	tipPtr, err := storage.ReadHeadRefMaybe(cwd, storeOpts, branch)
+	if err != nil {
+		return err
 	}
 	if tipPtr == nil {
-		fmt.Printf("On branch %s (no commits)\n", branch)
-		return
+		fmt.Fprintf(w, "On branch %s (no commits)\n", branch)
+		return nil
 	}
 
-	fmt.Printf("== log (%s) ==\n", branch)
+	fmt.Fprintf(w, "== log (%s) ==\n", branch)
 
 	id := *tipPtr
-	for {
-		c, err := storage.ReadCommitObject(cwd, opts, id)
+	printed := 0
+	seen := make(map[int]bool)
+	for walked := 0; walked < maxLogWalk; walked++ {
+		if seen[id] {
+			return fmt.Errorf("%w at commit %d", storage.ErrCommitCycle, id)
+		}
+		seen[id] = true
+		c, err := storage.ReadCommitObject(cwd, storeOpts, id)
 		if err != nil {
-			fmt.Println("Error:", err)
-			return
+			return err
 		}
 
-		fmt.Printf("commit %d\n", c.ID)
-		if c.Parent != nil {
-			fmt.Printf("parent %d\n", *c.Parent)
+		// History is newest first: stop once we're past the --since bound
+		if opts.since != 0 && c.Timestamp < opts.since {
+			return nil
 		}
-		if c.Parent2 != nil {
-			fmt.Printf("parent2 %d\n", *c.Parent2)
+
+		if opts.until == 0 || c.Timestamp <= opts.until {
+			fmt.Fprintf(w, "commit %d\n", c.ID)
+			if c.Parent != nil {
+				fmt.Fprintf(w, "parent %d\n", *c.Parent)
+			}
+			if c.Parent2 != nil {
+				fmt.Fprintf(w, "parent2 %d\n", *c.Parent2)
+			}
+			fmt.Fprintf(w, "branch %s\n", c.Branch)
+			fmt.Fprintf(w, "message %s\n\n", c.Message)
+
+			printed++
+			if opts.limit > 0 && printed >= opts.limit {
+				return nil
+			}
 		}
-		fmt.Printf("branch %s\n", c.Branch)
-		fmt.Printf("message %s\n\n", c.Message)
 
 		if c.Parent == nil {
-			break
+			return nil
 		}
 		id = *c.Parent
 	}
+
+	fmt.Fprintf(w, "(stopped after %d commits)\n", maxLogWalk)
+	return nil
 }
 
-func Show(args []string) {
-	if len(args) < 1 {
-		fmt.Println("usage: gitclone show <id>")
-		return
-	}
+// showOptions holds the parsed arguments of the show command
+type showOptions struct {
+	id       int
+	nameOnly bool // list changed paths without their status
+}
 
-	id, err := strconv.Atoi(args[0])
+// Show prints a commit and the files it changed against its first parent
+// Usage: gitclone show [--name-only] <id>
+func Show(args []string) {
+	opts, err := parseShowArgs(args)
 	if err != nil {
-		fmt.Println("Error: id must be a number")
+		fmt.Println("Error:", err)
+		fmt.Println("usage: gitclone show [--name-only] <id>")
 		return
 	}
 
@@ -78,21 +179,85 @@ func Show(args []string) {
 		return
 	}
 
-	opts := storage.InitOptions{Bare: false}
+	if err := printShow(os.Stdout, cwd, opts); err != nil {
+		fmt.Println("Error:", err)
+	}
+}
 
-	c, err := storage.ReadCommitObject(cwd, opts, id)
+// parseShowArgs parses the show command arguments
+func parseShowArgs(args []string) (showOptions, error) {
+	var opts showOptions
+	var ids []string
+	for _, arg := range args {
+		switch {
+		case arg == "--name-only":
+			opts.nameOnly = true
+		case strings.HasPrefix(arg, "-"):
+			return opts, fmt.Errorf("unknown flag: %s", arg)
+		default:
+			ids = append(ids, arg)
+		}
+	}
+	if len(ids) != 1 {
+		return opts, fmt.Errorf("expected one commit id")
+	}
+	id, err := strconv.Atoi(ids[0])
 	if err != nil {
-		fmt.Println("Error:", err)
-		return
+		return opts, fmt.Errorf("id must be a number")
 	}
+	opts.id = id
+	return opts, nil
+}
 
-	fmt.Printf("commit %d\n", c.ID)
+// showStatus abbreviates a TreeChange status for show's file list
+var showStatus = map[string]string{
+	storage.ChangeAdded:    "A",
+	storage.ChangeModified: "M",
+	storage.ChangeRemoved:  "D",
+}
+
+// printShow writes commit opts.id to w, followed by the files it changed
+// against its first parent. A root commit lists all its files as added.
+func printShow(w io.Writer, cwd string, opts showOptions) error {
+	storeOpts := storage.InitOptions{Bare: false}
+
+	c, err := storage.ReadCommitObject(cwd, storeOpts, opts.id)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "commit %d\n", c.ID)
 	if c.Parent != nil {
-		fmt.Printf("parent %d\n", *c.Parent)
+		fmt.Fprintf(w, "parent %d\n", *c.Parent)
 	}
 	if c.Parent2 != nil {
-		fmt.Printf("parent2 %d\n", *c.Parent2)
+		fmt.Fprintf(w, "parent2 %d\n", *c.Parent2)
+	}
+	fmt.Fprintf(w, "branch %s\n", c.Branch)
+	fmt.Fprintf(w, "message %s\n", c.Message)
+
+	// A commit's tree is stored under its own ID
+	tree, err := storage.ReadTreeMaybe(cwd, storeOpts, c.ID)
+	if err != nil {
+		return err
+	}
+	var parentTree []storage.TreeEntry
+	if c.Parent != nil {
+		if parentTree, err = storage.ReadTreeMaybe(cwd, storeOpts, *c.Parent); err != nil {
+			return err
+		}
+	}
+
+	changes := storage.DiffTrees(parentTree, tree)
+	if len(changes) > 0 {
+		fmt.Fprintln(w)
+	}
+	for _, change := range changes {
+		if opts.nameOnly {
+			fmt.Fprintln(w, change.Path)
+		} else {
+			fmt.Fprintf(w, "%s\t%s\n", showStatus[change.Status], change.Path)
+		}
 	}
-	fmt.Printf("branch %s\n", c.Branch)
-	fmt.Printf("message %s\n", c.Message)
+	return nil
 }
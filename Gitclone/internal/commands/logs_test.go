@@ -0,0 +1,179 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"gitclone/internal/storage"
+)
+
+// writeLinearHistory writes commits 0..len(timestamps)-1 on master, each the
+// parent of the next, and points master at the last one
+func writeLinearHistory(t *testing.T, root string, timestamps []int64) {
+	t.Helper()
+	options := storage.InitOptions{Bare: false}
+	for id, ts := range timestamps {
+		commit := storage.Commit{ID: id, Message: "commit", Branch: "master", Timestamp: ts}
+		if id > 0 {
+			parent := id - 1
+			commit.Parent = &parent
+		}
+		if err := storage.WriteCommitObject(root, options, commit); err != nil {
+			t.Fatalf("Failed to write commit %d: %v", id, err)
+		}
+	}
+	if err := storage.WriteHeadRef(root, options, "master", len(timestamps)-1); err != nil {
+		t.Fatalf("Failed to write head ref: %v", err)
+	}
+}
+
+func TestPrintLog_LimitAndTimeWindow(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-log-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := storage.InitRepo(tmpDir, storage.InitOptions{Bare: false}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+	writeLinearHistory(t, tmpDir, []int64{100, 200, 300, 400})
+
+	tests := []struct {
+		name string
+		args []string
+		want []string // commit lines in order
+	}{
+		{"no flags", nil, []string{"commit 3", "commit 2", "commit 1", "commit 0"}},
+		{"-n 2", []string{"-n", "2"}, []string{"commit 3", "commit 2"}},
+		{"since", []string{"--since", "200"}, []string{"commit 3", "commit 2", "commit 1"}},
+		{"until", []string{"--until", "300"}, []string{"commit 2", "commit 1", "commit 0"}},
+		{"window and limit", []string{"--since", "100", "--until", "300", "-n", "1"}, []string{"commit 2"}},
+	}
+
+	for _, tt := range tests {
+		opts, err := parseLogArgs(tt.args)
+		if err != nil {
+			t.Fatalf("%s: parseLogArgs failed: %v", tt.name, err)
+		}
+
+		var out bytes.Buffer
+		if err := printLog(&out, tmpDir, opts); err != nil {
+			t.Fatalf("%s: printLog failed: %v", tt.name, err)
+		}
+
+		var got []string
+		for _, line := range strings.Split(out.String(), "\n") {
+			if strings.HasPrefix(line, "commit ") {
+				got = append(got, line)
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+// TestPrintLog_Cycle checks that log stops with an error on a history whose
+// first commit names the last as its parent
+func TestPrintLog_Cycle(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-log-cycle-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	options := storage.InitOptions{Bare: false}
+	if err := storage.InitRepo(tmpDir, options); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+	writeLinearHistory(t, tmpDir, []int64{100, 200, 300})
+	last := 2
+	if err := storage.WriteCommitObject(tmpDir, options, storage.Commit{ID: 0, Message: "commit", Branch: "master", Parent: &last}); err != nil {
+		t.Fatalf("Failed to rewrite commit 0: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := printLog(&out, tmpDir, logOptions{}); !errors.Is(err, storage.ErrCommitCycle) {
+		t.Errorf("Expected ErrCommitCycle, got %v", err)
+	}
+	if _, ok, err := commitsSince(tmpDir, options, 2, nil); ok || !errors.Is(err, storage.ErrCommitCycle) {
+		t.Errorf("Expected commitsSince to fail with ErrCommitCycle, got %v", err)
+	}
+}
+
+func TestParseLogArgs_Invalid(t *testing.T) {
+	for _, args := range [][]string{
+		{"-n"},
+		{"-n", "0"},
+		{"-n", "abc"},
+		{"--since", "yesterday"},
+		{"--bogus", "1"},
+	} {
+		if _, err := parseLogArgs(args); err == nil {
+			t.Errorf("Expected error for args %v", args)
+		}
+	}
+}
+
+// TestPrintShow_ListsChangedFiles checks that show lists a root commit's files
+// as added and a later commit's changes against its parent
+func TestPrintShow_ListsChangedFiles(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-show-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	options := storage.InitOptions{Bare: false}
+	if err := storage.InitRepo(tmpDir, options); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+	writeLinearHistory(t, tmpDir, []int64{100, 200})
+	trees := [][]storage.TreeEntry{
+		{{Path: "a.txt", BlobID: "blob-a1", Mode: storage.ModeFile, Type: "blob"}},
+		{
+			{Path: "a.txt", BlobID: "blob-a2", Mode: storage.ModeFile, Type: "blob"},
+			{Path: "b.txt", BlobID: "blob-b1", Mode: storage.ModeFile, Type: "blob"},
+		},
+	}
+	for id, tree := range trees {
+		if err := storage.WriteTree(tmpDir, options, id, tree); err != nil {
+			t.Fatalf("Failed to write tree %d: %v", id, err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string // output after the commit header
+	}{
+		{"root commit", []string{"0"}, "\nA\ta.txt\n"},
+		{"against parent", []string{"1"}, "\nM\ta.txt\nA\tb.txt\n"},
+		{"name only", []string{"--name-only", "1"}, "\na.txt\nb.txt\n"},
+	}
+	for _, tt := range tests {
+		opts, err := parseShowArgs(tt.args)
+		if err != nil {
+			t.Fatalf("%s: parseShowArgs failed: %v", tt.name, err)
+		}
+
+		var out bytes.Buffer
+		if err := printShow(&out, tmpDir, opts); err != nil {
+			t.Fatalf("%s: printShow failed: %v", tt.name, err)
+		}
+		_, files, _ := strings.Cut(out.String(), "message commit\n")
+		if files != tt.want {
+			t.Errorf("%s: expected files %q, got output:\n%s", tt.name, tt.want, out.String())
+		}
+	}
+
+	for _, args := range [][]string{nil, {"abc"}, {"1", "2"}, {"--stat", "1"}} {
+		if _, err := parseShowArgs(args); err == nil {
+			t.Errorf("Expected error for args %v", args)
+		}
+	}
+}
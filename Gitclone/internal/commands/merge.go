@@ -2,11 +2,17 @@ package commands
 
 import (
 	"fmt"
+	infrastorage "gitclone/internal/infra/storage"
 	"gitclone/internal/storage"
 	"os"
+	"path/filepath"
 	"time"
 )
 
+// Merge merges another branch into the current one. It works on the same
+// RepoStore the server uses, and writes the merge commit, its tree and the
+// branch ref in one batch. The repo's merge.ff setting decides whether a merge
+// that can fast-forward does so (see storage.MergeFFAllow).
 func Merge(args []string) {
 	if len(args) < 1 {
 		fmt.Println("usage: gitclone merge <branch>")
@@ -20,14 +26,23 @@ func Merge(args []string) {
 		return
 	}
 
-	writeOptions := storage.InitOptions{Bare: false}
+	repoStore, err := infrastorage.NewRepoStore(filepath.Dir(cwd), filepath.Base(cwd))
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	defer repoStore.Close()
 
-	// Read current branch from HEAD
-	currentBranch, err := storage.ReadHEADBranch(cwd, writeOptions)
+	// Read current branch and its latest commit from HEAD
+	currentTip, currentBranch, err := storage.ResolveHead(repoStore)
 	if err != nil {
 		fmt.Println("Error:", err)
 		return
 	}
+	if currentBranch == "" {
+		fmt.Println("Error: cannot merge with a detached HEAD")
+		return
+	}
 
 	// Cannot merge a branch into itself
 	if currentBranch == otherBranch {
@@ -35,37 +50,69 @@ func Merge(args []string) {
 		return
 	}
 
-	// Ensure both refs exist
-	if err := storage.EnsureHeadRefExists(cwd, writeOptions, currentBranch); err != nil {
+	// Ensure the current ref exists; the other branch must already exist
+	if err := storage.EnsureHeadRefExistsFromStore(repoStore, currentBranch); err != nil {
 		fmt.Println("Error:", err)
 		return
 	}
-	if err := storage.EnsureHeadRefExists(cwd, writeOptions, otherBranch); err != nil {
-		fmt.Println("Error:", err)
+	if !storage.HeadRefExistsFromStore(repoStore, otherBranch) {
+		fmt.Printf("Error: branch %s does not exist\n", otherBranch)
 		return
 	}
 
-	// Read latest commit of both branches
-	currentTip, err := storage.ReadHeadRefMaybe(cwd, writeOptions, currentBranch)
+	// Read latest commit of the other branch
+	otherTip, err := storage.ReadHeadRefMaybeFromStore(repoStore, otherBranch)
 	if err != nil {
 		fmt.Println("Error:", err)
 		return
 	}
-	otherTip, err := storage.ReadHeadRefMaybe(cwd, writeOptions, otherBranch)
+
+	// If other branch has no commit, nothing to merge
+	if otherTip == nil {
+		fmt.Printf("Nothing to merge: branch %s has no commits\n", otherBranch)
+		return
+	}
+
+	ff, err := storage.ReadConfigFromStore(repoStore, "merge.ff")
 	if err != nil {
 		fmt.Println("Error:", err)
 		return
 	}
 
-	// If other branch has no commit, nothing to merge
-	if otherTip == nil {
-		fmt.Printf("Nothing to merge: branch %s has no commits\n", otherBranch)
+	// A current branch with no commits, or one the other branch contains, can
+	// fast-forward; one that already contains the other has nothing to merge
+	canFastForward := currentTip == nil
+	if currentTip != nil {
+		ours, err := storage.ReachableCommits(repoStore, *currentTip)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if ours[*otherTip] {
+			fmt.Println("Already up to date")
+			return
+		}
+		theirs, err := storage.ReachableCommits(repoStore, *otherTip)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		canFastForward = theirs[*currentTip]
+	}
+	if !canFastForward && ff == storage.MergeFFOnly {
+		fmt.Println("Error: not possible to fast-forward (merge.ff=only)")
 		return
 	}
 
-	// If current branch has no commits, fast-forward
-	if currentTip == nil {
-		if err := storage.WriteHeadRef(cwd, writeOptions, currentBranch, *otherTip); err != nil {
+	// Fast-forward unless merge.ff=false asks for a merge commit; an empty
+	// branch has no commit to be a parent, so it always fast-forwards
+	if canFastForward && (ff != storage.MergeFFNever || currentTip == nil) {
+		batch := repoStore.NewWriteBatch()
+		if err := storage.WriteHeadRefToBatch(batch, currentBranch, *otherTip); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if err := batch.Commit(); err != nil {
 			fmt.Println("Error:", err)
 			return
 		}
@@ -73,34 +120,84 @@ func Merge(args []string) {
 		return
 	}
 
+	// Merge commit tree: when the current tip is an ancestor of the other,
+	// the other tree already has every change, deletions included, so it is
+	// used as is. Otherwise both sides' changes since the merge base are
+	// combined, and a path both changed differently stops the merge.
+	otherTree, err := storage.ReadTreeMaybeFromStore(repoStore, *otherTip)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	mergedTree := otherTree
+	if !canFastForward {
+		if mergedTree, err = threeWayMerge(repoStore, *currentTip, *otherTip, otherTree); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+	}
+
 	// Create merge commit with two parents
-	mergeID, err := storage.NextCommitID(cwd, writeOptions)
+	mergeID, err := storage.NextCommitIDFromStore(repoStore)
 	if err != nil {
 		fmt.Println("Error:", err)
 		return
 	}
 
+	// The CLI has no user identity, so like a commit the merge is authored
+	// and committed by DefaultAuthor
 	mergeMessage := fmt.Sprintf("Merge branch %s into %s", otherBranch, currentBranch)
+	now := time.Now().Unix()
 	commit := storage.Commit{
-		ID:        mergeID,
-		Message:   mergeMessage,
-		Branch:    currentBranch,
-		Timestamp: time.Now().Unix(),
-		Parent:    currentTip,
-		Parent2:   otherTip,
+		ID:            mergeID,
+		Message:       mergeMessage,
+		Author:        storage.DefaultAuthor,
+		Committer:     storage.DefaultAuthor,
+		CommitterDate: now,
+		Branch:        currentBranch,
+		Timestamp:     now,
+		Parent:        currentTip,
+		Parent2:       otherTip,
 	}
 
-	// Write merge commit to disk
-	if err := storage.WriteCommitObject(cwd, writeOptions, commit); err != nil {
+	// Write the commit, its tree and the updated branch ref together
+	batch := repoStore.NewWriteBatch()
+	if err := storage.WriteCommitObjectToBatch(batch, commit, mergedTree); err != nil {
 		fmt.Println("Error:", err)
 		return
 	}
-
-	// Update current branch ref to point to merge commit
-	if err := storage.WriteHeadRef(cwd, writeOptions, currentBranch, mergeID); err != nil {
+	if err := storage.WriteTreeToBatch(batch, mergeID, mergedTree); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if err := storage.WriteHeadRefToBatch(batch, currentBranch, mergeID); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if err := batch.Commit(); err != nil {
 		fmt.Println("Error:", err)
 		return
 	}
 
 	fmt.Printf("[%s %d] %s\n", currentBranch, mergeID, mergeMessage)
 }
+
+// threeWayMerge merges the trees of ours and theirs against the tree of their
+// merge base
+func threeWayMerge(repoStore *infrastorage.RepoStore, ours, theirs int, theirTree []storage.TreeEntry) ([]storage.TreeEntry, error) {
+	base, err := storage.MergeBase(repoStore, ours, theirs)
+	if err != nil {
+		return nil, err
+	}
+	var baseTree []storage.TreeEntry
+	if base != nil {
+		if baseTree, err = storage.ReadTreeMaybeFromStore(repoStore, *base); err != nil {
+			return nil, err
+		}
+	}
+	ourTree, err := storage.ReadTreeMaybeFromStore(repoStore, ours)
+	if err != nil {
+		return nil, err
+	}
+	return storage.MergeTrees(baseTree, ourTree, theirTree)
+}
@@ -0,0 +1,273 @@
+package commands
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"gitclone/internal/app/commits"
+	"gitclone/internal/metadata"
+	"gitclone/internal/storage"
+)
+
+// TestMergeVisibleToListCommits verifies that a merge made with the CLI writes
+// to the same refs and objects the server reads, so after a push the merge
+// commit and both parents' history show up in the service's ListCommits
+func TestMergeVisibleToListCommits(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-cli-merge-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repoBase := filepath.Join(tmpDir, "repos")
+	repoID := "cli-repo"
+	repoPath := filepath.Join(repoBase, repoID)
+	if err := os.MkdirAll(repoPath, 0755); err != nil {
+		t.Fatalf("Failed to create repo dir: %v", err)
+	}
+	if err := storage.InitRepo(repoPath, storage.InitOptions{Bare: false}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	// The commands work on the current directory
+	oldDir, _ := os.Getwd()
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoPath); err != nil {
+		t.Fatalf("Failed to chdir: %v", err)
+	}
+
+	commitFile := func(name, content, message string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(repoPath, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		Add([]string{name})
+		Commit([]string{"-m", message})
+	}
+
+	commitFile("base.txt", "base", "base")
+	Checkout([]string{"feature"})
+	commitFile("feature.txt", "feature", "feature work")
+	Checkout([]string{"master"})
+	commitFile("master.txt", "master", "master work")
+	Merge([]string{"feature"})
+
+	metaStore, err := metadata.NewStore(filepath.Join(tmpDir, "db"))
+	if err != nil {
+		t.Fatalf("Failed to create metadata store: %v", err)
+	}
+	defer metaStore.Close()
+	if err := metaStore.CreateRepo(metadata.RepoMeta{ID: repoID, Name: repoID}); err != nil {
+		t.Fatalf("Failed to register repo: %v", err)
+	}
+
+	commitSvc := commits.NewService(repoBase, metaStore)
+	if _, err := commitSvc.PushCommits(context.Background(), repoID, "master", false); err != nil {
+		t.Fatalf("Failed to push master: %v", err)
+	}
+
+	list, err := commitSvc.ListCommits(context.Background(), repoID, "master", 10)
+	if err != nil {
+		t.Fatalf("Failed to list commits: %v", err)
+	}
+	if len(list) == 0 || list[0].Message != "Merge branch feature into master" {
+		t.Fatalf("Expected the merge commit at the tip of master, got %+v", list)
+	}
+
+	mergeID, err := strconv.Atoi(list[0].Hash)
+	if err != nil {
+		t.Fatalf("Failed to parse merge hash %q: %v", list[0].Hash, err)
+	}
+	merge, err := storage.ReadCommitObject(repoPath, storage.InitOptions{Bare: false}, mergeID)
+	if err != nil {
+		t.Fatalf("Failed to read merge commit: %v", err)
+	}
+	if merge.Parent == nil || merge.Parent2 == nil {
+		t.Fatalf("Expected the merge commit to have two parents, got %+v", merge)
+	}
+	feature, err := storage.ReadCommitObject(repoPath, storage.InitOptions{Bare: false}, *merge.Parent2)
+	if err != nil || feature.Message != "feature work" {
+		t.Fatalf("Expected the second parent to be the feature commit, got %+v (err %v)", feature, err)
+	}
+}
+
+// TestMergeFFConfig checks the merge.ff setting: with false a merge that could
+// fast-forward creates a merge commit whose tree is the other branch's,
+// deletions included, and with only a diverged merge is refused
+func TestMergeFFConfig(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-cli-mergeff-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repoPath := filepath.Join(tmpDir, "cli-repo")
+	if err := os.MkdirAll(repoPath, 0755); err != nil {
+		t.Fatalf("Failed to create repo dir: %v", err)
+	}
+	options := storage.InitOptions{Bare: false}
+	if err := storage.InitRepo(repoPath, options); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	oldDir, _ := os.Getwd()
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoPath); err != nil {
+		t.Fatalf("Failed to chdir: %v", err)
+	}
+
+	commitFile := func(name, message string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(repoPath, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		Add([]string{name})
+		Commit([]string{"-m", message})
+	}
+	tip := func(branch string) int {
+		t.Helper()
+		id, err := storage.ReadHeadRef(repoPath, options, branch)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", branch, err)
+		}
+		return id
+	}
+
+	// feature is ahead of master: a fast-forward is possible
+	commitFile("base.txt", "base")
+	commitFile("old.txt", "old")
+	Checkout([]string{"feature"})
+	commitFile("feature.txt", "feature work")
+	Rm([]string{"old.txt"})
+	Commit([]string{"-m", "drop old"})
+	Checkout([]string{"master"})
+	base := tip("master")
+
+	Config([]string{"merge.ff", "false"})
+	Merge([]string{"feature"})
+	merge, err := storage.ReadCommitObject(repoPath, options, tip("master"))
+	if err != nil {
+		t.Fatalf("Failed to read master's tip: %v", err)
+	}
+	if merge.Parent == nil || *merge.Parent != base || merge.Parent2 == nil || *merge.Parent2 != tip("feature") {
+		t.Fatalf("Expected a merge commit of %d and %d, got %+v", base, tip("feature"), merge)
+	}
+	tree, err := storage.ReadTree(repoPath, options, merge.ID)
+	if err != nil {
+		t.Fatalf("Failed to read the merge tree: %v", err)
+	}
+	paths := make(map[string]bool)
+	for _, entry := range tree {
+		paths[entry.Path] = true
+	}
+	if !paths["base.txt"] || !paths["feature.txt"] || paths["old.txt"] {
+		t.Errorf("Expected the merge tree to be feature's, without old.txt, got %+v", tree)
+	}
+
+	// Diverge the branches: with merge.ff=only the merge is refused
+	Checkout([]string{"feature"})
+	commitFile("more.txt", "more feature work")
+	Checkout([]string{"master"})
+	commitFile("master.txt", "master work")
+	before := tip("master")
+
+	Config([]string{"merge.ff", "only"})
+	Merge([]string{"feature"})
+	if after := tip("master"); after != before {
+		t.Errorf("Expected merge.ff=only to leave master at %d, got %d", before, after)
+	}
+}
+
+// TestMergeThreeWay merges diverged branches: edits and deletions made on
+// either side since the merge base survive, and a path both sides changed
+// differently stops the merge
+func TestMergeThreeWay(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-cli-merge3-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repoPath := filepath.Join(tmpDir, "cli-repo")
+	if err := os.MkdirAll(repoPath, 0755); err != nil {
+		t.Fatalf("Failed to create repo dir: %v", err)
+	}
+	options := storage.InitOptions{Bare: false}
+	if err := storage.InitRepo(repoPath, options); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	oldDir, _ := os.Getwd()
+	defer os.Chdir(oldDir)
+	if err := os.Chdir(repoPath); err != nil {
+		t.Fatalf("Failed to chdir: %v", err)
+	}
+
+	commitFile := func(name, content, message string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(repoPath, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		Add([]string{name})
+		Commit([]string{"-m", message})
+	}
+	tip := func(branch string) int {
+		t.Helper()
+		id, err := storage.ReadHeadRef(repoPath, options, branch)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", branch, err)
+		}
+		return id
+	}
+	blobs := func(commitID int) map[string]string {
+		t.Helper()
+		tree, err := storage.ReadTree(repoPath, options, commitID)
+		if err != nil {
+			t.Fatalf("Failed to read tree %d: %v", commitID, err)
+		}
+		byPath := make(map[string]string)
+		for _, entry := range tree {
+			byPath[entry.Path] = entry.BlobID
+		}
+		return byPath
+	}
+
+	commitFile("f.txt", "a", "base f")
+	commitFile("gone.txt", "gone", "base gone")
+	commitFile("shared.txt", "shared", "base shared")
+	Checkout([]string{"feat"})
+	commitFile("feat.txt", "feat", "feat work")
+	commitFile("shared.txt", "feat shared", "feat edits shared")
+	Checkout([]string{"master"})
+	commitFile("f.txt", "f2", "master edits f")
+	Rm([]string{"gone.txt"})
+	Commit([]string{"-m", "master drops gone"})
+	masterBlobs := blobs(tip("master"))
+	featBlobs := blobs(tip("feat"))
+
+	Merge([]string{"feat"})
+	merged := blobs(tip("master"))
+	if merged["f.txt"] != masterBlobs["f.txt"] {
+		t.Errorf("Expected master's edit of f.txt to survive the merge, got %q", merged["f.txt"])
+	}
+	if _, ok := merged["gone.txt"]; ok {
+		t.Errorf("Expected gone.txt, deleted on master, to stay deleted")
+	}
+	if merged["shared.txt"] != featBlobs["shared.txt"] || merged["feat.txt"] != featBlobs["feat.txt"] {
+		t.Errorf("Expected feat's changes in the merge, got %+v", merged)
+	}
+
+	// Both branches edit f.txt differently: the merge is refused
+	Checkout([]string{"feat"})
+	commitFile("f.txt", "feat f", "feat edits f")
+	Checkout([]string{"master"})
+	commitFile("f.txt", "master f", "master edits f again")
+	before := tip("master")
+	Merge([]string{"feat"})
+	if after := tip("master"); after != before {
+		t.Errorf("Expected a conflicting merge to leave master at %d, got %d", before, after)
+	}
+}
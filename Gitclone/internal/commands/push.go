@@ -0,0 +1,262 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gitclone/internal/app/commits"
+	"gitclone/internal/storage"
+)
+
+// Push and pull sync a branch with its remote-tracking ref,
+// refs/remotes/origin/<branch>, which is what the server lists as pushed.
+// Both only fast-forward, unless a push is given --force.
+
+// Push moves origin/<branch> up to the local branch
+// Usage: gitclone push [--force] [branch]
+// --force overwrites an origin/<branch> the branch has diverged from, as
+// after an amend of a pushed commit.
+func Push(args []string) {
+	force := false
+	var rest []string
+	for _, arg := range args {
+		if arg == "--force" {
+			force = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	branch, pushed, err := push(cwd, branchArg(rest), force)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if pushed == 0 {
+		fmt.Println("Everything up-to-date")
+		return
+	}
+	fmt.Printf("Pushed %d commit(s) to origin/%s\n", pushed, branch)
+}
+
+// Pull moves the local branch up to origin/<branch>
+// Usage: gitclone pull [branch]
+func Pull(args []string) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	branch, pulled, err := pull(cwd, branchArg(args))
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if pulled == 0 {
+		fmt.Println("Already up to date")
+		return
+	}
+	fmt.Printf("Pulled %d commit(s) from origin/%s\n", pulled, branch)
+}
+
+// branchArg returns the optional branch argument, or "" for the current branch
+func branchArg(args []string) string {
+	if len(args) >= 1 {
+		return args[0]
+	}
+	return ""
+}
+
+// push fast-forwards origin/<branch> to refs/heads/<branch> and returns the
+// branch and the number of commits pushed. An empty branch means HEAD's. A
+// forced push goes through the server's code path, which also refuses to
+// rewrite a protected branch.
+func push(cwd, branch string, force bool) (string, int, error) {
+	options := storage.InitOptions{Bare: false}
+
+	branch, err := resolveBranch(cwd, options, branch)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if force {
+		svc := commits.NewService(filepath.Dir(cwd), nil)
+		pushed, err := svc.PushCommitsWithInfo(context.Background(), filepath.Base(cwd), branch, commits.PushOptions{Force: true})
+		if err != nil {
+			return "", 0, err
+		}
+		return branch, len(pushed), nil
+	}
+
+	headTip, err := storage.ReadHeadRefMaybe(cwd, options, branch)
+	if err != nil {
+		return "", 0, err
+	}
+	if headTip == nil {
+		return "", 0, fmt.Errorf("no commits to push on branch %s", branch)
+	}
+	remoteTip, err := storage.ReadRemoteRef(cwd, options, branch)
+	if err != nil {
+		return "", 0, err
+	}
+
+	commits, ok, err := commitsSince(cwd, options, *headTip, remoteTip)
+	if err != nil {
+		return "", 0, err
+	}
+	if !ok {
+		return "", 0, fmt.Errorf("rejected: origin/%s has commits that %s doesn't (non-fast-forward)", branch, branch)
+	}
+	if len(commits) == 0 {
+		return branch, 0, nil
+	}
+
+	if err := storage.WriteRemoteRef(cwd, options, branch, *headTip); err != nil {
+		return "", 0, err
+	}
+	return branch, len(commits), nil
+}
+
+// pull fast-forwards refs/heads/<branch> to origin/<branch>, updating the
+// working tree if it is the current branch, and returns the branch and the
+// number of commits pulled. An empty branch means HEAD's.
+func pull(cwd, branch string) (string, int, error) {
+	options := storage.InitOptions{Bare: false}
+
+	branch, err := resolveBranch(cwd, options, branch)
+	if err != nil {
+		return "", 0, err
+	}
+
+	remoteTip, err := storage.ReadRemoteRef(cwd, options, branch)
+	if err != nil {
+		return "", 0, err
+	}
+	if remoteTip == nil {
+		return "", 0, fmt.Errorf("branch %s has never been pushed", branch)
+	}
+	headTip, err := storage.ReadHeadRefMaybe(cwd, options, branch)
+	if err != nil {
+		return "", 0, err
+	}
+
+	commits, ok, err := commitsSince(cwd, options, *remoteTip, headTip)
+	if err != nil {
+		return "", 0, err
+	}
+	if !ok {
+		// The local branch being ahead of origin is fine; diverging isn't
+		if _, ahead, err := commitsSince(cwd, options, *headTip, remoteTip); err != nil || !ahead {
+			return "", 0, fmt.Errorf("rejected: %s and origin/%s have diverged (non-fast-forward)", branch, branch)
+		}
+		return branch, 0, nil
+	}
+	if len(commits) == 0 {
+		return branch, 0, nil
+	}
+
+	if err := storage.WriteHeadRef(cwd, options, branch, *remoteTip); err != nil {
+		return "", 0, err
+	}
+	if current, err := storage.ReadHEADBranch(cwd, options); err == nil && current == branch {
+		if err := storage.MaterializeTree(cwd, options, *remoteTip); err != nil {
+			return "", 0, fmt.Errorf("updated %s but failed to update working tree: %w", branch, err)
+		}
+	}
+	return branch, len(commits), nil
+}
+
+// resolveBranch returns branch, or the branch HEAD points to if it is empty
+func resolveBranch(cwd string, options storage.InitOptions, branch string) (string, error) {
+	if branch != "" {
+		return branch, nil
+	}
+	return storage.ReadHEADBranch(cwd, options)
+}
+
+// commitsSince returns the commits reachable from tip, through both parents
+// of merges, that base can't reach, tip first, and whether base is an
+// ancestor of tip. A nil base counts every commit reachable from tip.
+func commitsSince(cwd string, options storage.InitOptions, tip int, base *int) ([]int, bool, error) {
+	if base == nil {
+		commits, _, err := ancestors(cwd, options, tip, -1)
+		return commits, err == nil, err
+	}
+	commits, found, err := ancestors(cwd, options, tip, *base)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	// Commits merged into base's history were pushed with it
+	known, _, err := ancestors(cwd, options, *base, -1)
+	if err != nil {
+		return nil, false, err
+	}
+	excluded := make(map[int]bool, len(known))
+	for _, id := range known {
+		excluded[id] = true
+	}
+	var since []int
+	for _, id := range commits {
+		if !excluded[id] {
+			since = append(since, id)
+		}
+	}
+	return since, true, nil
+}
+
+// ancestors walks the history from tip through every parent, tip first, and
+// returns the commits it visits and whether it reached stop, whose own
+// parents it doesn't follow. A history that loops back on itself fails with
+// ErrCommitCycle.
+func ancestors(cwd string, options storage.InitOptions, tip, stop int) ([]int, bool, error) {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[int]int)
+	var commits []int
+	found := false
+	var visit func(id int) error
+	visit = func(id int) error {
+		switch state[id] {
+		case visiting:
+			return fmt.Errorf("%w at commit %d", storage.ErrCommitCycle, id)
+		case visited:
+			return nil
+		}
+		if id == stop {
+			found = true
+			state[id] = visited
+			return nil
+		}
+		state[id] = visiting
+		commits = append(commits, id)
+
+		c, err := storage.ReadCommitObject(cwd, options, id)
+		if err != nil {
+			return err
+		}
+		for _, parent := range []*int{c.Parent, c.Parent2} {
+			if parent != nil {
+				if err := visit(*parent); err != nil {
+					return err
+				}
+			}
+		}
+		state[id] = visited
+		return nil
+	}
+	if err := visit(tip); err != nil {
+		return nil, false, err
+	}
+	return commits, found, nil
+}
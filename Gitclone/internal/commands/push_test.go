@@ -0,0 +1,148 @@
+package commands
+
+import (
+	"os"
+	"testing"
+
+	"gitclone/internal/storage"
+)
+
+// TestPushPull pushes a branch, moves it back and pulls it forward again,
+// checking the remote and local refs advance and the counts reported
+func TestPushPull(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-push-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	options := storage.InitOptions{Bare: false}
+	if err := storage.InitRepo(tmpDir, options); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+	writeLinearHistory(t, tmpDir, []int64{100, 200, 300})
+
+	if _, _, err := pull(tmpDir, "master"); err == nil {
+		t.Errorf("Expected pull of a never-pushed branch to fail")
+	}
+
+	branch, pushed, err := push(tmpDir, "", false)
+	if err != nil {
+		t.Fatalf("Failed to push: %v", err)
+	}
+	if branch != "master" || pushed != 3 {
+		t.Errorf("Expected 3 commits pushed to master, got %d to %s", pushed, branch)
+	}
+	if remote, _ := storage.ReadRemoteRef(tmpDir, options, "master"); remote == nil || *remote != 2 {
+		t.Fatalf("Expected origin/master at 2, got %v", remote)
+	}
+	if _, pushed, err := push(tmpDir, "master", false); err != nil || pushed != 0 {
+		t.Errorf("Expected a second push to be up to date, got %d (err %v)", pushed, err)
+	}
+
+	// Pushing only the new commit after origin
+	commit := storage.Commit{ID: 3, Message: "commit", Branch: "master", Timestamp: 400}
+	parent := 2
+	commit.Parent = &parent
+	if err := storage.WriteCommitObject(tmpDir, options, commit); err != nil {
+		t.Fatalf("Failed to write commit: %v", err)
+	}
+	if err := storage.WriteHeadRef(tmpDir, options, "master", 3); err != nil {
+		t.Fatalf("Failed to write head ref: %v", err)
+	}
+	if _, pushed, err := push(tmpDir, "master", false); err != nil || pushed != 1 {
+		t.Errorf("Expected 1 commit pushed, got %d (err %v)", pushed, err)
+	}
+
+	// A local branch behind origin pulls forward
+	if err := storage.WriteHeadRef(tmpDir, options, "master", 1); err != nil {
+		t.Fatalf("Failed to reset head ref: %v", err)
+	}
+	if _, pulled, err := pull(tmpDir, ""); err != nil || pulled != 2 {
+		t.Errorf("Expected 2 commits pulled, got %d (err %v)", pulled, err)
+	}
+	if head, _ := storage.ReadHeadRefMaybe(tmpDir, options, "master"); head == nil || *head != 3 {
+		t.Errorf("Expected master at 3 after pull, got %v", head)
+	}
+
+	// A diverged branch is refused both ways
+	diverged := storage.Commit{ID: 4, Message: "commit", Branch: "master", Timestamp: 500}
+	parent = 1
+	diverged.Parent = &parent
+	if err := storage.WriteCommitObject(tmpDir, options, diverged); err != nil {
+		t.Fatalf("Failed to write commit: %v", err)
+	}
+	if err := storage.WriteHeadRef(tmpDir, options, "master", 4); err != nil {
+		t.Fatalf("Failed to write head ref: %v", err)
+	}
+	if _, _, err := push(tmpDir, "master", false); err == nil {
+		t.Errorf("Expected a non-fast-forward push to be refused")
+	}
+	if _, _, err := pull(tmpDir, "master"); err == nil {
+		t.Errorf("Expected a non-fast-forward pull to be refused")
+	}
+	if remote, _ := storage.ReadRemoteRef(tmpDir, options, "master"); remote == nil || *remote != 3 {
+		t.Errorf("Expected origin/master to stay at 3, got %v", remote)
+	}
+
+	// A forced push overwrites origin with the diverged branch
+	if _, pushed, err := push(tmpDir, "master", true); err != nil || pushed != 1 {
+		t.Errorf("Expected a forced push of 1 commit, got %d (err %v)", pushed, err)
+	}
+	if remote, _ := storage.ReadRemoteRef(tmpDir, options, "master"); remote == nil || *remote != 4 {
+		t.Errorf("Expected origin/master at 4 after a forced push, got %v", remote)
+	}
+}
+
+// TestPushAcrossMerge pushes master after merging in a feature branch that
+// was never pushed: the feature commits, reachable only through the merge's
+// second parent, count as pushed, and origin reachable only that way is
+// still a fast-forward
+func TestPushAcrossMerge(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-push-merge-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	options := storage.InitOptions{Bare: false}
+	if err := storage.InitRepo(tmpDir, options); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+	writeLinearHistory(t, tmpDir, []int64{100})
+	if _, pushed, err := push(tmpDir, "master", false); err != nil || pushed != 1 {
+		t.Fatalf("Expected 1 commit pushed, got %d (err %v)", pushed, err)
+	}
+
+	// 1 and 2 on feature, 3 on master, 4 merges 2 into 3
+	writeCommit := func(id int, parent int, parent2 *int) {
+		t.Helper()
+		commit := storage.Commit{ID: id, Message: "commit", Branch: "master", Timestamp: int64(100 * (id + 1)), Parent: &parent, Parent2: parent2}
+		if err := storage.WriteCommitObject(tmpDir, options, commit); err != nil {
+			t.Fatalf("Failed to write commit %d: %v", id, err)
+		}
+	}
+	feature := 2
+	writeCommit(1, 0, nil)
+	writeCommit(2, 1, nil)
+	writeCommit(3, 0, nil)
+	writeCommit(4, 3, &feature)
+	if err := storage.WriteHeadRef(tmpDir, options, "master", 4); err != nil {
+		t.Fatalf("Failed to write head ref: %v", err)
+	}
+
+	if _, pushed, err := push(tmpDir, "master", false); err != nil || pushed != 4 {
+		t.Errorf("Expected the merge, master's commit and both feature commits pushed, got %d (err %v)", pushed, err)
+	}
+
+	// origin at the feature tip, behind master only through the merge
+	if err := storage.WriteRemoteRef(tmpDir, options, "master", feature); err != nil {
+		t.Fatalf("Failed to write remote ref: %v", err)
+	}
+	if _, pushed, err := push(tmpDir, "master", false); err != nil || pushed != 2 {
+		t.Errorf("Expected the merge and master's commit pushed, got %d (err %v)", pushed, err)
+	}
+	if _, pulled, err := pull(tmpDir, "master"); err != nil || pulled != 0 {
+		t.Errorf("Expected pull to be up to date, got %d (err %v)", pulled, err)
+	}
+}
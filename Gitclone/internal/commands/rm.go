@@ -0,0 +1,40 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gitclone/internal/storage"
+)
+
+// Rm deletes a file from the working tree and stages its removal
+// Usage: gitclone rm <path>
+func Rm(args []string) {
+	if len(args) < 1 {
+		fmt.Println("usage: gitclone rm <path>")
+		return
+	}
+	path := args[0]
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	options := storage.InitOptions{Bare: false}
+
+	// Remove from disk if still present; a file already deleted by hand is fine
+	if err := os.Remove(filepath.Join(cwd, path)); err != nil && !os.IsNotExist(err) {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	if err := storage.RemoveFromIndex(cwd, options, path); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	fmt.Printf("Removed: %s\n", path)
+}
@@ -0,0 +1,47 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"gitclone/internal/storage"
+)
+
+// Status prints staged, modified, deleted and untracked files
+// Usage: gitclone status
+func Status(args []string) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	options := storage.InitOptions{Bare: false}
+	status, err := storage.Status(cwd, options)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	if branch, err := storage.ReadHEADBranch(cwd, options); err == nil {
+		fmt.Println("On branch", branch)
+	}
+	printPaths("Changes to be committed:", status.Staged)
+	printPaths("Changes not staged for commit:", status.Modified)
+	printPaths("Deleted files:", status.Deleted)
+	printPaths("Untracked files:", status.Untracked)
+	if len(status.Staged)+len(status.Modified)+len(status.Deleted)+len(status.Untracked) == 0 {
+		fmt.Println("nothing to commit, working tree clean")
+	}
+}
+
+// printPaths prints a heading and its paths, or nothing if there are none
+func printPaths(heading string, paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+	fmt.Println(heading)
+	for _, path := range paths {
+		fmt.Println("\t" + path)
+	}
+}
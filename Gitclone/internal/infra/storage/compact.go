@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"errors"
+
+	"GitDb"
+)
+
+// ErrCompactUnsupported is returned for a store whose KV can't be compacted,
+// such as a GitDb.MemDB
+var ErrCompactUnsupported = errors.New("store does not support compaction")
+
+// compactor is a KV that reports how much of its log compaction would free
+// and compacts it, as GitDb.DB does
+type compactor interface {
+	Stats() (GitDb.Stats, error)
+	Compact() error
+}
+
+// Stats returns the size of the repository's log and how much of it Compact
+// would free
+func (rs *RepoStore) Stats() (GitDb.Stats, error) {
+	db, ok := rs.db.(compactor)
+	if !ok {
+		return GitDb.Stats{}, ErrCompactUnsupported
+	}
+	return db.Stats()
+}
+
+// Compact rewrites the repository's log without overwritten records and
+// tombstones. Writes through other handles while it runs make it fail with
+// GitDb.ErrLogChanged, so callers hold the repository's lock from RepoLocks.
+func (rs *RepoStore) Compact() error {
+	db, ok := rs.db.(compactor)
+	if !ok {
+		return ErrCompactUnsupported
+	}
+	return db.Compact()
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"GitDb"
+)
+
+// SchemaVersionKey stores the repository's schema version
+const SchemaVersionKey = "meta/SCHEMA_VERSION"
+
+// SchemaVersion is the schema version written by InitRepo and produced by MigrateRepo
+const SchemaVersion = 1
+
+// migration upgrades a repository from version-1 to version. Writes go to the
+// batch so the step and the version bump land atomically.
+type migration struct {
+	version int
+	apply   func(db GitDb.KV, batch *WriteBatch) error
+}
+
+// migrations are applied in order; append new steps with the next version
+var migrations = []migration{
+	{version: 1, apply: backfillCommitAuthor},
+}
+
+// commitKeyPattern matches commit objects stored by ID or by hash
+var commitKeyPattern = regexp.MustCompile(`^objects/(\d+|commit/[0-9a-f]+)$`)
+
+// ReadSchemaVersion returns the repository's schema version. Repositories
+// created before versioning have no version key and report 0; any other
+// failure to read the key is returned, so migrations never rerun on a repo
+// whose log couldn't be read.
+func ReadSchemaVersion(db GitDb.KV) (int, error) {
+	data, err := db.Get(SchemaVersionKey)
+	if errors.Is(err, GitDb.ErrNotFound) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	version, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema version %q: %w", data, err)
+	}
+	return version, nil
+}
+
+// MigrateRepo brings the repository up to SchemaVersion, applying each pending
+// migration step in order. Repositories from a newer version are rejected.
+func MigrateRepo(store *RepoStore) error {
+	db := store.DB()
+	version, err := ReadSchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("repository schema version %d is newer than supported version %d", version, SchemaVersion)
+	}
+
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+		batch := store.NewWriteBatch()
+		if err := m.apply(db, batch); err != nil {
+			return fmt.Errorf("migration to version %d failed: %w", m.version, err)
+		}
+		batch.Put(SchemaVersionKey, []byte(fmt.Sprintf("%d\n", m.version)))
+		if err := batch.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration to version %d: %w", m.version, err)
+		}
+		version = m.version
+	}
+
+	return nil
+}
+
+// backfillCommitAuthor sets author "system" (the author the API always
+// reported) on commits written before commits recorded an author
+func backfillCommitAuthor(db GitDb.KV, batch *WriteBatch) error {
+	// Collect the latest value of every commit object
+	latest := make(map[string][]byte)
+	err := db.Scan(func(record GitDb.Record) error {
+		if commitKeyPattern.MatchString(record.Key) {
+			latest[record.Key] = record.Value
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for key, data := range latest {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return fmt.Errorf("failed to decode %s: %w", key, err)
+		}
+		if _, ok := fields["author"]; ok {
+			continue
+		}
+		fields["author"] = json.RawMessage(`"system"`)
+		updated, err := json.MarshalIndent(fields, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", key, err)
+		}
+		batch.Put(key, updated)
+	}
+
+	return nil
+}
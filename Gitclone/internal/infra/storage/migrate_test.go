@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"GitDb"
+)
+
+// TestMigrateRepo_OldFormat verifies that opening a repository written before
+// schema versioning bumps the version and backfills commit authors
+func TestMigrateRepo_OldFormat(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-migrate-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Hand-craft a version 0 repo: no SCHEMA_VERSION, commits without author
+	dbDir := filepath.Join(tmpDir, "test-repo", ".gitclone", "db")
+	if err := os.MkdirAll(dbDir, 0755); err != nil {
+		t.Fatalf("Failed to create db dir: %v", err)
+	}
+	db, err := GitDb.Open(dbDir)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	oldRecords := map[string]string{
+		"meta/HEAD":           "ref: refs/heads/master\n",
+		"meta/NEXT_COMMIT_ID": "2\n",
+		"refs/heads/master":   "1\n",
+		"objects/0":           `{"id": 0, "message": "first", "branch": "master", "timestamp": 1000}`,
+		"objects/1":           `{"id": 1, "message": "second", "branch": "master", "timestamp": 2000, "parent": 0}`,
+		"objects/tree/1":      `[]`,
+	}
+	for key, value := range oldRecords {
+		if err := db.Put(key, []byte(value)); err != nil {
+			t.Fatalf("Failed to write %s: %v", key, err)
+		}
+	}
+	db.Close()
+
+	store, err := NewRepoStore(tmpDir, "test-repo")
+	if err != nil {
+		t.Fatalf("NewRepoStore failed: %v", err)
+	}
+	defer store.Close()
+
+	version, err := ReadSchemaVersion(store.DB())
+	if err != nil {
+		t.Fatalf("ReadSchemaVersion failed: %v", err)
+	}
+	if version != SchemaVersion {
+		t.Errorf("Expected schema version %d, got %d", SchemaVersion, version)
+	}
+
+	for _, key := range []string{"objects/0", "objects/1"} {
+		data, err := store.DB().Get(key)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", key, err)
+		}
+		var commit struct {
+			Message string `json:"message"`
+			Author  string `json:"author"`
+			Parent  *int   `json:"parent"`
+		}
+		if err := json.Unmarshal(data, &commit); err != nil {
+			t.Fatalf("Failed to decode %s: %v", key, err)
+		}
+		if commit.Author != "system" {
+			t.Errorf("%s: expected backfilled author %q, got %q", key, "system", commit.Author)
+		}
+		if commit.Message == "" {
+			t.Errorf("%s: expected other fields to be preserved, got %s", key, data)
+		}
+	}
+
+	// Non-commit objects are left alone
+	if data, _ := store.DB().Get("objects/tree/1"); string(data) != "[]" {
+		t.Errorf("Expected tree object to be untouched, got %s", data)
+	}
+}
+
+// TestMigrateRepo_NewerVersion verifies that repos from a newer schema are refused
+func TestMigrateRepo_NewerVersion(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-migrate-newer-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	dbDir := filepath.Join(tmpDir, "test-repo", ".gitclone", "db")
+	if err := os.MkdirAll(dbDir, 0755); err != nil {
+		t.Fatalf("Failed to create db dir: %v", err)
+	}
+	db, err := GitDb.Open(dbDir)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.Put(SchemaVersionKey, []byte("99\n")); err != nil {
+		t.Fatalf("Failed to write schema version: %v", err)
+	}
+	db.Close()
+
+	if store, err := NewRepoStore(tmpDir, "test-repo"); err == nil {
+		store.Close()
+		t.Fatalf("Expected NewRepoStore to reject schema version 99")
+	}
+}
+
+// failingGetKV is a MemDB whose Get of one key fails with err
+type failingGetKV struct {
+	*GitDb.MemDB
+	key string
+	err error
+}
+
+// Get fails for kv.key and reads every other key from the MemDB
+func (kv *failingGetKV) Get(key string) ([]byte, error) {
+	if key == kv.key {
+		return nil, kv.err
+	}
+	return kv.MemDB.Get(key)
+}
+
+// TestReadSchemaVersionError checks that only a missing version key reads as
+// version 0, and that a failed read stops the migration instead
+func TestReadSchemaVersionError(t *testing.T) {
+	if version, err := ReadSchemaVersion(GitDb.NewMemDB()); err != nil || version != 0 {
+		t.Errorf("Expected version 0 without a version key, got %d (err %v)", version, err)
+	}
+
+	readErr := errors.New("read failed")
+	kv := &failingGetKV{MemDB: GitDb.NewMemDB(), key: SchemaVersionKey, err: readErr}
+	if _, err := ReadSchemaVersion(kv); !errors.Is(err, readErr) {
+		t.Errorf("Expected the read error from ReadSchemaVersion, got %v", err)
+	}
+	if _, err := NewRepoStoreWithKV("test-repo", "/nonexistent", kv); !errors.Is(err, readErr) {
+		t.Errorf("Expected opening the store to fail with the read error, got %v", err)
+	}
+	if _, err := kv.MemDB.Get(SchemaVersionKey); !errors.Is(err, GitDb.ErrNotFound) {
+		t.Errorf("Expected no migration to run, got schema version key err %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package storage
+
+import "sync"
+
+// RepoLocks holds one mutex per repository ID. GitDb locking makes each write
+// atomic, but a commit, merge or push reads refs, builds objects and then
+// moves a ref; holding the repository's lock for the whole operation keeps two
+// of them from interleaving. Compaction rewrites the log under the same lock,
+// so every writer, staging and ref updates included, must hold it. Share one
+// RepoLocks between everything that writes to the same repositories.
+type RepoLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// NewRepoLocks returns an empty lock set
+func NewRepoLocks() *RepoLocks {
+	return &RepoLocks{locks: make(map[string]*sync.Mutex)}
+}
+
+// Lock blocks until repoID's lock is held and returns the function that
+// releases it
+func (l *RepoLocks) Lock(repoID string) (unlock func()) {
+	l.mu.Lock()
+	lock, ok := l.locks[repoID]
+	if !ok {
+		lock = &sync.Mutex{}
+		l.locks[repoID] = lock
+	}
+	l.mu.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+// TestRepoLocks checks that a repo's lock is exclusive while another repo's
+// lock stays free
+func TestRepoLocks(t *testing.T) {
+	locks := NewRepoLocks()
+	unlock := locks.Lock("a")
+
+	acquired := make(chan struct{})
+	go func() {
+		defer locks.Lock("a")()
+		close(acquired)
+	}()
+
+	// Another repo isn't blocked by a's lock
+	locks.Lock("b")()
+
+	select {
+	case <-acquired:
+		t.Fatalf("Expected a second Lock(\"a\") to wait for the first")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlock()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected Lock(\"a\") to be acquired after unlock")
+	}
+}
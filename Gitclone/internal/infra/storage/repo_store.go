@@ -1,19 +1,77 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"GitDb"
 )
 
+// ErrInvalidRepoID is returned for repository IDs that can't be mapped to a
+// directory under the repo base
+var ErrInvalidRepoID = errors.New("invalid repo ID")
+
+// ErrRepoNotFound is returned for a repository ID with no repository on disk
+var ErrRepoNotFound = errors.New("repository not found")
+
+// ErrNotARepo is returned for a repository ID whose directory exists but
+// isn't a gitclone repository, e.g. because its .gitclone/ was removed
+var ErrNotARepo = errors.New("not a gitclone repository")
+
+// RepoNamespaceSep separates the namespace from the name in a namespaced repo
+// ID such as "org/name"
+const RepoNamespaceSep = "/"
+
+// reservedRepoIDs are the paths the HTTP API serves directly under
+// /api/repos/, which would shadow a repo with one of them as its ID
+var reservedRepoIDs = map[string]bool{"prune": true, "scan": true, "validate": true}
+
+// IsReservedRepoID reports whether repoID is reserved for an API route
+func IsReservedRepoID(repoID string) bool {
+	return reservedRepoIDs[repoID]
+}
+
+// ValidateRepoID checks that repoID is either a plain name, stored at
+// <repoBase>/<name>, or "namespace/name", stored at <repoBase>/<namespace>/<name>.
+// Each segment must name exactly one directory, and a plain name mustn't be
+// reserved. Every code path that turns a repo ID into a path must use it so
+// they all agree on which IDs are valid.
+func ValidateRepoID(repoID string) error {
+	segments := strings.Split(repoID, RepoNamespaceSep)
+	if len(segments) > 2 {
+		return fmt.Errorf("%w: %q has more than one namespace", ErrInvalidRepoID, repoID)
+	}
+	if IsReservedRepoID(repoID) {
+		return fmt.Errorf("%w: %q is reserved", ErrInvalidRepoID, repoID)
+	}
+	for _, segment := range segments {
+		switch {
+		case segment == "" || strings.TrimSpace(segment) != segment:
+			return fmt.Errorf("%w: %q", ErrInvalidRepoID, repoID)
+		case segment == "." || strings.Contains(segment, ".."):
+			return fmt.Errorf("%w: %q contains a relative path component", ErrInvalidRepoID, repoID)
+		case strings.ContainsAny(segment, "\\\x00"):
+			return fmt.Errorf("%w: %q contains illegal characters", ErrInvalidRepoID, repoID)
+		}
+	}
+	return nil
+}
+
 // RepoStore represents a per-repository KV store for HEAD/refs/objects/index operations
 type RepoStore struct {
 	repoID   string
 	repoPath string
-	db       *GitDb.DB
+	db       GitDb.KV
+	closer   io.Closer // the DB NewRepoStore opened; nil for an injected KV
+
+	childMu      sync.Mutex
+	children     map[int][]int // reverse parent index, see ChildIndex
+	childLogSize int64         // log size children was built at
 }
 
 // NewRepoStore opens or creates a per-repo KV store for the given repository
@@ -21,15 +79,20 @@ type RepoStore struct {
 func NewRepoStore(repoBase, repoID string) (*RepoStore, error) {
 	// Resolve repo path: join repoBase with repoID and validate
 	// Prevent directory traversal attacks
-	if strings.Contains(repoID, "..") || strings.Contains(repoID, "/") || strings.Contains(repoID, "\\") {
-		return nil, fmt.Errorf("invalid repo ID: contains illegal characters")
+	if err := ValidateRepoID(repoID); err != nil {
+		return nil, err
 	}
 
 	repoPath := filepath.Join(repoBase, repoID)
 	
-	// Validate that .gitclone directory exists
+	// Validate that the directory exists and has a .gitclone directory
+	if _, err := os.Stat(repoPath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrRepoNotFound, repoID)
+	}
 	gitclonePath := filepath.Join(repoPath, ".gitclone")
-	if _, err := os.Stat(gitclonePath); err != nil {
+	if _, err := os.Stat(gitclonePath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s has no .gitclone/", ErrNotARepo, repoID)
+	} else if err != nil {
 		return nil, fmt.Errorf("repository not found or invalid: %w", err)
 	}
 
@@ -45,6 +108,27 @@ func NewRepoStore(repoBase, repoID string) (*RepoStore, error) {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
+	store, err := newRepoStore(repoID, repoPath, db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	store.closer = db
+	return store, nil
+}
+
+// NewRepoStoreWithKV wraps an already open KV, such as a GitDb.MemDB in tests,
+// as the store of repoID at repoPath. Nothing is read from or checked on disk,
+// and Close leaves kv open.
+func NewRepoStoreWithKV(repoID, repoPath string, kv GitDb.KV) (*RepoStore, error) {
+	if err := ValidateRepoID(repoID); err != nil {
+		return nil, err
+	}
+	return newRepoStore(repoID, repoPath, kv)
+}
+
+// newRepoStore recovers and migrates the repository in db
+func newRepoStore(repoID, repoPath string, db GitDb.KV) (*RepoStore, error) {
 	store := &RepoStore{
 		repoID:   repoID,
 		repoPath: repoPath,
@@ -56,23 +140,40 @@ func NewRepoStore(repoBase, repoID string) (*RepoStore, error) {
 		// Log but don't fail - recovery is best effort
 	}
 
+	// Bring older repositories up to the current schema
+	if err := MigrateRepo(store); err != nil {
+		return nil, fmt.Errorf("failed to migrate repository: %w", err)
+	}
+
 	return store, nil
 }
 
 // Close closes the database connection
 func (rs *RepoStore) Close() error {
-	if rs.db != nil {
-		return rs.db.Close()
+	if rs.closer != nil {
+		return rs.closer.Close()
 	}
 	return nil
 }
 
-// DB returns the underlying GitDb.DB for direct access
+// DB returns the underlying KV for direct access
 // This should only be used for HEAD/refs/objects/index operations
-func (rs *RepoStore) DB() *GitDb.DB {
+func (rs *RepoStore) DB() GitDb.KV {
 	return rs.db
 }
 
+// Snapshot returns a read-only store over the repository as it is now, for a
+// set of reads that must see one point-in-time state. Later writes through
+// rs or any other handle aren't visible in it, and writes to it fail with
+// GitDb.ErrReadOnly. It needs no Close and stays readable after rs is closed.
+func (rs *RepoStore) Snapshot() *RepoStore {
+	return &RepoStore{
+		repoID:   rs.repoID,
+		repoPath: rs.repoPath,
+		db:       rs.db.Snapshot(),
+	}
+}
+
 // RepoID returns the repository ID
 func (rs *RepoStore) RepoID() string {
 	return rs.repoID
@@ -83,6 +184,35 @@ func (rs *RepoStore) RepoPath() string {
 	return rs.repoPath
 }
 
+// LogSize returns the size of the store's log, and false if its KV doesn't
+// report one. Any write through this handle, a commit included, grows it.
+func (rs *RepoStore) LogSize() (int64, bool) {
+	sizer, ok := rs.db.(GitDb.Sizer)
+	if !ok {
+		return 0, false
+	}
+	return sizer.Size(), true
+}
+
+// ChildIndex returns the reverse parent index SetChildIndex cached, mapping
+// each commit to its children, if it was built at log size logSize
+func (rs *RepoStore) ChildIndex(logSize int64) (map[int][]int, bool) {
+	rs.childMu.Lock()
+	defer rs.childMu.Unlock()
+	if rs.children == nil || rs.childLogSize != logSize {
+		return nil, false
+	}
+	return rs.children, true
+}
+
+// SetChildIndex caches children, built from the log at size logSize. Callers
+// must not modify it afterwards.
+func (rs *RepoStore) SetChildIndex(logSize int64, children map[int][]int) {
+	rs.childMu.Lock()
+	defer rs.childMu.Unlock()
+	rs.children, rs.childLogSize = children, logSize
+}
+
 // NewWriteBatch creates a new write batch for atomic operations
 func (rs *RepoStore) NewWriteBatch() *WriteBatch {
 	return NewWriteBatch(rs)
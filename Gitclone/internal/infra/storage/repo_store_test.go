@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"GitDb"
+)
+
+// TestRepoStoreSnapshot reads refs from a snapshot while batches commit to the
+// store concurrently, and checks the snapshot's view never moves
+func TestRepoStoreSnapshot(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-snapshot-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := os.MkdirAll(filepath.Join(tmpDir, "test-repo", ".gitclone"), 0755); err != nil {
+		t.Fatalf("Failed to create repo dir: %v", err)
+	}
+	store, err := NewRepoStore(tmpDir, "test-repo")
+	if err != nil {
+		t.Fatalf("Failed to open RepoStore: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.DB().Put("refs/heads/master", []byte("1\n")); err != nil {
+		t.Fatalf("Failed to write ref: %v", err)
+	}
+
+	snapshot := store.Snapshot()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 2; i <= 100; i++ {
+			batch := store.NewWriteBatch()
+			batch.Put("refs/heads/master", []byte(fmt.Sprintf("%d\n", i)))
+			batch.Put(fmt.Sprintf("refs/heads/branch-%d", i), []byte(fmt.Sprintf("%d\n", i)))
+			if err := batch.Commit(); err != nil {
+				t.Errorf("Failed to commit batch %d: %v", i, err)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		if tip, err := snapshot.DB().Get("refs/heads/master"); err != nil || string(tip) != "1\n" {
+			t.Fatalf("Expected the snapshot to keep master at 1, got %q, %v", tip, err)
+		}
+		if _, err := snapshot.DB().Get("refs/heads/branch-2"); !errors.Is(err, GitDb.ErrNotFound) {
+			t.Fatalf("Expected branch-2 to be missing from the snapshot, got %v", err)
+		}
+	}
+	wg.Wait()
+
+	if tip, err := store.DB().Get("refs/heads/master"); err != nil || string(tip) != "100\n" {
+		t.Fatalf("Expected the store to have master at 100, got %q, %v", tip, err)
+	}
+	if tip, err := snapshot.DB().Get("refs/heads/master"); err != nil || string(tip) != "1\n" {
+		t.Fatalf("Expected the snapshot to still have master at 1, got %q, %v", tip, err)
+	}
+	if err := snapshot.DB().Put("refs/heads/master", []byte("5\n")); !errors.Is(err, GitDb.ErrReadOnly) {
+		t.Errorf("Expected writing to the snapshot to fail with ErrReadOnly, got %v", err)
+	}
+}
+
+// TestValidateRepoIDReserved checks the names routed under /api/repos/ are
+// refused as repo IDs, but not as a namespace or a namespaced name
+func TestValidateRepoIDReserved(t *testing.T) {
+	for _, id := range []string{"prune", "scan", "validate"} {
+		if err := ValidateRepoID(id); !errors.Is(err, ErrInvalidRepoID) {
+			t.Errorf("Expected %q to be refused, got %v", id, err)
+		}
+	}
+	for _, id := range []string{"prunes", "org/validate", "scan/demo"} {
+		if err := ValidateRepoID(id); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", id, err)
+		}
+	}
+}
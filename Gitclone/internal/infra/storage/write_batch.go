@@ -26,6 +26,11 @@ func NewWriteBatch(store *RepoStore) *WriteBatch {
 	}
 }
 
+// Store returns the store the batch writes to
+func (wb *WriteBatch) Store() *RepoStore {
+	return wb.store
+}
+
 // Put adds a key-value pair to the batch
 func (wb *WriteBatch) Put(key string, value []byte) {
 	wb.writes = append(wb.writes, writeOp{key: key, value: value})
@@ -0,0 +1,90 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"GitDb"
+	"gitclone/internal/timefmt"
+)
+
+// auditPrefix starts the key of every audit entry
+const auditPrefix = "audit/"
+
+// auditKeyLayout is a fixed-width UTC timestamp, so audit keys sort in time order
+const auditKeyLayout = "2006-01-02T15:04:05.000000000Z"
+
+// AuditEntry records one mutating API call
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	Path   string    `json:"path"`
+	RepoID string    `json:"repoId,omitempty"` // empty for calls not about one repo
+	Actor  string    `json:"actor,omitempty"`  // empty when the caller didn't identify itself
+	Status int       `json:"status"`
+}
+
+// AppendAudit stores entry under audit/<timestamp>. Entries are never
+// rewritten; two entries in the same nanosecond get distinct, ordered keys.
+// The stored entry's Time is truncated to the second.
+func (s *Store) AppendAudit(entry AuditEntry) error {
+	s.auditMu.Lock()
+	defer s.auditMu.Unlock()
+
+	// The key keeps the full precision; the entry is stamped to the second
+	// like every other timestamp
+	keyTime := entry.Time.UTC()
+	if !keyTime.After(s.lastAudit) {
+		keyTime = s.lastAudit.Add(time.Nanosecond)
+	}
+	entry.Time = timefmt.UTC(entry.Time)
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+	if err := s.db.Put(auditPrefix+keyTime.Format(auditKeyLayout), data); err != nil {
+		return fmt.Errorf("failed to store audit entry: %w", err)
+	}
+	s.lastAudit = keyTime
+	return nil
+}
+
+// ListAudit returns the audit entries for repoID, oldest first. An empty
+// repoID returns every entry.
+func (s *Store) ListAudit(repoID string) ([]AuditEntry, error) {
+	latest := make(map[string]GitDb.Record)
+	err := s.db.Scan(func(record GitDb.Record) error {
+		if strings.HasPrefix(record.Key, auditPrefix) {
+			latest[record.Key] = record
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan audit log: %w", err)
+	}
+
+	keys := make([]string, 0, len(latest))
+	for key, record := range latest {
+		if !record.Deleted {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	entries := make([]AuditEntry, 0, len(keys))
+	for _, key := range keys {
+		var entry AuditEntry
+		if err := json.Unmarshal(latest[key].Value, &entry); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal audit entry %s: %w", key, err)
+		}
+		if repoID != "" && entry.RepoID != repoID {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
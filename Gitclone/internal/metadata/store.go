@@ -3,10 +3,15 @@ package metadata
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"GitDb"
+	"gitclone/internal/timefmt"
 )
 
 // RepoMeta represents repository metadata stored in gitDb
@@ -14,7 +19,8 @@ type RepoMeta struct {
 	ID            string    `json:"id"`
 	Name          string    `json:"name"`
 	Description   string    `json:"description,omitempty"`
-	CurrentBranch string    `json:"currentBranch"`
+	CurrentBranch string    `json:"currentBranch"` // cache of the repository's HEAD; see SetCurrentBranch
+	DefaultBranch string    `json:"defaultBranch,omitempty"`
 	BranchCount   int       `json:"branchCount"`
 	CommitCount   int       `json:"commitCount"`
 	CreatedAt     time.Time `json:"createdAt"`
@@ -22,10 +28,44 @@ type RepoMeta struct {
 	Missing       bool      `json:"missing,omitempty"` // true if repo folder doesn't exist
 }
 
+// RepoFilter narrows a repository listing
+type RepoFilter struct {
+	Query       string // case-insensitive substring of name or description; empty matches all
+	HideMissing bool   // drop repos whose folder no longer exists
+	OnlyMissing bool   // keep only repos whose folder no longer exists
+}
+
+// FilterRepos returns the repos that match filter, preserving order
+func FilterRepos(repos []RepoMeta, filter RepoFilter) []RepoMeta {
+	query := strings.ToLower(strings.TrimSpace(filter.Query))
+	filtered := make([]RepoMeta, 0, len(repos))
+	for _, meta := range repos {
+		if filter.HideMissing && meta.Missing {
+			continue
+		}
+		if filter.OnlyMissing && !meta.Missing {
+			continue
+		}
+		if query != "" &&
+			!strings.Contains(strings.ToLower(meta.Name), query) &&
+			!strings.Contains(strings.ToLower(meta.Description), query) {
+			continue
+		}
+		filtered = append(filtered, meta)
+	}
+	return filtered
+}
+
 // Store manages repository metadata in gitDb
 type Store struct {
-	dbPath string
-	db     *GitDb.DB
+	dbPath  string
+	db      GitDb.KV
+	closer  io.Closer  // the DB NewStore opened; nil for an injected KV
+	seqMu   sync.Mutex // serializes read-increment-write of sequence counters
+	indexMu sync.Mutex // serializes read-modify-write of repos:index
+	auditMu sync.Mutex // serializes audit appends so their keys stay ordered
+
+	lastAudit time.Time // time of the last audit entry appended
 }
 
 // NewStore creates a new metadata store
@@ -44,19 +84,26 @@ func NewStore(dbPath string) (*Store, error) {
 	return &Store{
 		dbPath: dbPath,
 		db:     db,
+		closer: db,
 	}, nil
 }
 
+// NewStoreWithKV creates a metadata store over an already open KV, such as a
+// GitDb.MemDB in tests. Close leaves kv open.
+func NewStoreWithKV(kv GitDb.KV) *Store {
+	return &Store{db: kv}
+}
+
 // Close closes the database
 func (s *Store) Close() error {
-	if s.db != nil {
-		return s.db.Close()
+	if s.closer != nil {
+		return s.closer.Close()
 	}
 	return nil
 }
 
 // GetDB returns the underlying database for direct access
-func (s *Store) GetDB() *GitDb.DB {
+func (s *Store) GetDB() GitDb.KV {
 	return s.db
 }
 
@@ -107,7 +154,8 @@ func (s *Store) GetRepo(id string) (*RepoMeta, error) {
 // CreateRepo creates a new repository metadata entry
 func (s *Store) CreateRepo(meta RepoMeta) error {
 	// Set timestamps
-	now := time.Now()
+	now := timefmt.Now()
+	meta.CreatedAt = timefmt.UTC(meta.CreatedAt)
 	if meta.CreatedAt.IsZero() {
 		meta.CreatedAt = now
 	}
@@ -132,12 +180,67 @@ func (s *Store) CreateRepo(meta RepoMeta) error {
 	return nil
 }
 
-// UpdateRepo updates existing repository metadata
+// UpdateRepo updates existing repository metadata and sets UpdatedAt to now.
+// It is for changes to the repository's content; use SetMissing for the
+// missing flag.
 func (s *Store) UpdateRepo(meta RepoMeta) error {
 	// Update timestamp
-	meta.UpdatedAt = time.Now()
+	meta.UpdatedAt = timefmt.Now()
 
-	// Store repo metadata
+	return s.putRepo(meta)
+}
+
+// SetMissing records whether a repository's folder is missing. Unlike
+// UpdateRepo it leaves UpdatedAt alone: noticing a deleted folder doesn't
+// change the repository.
+func (s *Store) SetMissing(id string, missing bool) error {
+	meta, err := s.GetRepo(id)
+	if err != nil {
+		return err
+	}
+	if meta.Missing == missing {
+		return nil
+	}
+	meta.Missing = missing
+	return s.putRepo(*meta)
+}
+
+// SetCurrentBranch refreshes the current branch cached for a repository.
+// HEAD in the repository is the source of truth; like SetMissing this leaves
+// UpdatedAt alone, since catching up with HEAD doesn't change the repository.
+func (s *Store) SetCurrentBranch(id, branch string) error {
+	meta, err := s.GetRepo(id)
+	if err != nil {
+		return err
+	}
+	if meta.CurrentBranch == branch {
+		return nil
+	}
+	meta.CurrentBranch = branch
+	return s.putRepo(*meta)
+}
+
+// Reconcile replaces a repository's current branch and its branch and commit
+// counts with values read from the repository itself, and clears the missing
+// flag since the repository could be read. Like SetCurrentBranch it leaves
+// UpdatedAt alone.
+func (s *Store) Reconcile(id, currentBranch string, branchCount, commitCount int) (*RepoMeta, error) {
+	meta, err := s.GetRepo(id)
+	if err != nil {
+		return nil, err
+	}
+	meta.CurrentBranch = currentBranch
+	meta.BranchCount = branchCount
+	meta.CommitCount = commitCount
+	meta.Missing = false
+	if err := s.putRepo(*meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// putRepo stores repository metadata as given
+func (s *Store) putRepo(meta RepoMeta) error {
 	key := fmt.Sprintf("repo:%s", meta.ID)
 	data, err := json.Marshal(meta)
 	if err != nil {
@@ -153,6 +256,9 @@ func (s *Store) UpdateRepo(meta RepoMeta) error {
 
 // EnsureIndexContains ensures the repo ID is in the index
 func (s *Store) EnsureIndexContains(id string) error {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
 	// Read current index
 	indexData, err := s.db.Get("repos:index")
 	var repoIDs []string
@@ -189,11 +295,80 @@ func (s *Store) EnsureIndexContains(id string) error {
 	return nil
 }
 
-// DeleteRepo removes a repository from metadata (but keeps it in index for now)
-// In a production system, you might want to remove from index too
-func (s *Store) DeleteRepo(id string) error {
-	// Note: GitDb might not have Delete, so we could set to empty or leave it
-	// For now, we'll just leave it - the missing flag will indicate it's gone
+// GetIdempotencyKey returns the repo ID created under an idempotency key
+func (s *Store) GetIdempotencyKey(key string) (string, bool) {
+	data, err := s.db.Get(fmt.Sprintf("idempotency:%s", key))
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// SetIdempotencyKey records that key created repoID
+func (s *Store) SetIdempotencyKey(key, repoID string) error {
+	if err := s.db.Put(fmt.Sprintf("idempotency:%s", key), []byte(repoID)); err != nil {
+		return fmt.Errorf("failed to store idempotency key: %w", err)
+	}
 	return nil
 }
 
+// NextIssueNumber allocates the next issue number for a repo. Numbers start
+// at 1 and are never reused; the counter lives at repo:<id>:issues:next.
+func (s *Store) NextIssueNumber(repoID string) (int, error) {
+	s.seqMu.Lock()
+	defer s.seqMu.Unlock()
+
+	key := fmt.Sprintf("repo:%s:issues:next", repoID)
+	next := 1
+	if data, err := s.db.Get(key); err == nil {
+		cur, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			return 0, fmt.Errorf("invalid issue counter %q: %w", data, err)
+		}
+		next = cur
+	}
+
+	if err := s.db.Put(key, []byte(fmt.Sprintf("%d\n", next+1))); err != nil {
+		return 0, fmt.Errorf("failed to update issue counter: %w", err)
+	}
+
+	return next, nil
+}
+
+// DeleteRepo removes a repository from the index, so it is no longer listed.
+// GitDb has no delete, so the repo:<id> record stays in the log; creating a
+// repo with the same ID later overwrites it.
+func (s *Store) DeleteRepo(id string) error {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	indexData, err := s.db.Get("repos:index")
+	if err != nil {
+		// No index, nothing listed
+		return nil
+	}
+	var repoIDs []string
+	if err := json.Unmarshal(indexData, &repoIDs); err != nil {
+		return fmt.Errorf("failed to unmarshal index: %w", err)
+	}
+
+	kept := make([]string, 0, len(repoIDs))
+	for _, existingID := range repoIDs {
+		if existingID != id {
+			kept = append(kept, existingID)
+		}
+	}
+	if len(kept) == len(repoIDs) {
+		return nil
+	}
+
+	data, err := json.Marshal(kept)
+	if err != nil {
+		return fmt.Errorf("failed to marshal index: %w", err)
+	}
+	if err := s.db.Put("repos:index", data); err != nil {
+		return fmt.Errorf("failed to update index: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,162 @@
+package metadata
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// TestFilterRepos verifies the query and missing filters used by the repo listing
+func TestFilterRepos(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-metadata-filter-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	store, err := NewStore(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create metadata store: %v", err)
+	}
+	defer store.Close()
+
+	for _, meta := range []RepoMeta{
+		{ID: "website", Name: "website", Description: "Marketing site"},
+		{ID: "api", Name: "api", Description: "Backend for the Website"},
+		{ID: "tools", Name: "tools", Description: "Scripts"},
+		{ID: "old-site", Name: "old-site", Description: "Archived website", Missing: true},
+	} {
+		if err := store.CreateRepo(meta); err != nil {
+			t.Fatalf("Failed to create repo %s: %v", meta.ID, err)
+		}
+	}
+
+	all, err := store.ListRepos()
+	if err != nil {
+		t.Fatalf("ListRepos failed: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		filter RepoFilter
+		want   []string
+	}{
+		{"no filter", RepoFilter{}, []string{"website", "api", "tools", "old-site"}},
+		{"name or description, case-insensitive", RepoFilter{Query: "WEBSITE"}, []string{"website", "api", "old-site"}},
+		{"hide missing", RepoFilter{HideMissing: true}, []string{"website", "api", "tools"}},
+		{"query and hide missing", RepoFilter{Query: "site", HideMissing: true}, []string{"website", "api"}},
+		{"only missing", RepoFilter{OnlyMissing: true}, []string{"old-site"}},
+		{"no match", RepoFilter{Query: "nothing"}, []string{}},
+	}
+
+	for _, tt := range tests {
+		got := FilterRepos(all, tt.filter)
+		if got == nil {
+			t.Errorf("%s: expected empty slice, got nil", tt.name)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: expected %d repos, got %d (%v)", tt.name, len(tt.want), len(got), got)
+			continue
+		}
+		for i, meta := range got {
+			if meta.ID != tt.want[i] {
+				t.Errorf("%s: position %d: expected %s, got %s", tt.name, i, tt.want[i], meta.ID)
+			}
+		}
+	}
+}
+
+// TestDeleteRepo checks a deleted repo drops out of the listing and the index
+// keeps the others in order
+func TestDeleteRepo(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-metadata-delete-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	store, err := NewStore(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create metadata store: %v", err)
+	}
+	defer store.Close()
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err := store.CreateRepo(RepoMeta{ID: id, Name: id}); err != nil {
+			t.Fatalf("Failed to create repo %s: %v", id, err)
+		}
+	}
+	if err := store.DeleteRepo("b"); err != nil {
+		t.Fatalf("DeleteRepo failed: %v", err)
+	}
+	if err := store.DeleteRepo("unknown"); err != nil {
+		t.Fatalf("DeleteRepo of an unknown repo failed: %v", err)
+	}
+
+	repos, err := store.ListRepos()
+	if err != nil {
+		t.Fatalf("ListRepos failed: %v", err)
+	}
+	if len(repos) != 2 || repos[0].ID != "a" || repos[1].ID != "c" {
+		t.Errorf("Expected a and c after deleting b, got %v", repos)
+	}
+}
+
+// TestSetMissingKeepsUpdatedAt checks that flagging a repo missing leaves
+// UpdatedAt alone while a content update moves it
+func TestSetMissingKeepsUpdatedAt(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-metadata-missing-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	store, err := NewStore(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create metadata store: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.CreateRepo(RepoMeta{ID: "demo", Name: "demo"}); err != nil {
+		t.Fatalf("Failed to create repo: %v", err)
+	}
+	created, err := store.GetRepo("demo")
+	if err != nil {
+		t.Fatalf("GetRepo failed: %v", err)
+	}
+
+	for _, missing := range []bool{true, false} {
+		if err := store.SetMissing("demo", missing); err != nil {
+			t.Fatalf("SetMissing(%v) failed: %v", missing, err)
+		}
+		meta, err := store.GetRepo("demo")
+		if err != nil {
+			t.Fatalf("GetRepo failed: %v", err)
+		}
+		if meta.Missing != missing {
+			t.Errorf("Expected Missing=%v, got %v", missing, meta.Missing)
+		}
+		if !meta.UpdatedAt.Equal(created.UpdatedAt) {
+			t.Errorf("SetMissing(%v) moved UpdatedAt from %v to %v", missing, created.UpdatedAt, meta.UpdatedAt)
+		}
+	}
+
+	// Timestamps have one-second resolution
+	time.Sleep(time.Second)
+	created.CommitCount = 1
+	if err := store.UpdateRepo(*created); err != nil {
+		t.Fatalf("UpdateRepo failed: %v", err)
+	}
+	meta, err := store.GetRepo("demo")
+	if err != nil {
+		t.Fatalf("GetRepo failed: %v", err)
+	}
+	if !meta.UpdatedAt.After(created.UpdatedAt) {
+		t.Errorf("Expected UpdateRepo to move UpdatedAt past %v, got %v", created.UpdatedAt, meta.UpdatedAt)
+	}
+
+	if err := store.SetMissing("unknown", true); err == nil {
+		t.Errorf("Expected SetMissing on an unknown repo to fail")
+	}
+}
@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"GitDb"
+	repostorage "gitclone/internal/infra/storage"
+)
+
+// ReachableCommits returns the set of commits reachable from tip, tip
+// included, following both parents of merge commits. It fails with
+// ErrCommitNotFound if tip doesn't exist; missing ancestors are left out.
+func ReachableCommits(store *repostorage.RepoStore, tip int) (map[int]bool, error) {
+	dist, err := ancestorDistances(store.DB(), tip)
+	if err != nil {
+		return nil, err
+	}
+	reachable := make(map[int]bool, len(dist))
+	for id := range dist {
+		reachable[id] = true
+	}
+	return reachable, nil
+}
+
+// IsAncestor reports whether commit a is commit b or one of its ancestors,
+// following both parents of merge commits. It fails with ErrCommitNotFound
+// if b doesn't exist.
+func IsAncestor(store *repostorage.RepoStore, a, b int) (bool, error) {
+	reachable, err := ReachableCommits(store, b)
+	if err != nil {
+		return false, err
+	}
+	return reachable[a], nil
+}
+
+// BranchesContaining returns the local branches whose tip has commitID in
+// its history, in the order ListBranchesFromStore lists them. Branches
+// without commits contain nothing. It fails with ErrCommitNotFound if
+// commitID doesn't exist.
+func BranchesContaining(store *repostorage.RepoStore, commitID int) ([]string, error) {
+	if _, err := readCommitObjectFromDB(store.DB(), commitID); err != nil {
+		if errors.Is(err, GitDb.ErrNotFound) {
+			return nil, fmt.Errorf("%w: %d", ErrCommitNotFound, commitID)
+		}
+		return nil, fmt.Errorf("commit %d: %w", commitID, err)
+	}
+
+	branches, err := ListBranchesFromStore(store)
+	if err != nil {
+		return nil, err
+	}
+	containing := []string{}
+	for _, branch := range branches {
+		tip, err := ReadHeadRefMaybeFromStore(store, branch)
+		if err != nil {
+			return nil, err
+		}
+		if tip == nil {
+			continue
+		}
+		contains, err := IsAncestor(store, commitID, *tip)
+		if errors.Is(err, ErrCommitNotFound) {
+			continue // a dangling ref has no history to search
+		}
+		if err != nil {
+			return nil, fmt.Errorf("branch %s: %w", branch, err)
+		}
+		if contains {
+			containing = append(containing, branch)
+		}
+	}
+	return containing, nil
+}
+
+// MergeBase returns the nearest common ancestor of commits a and b, following
+// both parents of merge commits, or nil if their histories are unrelated. A
+// commit is its own ancestor, so if a is an ancestor of b the result is a.
+// "Nearest" means fewest parent steps from a and b combined; ties go to the
+// higher (newer) commit ID.
+func MergeBase(store *repostorage.RepoStore, a, b int) (*int, error) {
+	return mergeBaseFromDB(store.DB(), a, b)
+}
+
+// mergeBaseFromDB implements MergeBase
+func mergeBaseFromDB(db GitDb.KV, a, b int) (*int, error) {
+	fromA, err := ancestorDistances(db, a)
+	if err != nil {
+		return nil, err
+	}
+	fromB, err := ancestorDistances(db, b)
+	if err != nil {
+		return nil, err
+	}
+
+	var base *int
+	best := 0
+	for id, distA := range fromA {
+		distB, ok := fromB[id]
+		if !ok {
+			continue
+		}
+		if base == nil || distA+distB < best || (distA+distB == best && id > *base) {
+			id := id
+			base = &id
+			best = distA + distB
+		}
+	}
+	return base, nil
+}
+
+// ancestorDistances walks Parent and Parent2 breadth-first from start and
+// returns each ancestor's distance in parent steps. start must exist
+// (ErrCommitNotFound otherwise); missing ancestors, as in legacy histories, end
+// their line of the walk.
+func ancestorDistances(db GitDb.KV, start int) (map[int]int, error) {
+	if _, err := readCommitObjectFromDB(db, start); err != nil {
+		if errors.Is(err, GitDb.ErrNotFound) {
+			return nil, fmt.Errorf("%w: %d", ErrCommitNotFound, start)
+		}
+		return nil, fmt.Errorf("commit %d: %w", start, err)
+	}
+
+	dist := map[int]int{start: 0}
+	parents := make(map[int][]int)
+	queue := []int{start}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+
+		c, err := readCommitObjectFromDB(db, id)
+		if err != nil {
+			continue
+		}
+		for _, parent := range []*int{c.Parent, c.Parent2} {
+			if parent == nil {
+				continue
+			}
+			parents[id] = append(parents[id], *parent)
+			if _, seen := dist[*parent]; !seen {
+				dist[*parent] = dist[id] + 1
+				queue = append(queue, *parent)
+			}
+		}
+	}
+	if id, ok := FindCycle(parents); ok {
+		return nil, fmt.Errorf("%w at commit %d", ErrCommitCycle, id)
+	}
+	return dist, nil
+}
+
+// FindCycle reports whether the parent links of a set of commits, mapping
+// each commit to its parents, contain a cycle, and returns a commit on or
+// behind one. A history is acyclic exactly when its commits can be removed
+// children first; whatever can't be removed is in or below a cycle.
+func FindCycle(parents map[int][]int) (int, bool) {
+	children := make(map[int]int) // commit -> number of child links to it
+	for _, ps := range parents {
+		for _, parent := range ps {
+			children[parent]++
+		}
+	}
+
+	var queue []int
+	for id := range parents {
+		if children[id] == 0 {
+			queue = append(queue, id)
+		}
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, parent := range parents[id] {
+			if children[parent]--; children[parent] == 0 {
+				queue = append(queue, parent)
+			}
+		}
+	}
+
+	for id, n := range children {
+		if n > 0 {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// ChildrenOf returns the commits whose Parent or Parent2 is commitID, oldest
+// first. It fails with ErrCommitNotFound if commitID doesn't exist.
+//
+// The first call scans every commit object to build a reverse index, which is
+// cached on store and reused until the log changes size, so walking forward
+// through a history costs one scan per store.
+func ChildrenOf(store *repostorage.RepoStore, commitID int) ([]int, error) {
+	db := store.DB()
+	if _, err := readCommitObjectFromDB(db, commitID); err != nil {
+		if errors.Is(err, GitDb.ErrNotFound) {
+			return nil, fmt.Errorf("%w: %d", ErrCommitNotFound, commitID)
+		}
+		return nil, fmt.Errorf("commit %d: %w", commitID, err)
+	}
+
+	// Taken before the scan, so a write during it invalidates the index
+	logSize, sized := store.LogSize()
+	if sized {
+		if children, ok := store.ChildIndex(logSize); ok {
+			return append([]int(nil), children[commitID]...), nil
+		}
+	}
+
+	children, err := buildChildIndex(db)
+	if err != nil {
+		return nil, err
+	}
+	if sized {
+		store.SetChildIndex(logSize, children)
+	}
+	return append([]int(nil), children[commitID]...), nil
+}
+
+// buildChildIndex scans the commit objects (objects/<id>) in db and maps each
+// commit to the commits naming it as Parent or Parent2
+func buildChildIndex(db GitDb.KV) (map[int][]int, error) {
+	parents := make(map[int][]int) // latest record of each commit
+	err := db.Scan(func(record GitDb.Record) error {
+		id, err := strconv.Atoi(strings.TrimPrefix(record.Key, "objects/"))
+		if err != nil || !strings.HasPrefix(record.Key, "objects/") {
+			return nil
+		}
+		if record.Deleted {
+			delete(parents, id)
+			return nil
+		}
+		var c Commit
+		if err := json.Unmarshal(record.Value, &c); err != nil {
+			return fmt.Errorf("commit %d: %w", id, err)
+		}
+		parents[id] = nil
+		for _, parent := range []*int{c.Parent, c.Parent2} {
+			if parent != nil {
+				parents[id] = append(parents[id], *parent)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan commits: %w", err)
+	}
+
+	children := make(map[int][]int)
+	for id, ps := range parents {
+		for i, parent := range ps {
+			// A merge of a branch into itself names the same parent twice
+			if i == 1 && parent == ps[0] {
+				continue
+			}
+			children[parent] = append(children[parent], id)
+		}
+	}
+	for _, ids := range children {
+		sort.Ints(ids)
+	}
+	return children, nil
+}
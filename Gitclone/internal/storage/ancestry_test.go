@@ -0,0 +1,273 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"GitDb"
+	repostorage "gitclone/internal/infra/storage"
+)
+
+// newAncestryStore returns an in-memory store holding this history:
+//
+//	1 - 2 - 3 - 5      (5 merges 4 into 3)
+//	     \     /
+//	      4 --+-- 6
+//
+//	10 - 11            (unrelated root)
+func newAncestryStore(t *testing.T) *repostorage.RepoStore {
+	t.Helper()
+	return newAncestryStoreOn(t, GitDb.NewMemDB())
+}
+
+// newAncestryStoreOn is newAncestryStore over kv
+func newAncestryStoreOn(t *testing.T, kv GitDb.KV) *repostorage.RepoStore {
+	t.Helper()
+	store, err := repostorage.NewRepoStoreWithKV("test-repo", "/nonexistent", kv)
+	if err != nil {
+		t.Fatalf("Failed to open RepoStore: %v", err)
+	}
+	if err := InitRepoStore(store, InitOptions{}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	id := func(n int) *int { return &n }
+	commits := []Commit{
+		{ID: 1, Message: "root"},
+		{ID: 2, Message: "two", Parent: id(1)},
+		{ID: 3, Message: "three", Parent: id(2)},
+		{ID: 4, Message: "feature", Parent: id(2)},
+		{ID: 5, Message: "merge feature", Parent: id(3), Parent2: id(4)},
+		{ID: 6, Message: "more feature", Parent: id(4)},
+		{ID: 10, Message: "unrelated root"},
+		{ID: 11, Message: "unrelated", Parent: id(10)},
+	}
+	batch := store.NewWriteBatch()
+	for _, c := range commits {
+		if err := WriteCommitObjectToBatch(batch, c, nil); err != nil {
+			t.Fatalf("Failed to write commit %d: %v", c.ID, err)
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("Failed to commit batch: %v", err)
+	}
+	return store
+}
+
+// TestReachableCommits checks that the reachable set of a merge includes both
+// parent lines and nothing from unrelated history
+func TestReachableCommits(t *testing.T) {
+	store := newAncestryStore(t)
+
+	got, err := ReachableCommits(store, 5)
+	if err != nil {
+		t.Fatalf("ReachableCommits failed: %v", err)
+	}
+	want := map[int]bool{1: true, 2: true, 3: true, 4: true, 5: true}
+	if len(got) != len(want) {
+		t.Fatalf("Expected reachable set %v, got %v", want, got)
+	}
+	for id := range want {
+		if !got[id] {
+			t.Errorf("Expected %d to be reachable from 5, got %v", id, got)
+		}
+	}
+
+	if _, err := ReachableCommits(store, 99); !errors.Is(err, ErrCommitNotFound) {
+		t.Errorf("Expected ErrCommitNotFound for a missing tip, got %v", err)
+	}
+}
+
+// TestMergeBase checks the nearest common ancestor on linear, diverged,
+// merged and unrelated histories (see newAncestryStore)
+func TestMergeBase(t *testing.T) {
+	store := newAncestryStore(t)
+	id := func(n int) *int { return &n }
+
+	tests := []struct {
+		name string
+		a, b int
+		want *int
+	}{
+		{"same commit", 3, 3, id(3)},
+		{"ancestor", 2, 3, id(2)},
+		{"ancestor reversed", 3, 2, id(2)},
+		{"diverged", 3, 4, id(2)},
+		{"after merge", 5, 6, id(4)}, // only reachable through the merge's second parent
+		{"unrelated", 3, 11, nil},
+	}
+	for _, tt := range tests {
+		got, err := MergeBase(store, tt.a, tt.b)
+		if err != nil {
+			t.Fatalf("%s: MergeBase(%d, %d) failed: %v", tt.name, tt.a, tt.b, err)
+		}
+		if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+			t.Errorf("%s: MergeBase(%d, %d) = %v, want %v", tt.name, tt.a, tt.b, deref(got), deref(tt.want))
+		}
+	}
+
+	if _, err := MergeBase(store, 3, 99); !errors.Is(err, ErrCommitNotFound) {
+		t.Errorf("Expected ErrCommitNotFound for a missing commit, got %v", err)
+	}
+}
+
+// scanCountingKV is a MemDB that counts its Scans
+type scanCountingKV struct {
+	*GitDb.MemDB
+	scans int
+}
+
+// Scan counts the scan and runs it on the MemDB
+func (kv *scanCountingKV) Scan(fn func(GitDb.Record) error) error {
+	kv.scans++
+	return kv.MemDB.Scan(fn)
+}
+
+// TestChildrenOf checks forward traversal on the branched history of
+// newAncestryStore, that the reverse index is built once for all the calls,
+// and that a commit written after them shows up
+func TestChildrenOf(t *testing.T) {
+	kv := &scanCountingKV{MemDB: GitDb.NewMemDB()}
+	store := newAncestryStoreOn(t, kv)
+	kv.scans = 0
+
+	tests := []struct {
+		name     string
+		commitID int
+		want     []int
+	}{
+		{"fork point", 2, []int{3, 4}},
+		{"merged branch", 4, []int{5, 6}}, // 5 through its second parent
+		{"merge parent", 3, []int{5}},
+		{"tip", 6, nil},
+		{"unrelated root", 10, []int{11}},
+	}
+	for _, tt := range tests {
+		got, err := ChildrenOf(store, tt.commitID)
+		if err != nil {
+			t.Fatalf("%s: ChildrenOf(%d) failed: %v", tt.name, tt.commitID, err)
+		}
+		if len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+			t.Errorf("%s: ChildrenOf(%d) = %v, want %v", tt.name, tt.commitID, got, tt.want)
+		}
+	}
+
+	if _, err := ChildrenOf(store, 99); !errors.Is(err, ErrCommitNotFound) {
+		t.Errorf("Expected ErrCommitNotFound for a missing commit, got %v", err)
+	}
+	if kv.scans != 1 {
+		t.Errorf("Expected one scan for %d calls, got %d", len(tests), kv.scans)
+	}
+
+	// A commit written after the first calls must show up
+	next, err := NextCommitIDFromStore(store)
+	if err != nil {
+		t.Fatalf("Failed to allocate commit ID: %v", err)
+	}
+	parent := 6
+	batch := store.NewWriteBatch()
+	if err := WriteCommitObjectToBatch(batch, Commit{ID: next, Message: "after index", Parent: &parent}, nil); err != nil {
+		t.Fatalf("Failed to write commit %d: %v", next, err)
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("Failed to commit batch: %v", err)
+	}
+	got, err := ChildrenOf(store, 6)
+	if err != nil {
+		t.Fatalf("ChildrenOf(6) failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, []int{next}) {
+		t.Errorf("Expected ChildrenOf(6) = [%d] after a new commit, got %v", next, got)
+	}
+	if kv.scans != 2 {
+		t.Errorf("Expected the new commit to cause one rescan, got %d scans", kv.scans)
+	}
+}
+
+// TestBranchesContaining points master at 3, feature at 6 and other at 11
+// (see newAncestryStore) and checks which branches contain shared and
+// single-branch commits
+func TestBranchesContaining(t *testing.T) {
+	store := newAncestryStore(t)
+
+	batch := store.NewWriteBatch()
+	for _, ref := range []struct {
+		branch string
+		tip    int
+	}{{"master", 3}, {"feature", 6}, {"other", 11}} {
+		if err := WriteHeadRefToBatch(batch, ref.branch, ref.tip); err != nil {
+			t.Fatalf("Failed to write %s: %v", ref.branch, err)
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("Failed to commit batch: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		commitID int
+		want     []string
+	}{
+		{"before branching", 2, []string{"master", "feature"}},
+		{"feature only", 4, []string{"feature"}},
+		{"master only", 3, []string{"master"}},
+		{"unrelated", 10, []string{"other"}},
+		{"on no branch", 5, []string{}},
+	}
+	for _, tt := range tests {
+		got, err := BranchesContaining(store, tt.commitID)
+		if err != nil {
+			t.Fatalf("%s: BranchesContaining(%d) failed: %v", tt.name, tt.commitID, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: BranchesContaining(%d) = %v, want %v", tt.name, tt.commitID, got, tt.want)
+		}
+	}
+
+	if _, err := BranchesContaining(store, 99); !errors.Is(err, ErrCommitNotFound) {
+		t.Errorf("Expected ErrCommitNotFound for a missing commit, got %v", err)
+	}
+}
+
+// TestAncestryCycle checks that walks over a corrupt history, a self-parented
+// commit or a two-commit loop, fail with ErrCommitCycle, and that merges
+// sharing history aren't mistaken for cycles
+func TestAncestryCycle(t *testing.T) {
+	store := newAncestryStore(t)
+	id := func(n int) *int { return &n }
+
+	batch := store.NewWriteBatch()
+	for _, c := range []Commit{
+		{ID: 20, Message: "own parent", Parent: id(20)},
+		{ID: 21, Message: "loop a", Parent: id(22)},
+		{ID: 22, Message: "loop b", Parent: id(1), Parent2: id(21)},
+	} {
+		if err := WriteCommitObjectToBatch(batch, c, nil); err != nil {
+			t.Fatalf("Failed to write commit %d: %v", c.ID, err)
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("Failed to commit batch: %v", err)
+	}
+
+	for _, tip := range []int{20, 21, 22} {
+		if _, err := ReachableCommits(store, tip); !errors.Is(err, ErrCommitCycle) {
+			t.Errorf("Expected ErrCommitCycle walking from %d, got %v", tip, err)
+		}
+	}
+	if _, err := MergeBase(store, 5, 21); !errors.Is(err, ErrCommitCycle) {
+		t.Errorf("Expected ErrCommitCycle from MergeBase, got %v", err)
+	}
+	if _, err := ReachableCommits(store, 5); err != nil {
+		t.Errorf("Expected the merge at 5 to walk cleanly, got %v", err)
+	}
+}
+
+// deref formats an optional commit ID for test messages
+func deref(id *int) interface{} {
+	if id == nil {
+		return nil
+	}
+	return *id
+}
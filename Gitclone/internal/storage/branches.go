@@ -13,17 +13,26 @@ func ListBranches(root string, opts InitOptions) ([]string, error) {
 	}
 	defer db.Close()
 
+	return listBranchesFromDB(db)
+}
+
+// listBranchesFromDB returns each refs/heads/* branch once, in the order the
+// branches were first written
+func listBranchesFromDB(db GitDb.KV) ([]string, error) {
 	var branches []string
-	
-	// Scan for all refs/heads/* keys
-	err = db.Scan(func(record GitDb.Record) error {
+	seen := make(map[string]bool)
+
+	// Scan for all refs/heads/* keys; every ref update appends a record
+	err := db.Scan(func(record GitDb.Record) error {
 		if strings.HasPrefix(record.Key, "refs/heads/") {
 			branchName := strings.TrimPrefix(record.Key, "refs/heads/")
-			branches = append(branches, branchName)
+			if !seen[branchName] {
+				seen[branchName] = true
+				branches = append(branches, branchName)
+			}
 		}
 		return nil
 	})
 
 	return branches, err
 }
-
@@ -1,21 +1,99 @@
 package storage
 
 import (
+	"crypto/sha1"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
+
+	"GitDb"
 )
 
+// ErrCommitHashMismatch is returned by VerifyCommit when a commit's stored hash
+// doesn't match its contents
+var ErrCommitHashMismatch = errors.New("commit hash mismatch")
+
+// ErrCommitNotFound is returned when a commit ID names no stored commit
+var ErrCommitNotFound = errors.New("commit not found")
+
+// ErrCommitCycle is returned by history walks that find a commit among its
+// own ancestors, which only corrupt data can produce
+var ErrCommitCycle = errors.New("commit history has a cycle")
+
+// DefaultAuthor is recorded on commits that don't name an author.
+const DefaultAuthor = "system"
+
 // Commit represents a single commit stored on disk.
+// Author and Timestamp (the author date) describe who made the change and
+// when; Committer and CommitterDate describe who wrote this commit object and
+// when. They are the same for a new commit, while an amend keeps the author
+// and records a new committer. Commits written before committers were
+// recorded have neither.
 type Commit struct {
-	ID        int    `json:"id"`
-	Message   string `json:"message"`
-	Branch    string `json:"branch"`
-	Timestamp int64  `json:"timestamp"`
-	Parent    *int   `json:"parent,omitempty"`
-	Parent2   *int   `json:"parent2,omitempty"`
+	ID            int    `json:"id"`
+	Message       string `json:"message"`
+	Branch        string `json:"branch"`
+	Timestamp     int64  `json:"timestamp"`
+	Author        string `json:"author,omitempty"`
+	Committer     string `json:"committer,omitempty"`
+	CommitterDate int64  `json:"committerDate,omitempty"`
+	Parent        *int   `json:"parent,omitempty"`
+	Parent2       *int   `json:"parent2,omitempty"`
+	Hash          string `json:"hash,omitempty"` // SHA1 over the canonical fields, see CommitHash
+}
+
+// CommitHash computes the content hash of a commit: SHA1 over a digest of its
+// tree, its parents, author, timestamp, committer and message in a fixed
+// textual layout. The Hash field itself is not included, and the committer
+// line only when there is one.
+func CommitHash(commit Commit, tree []TreeEntry) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "tree %s\n", treeDigest(tree))
+	for _, parent := range []*int{commit.Parent, commit.Parent2} {
+		if parent != nil {
+			fmt.Fprintf(&b, "parent %d\n", *parent)
+		}
+	}
+	fmt.Fprintf(&b, "author %s\n", commit.Author)
+	fmt.Fprintf(&b, "timestamp %d\n", commit.Timestamp)
+	if commit.Committer != "" {
+		fmt.Fprintf(&b, "committer %s %d\n", commit.Committer, commit.CommitterDate)
+	}
+	fmt.Fprintf(&b, "\n%s", commit.Message)
+	return fmt.Sprintf("%x", sha1.Sum([]byte(b.String())))
+}
+
+// treeDigest returns SHA1 over the mode, path and blob ID of each tree entry,
+// sorted by path, so a commit's hash covers the files it records
+func treeDigest(tree []TreeEntry) string {
+	entries := append([]TreeEntry(nil), tree...)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	h := sha1.New()
+	for _, entry := range entries {
+		fmt.Fprintf(h, "%s %s %s\n", entry.Mode, entry.Path, entry.BlobID)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// VerifyCommit recomputes the hash of a commit with the given tree and
+// compares it with the stored one. Commits written before hashes were
+// introduced have no hash, and commits hashed before the hash covered the
+// tree have one that no longer matches; both fail verification.
+func VerifyCommit(commit Commit, tree []TreeEntry) error {
+	if commit.Hash == "" {
+		return fmt.Errorf("commit %d has no hash: %w", commit.ID, ErrCommitHashMismatch)
+	}
+	if want := CommitHash(commit, tree); commit.Hash != want {
+		return fmt.Errorf("commit %d: stored %s, computed %s: %w", commit.ID, commit.Hash, want, ErrCommitHashMismatch)
+	}
+	return nil
 }
 
 // WriteCommitObject serializes a commit as JSON and writes it to the database.
+// It is hashed over its tree, stored under the commit's ID, so the tree is
+// written first.
 func WriteCommitObject(root string, options InitOptions, commit Commit) error {
 	db, err := openDB(root, options)
 	if err != nil {
@@ -23,15 +101,43 @@ func WriteCommitObject(root string, options InitOptions, commit Commit) error {
 	}
 	defer db.Close()
 
+	tree, err := readTreeMaybeFromDB(db, commit.ID)
+	if err != nil {
+		return err
+	}
+	commit = completeCommit(commit, tree)
+
 	// Encode commit as JSON
 	data, err := json.MarshalIndent(commit, "", "  ")
 	if err != nil {
 		return err
 	}
 
-	// Write commit to DB with key "objects/<id>"
+	// Write commit to DB with key "objects/<id>", plus the content-addressed copy
 	key := fmt.Sprintf("objects/%d", commit.ID)
-	return db.Put(key, data)
+	if err := db.Put(key, data); err != nil {
+		return err
+	}
+	return db.Put(commitHashKey(commit.Hash), data)
+}
+
+// completeCommit fills in the defaults of a commit about to be written (the
+// default author, and the author as committer) and sets its hash over tree
+func completeCommit(commit Commit, tree []TreeEntry) Commit {
+	if commit.Author == "" {
+		commit.Author = DefaultAuthor
+	}
+	if commit.Committer == "" {
+		commit.Committer = commit.Author
+		commit.CommitterDate = commit.Timestamp
+	}
+	commit.Hash = CommitHash(commit, tree)
+	return commit
+}
+
+// commitHashKey returns the content-addressed key of a commit
+func commitHashKey(hash string) string {
+	return "objects/commit/" + hash
 }
 
 // ReadCommitObject loads and deserializes a commit from the database.
@@ -42,6 +148,11 @@ func ReadCommitObject(root string, opts InitOptions, id int) (Commit, error) {
 	}
 	defer db.Close()
 
+	return readCommitObjectFromDB(db, id)
+}
+
+// readCommitObjectFromDB loads objects/<id> from an open DB
+func readCommitObjectFromDB(db GitDb.KV, id int) (Commit, error) {
 	// Read commit from DB
 	key := fmt.Sprintf("objects/%d", id)
 	data, err := db.Get(key)
@@ -57,3 +168,28 @@ func ReadCommitObject(root string, opts InitOptions, id int) (Commit, error) {
 
 	return c, nil
 }
+
+// ReadCommitByHash loads a commit by its content hash.
+func ReadCommitByHash(root string, opts InitOptions, hash string) (Commit, error) {
+	db, err := openDB(root, opts)
+	if err != nil {
+		return Commit{}, err
+	}
+	defer db.Close()
+
+	return readCommitByHashFromDB(db, hash)
+}
+
+func readCommitByHashFromDB(db GitDb.KV, hash string) (Commit, error) {
+	data, err := db.Get(commitHashKey(hash))
+	if err != nil {
+		return Commit{}, fmt.Errorf("commit %s not found: %w", hash, err)
+	}
+
+	var c Commit
+	if err := json.Unmarshal(data, &c); err != nil {
+		return Commit{}, err
+	}
+
+	return c, nil
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// TestVerifyCommit verifies that written commits carry a content hash and that
+// tampering with the stored object is detected
+func TestVerifyCommit(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-commit-hash-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	options := InitOptions{Bare: false}
+	if err := InitRepo(tmpDir, options); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	tree := []TreeEntry{
+		{Path: "a.txt", BlobID: "blob-a", Mode: "100644", Type: "blob"},
+		{Path: "b.txt", BlobID: "blob-b", Mode: "100644", Type: "blob"},
+	}
+	if err := WriteTree(tmpDir, options, 1, tree); err != nil {
+		t.Fatalf("Failed to write tree: %v", err)
+	}
+	parent := 0
+	for _, commit := range []Commit{
+		{ID: 0, Message: "first", Branch: "master", Timestamp: 1000},
+		{ID: 1, Message: "second", Branch: "master", Timestamp: 2000, Parent: &parent},
+	} {
+		if err := WriteCommitObject(tmpDir, options, commit); err != nil {
+			t.Fatalf("Failed to write commit %d: %v", commit.ID, err)
+		}
+	}
+
+	stored, err := ReadCommitObject(tmpDir, options, 1)
+	if err != nil {
+		t.Fatalf("Failed to read commit: %v", err)
+	}
+	if stored.Hash == "" {
+		t.Fatalf("Expected written commit to have a hash")
+	}
+	if err := VerifyCommit(stored, tree); err != nil {
+		t.Fatalf("Expected untampered commit to verify, got %v", err)
+	}
+	if err := VerifyCommit(stored, []TreeEntry{tree[1], tree[0]}); err != nil {
+		t.Errorf("Expected the hash not to depend on tree order, got %v", err)
+	}
+
+	// A commit whose tree was changed must not verify
+	swapped := []TreeEntry{tree[0], {Path: "b.txt", BlobID: "blob-forged", Mode: "100644", Type: "blob"}}
+	if err := VerifyCommit(stored, swapped); !errors.Is(err, ErrCommitHashMismatch) {
+		t.Errorf("Expected ErrCommitHashMismatch for a changed tree, got %v", err)
+	}
+
+	// Rewrite the stored object with a different message but the old hash
+	db, err := openDB(tmpDir, options)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	tampered := fmt.Sprintf(`{"id": 1, "message": "forged", "branch": "master", "timestamp": 2000, "parent": 0, "hash": %q}`, stored.Hash)
+	if err := db.Put("objects/1", []byte(tampered)); err != nil {
+		t.Fatalf("Failed to overwrite commit: %v", err)
+	}
+	db.Close()
+
+	forged, err := ReadCommitObject(tmpDir, options, 1)
+	if err != nil {
+		t.Fatalf("Failed to read tampered commit: %v", err)
+	}
+	if err := VerifyCommit(forged, tree); !errors.Is(err, ErrCommitHashMismatch) {
+		t.Errorf("Expected ErrCommitHashMismatch for tampered commit, got %v", err)
+	}
+
+	// A re-parented commit must not verify either
+	other := 5
+	forged.Message = stored.Message
+	forged.Parent = &other
+	if err := VerifyCommit(forged, tree); !errors.Is(err, ErrCommitHashMismatch) {
+		t.Errorf("Expected ErrCommitHashMismatch for re-parented commit, got %v", err)
+	}
+}
+
+// TestReadCommitByHash verifies that a commit reads back identically by ID and by hash
+func TestReadCommitByHash(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-commit-by-hash-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	options := InitOptions{Bare: false}
+	if err := InitRepo(tmpDir, options); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	parent := 0
+	commit := Commit{ID: 1, Message: "second", Branch: "master", Timestamp: 2000, Parent: &parent}
+	if err := WriteCommitObject(tmpDir, options, commit); err != nil {
+		t.Fatalf("Failed to write commit: %v", err)
+	}
+
+	byID, err := ReadCommitObject(tmpDir, options, 1)
+	if err != nil {
+		t.Fatalf("Failed to read commit by ID: %v", err)
+	}
+	byHash, err := ReadCommitByHash(tmpDir, options, byID.Hash)
+	if err != nil {
+		t.Fatalf("Failed to read commit by hash: %v", err)
+	}
+
+	if byHash.ID != byID.ID || byHash.Message != byID.Message || byHash.Branch != byID.Branch ||
+		byHash.Timestamp != byID.Timestamp || byHash.Hash != byID.Hash ||
+		byHash.Parent == nil || *byHash.Parent != *byID.Parent {
+		t.Errorf("Expected equal commits, by ID %+v, by hash %+v", byID, byHash)
+	}
+
+	if _, err := ReadCommitByHash(tmpDir, options, "0000000000000000000000000000000000000000"); err == nil {
+		t.Errorf("Expected error for unknown hash")
+	}
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	repostorage "gitclone/internal/infra/storage"
+)
+
+// Repository config
+//
+// Per-repo settings live in the repository's GitDb under config/<name>, like
+// meta/DEFAULT_BRANCH, so the CLI and the server read the same values. Only
+// the settings in configSettings can be written; a missing key means the
+// setting's default.
+
+// Values of merge.ff, which decides whether a merge that could fast-forward
+// does so
+const (
+	MergeFFAllow = "true"  // fast-forward when possible, otherwise merge (default)
+	MergeFFNever = "false" // always create a merge commit
+	MergeFFOnly  = "only"  // fast-forward, and refuse merges that can't
+)
+
+// configSettings lists each known setting's allowed values, default first
+var configSettings = map[string][]string{
+	"merge.ff": {MergeFFAllow, MergeFFNever, MergeFFOnly},
+}
+
+// configKey returns the key of a config setting
+func configKey(name string) string {
+	return "config/" + name
+}
+
+// ReadConfigFromStore returns the value of a config setting, or its default
+// if the repository doesn't set it
+func ReadConfigFromStore(store *repostorage.RepoStore, name string) (string, error) {
+	allowed, ok := configSettings[name]
+	if !ok {
+		return "", fmt.Errorf("unknown config setting: %s", name)
+	}
+	b, err := store.DB().Get(configKey(name))
+	if err != nil {
+		return allowed[0], nil
+	}
+	value := strings.TrimSpace(string(b))
+	for _, v := range allowed {
+		if v == value {
+			return value, nil
+		}
+	}
+	// An unrecognized stored value falls back rather than breaking merges
+	return allowed[0], nil
+}
+
+// WriteConfigToBatch sets a config setting in a batch
+func WriteConfigToBatch(batch *repostorage.WriteBatch, name, value string) error {
+	allowed, ok := configSettings[name]
+	if !ok {
+		return fmt.Errorf("unknown config setting: %s", name)
+	}
+	for _, v := range allowed {
+		if v == value {
+			batch.Put(configKey(name), []byte(value+"\n"))
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid value for %s: %q (want one of %s)", name, value, strings.Join(allowed, ", "))
+}
+
+// ConfigSettings returns the names of the known config settings, sorted
+func ConfigSettings() []string {
+	names := make([]string, 0, len(configSettings))
+	for name := range configSettings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+
+	"GitDb"
+)
+
+// DiffStat summarizes a set of tree changes as files and lines changed
+type DiffStat struct {
+	FilesChanged int
+	Insertions   int
+	Deletions    int
+}
+
+// maxLineDiffCells bounds the line-matching work per file; beyond it the
+// differing middle of the file counts as fully removed and re-added
+const maxLineDiffCells = 4_000_000
+
+// CountLineChanges returns how many lines were added and removed going from
+// oldContent to newContent, based on their longest common subsequence of lines
+func CountLineChanges(oldContent, newContent []byte) (insertions, deletions int) {
+	oldLines := splitLines(oldContent)
+	newLines := splitLines(newContent)
+
+	// Common prefix and suffix don't need the quadratic match
+	for len(oldLines) > 0 && len(newLines) > 0 && bytes.Equal(oldLines[0], newLines[0]) {
+		oldLines, newLines = oldLines[1:], newLines[1:]
+	}
+	for len(oldLines) > 0 && len(newLines) > 0 && bytes.Equal(oldLines[len(oldLines)-1], newLines[len(newLines)-1]) {
+		oldLines, newLines = oldLines[:len(oldLines)-1], newLines[:len(newLines)-1]
+	}
+
+	common := 0
+	if len(oldLines)*len(newLines) <= maxLineDiffCells {
+		common = commonLineCount(oldLines, newLines)
+	}
+	return len(newLines) - common, len(oldLines) - common
+}
+
+// splitLines splits content into lines without their terminators
+func splitLines(content []byte) [][]byte {
+	if len(content) == 0 {
+		return nil
+	}
+	lines := bytes.Split(content, []byte("\n"))
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// commonLineCount returns the length of the longest common subsequence of lines
+func commonLineCount(a, b [][]byte) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			switch {
+			case bytes.Equal(a[i-1], b[j-1]):
+				cur[j] = prev[j-1] + 1
+			case prev[j] >= cur[j-1]:
+				cur[j] = prev[j]
+			default:
+				cur[j] = cur[j-1]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// diffStatFromDB counts files and lines changed, reading blob contents from db
+func diffStatFromDB(db GitDb.KV, changes []TreeChange) (DiffStat, error) {
+	stat := DiffStat{FilesChanged: len(changes)}
+	for _, change := range changes {
+		var oldContent, newContent []byte
+		var err error
+		if change.OldBlobID != "" {
+			if oldContent, err = db.Get(fmt.Sprintf("objects/blob/%s", change.OldBlobID)); err != nil {
+				return DiffStat{}, fmt.Errorf("blob not found for %s: %s", change.Path, change.OldBlobID)
+			}
+		}
+		if change.NewBlobID != "" {
+			if newContent, err = db.Get(fmt.Sprintf("objects/blob/%s", change.NewBlobID)); err != nil {
+				return DiffStat{}, fmt.Errorf("blob not found for %s: %s", change.Path, change.NewBlobID)
+			}
+		}
+		insertions, deletions := CountLineChanges(oldContent, newContent)
+		stat.Insertions += insertions
+		stat.Deletions += deletions
+	}
+	return stat, nil
+}
@@ -0,0 +1,25 @@
+package storage
+
+import "testing"
+
+// TestCountLineChanges checks insertions and deletions for common edits
+func TestCountLineChanges(t *testing.T) {
+	cases := []struct {
+		name, old, new        string
+		insertions, deletions int
+	}{
+		{"added file", "", "a\nb\n", 2, 0},
+		{"removed file", "a\nb\nc\n", "", 0, 3},
+		{"unchanged", "a\nb\n", "a\nb\n", 0, 0},
+		{"replaced line", "a\nb\nc\n", "a\nB\nc\n", 1, 1},
+		{"inserted in middle", "a\nc\n", "a\nb\nc\n", 1, 0},
+		{"moved line", "a\nb\nc\n", "b\nc\na\n", 1, 1},
+		{"no trailing newline", "a", "a\nb", 1, 0},
+	}
+	for _, tc := range cases {
+		insertions, deletions := CountLineChanges([]byte(tc.old), []byte(tc.new))
+		if insertions != tc.insertions || deletions != tc.deletions {
+			t.Errorf("%s: expected +%d -%d, got +%d -%d", tc.name, tc.insertions, tc.deletions, insertions, deletions)
+		}
+	}
+}
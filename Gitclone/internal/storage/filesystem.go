@@ -1,16 +1,27 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
+
+	"GitDb"
+	repostorage "gitclone/internal/infra/storage"
 )
 
 const RepoDir = ".gitclone"
 
+// ErrInvalidBackup is returned by RestoreRepo when the supplied log is unusable.
+var ErrInvalidBackup = errors.New("invalid backup")
+
 type InitOptions struct {
 	Bare bool
+	// InitialBranch names the branch HEAD points at in a new repository, which
+	// also becomes its default branch. Empty means DefaultBranch. Only InitRepo
+	// reads it.
+	InitialBranch string
 }
 
 // InRepo checks whether the current folder already contains a gitclone repository.
@@ -37,6 +48,14 @@ func InitRepo(root string, options InitOptions) error {
 		return fmt.Errorf("repository already initialized")
 	}
 
+	initialBranch := options.InitialBranch
+	if initialBranch == "" {
+		initialBranch = DefaultBranch
+	}
+	if err := validateBranch(initialBranch); err != nil {
+		return err
+	}
+
 	// Create directory structure (config file and objects directory still needed)
 	gitcloneStructure := map[string]any{
 		"config":  "[core]\n\tbare = " + strconv.FormatBool(options.Bare) + "\n",
@@ -64,24 +83,74 @@ func InitRepo(root string, options InitOptions) error {
 	}
 	defer db.Close()
 
+	return initRepoDB(db, initialBranch)
+}
+
+// initRepoDB writes the keys of a new repository on initialBranch
+func initRepoDB(db GitDb.KV, initialBranch string) error {
 	// Initialize HEAD
-	if err := db.Put("meta/HEAD", []byte("ref: refs/heads/master\n")); err != nil {
+	if err := db.Put("meta/HEAD", headValue(initialBranch)); err != nil {
 		return fmt.Errorf("failed to initialize HEAD: %w", err)
 	}
 
+	// Initialize DEFAULT_BRANCH
+	if err := db.Put(defaultBranchKey, []byte(initialBranch+"\n")); err != nil {
+		return fmt.Errorf("failed to initialize DEFAULT_BRANCH: %w", err)
+	}
+
 	// Initialize NEXT_COMMIT_ID
 	if err := db.Put("meta/NEXT_COMMIT_ID", []byte("0\n")); err != nil {
 		return fmt.Errorf("failed to initialize NEXT_COMMIT_ID: %w", err)
 	}
 
-	// Initialize master branch ref (empty for new branch)
-	if err := db.Put("refs/heads/master", []byte("")); err != nil {
-		return fmt.Errorf("failed to initialize master ref: %w", err)
+	// Record the schema version so later releases can migrate this repo
+	if err := db.Put(repostorage.SchemaVersionKey, []byte(fmt.Sprintf("%d\n", repostorage.SchemaVersion))); err != nil {
+		return fmt.Errorf("failed to initialize SCHEMA_VERSION: %w", err)
+	}
+
+	// Initialize the initial branch ref (empty for new branch)
+	if err := db.Put(headRefKey(initialBranch), []byte("")); err != nil {
+		return fmt.Errorf("failed to initialize %s ref: %w", initialBranch, err)
 	}
 
 	return nil
 }
 
+// RestoreRepo creates a new repository whose database is the given GitDb log.
+// The log is validated before anything is written and must contain a HEAD.
+func RestoreRepo(root string, options InitOptions, log []byte) error {
+	if InRepo(root, options) {
+		return fmt.Errorf("repository already initialized")
+	}
+	if err := GitDb.ValidateLog(log); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+
+	tree := map[string]any{
+		"config":  "[core]\n\tbare = " + strconv.FormatBool(options.Bare) + "\n",
+		"objects": map[string]any{},
+		"db":      map[string]any{},
+	}
+	if !options.Bare {
+		tree = map[string]any{RepoDir: tree}
+	}
+	if err := WriteFilesFromTree(root, tree); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dbPath(root, options), "log"), log, 0644); err != nil {
+		return fmt.Errorf("failed to write log: %w", err)
+	}
+
+	if _, err := ReadHEADBranch(root, options); err != nil {
+		// Undo only what was created above
+		for name := range tree {
+			os.RemoveAll(filepath.Join(root, name))
+		}
+		return fmt.Errorf("%w: missing HEAD: %v", ErrInvalidBackup, err)
+	}
+	return nil
+}
+
 // WriteFilesFromTree writes a nested file/directory structure to disk.
 func WriteFilesFromTree(root string, tree map[string]any) error {
 	for name, val := range tree {
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"os"
+	"testing"
+)
+
+// TestInitRepoInitialBranch verifies that HEAD, the initial ref and the default
+// branch follow InitOptions.InitialBranch, and that master stays the default
+func TestInitRepoInitialBranch(t *testing.T) {
+	tests := []struct {
+		initialBranch string
+		want          string
+	}{
+		{"", "master"},
+		{"main", "main"},
+	}
+	for _, tt := range tests {
+		tmpDir, err := os.MkdirTemp("", "gitstore-init-test-*")
+		if err != nil {
+			t.Fatalf("Failed to create temp dir: %v", err)
+		}
+		defer os.RemoveAll(tmpDir)
+
+		options := InitOptions{Bare: false, InitialBranch: tt.initialBranch}
+		if err := InitRepo(tmpDir, options); err != nil {
+			t.Fatalf("Failed to init repo: %v", err)
+		}
+
+		head, err := ReadHEADBranch(tmpDir, options)
+		if err != nil || head != tt.want {
+			t.Errorf("InitialBranch %q: expected HEAD %s, got %q (err %v)", tt.initialBranch, tt.want, head, err)
+		}
+		branches, err := ListBranches(tmpDir, options)
+		if err != nil || len(branches) != 1 || branches[0] != tt.want {
+			t.Errorf("InitialBranch %q: expected only branch %s, got %v (err %v)", tt.initialBranch, tt.want, branches, err)
+		}
+		if tip, err := ReadHeadRefMaybe(tmpDir, options, tt.want); err != nil || tip != nil {
+			t.Errorf("InitialBranch %q: expected an empty %s ref, got %v (err %v)", tt.initialBranch, tt.want, tip, err)
+		}
+		if def, err := ReadDefaultBranch(tmpDir, options); err != nil || def != tt.want {
+			t.Errorf("InitialBranch %q: expected default branch %s, got %q (err %v)", tt.initialBranch, tt.want, def, err)
+		}
+	}
+
+	tmpDir, err := os.MkdirTemp("", "gitstore-init-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := InitRepo(tmpDir, InitOptions{InitialBranch: "bad name"}); err == nil {
+		t.Errorf("Expected an invalid initial branch to be rejected")
+	}
+	if InRepo(tmpDir, InitOptions{}) {
+		t.Errorf("Expected a rejected init to leave no repository behind")
+	}
+}
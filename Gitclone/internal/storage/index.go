@@ -12,7 +12,7 @@ func GetStagedFiles(root string, options InitOptions) ([]string, error) {
 
 	paths := make([]string, 0, len(entries))
 	for path, entry := range entries {
-		if entry.BlobID != "" {
+		if entry.IsStaged() {
 			paths = append(paths, path)
 		}
 	}
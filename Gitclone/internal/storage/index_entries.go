@@ -11,19 +11,41 @@ import (
 	"GitDb"
 )
 
+// File modes recorded in index and tree entries
+const (
+	ModeFile       = "100644"
+	ModeExecutable = "100755"
+	ModeSymlink    = "120000"
+	ModeDir        = "040000"
+)
+
 // IndexEntry represents a single entry in the staging area
-// Stored as: index/entries/<path> -> {blobId, mode}
+// Stored as: index/entries/<path> -> {blobId, mode, size, mtime}
+// A staged deletion is stored as {deleted: true} with an empty blobId.
+// Size and ModTime are the file's stat at stage time; entries written before
+// they were recorded decode with both zero.
 type IndexEntry struct {
-	BlobID string `json:"blobId"` // SHA1 hash of file content (or simple ID for now)
-	Mode   string `json:"mode"`   // File mode: "100644" for regular files, "100755" for executables, "040000" for directories
+	BlobID  string `json:"blobId"`            // SHA1 hash of file content (or simple ID for now)
+	Mode    string `json:"mode"`              // File mode: "100644" for regular files, "100755" for executables, "120000" for symlinks, "040000" for directories
+	Deleted bool   `json:"deleted,omitempty"` // true if the path is staged for removal from the tree
+	Size    int64  `json:"size,omitempty"`    // File size in bytes when staged
+	ModTime int64  `json:"mtime,omitempty"`   // File modification time when staged, in Unix nanoseconds
+}
+
+// IsStaged reports whether the entry is a staged change (a blob or a deletion)
+// rather than a cleared slot
+func (entry IndexEntry) IsStaged() bool {
+	return entry.BlobID != "" || entry.Deleted
 }
 
 // AddToIndex stages files to the index
 // Stores entries as index/entries/<path> -> {blobId, mode}
-func AddToIndex(root string, options InitOptions, path string) error {
+// Returns the number of paths whose index entry changed; files already staged
+// with the same content and mode are skipped without writing.
+func AddToIndex(root string, options InitOptions, path string) (int, error) {
 	db, err := openDB(root, options)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	// Note: We defer Close() to ensure writes are persisted
 	// GitDb.Put() writes directly to file AND updates in-memory log
@@ -33,82 +55,298 @@ func AddToIndex(root string, options InitOptions, path string) error {
 	// Normalize path
 	normalizedPath := filepath.Clean(path)
 	if normalizedPath == "." {
-		// Stage all files in repo (except .gitclone)
-		return addAllFilesToIndex(root, options, db)
+		// Stage all files in repo (except .gitclone), and tracked files
+		// deleted from it
+		staged, err := addAllFilesToIndex(root, options, db)
+		return withDeletions(root, normalizedPath, db, staged, err)
 	}
 
-	// Stage single file or directory
+	// Stage single file or directory (Lstat so a symlink is staged as a link)
 	fullPath := filepath.Join(root, normalizedPath)
-	info, err := os.Stat(fullPath)
-	if err != nil {
-		return fmt.Errorf("file not found: %s", normalizedPath)
+	info, err := os.Lstat(fullPath)
+	if os.IsNotExist(err) {
+		return stageMissingPath(root, normalizedPath, db)
+	} else if err != nil {
+		return 0, fmt.Errorf("file not found: %s", normalizedPath)
 	}
 
 	if info.IsDir() {
 		// Recursively add all files in directory
-		return addDirectoryToIndex(root, normalizedPath, options, db)
+		staged, err := addDirectoryToIndex(root, normalizedPath, options, db)
+		return withDeletions(root, normalizedPath, db, staged, err)
 	}
 
 	// Add single file
-	return addFileToIndex(root, normalizedPath, db)
+	return countStaged(addFileToIndex(root, normalizedPath, db))
 }
 
-// addFileToIndex stages a single file
-func addFileToIndex(root, relPath string, db *GitDb.DB) error {
-	fullPath := filepath.Join(root, relPath)
+// stageDeletions stages the removal of every tracked file at or under dir
+// ("." for the whole repository) that is gone from the working tree, and
+// returns how many stages changed. Tracked files are HEAD's plus those staged
+// since; one staged but never committed is unstaged instead.
+func stageDeletions(root, dir string, db GitDb.KV) (int, error) {
+	staged, err := indexEntriesFromDB(db)
+	if err != nil {
+		return 0, err
+	}
+	headTree, err := headTreeFromDB(db)
+	if err != nil {
+		return 0, err
+	}
+	inHead := make(map[string]bool)
+	for _, entry := range headTree {
+		inHead[entry.Path] = true
+	}
 
-	// Read file content
-	content, err := os.ReadFile(fullPath)
+	dir = normalizeIndexPath(dir)
+	changed := 0
+	for _, entry := range ApplyIndexToTree(headTree, staged) {
+		if entry.Type == "tree" {
+			continue
+		}
+		if dir != "." && entry.Path != dir && !strings.HasPrefix(entry.Path, dir+"/") {
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(root, filepath.FromSlash(entry.Path))); !os.IsNotExist(err) {
+			continue
+		}
+		if inHead[entry.Path] {
+			err = removeFileFromIndex(entry.Path, db)
+		} else {
+			err = clearIndexEntry(entry.Path, db)
+		}
+		if err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// withDeletions follows staging the files under dir, which changed staged
+// stages or failed with err, with stageDeletions there
+func withDeletions(root, dir string, db GitDb.KV, staged int, err error) (int, error) {
 	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+		return staged, err
+	}
+	deleted, err := stageDeletions(root, dir, db)
+	return staged + deleted, err
+}
+
+// stageMissingPath stages the deletion of a tracked file or directory that
+// no longer exists in the working tree. It fails if nothing was tracked there.
+func stageMissingPath(root, relPath string, db GitDb.KV) (int, error) {
+	deleted, err := stageDeletions(root, relPath, db)
+	if err == nil && deleted == 0 {
+		return 0, fmt.Errorf("file not found: %s", relPath)
 	}
+	return deleted, err
+}
 
-	// Compute blob ID (simple SHA1 hash for now)
-	hash := sha1.Sum(content)
-	blobID := fmt.Sprintf("%x", hash)
+// clearIndexEntry unstages path, as a commit does
+func clearIndexEntry(relPath string, db GitDb.KV) error {
+	entryData, err := json.Marshal(IndexEntry{})
+	if err != nil {
+		return fmt.Errorf("failed to marshal empty entry: %w", err)
+	}
+	return db.Put(indexKey(relPath), entryData)
+}
 
-	// Determine file mode
-	mode := "100644" // Regular file
-	info, err := os.Stat(fullPath)
-	if err == nil && info.Mode()&0111 != 0 {
-		mode = "100755" // Executable
+// countStaged turns addFileToIndex's result into a count of changed stages
+func countStaged(changed bool, err error) (int, error) {
+	if err != nil || !changed {
+		return 0, err
 	}
+	return 1, nil
+}
+
+// addFileToIndex stages a single file and reports whether its index entry
+// changed. A file already staged with the same blob and mode is left alone,
+// so repeated adds don't grow the log; only a changed stat is recorded, in
+// the stat cache.
+func addFileToIndex(root, relPath string, db GitDb.KV) (bool, error) {
+	fullPath := filepath.Join(root, relPath)
 
-	// Create index entry
+	info, err := os.Lstat(fullPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	content, mode, err := readWorktreeFile(fullPath, info)
+	if err != nil {
+		return false, err
+	}
+
+	// Record the stat Status uses to skip re-hashing
 	entry := IndexEntry{
-		BlobID: blobID,
-		Mode:   mode,
+		Mode:    mode,
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+	}
+	path := normalizeIndexPath(relPath)
+
+	if existing, ok := readIndexEntry(db, path); ok && !existing.Deleted &&
+		existing.BlobID == blobIDOf(content) && existing.Mode == mode {
+		if existing.Size == entry.Size && existing.ModTime == entry.ModTime {
+			return false, nil
+		}
+		entry.BlobID = existing.BlobID
+		entryData, err := json.Marshal(entry)
+		if err != nil {
+			return false, fmt.Errorf("failed to marshal entry: %w", err)
+		}
+		return false, db.Put(statCacheKey(path), entryData)
+	}
+
+	return true, stageBlob(db, path, content, entry)
+}
+
+// readIndexEntry returns the staged entry of path (in index key form), if any
+func readIndexEntry(db GitDb.KV, path string) (IndexEntry, bool) {
+	data, err := db.Get(indexKey(path))
+	if err != nil {
+		return IndexEntry{}, false
 	}
+	var entry IndexEntry
+	if err := json.Unmarshal(data, &entry); err != nil || !entry.IsStaged() {
+		return IndexEntry{}, false
+	}
+	return entry, true
+}
+
+// stageBlob stores content as a blob and stages it at path (in index key
+// form) with entry's mode and stat
+func stageBlob(db GitDb.KV, path string, content []byte, entry IndexEntry) error {
+	entry.BlobID = blobIDOf(content)
 
 	// Store blob object
-	blobKey := fmt.Sprintf("objects/blob/%s", blobID)
+	blobKey := fmt.Sprintf("objects/blob/%s", entry.BlobID)
 	if err := db.Put(blobKey, content); err != nil {
 		return fmt.Errorf("failed to store blob: %w", err)
 	}
 
-	// Normalize path: clean, convert to forward slashes, remove leading ./
-	normalizedRelPath := filepath.Clean(relPath)
-	normalizedRelPath = filepath.ToSlash(normalizedRelPath)
-	// Remove leading ./ if present
-	if strings.HasPrefix(normalizedRelPath, "./") {
-		normalizedRelPath = normalizedRelPath[2:]
-	}
-
-	// Store index entry: index/entries/<path> -> {blobId, mode}
-	entryKey := fmt.Sprintf("index/entries/%s", normalizedRelPath)
+	// Store index entry: index/entries/<path> -> {blobId, mode, size, mtime}
+	entryKey := indexKey(path)
 	entryData, err := json.Marshal(entry)
 	if err != nil {
 		return fmt.Errorf("failed to marshal entry: %w", err)
 	}
 
-	return db.Put(entryKey, entryData)
+	if err := db.Put(entryKey, entryData); err != nil {
+		return err
+	}
+
+	// The stat cache outlives the staged entry, which commits clear. Content
+	// staged without a file has no stat to cache.
+	if entry.ModTime == 0 {
+		return nil
+	}
+	return db.Put(statCacheKey(path), entryData)
 }
 
-// addDirectoryToIndex recursively stages all files in a directory
-func addDirectoryToIndex(root, relPath string, options InitOptions, db *GitDb.DB) error {
+// readWorktreeFile returns a working-tree file's blob content and mode; a
+// symlink's blob is its target path
+func readWorktreeFile(fullPath string, info os.FileInfo) ([]byte, string, error) {
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(fullPath)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read symlink: %w", err)
+		}
+		return []byte(target), ModeSymlink, nil
+	}
+
+	content, err := os.ReadFile(fullPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read file: %w", err)
+	}
+	if info.Mode()&0111 != 0 {
+		return content, ModeExecutable, nil
+	}
+	return content, ModeFile, nil
+}
+
+// blobIDOf computes a blob ID (simple SHA1 hash for now)
+func blobIDOf(content []byte) string {
+	return fmt.Sprintf("%x", sha1.Sum(content))
+}
+
+// indexEntriesPrefix is the key prefix of staged entries
+const indexEntriesPrefix = "index/entries/"
+
+// normalizeIndexPath cleans a repo-relative path into the form index keys,
+// trees and Status use: cleaned, with forward slashes (so a Windows path
+// matches its Unix spelling) and no leading ./. Names are otherwise kept byte
+// for byte, so Unicode names round-trip unchanged. Every path that becomes or
+// is compared with an index key goes through here.
+func normalizeIndexPath(relPath string) string {
+	normalized := filepath.ToSlash(filepath.Clean(relPath))
+	return strings.TrimPrefix(normalized, "./")
+}
+
+// NormalizeIndexPath converts a repo-relative path to the form index entries
+// are keyed by
+func NormalizeIndexPath(relPath string) string {
+	return normalizeIndexPath(relPath)
+}
+
+// SelectIndexEntries returns the entries at or under any of paths, which are
+// repo-relative files or directories
+func SelectIndexEntries(entries map[string]IndexEntry, paths []string) map[string]IndexEntry {
+	selected := make(map[string]IndexEntry)
+	for _, p := range paths {
+		p = normalizeIndexPath(p)
+		for entryPath, entry := range entries {
+			if p == "." || entryPath == p || strings.HasPrefix(entryPath, p+"/") {
+				selected[entryPath] = entry
+			}
+		}
+	}
+	return selected
+}
+
+// indexKey returns the index entry key of a repo-relative path
+func indexKey(relPath string) string {
+	return indexEntriesPrefix + normalizeIndexPath(relPath)
+}
+
+// indexPathFromKey returns the path of an index entry key, and whether key
+// is one
+func indexPathFromKey(key string) (string, bool) {
+	return strings.CutPrefix(key, indexEntriesPrefix)
+}
+
+// RemoveFromIndex stages the removal of path from the next commit's tree
+func RemoveFromIndex(root string, options InitOptions, path string) error {
+	db, err := openDB(root, options)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return removeFileFromIndex(path, db)
+}
+
+// removeFileFromIndex writes a deletion marker for a single path
+func removeFileFromIndex(relPath string, db GitDb.KV) error {
+	normalizedRelPath := normalizeIndexPath(relPath)
+	if normalizedRelPath == "." || normalizedRelPath == "" {
+		return fmt.Errorf("invalid path: %s", relPath)
+	}
+
+	entryData, err := json.Marshal(IndexEntry{Deleted: true})
+	if err != nil {
+		return fmt.Errorf("failed to marshal entry: %w", err)
+	}
+	return db.Put(indexKey(normalizedRelPath), entryData)
+}
+
+// addDirectoryToIndex recursively stages all files in a directory and
+// returns how many stages changed
+func addDirectoryToIndex(root, relPath string, options InitOptions, db GitDb.KV) (int, error) {
 	fullPath := filepath.Join(root, relPath)
 
-	return filepath.Walk(fullPath, func(filePath string, info os.FileInfo, err error) error {
+	staged := 0
+	err := filepath.Walk(fullPath, func(filePath string, info os.FileInfo, err error) error {
 		if err != nil {
 			return nil // Skip errors
 		}
@@ -129,16 +367,23 @@ func addDirectoryToIndex(root, relPath string, options InitOptions, db *GitDb.DB
 		}
 
 		// Normalize path separators
-		fileRelPath = filepath.ToSlash(fileRelPath)
+		fileRelPath = normalizeIndexPath(fileRelPath)
 
 		// Add file to index
-		return addFileToIndex(root, fileRelPath, db)
+		changed, err := addFileToIndex(root, fileRelPath, db)
+		if changed {
+			staged++
+		}
+		return err
 	})
+	return staged, err
 }
 
-// addAllFilesToIndex stages all files in the repository
-func addAllFilesToIndex(root string, options InitOptions, db *GitDb.DB) error {
-	return filepath.Walk(root, func(filePath string, info os.FileInfo, err error) error {
+// addAllFilesToIndex stages all files in the repository and returns how many
+// stages changed
+func addAllFilesToIndex(root string, options InitOptions, db GitDb.KV) (int, error) {
+	staged := 0
+	err := filepath.Walk(root, func(filePath string, info os.FileInfo, err error) error {
 		if err != nil {
 			return nil
 		}
@@ -159,10 +404,15 @@ func addAllFilesToIndex(root string, options InitOptions, db *GitDb.DB) error {
 		}
 
 		// Normalize path separators
-		relPath = filepath.ToSlash(relPath)
+		relPath = normalizeIndexPath(relPath)
 
-		return addFileToIndex(root, relPath, db)
+		changed, err := addFileToIndex(root, relPath, db)
+		if changed {
+			staged++
+		}
+		return err
 	})
+	return staged, err
 }
 
 // GetIndexEntries returns all staged entries from the index
@@ -173,17 +423,22 @@ func GetIndexEntries(root string, options InitOptions) (map[string]IndexEntry, e
 	}
 	defer db.Close()
 
+	return indexEntriesFromDB(db)
+}
+
+// indexEntriesFromDB returns the staged entries: the latest index/entries/*
+// record of each path, leaving out cleared and deleted ones
+func indexEntriesFromDB(db GitDb.KV) (map[string]IndexEntry, error) {
 	entries := make(map[string]IndexEntry)
 
-	// Scan for all index/entries/* keys
-	// GitDb.Scan() iterates through the in-memory log, which is rebuilt from file on Open()
-	// Since GitDb.Put() writes directly to the log file, and Open() reads the file,
-	// we should see all writes from AddToIndex() even if it closed the DB
-	const indexEntriesPrefix = "index/entries/"
-	err = db.Scan(func(record GitDb.Record) error {
-		// Check if key starts with "index/entries/" using strings.HasPrefix
-		if strings.HasPrefix(record.Key, indexEntriesPrefix) {
-			path := record.Key[len(indexEntriesPrefix):] // Remove "index/entries/" prefix
+	// Since GitDb is append-only, Scan() iterates through all entries in order;
+	// for the same key, later entries overwrite earlier ones in the map
+	err := db.Scan(func(record GitDb.Record) error {
+		if path, ok := indexPathFromKey(record.Key); ok {
+			if record.Deleted {
+				delete(entries, path)
+				return nil
+			}
 
 			var entry IndexEntry
 			if err := json.Unmarshal(record.Value, &entry); err != nil {
@@ -191,15 +446,11 @@ func GetIndexEntries(root string, options InitOptions) (map[string]IndexEntry, e
 				return nil
 			}
 
-			// Since GitDb is append-only, Scan() iterates through all entries in order
-			// For the same key, later entries overwrite earlier ones in the map
-			// We only include entries with valid blobId (skip cleared entries with empty blobId)
-			// But we need to check: if we've already seen this path with a valid blobId,
-			// and now we see it with an empty blobId, we should remove it from the map
-			if entry.BlobID != "" {
+			// Only staged entries (a blob or a deletion marker) are kept; a
+			// cleared entry removes an earlier staged one
+			if entry.IsStaged() {
 				entries[path] = entry
 			} else {
-				// Empty blobId means cleared - remove from map if it exists
 				delete(entries, path)
 			}
 		}
@@ -209,7 +460,9 @@ func GetIndexEntries(root string, options InitOptions) (map[string]IndexEntry, e
 	return entries, err
 }
 
-// ClearIndex clears all entries from the staging area
+// ClearIndex clears all entries from the staging area. The keys are deleted,
+// cleared leftovers included, so clearing costs one record per key left in
+// the index rather than one per path ever staged.
 func ClearIndex(root string, options InitOptions) error {
 	db, err := openDB(root, options)
 	if err != nil {
@@ -217,44 +470,51 @@ func ClearIndex(root string, options InitOptions) error {
 	}
 	defer db.Close()
 
-	// Get all index entry keys (including those with empty blobId to find all keys)
-	// We need to scan for ALL keys with the prefix, not just valid entries
-	const indexEntriesPrefix = "index/entries/"
-	
-	// Scan for ALL keys with the prefix (including already-cleared entries)
-	// We need to find all keys, not just valid entries, to clear them all
-	allPaths := make(map[string]bool)
-	err = db.Scan(func(record GitDb.Record) error {
-		if strings.HasPrefix(record.Key, indexEntriesPrefix) {
-			path := record.Key[len(indexEntriesPrefix):]
-			allPaths[path] = true
-		}
-		return nil
-	})
+	return clearIndexFromDB(db)
+}
+
+// clearIndexFromDB is ClearIndex on an open DB
+func clearIndexFromDB(db GitDb.KV) error {
+	paths, err := liveIndexPaths(db)
 	if err != nil {
 		return err
 	}
-
-	// Clear by writing empty entries for all paths found
-	// Since GitDb is append-only, we can't truly delete, but we can mark entries as cleared
-	// by writing entries with empty blobId, which GetIndexEntries() will filter out
-	// GitDb's index will point to the latest (empty) entry for each key
-	for path := range allPaths {
-		entryKey := fmt.Sprintf("index/entries/%s", path)
-		// Write empty entry to effectively "delete" it
-		emptyEntry := IndexEntry{BlobID: "", Mode: ""}
-		emptyEntryData, err := json.Marshal(emptyEntry)
-		if err != nil {
-			return fmt.Errorf("failed to marshal empty entry: %w", err)
-		}
-		if err := db.Put(entryKey, emptyEntryData); err != nil {
+	for path := range paths {
+		if err := db.Delete(indexKey(path)); err != nil {
 			return fmt.Errorf("failed to clear entry %s: %w", path, err)
 		}
 	}
-
 	return nil
 }
 
+// liveIndexPaths returns the paths with an index/entries/* key that hasn't
+// been deleted, mapped to whether the path is staged. Entries that can't be
+// decoded count as staged, so they are never deleted as cleared ones.
+func liveIndexPaths(db GitDb.KV) (map[string]bool, error) {
+	paths := make(map[string]bool)
+	err := db.Scan(func(record GitDb.Record) error {
+		path, ok := indexPathFromKey(record.Key)
+		if !ok {
+			return nil
+		}
+		if record.Deleted {
+			delete(paths, path)
+			return nil
+		}
+		var entry IndexEntry
+		if err := json.Unmarshal(record.Value, &entry); err != nil {
+			paths[path] = true
+			return nil
+		}
+		paths[path] = entry.IsStaged()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan index: %w", err)
+	}
+	return paths, nil
+}
+
 // HasStagedEntries checks if there are any staged entries
 func HasStagedEntries(root string, options InitOptions) (bool, error) {
 	entries, err := GetIndexEntries(root, options)
@@ -262,9 +522,9 @@ func HasStagedEntries(root string, options InitOptions) (bool, error) {
 		return false, err
 	}
 
-	// Check if any entries have valid blobId
+	// Check if any entries are staged changes
 	for _, entry := range entries {
-		if entry.BlobID != "" {
+		if entry.IsStaged() {
 			return true, nil
 		}
 	}
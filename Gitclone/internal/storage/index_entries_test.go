@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 
@@ -39,7 +40,7 @@ func TestAddToIndex(t *testing.T) {
 
 	// Stage the file using AddToIndex
 	// This opens DB, writes entry, then closes DB
-	if err := AddToIndex(tmpDir, options, "test.txt"); err != nil {
+	if _, err := AddToIndex(tmpDir, options, "test.txt"); err != nil {
 		t.Fatalf("Failed to add to index: %v", err)
 	}
 
@@ -147,7 +148,7 @@ func TestHasStagedEntries(t *testing.T) {
 		t.Fatalf("Failed to create test file: %v", err)
 	}
 
-	if err := AddToIndex(tmpDir, options, "test.txt"); err != nil {
+	if _, err := AddToIndex(tmpDir, options, "test.txt"); err != nil {
 		t.Fatalf("Failed to add to index: %v", err)
 	}
 
@@ -181,7 +182,7 @@ func TestClearIndex(t *testing.T) {
 		t.Fatalf("Failed to create test file: %v", err)
 	}
 
-	if err := AddToIndex(tmpDir, options, "test.txt"); err != nil {
+	if _, err := AddToIndex(tmpDir, options, "test.txt"); err != nil {
 		t.Fatalf("Failed to add to index: %v", err)
 	}
 
@@ -254,10 +255,10 @@ func TestBuildTreeFromIndex(t *testing.T) {
 		t.Fatalf("Failed to create test file: %v", err)
 	}
 
-	if err := AddToIndex(tmpDir, options, "file1.txt"); err != nil {
+	if _, err := AddToIndex(tmpDir, options, "file1.txt"); err != nil {
 		t.Fatalf("Failed to add to index: %v", err)
 	}
-	if err := AddToIndex(tmpDir, options, "file2.txt"); err != nil {
+	if _, err := AddToIndex(tmpDir, options, "file2.txt"); err != nil {
 		t.Fatalf("Failed to add to index: %v", err)
 	}
 
@@ -318,3 +319,230 @@ func TestBuildTreeFromIndex_EmptyIndex(t *testing.T) {
 	}
 }
 
+
+func TestBuildTreeFromIndex_StagedDeletion(t *testing.T) {
+	// Create temporary directory
+	tmpDir, err := os.MkdirTemp("", "gitstore-tree-delete-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Initialize repo
+	options := InitOptions{Bare: false}
+	if err := InitRepo(tmpDir, options); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	// Commit A and B
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		if _, err := AddToIndex(tmpDir, options, name); err != nil {
+			t.Fatalf("Failed to add %s to index: %v", name, err)
+		}
+	}
+	if err := BuildTreeFromIndexWithParent(tmpDir, options, 1, nil); err != nil {
+		t.Fatalf("Failed to build first tree: %v", err)
+	}
+	if err := ClearIndex(tmpDir, options); err != nil {
+		t.Fatalf("Failed to clear index: %v", err)
+	}
+
+	// Remove A and commit again on top of the first tree
+	if err := os.Remove(filepath.Join(tmpDir, "a.txt")); err != nil {
+		t.Fatalf("Failed to delete a.txt: %v", err)
+	}
+	if err := RemoveFromIndex(tmpDir, options, "a.txt"); err != nil {
+		t.Fatalf("Failed to stage deletion: %v", err)
+	}
+
+	hasStaged, err := HasStagedEntries(tmpDir, options)
+	if err != nil {
+		t.Fatalf("Failed to check staged entries: %v", err)
+	}
+	if !hasStaged {
+		t.Fatal("Expected staged deletion to count as a staged change")
+	}
+
+	parent := 1
+	if err := BuildTreeFromIndexWithParent(tmpDir, options, 2, &parent); err != nil {
+		t.Fatalf("Failed to build second tree: %v", err)
+	}
+
+	tree, err := ReadTree(tmpDir, options, 2)
+	if err != nil {
+		t.Fatalf("Failed to read tree: %v", err)
+	}
+	if len(tree) != 1 || tree[0].Path != "b.txt" {
+		t.Errorf("Expected tree to contain only b.txt, got %+v", tree)
+	}
+
+	// Clearing the index drops the deletion marker too
+	if err := ClearIndex(tmpDir, options); err != nil {
+		t.Fatalf("Failed to clear index: %v", err)
+	}
+	entries, err := GetIndexEntries(tmpDir, options)
+	if err != nil {
+		t.Fatalf("Failed to get index entries: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected empty index after clear, got %v", entries)
+	}
+}
+
+// TestAddToIndexSkipsUnchanged stages the same unchanged file twice: the second
+// add stages nothing and appends no records, while an edit is staged again
+func TestAddToIndexSkipsUnchanged(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-index-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	options := InitOptions{Bare: false}
+	if err := InitRepo(tmpDir, options); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+	testFile := filepath.Join(tmpDir, "test.txt")
+	if err := os.WriteFile(testFile, []byte("test content"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	countRecords := func() int {
+		db, err := openDB(tmpDir, options)
+		if err != nil {
+			t.Fatalf("Failed to open DB: %v", err)
+		}
+		defer db.Close()
+		n := 0
+		if err := db.Scan(func(GitDb.Record) error { n++; return nil }); err != nil {
+			t.Fatalf("Failed to scan DB: %v", err)
+		}
+		return n
+	}
+
+	if staged, err := AddToIndex(tmpDir, options, "test.txt"); err != nil || staged != 1 {
+		t.Fatalf("Expected the first add to stage 1 file, got %d (err %v)", staged, err)
+	}
+	before := countRecords()
+	if staged, err := AddToIndex(tmpDir, options, "."); err != nil || staged != 0 {
+		t.Fatalf("Expected the second add to stage nothing, got %d (err %v)", staged, err)
+	}
+	if after := countRecords(); after != before {
+		t.Errorf("Expected no new records for an unchanged file, got %d -> %d", before, after)
+	}
+
+	if err := os.WriteFile(testFile, []byte("edited content"), 0644); err != nil {
+		t.Fatalf("Failed to edit test file: %v", err)
+	}
+	if staged, err := AddToIndex(tmpDir, options, "test.txt"); err != nil || staged != 1 {
+		t.Errorf("Expected an edited file to be staged again, got %d (err %v)", staged, err)
+	}
+}
+
+// TestNormalizeIndexPath checks the index key form of Unicode, ./-prefixed
+// and OS-separated paths. Backslashes only separate on Windows; elsewhere they
+// are part of the name.
+func TestNormalizeIndexPath(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"héllo.txt", "héllo.txt"},
+		{"./docs/日本語.md", "docs/日本語.md"},
+		{filepath.Join("dir", "sub", "файл.txt"), "dir/sub/файл.txt"},
+		{"dir//sub/../emoji 🎉.txt", "dir/emoji 🎉.txt"},
+	}
+	if runtime.GOOS == "windows" {
+		tests = append(tests, struct{ in, want string }{`dir\file.txt`, "dir/file.txt"})
+	} else {
+		tests = append(tests, struct{ in, want string }{`dir\file.txt`, `dir\file.txt`})
+	}
+	for _, tt := range tests {
+		if got := NormalizeIndexPath(tt.in); got != tt.want {
+			t.Errorf("NormalizeIndexPath(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestIndexUnicodeRoundTrip stages Unicode file names given in several
+// spellings and checks each reads back under one key that Status, the tree and
+// RemoveFromIndex agree on
+func TestIndexUnicodeRoundTrip(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-unicode-index-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	options := InitOptions{Bare: false}
+	if err := InitRepo(tmpDir, options); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	// Key form, and the spelling passed to AddToIndex
+	files := map[string]string{
+		"héllo.txt":          "héllo.txt",
+		"docs/日本語.md":        "./" + filepath.Join("docs", "日本語.md"),
+		"dir/sub/файл 🎉.txt": filepath.Join("dir", "sub", "..", "sub", "файл 🎉.txt"),
+	}
+	for key, spelling := range files {
+		fullPath := filepath.Join(tmpDir, filepath.FromSlash(key))
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("Failed to create dir for %s: %v", key, err)
+		}
+		if err := os.WriteFile(fullPath, []byte(key), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", key, err)
+		}
+		if _, err := AddToIndex(tmpDir, options, spelling); err != nil {
+			t.Fatalf("Failed to stage %q: %v", spelling, err)
+		}
+	}
+
+	entries, err := GetIndexEntries(tmpDir, options)
+	if err != nil {
+		t.Fatalf("Failed to read index: %v", err)
+	}
+	if len(entries) != len(files) {
+		t.Fatalf("Expected %d entries, got %v", len(files), entries)
+	}
+	for key := range files {
+		if _, ok := entries[key]; !ok {
+			t.Errorf("Expected an entry for %q, got %v", key, entries)
+		}
+	}
+
+	// Staging the whole tree again finds the same keys: nothing changes
+	changed, err := AddToIndex(tmpDir, options, ".")
+	if err != nil {
+		t.Fatalf("Failed to stage all: %v", err)
+	}
+	if changed != 0 {
+		t.Errorf("Expected re-staging to change nothing, got %d changes", changed)
+	}
+
+	status, err := Status(tmpDir, options)
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if len(status.Untracked) != 0 || len(status.Staged) != len(files) {
+		t.Errorf("Expected all files staged and none untracked, got %+v", status)
+	}
+
+	tree := ApplyIndexToTree(nil, entries)
+	if len(tree) != len(files) {
+		t.Errorf("Expected %d tree entries, got %+v", len(files), tree)
+	}
+
+	if err := RemoveFromIndex(tmpDir, options, "./"+filepath.Join("docs", "日本語.md")); err != nil {
+		t.Fatalf("Failed to stage removal: %v", err)
+	}
+	entries, err = GetIndexEntries(tmpDir, options)
+	if err != nil {
+		t.Fatalf("Failed to read index: %v", err)
+	}
+	if entry := entries["docs/日本語.md"]; !entry.Deleted || len(entries) != len(files) {
+		t.Errorf("Expected the removal to replace docs/日本語.md's entry, got %v", entries)
+	}
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"GitDb"
+	repostorage "gitclone/internal/infra/storage"
+)
+
+// ObjectTypes maps each object type to the key prefix its objects are stored
+// under. Commits are listed by their content-addressed copies; the
+// objects/<id> records hold the same commits.
+var ObjectTypes = map[string]string{
+	"blob":   "objects/blob/",
+	"tree":   "objects/tree/",
+	"commit": "objects/commit/",
+}
+
+// ObjectInfo is the key of a stored object and the size of its value
+type ObjectInfo struct {
+	Key  string
+	Size int // uncompressed
+}
+
+// ListObjects returns the objects of the given type (a key of ObjectTypes)
+// in the store, sorted by key. Deleted objects are left out.
+func ListObjects(store *repostorage.RepoStore, objectType string) ([]ObjectInfo, error) {
+	prefix, ok := ObjectTypes[objectType]
+	if !ok {
+		return nil, fmt.Errorf("unknown object type %q", objectType)
+	}
+
+	// Later records overwrite earlier ones, leaving the latest size per key
+	sizes := make(map[string]int)
+	err := store.DB().Scan(func(record GitDb.Record) error {
+		if !strings.HasPrefix(record.Key, prefix) {
+			return nil
+		}
+		if record.Deleted {
+			delete(sizes, record.Key)
+		} else {
+			sizes[record.Key] = len(record.Value)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan objects: %w", err)
+	}
+
+	objects := make([]ObjectInfo, 0, len(sizes))
+	for key, size := range sizes {
+		objects = append(objects, ObjectInfo{Key: key, Size: size})
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
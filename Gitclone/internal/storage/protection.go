@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"GitDb"
+	repostorage "gitclone/internal/infra/storage"
+)
+
+// Branch protection
+//
+// A protected branch's remote copy only moves forward: a forced push or a
+// push rollback that would rewrite it fails with ErrProtectedBranch unless
+// the caller overrides the protection. The flag lives in the repository's
+// GitDb under meta/protected/<branch>; a missing key means unprotected.
+
+// ErrProtectedBranch is returned for a rewrite of a protected branch made
+// without an override
+var ErrProtectedBranch = errors.New("branch is protected")
+
+// protectionKey returns the key of a branch's protection flag
+func protectionKey(branch string) string {
+	return "meta/protected/" + branch
+}
+
+// IsBranchProtectedFromStore reports whether branch is protected
+func IsBranchProtectedFromStore(store *repostorage.RepoStore, branch string) (bool, error) {
+	b, err := store.DB().Get(protectionKey(branch))
+	if errors.Is(err, GitDb.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read protection of %s: %w", branch, err)
+	}
+	return strings.TrimSpace(string(b)) == "true", nil
+}
+
+// WriteBranchProtectionToBatch sets or clears a branch's protection in a batch
+func WriteBranchProtectionToBatch(batch *repostorage.WriteBatch, branch string, protected bool) error {
+	if err := validateBranch(branch); err != nil {
+		return err
+	}
+	// Batches can't delete, so clearing stores false
+	batch.Put(protectionKey(branch), []byte(fmt.Sprintf("%t\n", protected)))
+	return nil
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"GitDb"
+	repostorage "gitclone/internal/infra/storage"
+)
+
+// Reflog
+//
+// logs/<ref> holds the reflog of a ref: a JSON list of the updates made to
+// it, oldest first, so a tip that was overwritten can still be found. Pushes
+// record entries for the remote-tracking refs they move.
+
+// ReflogEntry is one update of a ref
+type ReflogEntry struct {
+	Old       *int   `json:"old,omitempty"` // nil when the update created the ref
+	New       int    `json:"new"`
+	Timestamp int64  `json:"timestamp"`
+	Message   string `json:"message"`
+}
+
+// reflogKey returns the key of a ref's reflog
+func reflogKey(ref string) string {
+	return "logs/" + ref
+}
+
+// readReflogFromDB reads a ref's reflog, oldest first; a ref without one has
+// an empty reflog
+func readReflogFromDB(db GitDb.KV, ref string) ([]ReflogEntry, error) {
+	data, err := db.Get(reflogKey(ref))
+	if err != nil {
+		return []ReflogEntry{}, nil
+	}
+	var entries []ReflogEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid reflog for %s: %w", ref, err)
+	}
+	return entries, nil
+}
+
+// ReadReflogFromStore returns a ref's reflog, oldest first
+func ReadReflogFromStore(store *repostorage.RepoStore, ref string) ([]ReflogEntry, error) {
+	return readReflogFromDB(store.DB(), ref)
+}
+
+// AppendReflogToBatch adds entry to the end of a ref's reflog when batch
+// commits
+func AppendReflogToBatch(batch *repostorage.WriteBatch, ref string, entry ReflogEntry) error {
+	entries, err := readReflogFromDB(batch.Store().DB(), ref)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(append(entries, entry))
+	if err != nil {
+		return fmt.Errorf("failed to marshal reflog: %w", err)
+	}
+	batch.Put(reflogKey(ref), data)
+	return nil
+}
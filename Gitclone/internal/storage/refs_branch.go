@@ -1,27 +1,85 @@
 package storage
 
 import (
+	"GitDb"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 )
 
-// EnsureHeadRefExists creates refs/heads/<branch> if missing.
-func EnsureHeadRefExists(root string, opts InitOptions, branch string) error {
-	if branch == "" || strings.ContainsAny(branch, " \t\n") {
-		return fmt.Errorf("invalid branch name")
+// ErrDetachedHead is returned when HEAD is needed as a branch but names a
+// commit directly
+var ErrDetachedHead = errors.New("HEAD is detached")
+
+// Refs
+//
+// All refs live in the repository's GitDb; there is no other ref backend. Each
+// operation is implemented once against a GitDb.KV. The path-based functions
+// open the repository's DB for a single call (used by the CLI), and the
+// ...FromStore/...ToBatch wrappers in repo_store_wrappers.go reuse a RepoStore's
+// handle (used by the server). Both therefore read and write the same keys.
+//
+// Ref values
+//
+// Branch refs (refs/heads/<branch>) and remote refs (refs/remotes/origin/<branch>)
+// hold a decimal commit ID, usually followed by a newline. An empty value is
+// the legacy form written by init and by checkout in an empty repository: the
+// branch exists and is listed, but has no commits yet, and its first commit has
+// no parent. A missing key means the ref doesn't exist. The ...Maybe readers
+// report both as a nil tip; use HeadRefExistsFromStore to tell them apart.
+// ReadHeadRef, which requires a tip, is the only reader that fails on them.
+//
+// HEAD
+//
+// meta/HEAD holds "ref: refs/heads/<branch>", or a bare commit ID when HEAD is
+// detached. ResolveHead reads either; the branch readers fail with
+// ErrDetachedHead on the latter.
+
+// headRefKey returns the key of a local branch ref
+func headRefKey(branch string) string {
+	return "refs/heads/" + branch
+}
+
+// refValue encodes a commit ID as a ref value
+func refValue(commitID int) []byte {
+	return []byte(fmt.Sprintf("%d\n", commitID))
+}
+
+// parseRefValue parses a ref value per the contract above: nil for an empty
+// ref, the commit ID otherwise
+func parseRefValue(key string, data []byte) (*int, error) {
+	s := strings.TrimSpace(string(data))
+	if s == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid commit id in %s: %q", key, s)
 	}
+	return &n, nil
+}
 
+// EnsureHeadRefExists creates refs/heads/<branch> if missing.
+func EnsureHeadRefExists(root string, opts InitOptions, branch string) error {
 	db, err := openDB(root, opts)
 	if err != nil {
 		return err
 	}
 	defer db.Close()
 
-	key := "refs/heads/" + branch
+	return ensureHeadRefExists(db, branch)
+}
+
+// ensureHeadRefExists creates refs/heads/<branch> as an empty ref if missing
+func ensureHeadRefExists(db GitDb.KV, branch string) error {
+	if branch == "" || strings.ContainsAny(branch, " \t\n") {
+		return fmt.Errorf("invalid branch name")
+	}
+
+	key := headRefKey(branch)
 	// Check if key exists
-	_, err = db.Get(key)
-	if err == nil {
+	if _, err := db.Get(key); err == nil {
 		// Key exists, do nothing
 		return nil
 	}
@@ -32,17 +90,16 @@ func EnsureHeadRefExists(root string, opts InitOptions, branch string) error {
 
 // WriteHeadRef writes commit ID into refs/heads/<branch>
 func WriteHeadRef(root string, opts InitOptions, branch string, commitID int) error {
-	if err := EnsureHeadRefExists(root, opts, branch); err != nil {
-		return err
-	}
 	db, err := openDB(root, opts)
 	if err != nil {
 		return err
 	}
 	defer db.Close()
 
-	key := "refs/heads/" + branch
-	return db.Put(key, []byte(fmt.Sprintf("%d\n", commitID)))
+	if err := ensureHeadRefExists(db, branch); err != nil {
+		return err
+	}
+	return db.Put(headRefKey(branch), refValue(commitID))
 }
 
 // ReadHeadRef reads commit ID from refs/heads/<branch>
@@ -53,20 +110,18 @@ func ReadHeadRef(root string, opts InitOptions, branch string) (int, error) {
 	}
 	defer db.Close()
 
-	key := "refs/heads/" + branch
-	b, err := db.Get(key)
+	key := headRefKey(branch)
+	if _, err := db.Get(key); err != nil {
+		return 0, err
+	}
+	tip, err := readHeadRefMaybeFromDB(db, branch)
 	if err != nil {
 		return 0, err
 	}
-	s := strings.TrimSpace(string(b))
-	if s == "" {
+	if tip == nil {
 		return 0, fmt.Errorf("branch has no commits")
 	}
-	n, err := strconv.Atoi(s)
-	if err != nil {
-		return 0, fmt.Errorf("invalid commit id in branch ref: %q", s)
-	}
-	return n, nil
+	return *tip, nil
 }
 
 // ReadHeadRefMaybe reads commit ID from refs/heads/<branch>.
@@ -78,24 +133,22 @@ func ReadHeadRefMaybe(root string, options InitOptions, branch string) (*int, er
 	}
 	defer db.Close()
 
-	key := "refs/heads/" + branch
+	return readHeadRefMaybeFromDB(db, branch)
+}
+
+// readHeadRefMaybeFromDB reads refs/heads/<branch>, returning nil for a
+// missing or empty ref
+func readHeadRefMaybeFromDB(db GitDb.KV, branch string) (*int, error) {
+	key := headRefKey(branch)
 	b, err := db.Get(key)
 	if err != nil {
-		// Note: Assuming key not found means branch doesn't exist (returns nil)
 		// GitDb.Get returns error for missing keys, which we treat as nil
 		return nil, nil
 	}
-	s := strings.TrimSpace(string(b))
-	if s == "" {
-		return nil, nil
-	}
-	n, err := strconv.Atoi(s)
-	if err != nil {
-		return nil, fmt.Errorf("invalid commit id in branch ref: %q", s)
-	}
-	return &n, nil
+	return parseRefValue(key, b)
 }
 
+// ReadHEADBranch returns the branch HEAD points to
 func ReadHEADBranch(root string, opts InitOptions) (string, error) {
 	db, err := openDB(root, opts)
 	if err != nil {
@@ -103,20 +156,61 @@ func ReadHEADBranch(root string, opts InitOptions) (string, error) {
 	}
 	defer db.Close()
 
-	b, err := db.Get("meta/HEAD")
+	return readHEADBranchFromDB(db)
+}
+
+// readHEADBranchFromDB parses meta/HEAD ("ref: refs/heads/<branch>"). A
+// detached HEAD is an ErrDetachedHead.
+func readHEADBranchFromDB(db GitDb.KV) (string, error) {
+	branch, detached, err := readHEADFromDB(db)
 	if err != nil {
 		return "", err
 	}
+	if detached != nil {
+		return "", fmt.Errorf("%w at commit %d", ErrDetachedHead, *detached)
+	}
+	return branch, nil
+}
+
+// readHEADFromDB parses meta/HEAD, which is either "ref: refs/heads/<branch>"
+// or, when detached, a bare commit ID. It returns the branch or the commit.
+func readHEADFromDB(db GitDb.KV) (string, *int, error) {
+	b, err := db.Get("meta/HEAD")
+	if err != nil {
+		return "", nil, err
+	}
 
 	head := strings.TrimSpace(string(b))
+	if id, err := strconv.Atoi(head); err == nil {
+		return "", &id, nil
+	}
+
 	const prefix = "ref: refs/heads/"
 	if !strings.HasPrefix(head, prefix) {
-		return "", fmt.Errorf("invalid HEAD format: %q", head)
+		return "", nil, fmt.Errorf("invalid HEAD format: %q", head)
 	}
 
 	branch := strings.TrimPrefix(head, prefix)
 	if err := validateBranch(branch); err != nil {
-		return "", err
+		return "", nil, err
 	}
-	return branch, nil
+	return branch, nil, nil
+}
+
+// resolveHeadFromDB returns the commit HEAD is at and the branch it is on.
+// The commit is nil on a branch without commits; the branch is "" when HEAD
+// is detached.
+func resolveHeadFromDB(db GitDb.KV) (*int, string, error) {
+	branch, detached, err := readHEADFromDB(db)
+	if err != nil {
+		return nil, "", err
+	}
+	if detached != nil {
+		return detached, "", nil
+	}
+	tip, err := readHeadRefMaybeFromDB(db, branch)
+	if err != nil {
+		return nil, "", err
+	}
+	return tip, branch, nil
 }
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"GitDb"
 	"fmt"
 	"strconv"
 	"strings"
@@ -13,6 +14,11 @@ func NextCommitID(root string, options InitOptions) (int, error) {
 	}
 	defer db.Close()
 
+	return nextCommitIDFromDB(db)
+}
+
+// nextCommitIDFromDB returns meta/NEXT_COMMIT_ID and increments it
+func nextCommitIDFromDB(db GitDb.KV) (int, error) {
 	// Read current value
 	b, err := db.Get("meta/NEXT_COMMIT_ID")
 	if err != nil {
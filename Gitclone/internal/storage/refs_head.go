@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"GitDb"
 	"fmt"
 	"path/filepath"
 	"strings"
@@ -27,6 +28,16 @@ func validateBranch(branch string) error {
 	return nil
 }
 
+// ValidateBranch checks a branch name against the rules every ref write uses
+func ValidateBranch(branch string) error {
+	return validateBranch(branch)
+}
+
+// headValue encodes the HEAD contents for a branch
+func headValue(branch string) []byte {
+	return []byte("ref: refs/heads/" + branch + "\n")
+}
+
 // WriteHEADBranch writes: "ref: refs/heads/<branch>\n" into HEAD.
 func WriteHEADBranch(root string, opts InitOptions, branch string) error {
 	if err := validateBranch(branch); err != nil {
@@ -38,30 +49,39 @@ func WriteHEADBranch(root string, opts InitOptions, branch string) error {
 	}
 	defer db.Close()
 
-	content := "ref: refs/heads/" + branch + "\n"
-	return db.Put("meta/HEAD", []byte(content))
+	return db.Put("meta/HEAD", headValue(branch))
 }
 
-// EnsureBranchRefExists creates refs/heads/<branch> if missing.
-func EnsureBranchRefExists(root string, opts InitOptions, branch string) error {
-	if err := validateBranch(branch); err != nil {
-		return err
-	}
+// DefaultBranch is the initial branch of a new repository unless
+// InitOptions.InitialBranch names another, and the default branch of
+// repositories created before meta/DEFAULT_BRANCH was recorded
+const DefaultBranch = "master"
 
+// defaultBranchKey holds the repository's default branch. Unlike HEAD it
+// doesn't move on checkout; it names the branch a repo is presented by.
+const defaultBranchKey = "meta/DEFAULT_BRANCH"
+
+// ReadDefaultBranch returns the repository's default branch
+func ReadDefaultBranch(root string, opts InitOptions) (string, error) {
 	db, err := openDB(root, opts)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer db.Close()
 
-	key := "refs/heads/" + branch
-	// Check if key exists
-	_, err = db.Get(key)
-	if err == nil {
-		// Key exists, do nothing
-		return nil
-	}
+	return readDefaultBranchFromDB(db), nil
+}
 
-	//create empty ref
-	return db.Put(key, []byte(""))
+// readDefaultBranchFromDB reads meta/DEFAULT_BRANCH, falling back to
+// DefaultBranch for repositories that predate it
+func readDefaultBranchFromDB(db GitDb.KV) string {
+	b, err := db.Get(defaultBranchKey)
+	if err != nil {
+		return DefaultBranch
+	}
+	branch := strings.TrimSpace(string(b))
+	if validateBranch(branch) != nil {
+		return DefaultBranch
+	}
+	return branch
 }
@@ -1,10 +1,17 @@
 package storage
 
-import (
-	"fmt"
-	"strconv"
-	"strings"
-)
+import "GitDb"
+
+// remoteRefKey returns the key of a branch's remote-tracking ref
+func remoteRefKey(branch string) string {
+	return "refs/remotes/origin/" + branch
+}
+
+// RemoteRefName returns the full name of a branch's remote-tracking ref,
+// refs/remotes/origin/<branch>
+func RemoteRefName(branch string) string {
+	return remoteRefKey(branch)
+}
 
 // ReadRemoteRef reads commit ID from refs/remotes/origin/<branch>
 // Returns nil if branch has no remote ref (not pushed yet)
@@ -15,23 +22,19 @@ func ReadRemoteRef(root string, opts InitOptions, branch string) (*int, error) {
 	}
 	defer db.Close()
 
-	key := "refs/remotes/origin/" + branch
+	return readRemoteRefFromDB(db, branch)
+}
+
+// readRemoteRefFromDB reads refs/remotes/origin/<branch>, returning nil for a
+// missing or empty ref
+func readRemoteRefFromDB(db GitDb.KV, branch string) (*int, error) {
+	key := remoteRefKey(branch)
 	b, err := db.Get(key)
 	if err != nil {
 		// Remote ref doesn't exist - branch hasn't been pushed yet
 		return nil, nil
 	}
-	
-	s := strings.TrimSpace(string(b))
-	if s == "" {
-		return nil, nil
-	}
-	
-	n, err := strconv.Atoi(s)
-	if err != nil {
-		return nil, fmt.Errorf("invalid commit id in remote ref: %q", s)
-	}
-	return &n, nil
+	return parseRefValue(key, b)
 }
 
 // WriteRemoteRef writes commit ID into refs/remotes/origin/<branch>
@@ -42,14 +45,5 @@ func WriteRemoteRef(root string, opts InitOptions, branch string, commitID int)
 	}
 	defer db.Close()
 
-	key := "refs/remotes/origin/" + branch
-	return db.Put(key, []byte(fmt.Sprintf("%d\n", commitID)))
+	return db.Put(remoteRefKey(branch), refValue(commitID))
 }
-
-// ReadRemoteRefMaybe reads commit ID from refs/remotes/origin/<branch>
-// Returns nil if branch has no remote ref (not pushed yet)
-func ReadRemoteRefMaybe(root string, options InitOptions, branch string) (*int, error) {
-	return ReadRemoteRef(root, options, branch)
-}
-
-
@@ -1,71 +1,49 @@
 package storage
 
 import (
-	"encoding/json"
-	"fmt"
+	"sort"
+
+	"GitDb"
 )
 
-// PushCommit marks a commit as pushed to remote
-func PushCommit(root string, options InitOptions, branch string, commitID int) error {
+// A branch's pushed state is refs/remotes/origin/<branch>, which push writes
+// in one batch with its reflog entry. Older versions also kept the IDs of the
+// pushed commits under remote/<branch>/commits; nothing writes that list any
+// more, so the pushed commits are read from the remote ref instead.
+
+// GetPushedCommits returns the IDs of the commits pushed to origin/<branch>,
+// oldest first: the remote ref's tip and its ancestors
+func GetPushedCommits(root string, options InitOptions, branch string) ([]int, error) {
 	db, err := openDB(root, options)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer db.Close()
 
-	// Read current remote commits for branch
-	key := fmt.Sprintf("remote/%s/commits", branch)
-	remoteData, err := db.Get(key)
-	var pushedCommits []int
-	if err != nil {
-		// No remote commits yet, create new
-		pushedCommits = []int{}
-	} else {
-		if err := json.Unmarshal(remoteData, &pushedCommits); err != nil {
-			return fmt.Errorf("failed to unmarshal remote commits: %w", err)
-		}
-	}
-
-	// Check if commit is already pushed
-	for _, id := range pushedCommits {
-		if id == commitID {
-			// Already pushed
-			return nil
-		}
-	}
-
-	// Add commit to pushed list
-	pushedCommits = append(pushedCommits, commitID)
-
-	// Write back
-	data, err := json.Marshal(pushedCommits)
-	if err != nil {
-		return fmt.Errorf("failed to marshal remote commits: %w", err)
-	}
-
-	return db.Put(key, data)
+	return pushedCommitsFromDB(db, branch)
 }
 
-// GetPushedCommits returns the list of pushed commit IDs for a branch
-func GetPushedCommits(root string, options InitOptions, branch string) ([]int, error) {
-	db, err := openDB(root, options)
+// pushedCommitsFromDB is GetPushedCommits on an open DB
+func pushedCommitsFromDB(db GitDb.KV, branch string) ([]int, error) {
+	tip, err := readRemoteRefFromDB(db, branch)
 	if err != nil {
 		return nil, err
 	}
-	defer db.Close()
-
-	key := fmt.Sprintf("remote/%s/commits", branch)
-	remoteData, err := db.Get(key)
-	if err != nil {
+	if tip == nil {
 		// No pushed commits
 		return []int{}, nil
 	}
 
-	var pushedCommits []int
-	if err := json.Unmarshal(remoteData, &pushedCommits); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal remote commits: %w", err)
+	dist, err := ancestorDistances(db, *tip)
+	if err != nil {
+		return nil, err
 	}
-
+	pushedCommits := make([]int, 0, len(dist))
+	for id := range dist {
+		pushedCommits = append(pushedCommits, id)
+	}
+	// Commit IDs are allocated in order
+	sort.Ints(pushedCommits)
 	return pushedCommits, nil
 }
 
@@ -84,4 +62,3 @@ func IsCommitPushed(root string, options InitOptions, branch string, commitID in
 
 	return false, nil
 }
-
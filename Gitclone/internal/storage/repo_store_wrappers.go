@@ -1,74 +1,103 @@
 package storage
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 
 	"GitDb"
 	repostorage "gitclone/internal/infra/storage"
 )
 
+// InitRepoStore writes a new repository's HEAD, counters and initial branch
+// into a store with no working tree on disk, such as one over a GitDb.MemDB.
+// Only options.InitialBranch is used.
+func InitRepoStore(store *repostorage.RepoStore, options InitOptions) error {
+	initialBranch := options.InitialBranch
+	if initialBranch == "" {
+		initialBranch = DefaultBranch
+	}
+	if err := validateBranch(initialBranch); err != nil {
+		return err
+	}
+	return initRepoDB(store.DB(), initialBranch)
+}
+
+// StageContentFromStore stages content as a regular file at path without
+// reading the working tree
+func StageContentFromStore(store *repostorage.RepoStore, path string, content []byte) error {
+	normalizedPath := normalizeIndexPath(path)
+	if normalizedPath == "." || normalizedPath == ".." || strings.HasPrefix(normalizedPath, "../") || strings.HasPrefix(normalizedPath, "/") {
+		return fmt.Errorf("invalid path: %q", path)
+	}
+	return stageBlob(store.DB(), normalizedPath, content, IndexEntry{Mode: ModeFile})
+}
+
 // ListBranchesFromStore lists branches using a RepoStore
 func ListBranchesFromStore(store *repostorage.RepoStore) ([]string, error) {
-	db := store.DB()
-	var branches []string
-	
-	// Scan for all refs/heads/* keys
-	err := db.Scan(func(record GitDb.Record) error {
-		if strings.HasPrefix(record.Key, "refs/heads/") {
-			branchName := strings.TrimPrefix(record.Key, "refs/heads/")
-			branches = append(branches, branchName)
+	return listBranchesFromDB(store.DB())
+}
+
+// ListAllRefs returns every refs/* key (heads, remotes, tags) mapped to its
+// current value, with surrounding whitespace trimmed
+func ListAllRefs(store *repostorage.RepoStore) (map[string]string, error) {
+	refs := make(map[string]string)
+
+	// Later records overwrite earlier ones, leaving the latest value per ref
+	err := store.DB().Scan(func(record GitDb.Record) error {
+		if strings.HasPrefix(record.Key, "refs/") {
+			refs[record.Key] = strings.TrimSpace(string(record.Value))
 		}
 		return nil
 	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan refs: %w", err)
+	}
 
-	return branches, err
+	return refs, nil
 }
 
 // ReadHEADBranchFromStore reads the current branch from HEAD using RepoStore
 func ReadHEADBranchFromStore(store *repostorage.RepoStore) (string, error) {
-	db := store.DB()
-	data, err := db.Get("meta/HEAD")
-	if err != nil {
-		return "", err
-	}
-	
-	// Parse "ref: refs/heads/<branch>\n"
-	content := string(data)
-	if !strings.HasPrefix(content, "ref: refs/heads/") {
-		return "", fmt.Errorf("invalid HEAD format")
+	return readHEADBranchFromDB(store.DB())
+}
+
+// ResolveHead returns the commit HEAD is at and the branch it is on in one
+// read of HEAD. The commit is nil if the branch has no commits, and the
+// branch is "" if HEAD is detached at a commit.
+func ResolveHead(store *repostorage.RepoStore) (*int, string, error) {
+	return resolveHeadFromDB(store.DB())
+}
+
+// ReadDefaultBranchFromStore reads the repository's default branch using RepoStore
+func ReadDefaultBranchFromStore(store *repostorage.RepoStore) string {
+	return readDefaultBranchFromDB(store.DB())
+}
+
+// WriteDefaultBranchToBatch sets the repository's default branch in a batch
+func WriteDefaultBranchToBatch(batch *repostorage.WriteBatch, branch string) error {
+	if err := validateBranch(branch); err != nil {
+		return err
 	}
-	
-	branch := strings.TrimPrefix(content, "ref: refs/heads/")
-	branch = strings.TrimSuffix(branch, "\n")
-	return branch, nil
+	batch.Put(defaultBranchKey, []byte(branch+"\n"))
+	return nil
 }
 
 // ReadHeadRefMaybeFromStore reads commit ID from refs/heads/<branch> using RepoStore
 func ReadHeadRefMaybeFromStore(store *repostorage.RepoStore, branch string) (*int, error) {
-	db := store.DB()
-	key := "refs/heads/" + branch
-	data, err := db.Get(key)
-	if err != nil {
-		return nil, nil
-	}
-	
-	// Parse commit ID
-	content := strings.TrimSpace(string(data))
-	if content == "" {
-		return nil, nil
-	}
-	
-	commitID, err := strconv.Atoi(content)
-	if err != nil {
-		return nil, fmt.Errorf("invalid commit ID: %w", err)
-	}
-	
-	return &commitID, nil
+	return readHeadRefMaybeFromDB(store.DB(), branch)
+}
+
+// HeadRefExistsFromStore reports whether refs/heads/<branch> exists, including
+// branches whose ref is empty because they have no commits yet
+func HeadRefExistsFromStore(store *repostorage.RepoStore, branch string) bool {
+	_, err := store.DB().Get(headRefKey(branch))
+	return err == nil
 }
 
 // GetStagedFilesFromStore returns staged file paths using RepoStore
@@ -80,7 +109,7 @@ func GetStagedFilesFromStore(store *repostorage.RepoStore) ([]string, error) {
 
 	paths := make([]string, 0, len(entries))
 	for path, entry := range entries {
-		if entry.BlobID != "" {
+		if entry.IsStaged() {
 			paths = append(paths, path)
 		}
 	}
@@ -88,75 +117,68 @@ func GetStagedFilesFromStore(store *repostorage.RepoStore) ([]string, error) {
 	return paths, nil
 }
 
+// ReadIndexEntryFromStore returns the staged entry of a repo-relative path,
+// if it is staged
+func ReadIndexEntryFromStore(store *repostorage.RepoStore, path string) (IndexEntry, bool) {
+	return readIndexEntry(store.DB(), normalizeIndexPath(path))
+}
+
 // GetIndexEntriesFromStore returns all staged entries using RepoStore
 func GetIndexEntriesFromStore(store *repostorage.RepoStore) (map[string]IndexEntry, error) {
-	db := store.DB()
-	entries := make(map[string]IndexEntry)
-
-	// Scan for all index/entries/* keys
-	const indexEntriesPrefix = "index/entries/"
-	err := db.Scan(func(record GitDb.Record) error {
-		if strings.HasPrefix(record.Key, indexEntriesPrefix) {
-			path := record.Key[len(indexEntriesPrefix):] // Remove "index/entries/" prefix
-
-			var entry IndexEntry
-			if err := json.Unmarshal(record.Value, &entry); err != nil {
-				return nil // Skip invalid entries
-			}
-
-			// Since GitDb is append-only, Scan() iterates through all entries in order
-			// For the same key, later entries overwrite earlier ones in the map
-			// We only include entries with valid blobId (skip cleared entries with empty blobId)
-			// But we need to check: if we've already seen this path with a valid blobId,
-			// and now we see it with an empty blobId, we should remove it from the map
-			if entry.BlobID != "" {
-				entries[path] = entry
-			} else {
-				// Empty blobId means cleared - remove from map if it exists
-				delete(entries, path)
-			}
-		}
-		return nil
-	})
-
-	return entries, err
+	return indexEntriesFromDB(store.DB())
 }
 
 // AddToIndexFromStore adds files to staging area using RepoStore
 // This uses the RepoStore's DB directly to ensure consistency with other operations
-func AddToIndexFromStore(store *repostorage.RepoStore, path string) error {
+// Returns the number of paths whose index entry changed, like AddToIndex.
+// Staging a directory stops with ctx's error once ctx is done.
+func AddToIndexFromStore(ctx context.Context, store *repostorage.RepoStore, path string) (int, error) {
 	repoPath := store.RepoPath()
 	db := store.DB()
 
 	// Normalize path
 	normalizedPath := filepath.Clean(path)
 	if normalizedPath == "." {
-		// Stage all files in repo (except .gitclone)
-		return addAllFilesToIndexFromStore(repoPath, db)
+		// Stage all files in repo (except .gitclone), and tracked files
+		// deleted from it
+		staged, err := addAllFilesToIndexFromStore(ctx, repoPath, db)
+		return withDeletions(repoPath, normalizedPath, db, staged, err)
 	}
 
 	// Stage single file or directory
 	fullPath := filepath.Join(repoPath, normalizedPath)
-	info, err := os.Stat(fullPath)
-	if err != nil {
-		return fmt.Errorf("file not found: %s", normalizedPath)
+	info, err := os.Lstat(fullPath)
+	if os.IsNotExist(err) {
+		return stageMissingPath(repoPath, normalizedPath, db)
+	} else if err != nil {
+		return 0, fmt.Errorf("file not found: %s", normalizedPath)
 	}
 
 	if info.IsDir() {
 		// Recursively add all files in directory
-		return addDirectoryToIndexFromStore(repoPath, normalizedPath, db)
+		staged, err := addDirectoryToIndexFromStore(ctx, repoPath, normalizedPath, db)
+		return withDeletions(repoPath, normalizedPath, db, staged, err)
 	}
 
 	// Add single file
-	return addFileToIndex(repoPath, normalizedPath, db)
+	return countStaged(addFileToIndex(repoPath, normalizedPath, db))
+}
+
+// RemoveFromIndexFromStore stages the removal of path using RepoStore
+func RemoveFromIndexFromStore(store *repostorage.RepoStore, path string) error {
+	return removeFileFromIndex(path, store.DB())
 }
 
 // addAllFilesToIndexFromStore stages all files in repo using provided DB
-func addAllFilesToIndexFromStore(root string, db *GitDb.DB) error {
-	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+func addAllFilesToIndexFromStore(ctx context.Context, root string, db GitDb.KV) (int, error) {
+	staged := 0
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
 		// Skip .gitclone directory
 		if info.IsDir() && filepath.Base(path) == ".gitclone" {
@@ -173,24 +195,28 @@ func addAllFilesToIndexFromStore(root string, db *GitDb.DB) error {
 		}
 
 		// Normalize: remove leading ./ and convert to forward slashes
-		relPath = filepath.Clean(relPath)
-		relPath = filepath.ToSlash(relPath)
-		// Remove leading ./ if present
-		if strings.HasPrefix(relPath, "./") {
-			relPath = relPath[2:]
-		}
+		relPath = normalizeIndexPath(relPath)
 
-		return addFileToIndex(root, relPath, db)
+		changed, err := addFileToIndex(root, relPath, db)
+		if changed {
+			staged++
+		}
+		return err
 	})
+	return staged, err
 }
 
 // addDirectoryToIndexFromStore recursively stages all files in a directory using provided DB
-func addDirectoryToIndexFromStore(root, relPath string, db *GitDb.DB) error {
+func addDirectoryToIndexFromStore(ctx context.Context, root, relPath string, db GitDb.KV) (int, error) {
 	fullPath := filepath.Join(root, relPath)
-	return filepath.Walk(fullPath, func(path string, info os.FileInfo, err error) error {
+	staged := 0
+	err := filepath.Walk(fullPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
 		// Skip .gitclone directory
 		if info.IsDir() && filepath.Base(path) == RepoDir {
@@ -207,17 +233,77 @@ func addDirectoryToIndexFromStore(root, relPath string, db *GitDb.DB) error {
 		}
 
 		// Normalize path separators to forward slashes
-		rel = filepath.ToSlash(rel)
+		rel = normalizeIndexPath(rel)
 
-		return addFileToIndex(root, rel, db)
+		changed, err := addFileToIndex(root, rel, db)
+		if changed {
+			staged++
+		}
+		return err
 	})
+	return staged, err
 }
 
 // ClearIndexFromStore clears staging area using RepoStore
 func ClearIndexFromStore(store *repostorage.RepoStore) error {
-	repoPath := store.RepoPath()
-	options := InitOptions{Bare: false}
-	return ClearIndex(repoPath, options)
+	return clearIndexFromDB(store.DB())
+}
+
+// CompactIndex deletes the cleared entries that commits and unstaging leave
+// in the index, which would otherwise stay in it forever. Staged entries are
+// kept, including a path another handle staged since store was opened: each
+// cleared path is checked against the log on disk before it is deleted. The
+// deleted records are reclaimed when the log is compacted. It returns the
+// number of entries deleted.
+func CompactIndex(store *repostorage.RepoStore) (int, error) {
+	db := store.DB()
+	paths, err := liveIndexPaths(db)
+	if err != nil {
+		return 0, err
+	}
+
+	latest, closeLatest, err := openLatestDB(store)
+	if err != nil {
+		return 0, err
+	}
+	defer closeLatest()
+
+	deleted := 0
+	for path, staged := range paths {
+		if staged || !isClearedEntry(latest, path) {
+			continue
+		}
+		if err := db.Delete(indexKey(path)); err != nil {
+			return deleted, fmt.Errorf("failed to delete cleared entry %s: %w", path, err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// openLatestDB opens store's log afresh, so records other handles appended
+// since store was opened are seen, and returns it with the function that
+// closes it. A store whose KV isn't a log on disk is returned as is.
+func openLatestDB(store *repostorage.RepoStore) (GitDb.KV, func() error, error) {
+	if _, ok := store.DB().(*GitDb.DB); !ok {
+		return store.DB(), func() error { return nil }, nil
+	}
+	db, err := GitDb.OpenWithOptions(filepath.Join(store.RepoPath(), RepoDir, "db"), GitDb.Options{OnDemand: true})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reopen database: %w", err)
+	}
+	return db, db.Close, nil
+}
+
+// isClearedEntry reports whether path's latest index entry in db is a
+// cleared one. A missing or undecodable entry is not.
+func isClearedEntry(db GitDb.KV, path string) bool {
+	data, err := db.Get(indexKey(path))
+	if err != nil {
+		return false
+	}
+	var entry IndexEntry
+	return json.Unmarshal(data, &entry) == nil && !entry.IsStaged()
 }
 
 // HasStagedEntriesFromStore checks if there are staged entries using RepoStore
@@ -227,9 +313,9 @@ func HasStagedEntriesFromStore(store *repostorage.RepoStore) (bool, error) {
 		return false, err
 	}
 
-	// Check if any entries have valid blobId
+	// Check if any entries are staged changes
 	for _, entry := range entries {
-		if entry.BlobID != "" {
+		if entry.IsStaged() {
 			return true, nil
 		}
 	}
@@ -240,63 +326,29 @@ func HasStagedEntriesFromStore(store *repostorage.RepoStore) (bool, error) {
 // ReadRemoteRefFromStore reads commit ID from refs/remotes/origin/<branch> using RepoStore
 // Returns nil if branch has no remote ref (not pushed yet)
 func ReadRemoteRefFromStore(store *repostorage.RepoStore, branch string) (*int, error) {
-	db := store.DB()
-	key := "refs/remotes/origin/" + branch
-	data, err := db.Get(key)
-	if err != nil {
-		// Remote ref doesn't exist - branch hasn't been pushed yet
-		return nil, nil
-	}
-	
-	content := strings.TrimSpace(string(data))
-	if content == "" {
-		return nil, nil
-	}
-	
-	commitID, err := strconv.Atoi(content)
-	if err != nil {
-		return nil, fmt.Errorf("invalid commit ID in remote ref: %w", err)
-	}
-	
-	return &commitID, nil
+	return readRemoteRefFromDB(store.DB(), branch)
 }
 
 // WriteRemoteRefFromStore writes commit ID into refs/remotes/origin/<branch> using RepoStore
 func WriteRemoteRefFromStore(store *repostorage.RepoStore, branch string, commitID int) error {
-	db := store.DB()
-	key := "refs/remotes/origin/" + branch
-	return db.Put(key, []byte(fmt.Sprintf("%d\n", commitID)))
+	return store.DB().Put(remoteRefKey(branch), refValue(commitID))
 }
 
 // WriteRemoteRefToBatch writes remote ref to a batch
 func WriteRemoteRefToBatch(batch *repostorage.WriteBatch, branch string, commitID int) error {
-	key := "refs/remotes/origin/" + branch
-	batch.Put(key, []byte(fmt.Sprintf("%d\n", commitID)))
+	batch.Put(remoteRefKey(branch), refValue(commitID))
 	return nil
 }
 
 // ReadCommitObjectFromStore reads a commit object using RepoStore
 func ReadCommitObjectFromStore(store *repostorage.RepoStore, commitID int) (Commit, error) {
-	db := store.DB()
-	
-	// Read commit from DB
-	key := fmt.Sprintf("objects/%d", commitID)
-	data, err := db.Get(key)
-	if err != nil {
-		return Commit{}, err
-	}
-
-	// Decode JSON into Commit struct
-	var c Commit
-	if err := json.Unmarshal(data, &c); err != nil {
-		return Commit{}, err
-	}
-
-	return c, nil
+	return readCommitObjectFromDB(store.DB(), commitID)
 }
 
-// WriteCommitObjectToBatch writes a commit object to a batch
-func WriteCommitObjectToBatch(batch *repostorage.WriteBatch, commit Commit) error {
+// WriteCommitObjectToBatch writes a commit object to a batch, hashed over
+// tree, the tree written with it
+func WriteCommitObjectToBatch(batch *repostorage.WriteBatch, commit Commit, tree []TreeEntry) error {
+	commit = completeCommit(commit, tree)
 	data, err := json.MarshalIndent(commit, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal commit: %w", err)
@@ -304,45 +356,29 @@ func WriteCommitObjectToBatch(batch *repostorage.WriteBatch, commit Commit) erro
 	
 	key := fmt.Sprintf("objects/%d", commit.ID)
 	batch.Put(key, data)
+	batch.Put(commitHashKey(commit.Hash), data)
 	return nil
 }
 
+// ReadCommitByHashFromStore reads a commit object by its content hash using RepoStore
+func ReadCommitByHashFromStore(store *repostorage.RepoStore, hash string) (Commit, error) {
+	return readCommitByHashFromDB(store.DB(), hash)
+}
+
 // NextCommitIDFromStore gets and increments the next commit ID
 func NextCommitIDFromStore(store *repostorage.RepoStore) (int, error) {
-	db := store.DB()
-	
-	// Read current value
-	b, err := db.Get("meta/NEXT_COMMIT_ID")
-	if err != nil {
-		return 0, err
-	}
-
-	curStr := strings.TrimSpace(string(b))
-	cur, err := strconv.Atoi(curStr)
-	if err != nil {
-		return 0, fmt.Errorf("invalid NEXT_COMMIT_ID: %q", curStr)
-	}
-
-	// Write incremented value
-	if err := db.Put("meta/NEXT_COMMIT_ID", []byte(fmt.Sprintf("%d\n", cur+1))); err != nil {
-		return 0, err
-	}
-
-	return cur, nil
+	return nextCommitIDFromDB(store.DB())
 }
 
 // WriteHeadRefToBatch writes a branch ref to a batch
 func WriteHeadRefToBatch(batch *repostorage.WriteBatch, branch string, commitID int) error {
-	// Ensure ref exists first (check if it exists, if not add empty)
-	key := "refs/heads/" + branch
-	batch.Put(key, []byte(fmt.Sprintf("%d\n", commitID)))
+	batch.Put(headRefKey(branch), refValue(commitID))
 	return nil
 }
 
 // WriteHEADBranchToBatch writes HEAD to a batch
 func WriteHEADBranchToBatch(batch *repostorage.WriteBatch, branch string) error {
-	content := "ref: refs/heads/" + branch + "\n"
-	batch.Put("meta/HEAD", []byte(content))
+	batch.Put("meta/HEAD", headValue(branch))
 	return nil
 }
 
@@ -355,9 +391,19 @@ func ClearIndexToBatch(batch *repostorage.WriteBatch, store *repostorage.RepoSto
 		return fmt.Errorf("failed to get index entries: %w", err)
 	}
 
-	// Mark all entries as cleared by writing empty entries
+	paths := make([]string, 0, len(entries))
 	for path := range entries {
-		entryKey := fmt.Sprintf("index/entries/%s", path)
+		paths = append(paths, path)
+	}
+	return ClearIndexEntriesToBatch(batch, paths)
+}
+
+// ClearIndexEntriesToBatch clears the index entries of paths in a batch,
+// leaving the rest of the index staged
+func ClearIndexEntriesToBatch(batch *repostorage.WriteBatch, paths []string) error {
+	// Mark the entries as cleared by writing empty entries
+	for _, path := range paths {
+		entryKey := indexKey(path)
 		emptyEntry := IndexEntry{BlobID: "", Mode: ""}
 		entryData, err := json.Marshal(emptyEntry)
 		if err != nil {
@@ -371,5 +417,59 @@ func ClearIndexToBatch(batch *repostorage.WriteBatch, store *repostorage.RepoSto
 
 // EnsureHeadRefExistsFromStore ensures HEAD ref exists using RepoStore
 func EnsureHeadRefExistsFromStore(store *repostorage.RepoStore, branch string) error {
-	return EnsureHeadRefExists(store.RepoPath(), InitOptions{Bare: false}, branch)
+	// Write through the store's own handle so its index sees the new ref
+	return ensureHeadRefExists(store.DB(), branch)
+}
+
+// ReadTreeFromStore reads a tree object using RepoStore
+func ReadTreeFromStore(store *repostorage.RepoStore, treeID int) ([]TreeEntry, error) {
+	return readTreeFromDB(store.DB(), treeID)
+}
+
+// ReadTreeMaybeFromStore reads a tree object using RepoStore.
+// Returns an empty tree if the tree object doesn't exist.
+func ReadTreeMaybeFromStore(store *repostorage.RepoStore, treeID int) ([]TreeEntry, error) {
+	return readTreeMaybeFromDB(store.DB(), treeID)
+}
+
+// GetBlobContentFromStore retrieves blob content by blob ID using RepoStore
+func GetBlobContentFromStore(store *repostorage.RepoStore, blobID string) ([]byte, error) {
+	return store.DB().Get(fmt.Sprintf("objects/blob/%s", blobID))
+}
+
+// BlobReader opens a blob for streaming and returns its size, so a large
+// file can be sent without holding a second copy of it. The caller must close
+// the reader. Stores that can't stream fall back to reading the whole blob.
+func BlobReader(store *repostorage.RepoStore, blobID string) (io.ReadCloser, int64, error) {
+	key := fmt.Sprintf("objects/blob/%s", blobID)
+	if streamer, ok := store.DB().(GitDb.ValueReader); ok {
+		reader, size, err := streamer.GetReader(key)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read blob %s: %w", blobID, err)
+		}
+		return reader, size, nil
+	}
+
+	content, err := store.DB().Get(key)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read blob %s: %w", blobID, err)
+	}
+	return io.NopCloser(bytes.NewReader(content)), int64(len(content)), nil
+}
+
+// WriteTreeToBatch writes a tree object to a batch
+func WriteTreeToBatch(batch *repostorage.WriteBatch, treeID int, entries []TreeEntry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal tree: %w", err)
+	}
+
+	key := fmt.Sprintf("objects/tree/%d", treeID)
+	batch.Put(key, data)
+	return nil
+}
+
+// DiffStatFromStore counts files and lines changed by changes using RepoStore
+func DiffStatFromStore(store *repostorage.RepoStore, changes []TreeChange) (DiffStat, error) {
+	return diffStatFromDB(store.DB(), changes)
 }
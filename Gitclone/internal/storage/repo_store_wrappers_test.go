@@ -0,0 +1,457 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"GitDb"
+	repostorage "gitclone/internal/infra/storage"
+)
+
+// TestListAllRefs verifies that heads, remotes and tags are all returned with
+// their latest values
+func TestListAllRefs(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-list-refs-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repoBase := filepath.Join(tmpDir, "repos")
+	repoID := "test-repo"
+	repoPath := filepath.Join(repoBase, repoID)
+	if err := os.MkdirAll(repoPath, 0755); err != nil {
+		t.Fatalf("Failed to create repo dir: %v", err)
+	}
+
+	options := InitOptions{Bare: false}
+	if err := InitRepo(repoPath, options); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	store, err := repostorage.NewRepoStore(repoBase, repoID)
+	if err != nil {
+		t.Fatalf("Failed to open RepoStore: %v", err)
+	}
+	defer store.Close()
+
+	batch := store.NewWriteBatch()
+	if err := WriteHeadRefToBatch(batch, "master", 1); err != nil {
+		t.Fatalf("Failed to write head ref: %v", err)
+	}
+	if err := WriteHeadRefToBatch(batch, "master", 2); err != nil {
+		t.Fatalf("Failed to write head ref: %v", err)
+	}
+	if err := WriteHeadRefToBatch(batch, "feature", 3); err != nil {
+		t.Fatalf("Failed to write head ref: %v", err)
+	}
+	if err := WriteRemoteRefToBatch(batch, "master", 1); err != nil {
+		t.Fatalf("Failed to write remote ref: %v", err)
+	}
+	batch.Put("refs/tags/v1.0", []byte("1"))
+	batch.Put("meta/NEXT_COMMIT_ID", []byte("4"))
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("Failed to commit batch: %v", err)
+	}
+
+	refs, err := ListAllRefs(store)
+	if err != nil {
+		t.Fatalf("ListAllRefs failed: %v", err)
+	}
+
+	want := map[string]string{
+		"refs/heads/master":          "2",
+		"refs/heads/feature":         "3",
+		"refs/remotes/origin/master": "1",
+		"refs/tags/v1.0":             "1",
+	}
+	for key, value := range want {
+		if got, ok := refs[key]; !ok || got != value {
+			t.Errorf("%s: expected %q, got %q (present=%v)", key, value, got, ok)
+		}
+	}
+	for key := range refs {
+		if _, ok := want[key]; !ok {
+			t.Errorf("Unexpected ref %s=%q", key, refs[key])
+		}
+	}
+}
+
+// TestEmptyRefContract checks that every ref reader treats an empty ref as an
+// existing branch without commits, and that EnsureHeadRefExistsFromStore is
+// visible through the same store
+func TestEmptyRefContract(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-empty-ref-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repoID := "test-repo"
+	repoPath := filepath.Join(tmpDir, repoID)
+	if err := os.MkdirAll(repoPath, 0755); err != nil {
+		t.Fatalf("Failed to create repo dir: %v", err)
+	}
+	options := InitOptions{Bare: false}
+	if err := InitRepo(repoPath, options); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	store, err := repostorage.NewRepoStore(tmpDir, repoID)
+	if err != nil {
+		t.Fatalf("Failed to open RepoStore: %v", err)
+	}
+	defer store.Close()
+
+	// init leaves master as an empty ref
+	if !HeadRefExistsFromStore(store, "master") {
+		t.Fatalf("Expected master to exist after init")
+	}
+	if tip, err := ReadHeadRefMaybeFromStore(store, "master"); err != nil || tip != nil {
+		t.Errorf("ReadHeadRefMaybeFromStore(master) = %v, %v; want nil, nil", tip, err)
+	}
+	if tip, err := ReadHeadRefMaybe(repoPath, options, "master"); err != nil || tip != nil {
+		t.Errorf("ReadHeadRefMaybe(master) = %v, %v; want nil, nil", tip, err)
+	}
+	if _, err := ReadHeadRef(repoPath, options, "master"); err == nil {
+		t.Errorf("ReadHeadRef(master) should fail for a branch with no commits")
+	}
+
+	// A missing branch reads the same but doesn't exist
+	if HeadRefExistsFromStore(store, "missing") {
+		t.Errorf("Expected missing branch not to exist")
+	}
+	if tip, err := ReadHeadRefMaybeFromStore(store, "missing"); err != nil || tip != nil {
+		t.Errorf("ReadHeadRefMaybeFromStore(missing) = %v, %v; want nil, nil", tip, err)
+	}
+
+	if err := EnsureHeadRefExistsFromStore(store, "feature"); err != nil {
+		t.Fatalf("EnsureHeadRefExistsFromStore failed: %v", err)
+	}
+	if !HeadRefExistsFromStore(store, "feature") {
+		t.Errorf("Expected feature to be visible through the store that created it")
+	}
+
+	// Remote refs follow the same contract
+	if err := store.DB().Put("refs/remotes/origin/master", []byte("")); err != nil {
+		t.Fatalf("Failed to write empty remote ref: %v", err)
+	}
+	if tip, err := ReadRemoteRefFromStore(store, "master"); err != nil || tip != nil {
+		t.Errorf("ReadRemoteRefFromStore(master) = %v, %v; want nil, nil", tip, err)
+	}
+
+	if err := store.DB().Put("refs/heads/broken", []byte("abc\n")); err != nil {
+		t.Fatalf("Failed to write invalid ref: %v", err)
+	}
+	if _, err := ReadHeadRefMaybeFromStore(store, "broken"); err == nil {
+		t.Errorf("Expected an error for a non-numeric ref")
+	}
+}
+
+// TestResolveHead covers a branch with commits, an empty branch and a
+// detached HEAD, using an in-memory store
+func TestResolveHead(t *testing.T) {
+	store, err := repostorage.NewRepoStoreWithKV("test-repo", "/nonexistent", GitDb.NewMemDB())
+	if err != nil {
+		t.Fatalf("Failed to open RepoStore: %v", err)
+	}
+	if err := InitRepoStore(store, InitOptions{}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	// Empty branch
+	tip, branch, err := ResolveHead(store)
+	if err != nil || tip != nil || branch != "master" {
+		t.Fatalf("Expected master with no tip, got %v, %q, %v", tip, branch, err)
+	}
+
+	// Branch with commits
+	batch := store.NewWriteBatch()
+	if err := WriteHeadRefToBatch(batch, "master", 4); err != nil {
+		t.Fatalf("Failed to write head ref: %v", err)
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("Failed to commit batch: %v", err)
+	}
+	tip, branch, err = ResolveHead(store)
+	if err != nil || tip == nil || *tip != 4 || branch != "master" {
+		t.Fatalf("Expected master at 4, got %v, %q, %v", tip, branch, err)
+	}
+
+	// Detached at a commit
+	if err := store.DB().Put("meta/HEAD", []byte("2\n")); err != nil {
+		t.Fatalf("Failed to detach HEAD: %v", err)
+	}
+	tip, branch, err = ResolveHead(store)
+	if err != nil || tip == nil || *tip != 2 || branch != "" {
+		t.Fatalf("Expected detached at 2, got %v, %q, %v", tip, branch, err)
+	}
+	if _, err := ReadHEADBranchFromStore(store); !errors.Is(err, ErrDetachedHead) {
+		t.Errorf("Expected ErrDetachedHead reading the branch, got %v", err)
+	}
+}
+
+// matchWriter compares what is written to it against want, a chunk at a
+// time, so a streamed blob is checked without collecting it
+type matchWriter struct {
+	want    []byte
+	written int
+}
+
+func (w *matchWriter) Write(p []byte) (int, error) {
+	if w.written+len(p) > len(w.want) || !bytes.Equal(p, w.want[w.written:w.written+len(p)]) {
+		return 0, fmt.Errorf("content differs at or after byte %d", w.written)
+	}
+	w.written += len(p)
+	return len(p), nil
+}
+
+// TestBlobReader streams multi-megabyte blobs, compressible and not, back
+// byte for byte with their size, from a store on disk and one in memory
+func TestBlobReader(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-blob-reader-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repoID := "test-repo"
+	if err := os.MkdirAll(filepath.Join(tmpDir, repoID), 0755); err != nil {
+		t.Fatalf("Failed to create repo dir: %v", err)
+	}
+	if err := InitRepo(filepath.Join(tmpDir, repoID), InitOptions{Bare: false}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+	onDisk, err := repostorage.NewRepoStore(tmpDir, repoID)
+	if err != nil {
+		t.Fatalf("Failed to open RepoStore: %v", err)
+	}
+	defer onDisk.Close()
+
+	inMemory, err := repostorage.NewRepoStoreWithKV(repoID, "/nonexistent", GitDb.NewMemDB())
+	if err != nil {
+		t.Fatalf("Failed to open RepoStore: %v", err)
+	}
+	if err := InitRepoStore(inMemory, InitOptions{}); err != nil {
+		t.Fatalf("Failed to init repo store: %v", err)
+	}
+
+	// A pseudo-random blob doesn't compress; a repeated one does
+	noisy := make([]byte, 3<<20)
+	seed := uint32(1)
+	for i := range noisy {
+		seed = seed*1664525 + 1013904223
+		noisy[i] = byte(seed >> 24)
+	}
+	blobs := map[string][]byte{
+		"noisy.bin": noisy,
+		"big.txt":   bytes.Repeat([]byte("a line of a large text file\n"), 150000),
+	}
+
+	for _, store := range []*repostorage.RepoStore{onDisk, inMemory} {
+		for path, content := range blobs {
+			if err := StageContentFromStore(store, path, content); err != nil {
+				t.Fatalf("Failed to stage %s: %v", path, err)
+			}
+		}
+		entries, err := GetIndexEntriesFromStore(store)
+		if err != nil {
+			t.Fatalf("Failed to read index: %v", err)
+		}
+
+		for path, content := range blobs {
+			reader, size, err := BlobReader(store, entries[path].BlobID)
+			if err != nil {
+				t.Fatalf("BlobReader(%s) failed: %v", path, err)
+			}
+			if size != int64(len(content)) {
+				t.Errorf("BlobReader(%s): size %d, want %d", path, size, len(content))
+			}
+			w := &matchWriter{want: content}
+			_, err = io.CopyBuffer(w, reader, make([]byte, 32<<10))
+			reader.Close()
+			if err != nil || w.written != len(content) {
+				t.Errorf("BlobReader(%s): streamed %d of %d bytes: %v", path, w.written, len(content), err)
+			}
+		}
+
+		if _, _, err := BlobReader(store, "missing"); !errors.Is(err, GitDb.ErrNotFound) {
+			t.Errorf("Expected ErrNotFound for a missing blob, got %v", err)
+		}
+	}
+}
+
+// TestCompactIndex stages a large index of new files over and over, clearing
+// it the way commits and ClearIndexFromStore do, and checks that cleared
+// entries don't pile up: no index keys outlive a cycle, and every cycle
+// writes the same number of index records
+func TestCompactIndex(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-compact-index-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repoBase := filepath.Join(tmpDir, "repos")
+	repoPath := filepath.Join(repoBase, "test-repo")
+	if err := os.MkdirAll(repoPath, 0755); err != nil {
+		t.Fatalf("Failed to create repo dir: %v", err)
+	}
+	if err := InitRepo(repoPath, InitOptions{Bare: false}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+	store, err := repostorage.NewRepoStore(repoBase, "test-repo")
+	if err != nil {
+		t.Fatalf("Failed to open RepoStore: %v", err)
+	}
+	defer store.Close()
+
+	indexRecords := func() int {
+		t.Helper()
+		count := 0
+		if err := store.DB().Scan(func(record GitDb.Record) error {
+			if _, ok := indexPathFromKey(record.Key); ok {
+				count++
+			}
+			return nil
+		}); err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		return count
+	}
+
+	const files = 200
+	perCycle := -1
+	for cycle := 0; cycle < 6; cycle++ {
+		dir := fmt.Sprintf("cycle%d", cycle)
+		if err := os.MkdirAll(filepath.Join(repoPath, dir), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		for i := 0; i < files; i++ {
+			if err := os.WriteFile(filepath.Join(repoPath, dir, fmt.Sprintf("f%d.txt", i)), []byte(fmt.Sprintf("%d/%d", cycle, i)), 0644); err != nil {
+				t.Fatalf("Failed to write file: %v", err)
+			}
+		}
+
+		before := indexRecords()
+		if _, err := AddToIndexFromStore(context.Background(), store, dir); err != nil {
+			t.Fatalf("Failed to stage %s: %v", dir, err)
+		}
+		if cycle%2 == 0 {
+			// As a commit does: clear the staged entries, then compact
+			batch := store.NewWriteBatch()
+			if err := ClearIndexToBatch(batch, store); err != nil {
+				t.Fatalf("Failed to clear index: %v", err)
+			}
+			if err := batch.Commit(); err != nil {
+				t.Fatalf("Failed to commit batch: %v", err)
+			}
+			if deleted, err := CompactIndex(store); err != nil || deleted != files {
+				t.Fatalf("Cycle %d: expected %d cleared entries deleted, got %d, %v", cycle, files, deleted, err)
+			}
+		} else if err := ClearIndexFromStore(store); err != nil {
+			t.Fatalf("Failed to clear index: %v", err)
+		}
+
+		paths, err := liveIndexPaths(store.DB())
+		if err != nil {
+			t.Fatalf("Failed to read index: %v", err)
+		}
+		if len(paths) != 0 {
+			t.Fatalf("Cycle %d: expected no index keys left, got %d", cycle, len(paths))
+		}
+		written := indexRecords() - before
+		if cycle < 2 {
+			continue
+		}
+		if perCycle == -1 {
+			perCycle = written
+		}
+		// Commit-style and ClearIndex cycles alternate, so compare like with like
+		if cycle%2 == 0 && written != perCycle {
+			t.Errorf("Cycle %d wrote %d index records, the first commit-style cycle %d", cycle, written, perCycle)
+		}
+		if cycle%2 == 1 && written > 2*files {
+			t.Errorf("Cycle %d wrote %d index records for %d files", cycle, written, files)
+		}
+	}
+
+	if deleted, err := CompactIndex(store); err != nil || deleted != 0 {
+		t.Errorf("Expected nothing left to compact, got %d, %v", deleted, err)
+	}
+}
+
+// TestCompactIndexKeepsStageFromOtherHandle stages a path from a second
+// handle after the committing handle has cleared it, then compacts through
+// the committing handle: the new stage must survive a reopen
+func TestCompactIndexKeepsStageFromOtherHandle(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-compact-index-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repoBase := filepath.Join(tmpDir, "repos")
+	repoPath := filepath.Join(repoBase, "test-repo")
+	if err := os.MkdirAll(repoPath, 0755); err != nil {
+		t.Fatalf("Failed to create repo dir: %v", err)
+	}
+	if err := InitRepo(repoPath, InitOptions{Bare: false}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repoPath, "a.txt"), []byte("one"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	committer, err := repostorage.NewRepoStore(repoBase, "test-repo")
+	if err != nil {
+		t.Fatalf("Failed to open RepoStore: %v", err)
+	}
+	defer committer.Close()
+	if _, err := AddToIndexFromStore(context.Background(), committer, "a.txt"); err != nil {
+		t.Fatalf("Failed to stage a.txt: %v", err)
+	}
+	batch := committer.NewWriteBatch()
+	if err := ClearIndexToBatch(batch, committer); err != nil {
+		t.Fatalf("Failed to clear index: %v", err)
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("Failed to commit batch: %v", err)
+	}
+
+	// Between the commit and its compaction, a.txt is staged again elsewhere
+	if err := os.WriteFile(filepath.Join(repoPath, "a.txt"), []byte("two"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	stager, err := repostorage.NewRepoStore(repoBase, "test-repo")
+	if err != nil {
+		t.Fatalf("Failed to open second RepoStore: %v", err)
+	}
+	if _, err := AddToIndexFromStore(context.Background(), stager, "a.txt"); err != nil {
+		t.Fatalf("Failed to stage a.txt again: %v", err)
+	}
+	stager.Close()
+
+	if deleted, err := CompactIndex(committer); err != nil || deleted != 0 {
+		t.Fatalf("Expected the restaged entry kept, got %d deleted, %v", deleted, err)
+	}
+
+	reopened, err := repostorage.NewRepoStore(repoBase, "test-repo")
+	if err != nil {
+		t.Fatalf("Failed to reopen RepoStore: %v", err)
+	}
+	defer reopened.Close()
+	entries, err := GetIndexEntriesFromStore(reopened)
+	if err != nil {
+		t.Fatalf("Failed to read index: %v", err)
+	}
+	if entry, ok := entries["a.txt"]; !ok || entry.BlobID != blobIDOf([]byte("two")) {
+		t.Errorf("Expected a.txt staged with its new content after reopening, got %+v", entries)
+	}
+}
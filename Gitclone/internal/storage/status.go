@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"GitDb"
+	repostorage "gitclone/internal/infra/storage"
+)
+
+// Status compares the working tree with what the next commit would start
+// from: the HEAD commit's tree with the staged index applied. Like git's stat
+// cache, it avoids re-reading files it has seen before: staging a file records
+// its blob ID, size and mtime under index/stat/<path>, which commits don't
+// clear. A file whose size and mtime still match is taken to hold that blob;
+// any other file is hashed.
+
+// WorktreeStatus lists how the working tree differs from the next commit's base
+type WorktreeStatus struct {
+	Staged    []string `json:"staged"`    // paths with a staged change
+	Modified  []string `json:"modified"`  // files whose content differs from their staged or committed version
+	Deleted   []string `json:"deleted"`   // staged or committed files missing from disk, not staged for removal
+	Untracked []string `json:"untracked"` // files neither staged nor committed
+}
+
+// statCacheKey returns the key of a path's stat cache entry
+func statCacheKey(path string) string {
+	return "index/stat/" + path
+}
+
+// Status reports the working tree's status
+func Status(root string, options InitOptions) (WorktreeStatus, error) {
+	db, err := openDB(root, options)
+	if err != nil {
+		return WorktreeStatus{}, err
+	}
+	defer db.Close()
+
+	status, _, err := statusFromDB(root, db)
+	return status, err
+}
+
+// StatusFromStore reports the working tree's status using RepoStore
+func StatusFromStore(store *repostorage.RepoStore) (WorktreeStatus, error) {
+	status, _, err := statusFromDB(store.RepoPath(), store.DB())
+	return status, err
+}
+
+// headTreeFromDB returns the tree of the commit HEAD's branch is at, or nil
+// if the branch has no commits or HEAD can't be read
+func headTreeFromDB(db GitDb.KV) ([]TreeEntry, error) {
+	branch, err := readHEADBranchFromDB(db)
+	if err != nil {
+		return nil, nil
+	}
+	tip, err := readHeadRefMaybeFromDB(db, branch)
+	if err != nil || tip == nil {
+		return nil, nil
+	}
+	return readTreeMaybeFromDB(db, *tip)
+}
+
+// statusFromDB computes the status of the working tree at root and also
+// returns how many files it had to hash
+func statusFromDB(root string, db GitDb.KV) (WorktreeStatus, int, error) {
+	status := WorktreeStatus{Staged: []string{}, Modified: []string{}, Deleted: []string{}, Untracked: []string{}}
+
+	staged, err := indexEntriesFromDB(db)
+	if err != nil {
+		return status, 0, err
+	}
+
+	// Expected blob of every tracked path: HEAD's tree with the index applied
+	headTree, err := headTreeFromDB(db)
+	if err != nil {
+		return status, 0, err
+	}
+	expected := make(map[string]string)
+	for _, entry := range ApplyIndexToTree(headTree, staged) {
+		if entry.Type != "tree" {
+			expected[entry.Path] = entry.BlobID
+		}
+	}
+	for path := range staged {
+		status.Staged = append(status.Staged, path)
+	}
+
+	hashed := 0
+	seen := make(map[string]bool)
+	err = filepath.Walk(root, func(fullPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil // Skip unreadable paths
+		}
+		if info.IsDir() {
+			if info.Name() == RepoDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, fullPath)
+		if err != nil {
+			return nil
+		}
+		rel = normalizeIndexPath(rel)
+		seen[rel] = true
+
+		want, tracked := expected[rel]
+		if !tracked {
+			status.Untracked = append(status.Untracked, rel)
+			return nil
+		}
+
+		blobID, ok := cachedBlobID(db, rel, info)
+		if !ok {
+			content, _, err := readWorktreeFile(fullPath, info)
+			if err != nil {
+				return err
+			}
+			blobID = blobIDOf(content)
+			hashed++
+		}
+		if blobID != want {
+			status.Modified = append(status.Modified, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return status, hashed, err
+	}
+
+	for path := range expected {
+		if !seen[path] {
+			status.Deleted = append(status.Deleted, path)
+		}
+	}
+
+	sort.Strings(status.Staged)
+	sort.Strings(status.Modified)
+	sort.Strings(status.Deleted)
+	sort.Strings(status.Untracked)
+	return status, hashed, nil
+}
+
+// cachedBlobID returns the blob ID recorded when path was last staged, if the
+// file's size and mtime haven't changed since
+func cachedBlobID(db GitDb.KV, path string, info os.FileInfo) (string, bool) {
+	data, err := db.Get(statCacheKey(path))
+	if err != nil {
+		return "", false
+	}
+	var entry IndexEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return "", false
+	}
+	// Entries without a recorded stat can't vouch for the file
+	if entry.BlobID == "" || entry.ModTime == 0 {
+		return "", false
+	}
+	if entry.Size != info.Size() || entry.ModTime != info.ModTime().UnixNano() {
+		return "", false
+	}
+	return entry.BlobID, true
+}
+
+// StagedChangesFromStore compares the index with the HEAD commit: the paths
+// the next commit would add, modify or remove, sorted by path. With no HEAD
+// commit yet, every staged file is added.
+func StagedChangesFromStore(store *repostorage.RepoStore) ([]TreeChange, error) {
+	db := store.DB()
+	staged, err := indexEntriesFromDB(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var headTree []TreeEntry
+	tip, _, err := resolveHeadFromDB(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HEAD: %w", err)
+	}
+	if tip != nil {
+		if headTree, err = readTreeMaybeFromDB(db, *tip); err != nil {
+			return nil, err
+		}
+	}
+	return DiffTrees(treeFiles(headTree), treeFiles(ApplyIndexToTree(headTree, staged))), nil
+}
+
+// treeFiles returns the entries of tree that aren't directories
+func treeFiles(tree []TreeEntry) []TreeEntry {
+	files := make([]TreeEntry, 0, len(tree))
+	for _, entry := range tree {
+		if entry.Type != "tree" {
+			files = append(files, entry)
+		}
+	}
+	return files
+}
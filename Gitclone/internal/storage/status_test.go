@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestStatusStatCache checks a touched-but-unchanged file isn't reported
+// modified, a rewrite of the same size and mtime is trusted to the cache, and
+// a changed file is rehashed and reported
+func TestStatusStatCache(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-status-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	options := InitOptions{Bare: false}
+	if err := InitRepo(tmpDir, options); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+	for _, name := range []string{"a.txt", "b.txt", "gone.txt"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(name+"\n"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		if _, err := AddToIndex(tmpDir, options, name); err != nil {
+			t.Fatalf("Failed to stage %s: %v", name, err)
+		}
+	}
+	entries, _ := GetIndexEntries(tmpDir, options)
+	if entries["a.txt"].Size != int64(len("a.txt\n")) || entries["a.txt"].ModTime == 0 {
+		t.Errorf("Expected size and mtime recorded at stage time, got %+v", entries["a.txt"])
+	}
+
+	// Touch a.txt, rewrite b.txt, remove gone.txt and add an untracked file
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(tmpDir, "a.txt"), later, later); err != nil {
+		t.Fatalf("Failed to touch a.txt: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "b.txt"), []byte("changed\n"), 0644); err != nil {
+		t.Fatalf("Failed to rewrite b.txt: %v", err)
+	}
+	os.Remove(filepath.Join(tmpDir, "gone.txt"))
+	if err := os.WriteFile(filepath.Join(tmpDir, "new.txt"), []byte("new\n"), 0644); err != nil {
+		t.Fatalf("Failed to write new.txt: %v", err)
+	}
+
+	db, err := openDB(tmpDir, options)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	status, hashed, err := statusFromDB(tmpDir, db)
+	db.Close()
+	if err != nil {
+		t.Fatalf("Failed to get status: %v", err)
+	}
+	want := WorktreeStatus{
+		Staged:    []string{"a.txt", "b.txt", "gone.txt"},
+		Modified:  []string{"b.txt"},
+		Deleted:   []string{"gone.txt"},
+		Untracked: []string{"new.txt"},
+	}
+	if !reflect.DeepEqual(status, want) {
+		t.Errorf("Expected %+v, got %+v", want, status)
+	}
+	if hashed != 2 {
+		t.Errorf("Expected the touched and rewritten files hashed, got %d hashes", hashed)
+	}
+}
+
+// TestStatusLegacyIndexEntry checks entries staged before size and mtime were
+// recorded still decode and fall back to hashing
+func TestStatusLegacyIndexEntry(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-status-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	options := InitOptions{Bare: false}
+	if err := InitRepo(tmpDir, options); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+	content := []byte("legacy\n")
+	if err := os.WriteFile(filepath.Join(tmpDir, "old.txt"), content, 0644); err != nil {
+		t.Fatalf("Failed to write old.txt: %v", err)
+	}
+
+	db, err := openDB(tmpDir, options)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+	legacy := []byte(fmt.Sprintf(`{"blobId":%q,"mode":"100644"}`, blobIDOf(content)))
+	if err := db.Put("index/entries/old.txt", legacy); err != nil {
+		t.Fatalf("Failed to write legacy entry: %v", err)
+	}
+
+	status, hashed, err := statusFromDB(tmpDir, db)
+	if err != nil {
+		t.Fatalf("Failed to get status: %v", err)
+	}
+	if len(status.Staged) != 1 || len(status.Modified) != 0 || hashed != 1 {
+		t.Errorf("Expected old.txt staged, unmodified and hashed once, got %+v with %d hashes", status, hashed)
+	}
+}
+
+// BenchmarkStatusUnchangedTree compares status over an unchanged tree with a
+// warm stat cache against one where every file's mtime has moved
+func BenchmarkStatusUnchangedTree(b *testing.B) {
+	const files = 200
+	for _, touched := range []bool{false, true} {
+		name := "stat cache"
+		if touched {
+			name = "no stat cache"
+		}
+		b.Run(name, func(b *testing.B) {
+			tmpDir, err := os.MkdirTemp("", "gitstore-status-bench-*")
+			if err != nil {
+				b.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(tmpDir)
+
+			options := InitOptions{Bare: false}
+			if err := InitRepo(tmpDir, options); err != nil {
+				b.Fatalf("Failed to init repo: %v", err)
+			}
+			later := time.Now().Add(time.Hour)
+			for i := 0; i < files; i++ {
+				path := fmt.Sprintf("file%03d.txt", i)
+				if err := os.WriteFile(filepath.Join(tmpDir, path), []byte(path+"\n"), 0644); err != nil {
+					b.Fatalf("Failed to write %s: %v", path, err)
+				}
+				if _, err := AddToIndex(tmpDir, options, path); err != nil {
+					b.Fatalf("Failed to stage %s: %v", path, err)
+				}
+				if touched {
+					os.Chtimes(filepath.Join(tmpDir, path), later, later)
+				}
+			}
+
+			db, err := openDB(tmpDir, options)
+			if err != nil {
+				b.Fatalf("Failed to open DB: %v", err)
+			}
+			defer db.Close()
+
+			hashes := 0
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, hashed, err := statusFromDB(tmpDir, db)
+				if err != nil {
+					b.Fatalf("Failed to get status: %v", err)
+				}
+				hashes += hashed
+			}
+			b.ReportMetric(float64(hashes)/float64(b.N), "hashes/op")
+		})
+	}
+}
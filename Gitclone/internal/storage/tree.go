@@ -2,9 +2,13 @@ package storage
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"sort"
+	"strings"
+
+	"GitDb"
 )
 
 // TreeEntry represents a single entry in a tree object
@@ -19,6 +23,13 @@ type TreeEntry struct {
 // BuildTreeFromIndex builds a tree object from the staging area index
 // Returns the tree ID (which is just a sequential ID for now)
 func BuildTreeFromIndex(root string, options InitOptions, treeID int) error {
+	return BuildTreeFromIndexWithParent(root, options, treeID, nil)
+}
+
+// BuildTreeFromIndexWithParent builds a tree object by applying the staged index
+// on top of the parent tree: staged blobs add or replace paths and staged
+// deletions remove them. A nil parentTreeID starts from an empty tree.
+func BuildTreeFromIndexWithParent(root string, options InitOptions, treeID int, parentTreeID *int) error {
 	db, err := openDB(root, options)
 	if err != nil {
 		return err
@@ -35,40 +46,221 @@ func BuildTreeFromIndex(root string, options InitOptions, treeID int) error {
 		return fmt.Errorf("Nothing to commit. Stage changes first with 'git add <path>' or 'gitclone add <path>'")
 	}
 
-	// Build tree entries from index
-	treeEntries := make([]TreeEntry, 0, len(entries))
-	
-	// Sort paths for consistent ordering
-	paths := make([]string, 0, len(entries))
-	for path := range entries {
-		paths = append(paths, path)
+	var parentEntries []TreeEntry
+	if parentTreeID != nil {
+		parentEntries, err = readTreeMaybeFromDB(db, *parentTreeID)
+		if err != nil {
+			return err
+		}
 	}
-	sort.Strings(paths)
 
-	for _, path := range paths {
-		entry := entries[path]
+	return writeTree(db, treeID, ApplyIndexToTree(parentEntries, entries))
+}
+
+// ApplyIndexToTree returns a new tree built from parent with the staged index
+// entries applied. The result is sorted by path.
+func ApplyIndexToTree(parent []TreeEntry, entries map[string]IndexEntry) []TreeEntry {
+	byPath := make(map[string]TreeEntry, len(parent)+len(entries))
+	for _, entry := range parent {
+		byPath[entry.Path] = entry
+	}
+
+	for path, entry := range entries {
+		normalizedPath := normalizeIndexPath(path)
+		if entry.Deleted {
+			delete(byPath, normalizedPath)
+			continue
+		}
 		if entry.BlobID == "" {
 			continue // Skip empty entries
 		}
-
-		// Normalize path (use forward slashes)
-		normalizedPath := filepath.ToSlash(path)
-		
-		treeEntries = append(treeEntries, TreeEntry{
+		byPath[normalizedPath] = TreeEntry{
 			Path:   normalizedPath,
 			BlobID: entry.BlobID,
 			Mode:   entry.Mode,
 			Type:   "blob",
-		})
+		}
+	}
+
+	return sortedTree(byPath)
+}
+
+// ErrMergeConflict is returned by MergeTrees when both sides changed a path
+// in different ways
+var ErrMergeConflict = errors.New("merge conflict")
+
+// MergeTrees three-way merges ours and theirs against base, the tree of their
+// merge base (nil if they have none). Each path keeps the side that changed
+// it from base, whether by adding, editing or deleting it; a path both sides
+// changed the same way is kept as is. If both sides changed a path
+// differently, the merge fails with ErrMergeConflict naming every such path.
+// The result is sorted by path.
+func MergeTrees(base, ours, theirs []TreeEntry) ([]TreeEntry, error) {
+	byPath := func(tree []TreeEntry) map[string]TreeEntry {
+		m := make(map[string]TreeEntry, len(tree))
+		for _, entry := range tree {
+			m[entry.Path] = entry
+		}
+		return m
+	}
+	baseByPath, oursByPath, theirsByPath := byPath(base), byPath(ours), byPath(theirs)
+
+	paths := make(map[string]bool)
+	for _, m := range []map[string]TreeEntry{baseByPath, oursByPath, theirsByPath} {
+		for path := range m {
+			paths[path] = true
+		}
+	}
+
+	merged := make(map[string]TreeEntry)
+	var conflicts []string
+	for path := range paths {
+		b, inBase := baseByPath[path]
+		o, inOurs := oursByPath[path]
+		t, inTheirs := theirsByPath[path]
+
+		var entry TreeEntry
+		var keep bool
+		switch {
+		case sameEntry(o, inOurs, t, inTheirs), sameEntry(b, inBase, t, inTheirs):
+			entry, keep = o, inOurs
+		case sameEntry(b, inBase, o, inOurs):
+			entry, keep = t, inTheirs
+		default:
+			conflicts = append(conflicts, path)
+			continue
+		}
+		if keep {
+			merged[path] = entry
+		}
+	}
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		return nil, fmt.Errorf("%w in %s", ErrMergeConflict, strings.Join(conflicts, ", "))
+	}
+	return sortedTree(merged), nil
+}
+
+// sameEntry reports whether two optional tree entries for a path record the
+// same content: both absent, or both present with the same blob and mode
+func sameEntry(a TreeEntry, aOK bool, b TreeEntry, bOK bool) bool {
+	if !aOK || !bOK {
+		return aOK == bOK
+	}
+	return a.BlobID == b.BlobID && a.Mode == b.Mode
+}
+
+// sortedTree flattens a path-keyed tree into a slice sorted by path
+func sortedTree(byPath map[string]TreeEntry) []TreeEntry {
+	// Sort paths for consistent ordering
+	paths := make([]string, 0, len(byPath))
+	for path := range byPath {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	treeEntries := make([]TreeEntry, 0, len(paths))
+	for _, path := range paths {
+		treeEntries = append(treeEntries, byPath[path])
+	}
+	return treeEntries
+}
+
+// ListTreeDir returns the entries of a flat tree that live under dir. With
+// recursive it returns every blob below dir with its full path; otherwise it
+// returns one directory level, with subdirectories as "tree" entries. An empty
+// dir (or ".") is the root. The result is sorted by path.
+func ListTreeDir(entries []TreeEntry, dir string, recursive bool) []TreeEntry {
+	prefix := strings.Trim(filepath.ToSlash(dir), "/")
+	if prefix == "." {
+		prefix = ""
+	}
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	byPath := make(map[string]TreeEntry)
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Path, prefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(entry.Path, prefix)
+		if recursive {
+			byPath[entry.Path] = entry
+			continue
+		}
+		if name, _, nested := strings.Cut(rest, "/"); nested {
+			byPath[prefix+name] = TreeEntry{Path: prefix + name, Mode: ModeDir, Type: "tree"}
+			continue
+		}
+		byPath[entry.Path] = entry
+	}
+
+	return sortedTree(byPath)
+}
+
+// Change statuses reported by DiffTrees
+const (
+	ChangeAdded    = "added"
+	ChangeModified = "modified"
+	ChangeRemoved  = "removed"
+)
+
+// TreeChange describes how one path differs between two trees
+type TreeChange struct {
+	Path      string
+	Status    string // ChangeAdded, ChangeModified or ChangeRemoved
+	OldBlobID string
+	NewBlobID string
+}
+
+// DiffTrees compares two flat trees and returns the paths that were added,
+// removed, or whose blob or mode changed, sorted by path.
+func DiffTrees(oldTree, newTree []TreeEntry) []TreeChange {
+	oldByPath := make(map[string]TreeEntry, len(oldTree))
+	for _, entry := range oldTree {
+		oldByPath[entry.Path] = entry
 	}
 
-	// Serialize tree
-	treeData, err := json.MarshalIndent(treeEntries, "", "  ")
+	changes := make([]TreeChange, 0)
+	for _, entry := range newTree {
+		old, ok := oldByPath[entry.Path]
+		delete(oldByPath, entry.Path)
+		switch {
+		case !ok:
+			changes = append(changes, TreeChange{Path: entry.Path, Status: ChangeAdded, NewBlobID: entry.BlobID})
+		case old.BlobID != entry.BlobID || old.Mode != entry.Mode:
+			changes = append(changes, TreeChange{Path: entry.Path, Status: ChangeModified, OldBlobID: old.BlobID, NewBlobID: entry.BlobID})
+		}
+	}
+	for path, old := range oldByPath {
+		changes = append(changes, TreeChange{Path: path, Status: ChangeRemoved, OldBlobID: old.BlobID})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+// WriteTree stores a tree object under the given tree ID
+func WriteTree(root string, options InitOptions, treeID int, entries []TreeEntry) error {
+	db, err := openDB(root, options)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return writeTree(db, treeID, entries)
+}
+
+// writeTree serializes a tree and stores it as objects/tree/<treeId>
+func writeTree(db GitDb.KV, treeID int, entries []TreeEntry) error {
+	treeData, err := json.MarshalIndent(entries, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal tree: %w", err)
 	}
 
-	// Store tree object: objects/tree/<treeId>
 	treeKey := fmt.Sprintf("objects/tree/%d", treeID)
 	return db.Put(treeKey, treeData)
 }
@@ -81,6 +273,31 @@ func ReadTree(root string, options InitOptions, treeID int) ([]TreeEntry, error)
 	}
 	defer db.Close()
 
+	return readTreeFromDB(db, treeID)
+}
+
+// ReadTreeMaybe reads a tree object, returning an empty tree if it doesn't exist
+func ReadTreeMaybe(root string, options InitOptions, treeID int) ([]TreeEntry, error) {
+	db, err := openDB(root, options)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return readTreeMaybeFromDB(db, treeID)
+}
+
+// readTreeMaybeFromDB is like readTreeFromDB but returns an empty tree when the
+// tree object doesn't exist (commits created before trees were recorded)
+func readTreeMaybeFromDB(db GitDb.KV, treeID int) ([]TreeEntry, error) {
+	if _, err := db.Get(fmt.Sprintf("objects/tree/%d", treeID)); err != nil {
+		return nil, nil
+	}
+	return readTreeFromDB(db, treeID)
+}
+
+// readTreeFromDB loads objects/tree/<treeId> from an open DB
+func readTreeFromDB(db GitDb.KV, treeID int) ([]TreeEntry, error) {
 	treeKey := fmt.Sprintf("objects/tree/%d", treeID)
 	data, err := db.Get(treeKey)
 	if err != nil {
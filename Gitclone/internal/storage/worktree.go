@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"GitDb"
+)
+
+// MaterializeTree writes the files of a tree object into the working directory,
+// restoring executable bits and recreating symlinks. Files not in the tree are
+// left untouched. A missing tree object (legacy commit) writes nothing.
+func MaterializeTree(root string, options InitOptions, treeID int) error {
+	db, err := openDB(root, options)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	entries, err := readTreeMaybeFromDB(db, treeID)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := materializeEntry(root, db, entry); err != nil {
+			return fmt.Errorf("failed to checkout %s: %w", entry.Path, err)
+		}
+	}
+	return nil
+}
+
+// materializeEntry writes a single tree entry below root
+func materializeEntry(root string, db GitDb.KV, entry TreeEntry) error {
+	if entry.Type != "" && entry.Type != "blob" {
+		return nil
+	}
+
+	// Trees can come from a restored backup, so their paths aren't trusted
+	relPath := filepath.Clean(filepath.FromSlash(entry.Path))
+	if !filepath.IsLocal(relPath) {
+		return fmt.Errorf("path escapes repository")
+	}
+	if first, _, _ := strings.Cut(relPath, string(filepath.Separator)); first == RepoDir {
+		return fmt.Errorf("path is inside %s", RepoDir)
+	}
+	if err := checkParentDirs(root, relPath); err != nil {
+		return err
+	}
+	fullPath := filepath.Join(root, relPath)
+
+	content, err := db.Get(fmt.Sprintf("objects/blob/%s", entry.BlobID))
+	if err != nil {
+		return fmt.Errorf("blob not found: %s", entry.BlobID)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return err
+	}
+
+	// Replace whatever is there; writing through an existing symlink would
+	// modify the link target instead of the tracked path
+	if info, err := os.Lstat(fullPath); err == nil && !info.Mode().IsRegular() {
+		if err := os.Remove(fullPath); err != nil {
+			return err
+		}
+	}
+
+	switch entry.Mode {
+	case ModeSymlink:
+		if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return os.Symlink(string(content), fullPath)
+	case ModeExecutable:
+		if err := os.WriteFile(fullPath, content, 0755); err != nil {
+			return err
+		}
+		return os.Chmod(fullPath, 0755)
+	default:
+		if err := os.WriteFile(fullPath, content, 0644); err != nil {
+			return err
+		}
+		return os.Chmod(fullPath, 0644)
+	}
+}
+
+// CheckWorktreePath fails if a write to relPath, a cleaned path below root,
+// could land outside root: a directory above it is a symlink or not a
+// directory, or relPath itself is a symlink
+func CheckWorktreePath(root, relPath string) error {
+	if err := checkParentDirs(root, relPath); err != nil {
+		return err
+	}
+	info, err := os.Lstat(filepath.Join(root, relPath))
+	if err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("%s is a symlink", relPath)
+	} else if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// checkParentDirs fails if a directory above relPath exists below root as
+// anything but a real directory. A symlink there, perhaps created by an
+// earlier tree entry, would send the write outside root.
+func checkParentDirs(root, relPath string) error {
+	dir := root
+	parents := strings.Split(filepath.Dir(relPath), string(filepath.Separator))
+	for _, name := range parents {
+		if name == "." {
+			break
+		}
+		dir = filepath.Join(dir, name)
+		info, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("parent directory %s is a symlink", name)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("parent %s is not a directory", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"GitDb"
+)
+
+func TestMaterializeTree_PreservesModes(t *testing.T) {
+	// Create temporary directory
+	tmpDir, err := os.MkdirTemp("", "gitstore-worktree-modes-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Initialize repo
+	options := InitOptions{Bare: false}
+	if err := InitRepo(tmpDir, options); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	// An executable script and a symlink pointing at it
+	scriptPath := filepath.Join(tmpDir, "run.sh")
+	linkPath := filepath.Join(tmpDir, "latest")
+	if err := os.WriteFile(scriptPath, []byte("#!/bin/sh\necho hi\n"), 0755); err != nil {
+		t.Fatalf("Failed to create script: %v", err)
+	}
+	if err := os.Symlink("run.sh", linkPath); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	if _, err := AddToIndex(tmpDir, options, "."); err != nil {
+		t.Fatalf("Failed to add to index: %v", err)
+	}
+	entries, err := GetIndexEntries(tmpDir, options)
+	if err != nil {
+		t.Fatalf("Failed to get index entries: %v", err)
+	}
+	if entries["run.sh"].Mode != ModeExecutable {
+		t.Errorf("Expected run.sh mode %s, got %s", ModeExecutable, entries["run.sh"].Mode)
+	}
+	if entries["latest"].Mode != ModeSymlink {
+		t.Errorf("Expected latest mode %s, got %s", ModeSymlink, entries["latest"].Mode)
+	}
+
+	if err := BuildTreeFromIndex(tmpDir, options, 1); err != nil {
+		t.Fatalf("Failed to build tree: %v", err)
+	}
+
+	// Wipe the working copies, replacing the link with a regular file
+	if err := os.Remove(scriptPath); err != nil {
+		t.Fatalf("Failed to remove script: %v", err)
+	}
+	if err := os.Remove(linkPath); err != nil {
+		t.Fatalf("Failed to remove link: %v", err)
+	}
+	if err := os.WriteFile(linkPath, []byte("not a link"), 0644); err != nil {
+		t.Fatalf("Failed to overwrite link: %v", err)
+	}
+
+	if err := MaterializeTree(tmpDir, options, 1); err != nil {
+		t.Fatalf("Failed to materialize tree: %v", err)
+	}
+
+	info, err := os.Stat(scriptPath)
+	if err != nil {
+		t.Fatalf("Script not restored: %v", err)
+	}
+	if info.Mode().Perm()&0111 == 0 {
+		t.Errorf("Expected executable bit on restored script, got %v", info.Mode())
+	}
+
+	linkInfo, err := os.Lstat(linkPath)
+	if err != nil {
+		t.Fatalf("Symlink not restored: %v", err)
+	}
+	if linkInfo.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("Expected latest to be a symlink, got %v", linkInfo.Mode())
+	}
+	target, err := os.Readlink(linkPath)
+	if err != nil {
+		t.Fatalf("Failed to read symlink: %v", err)
+	}
+	if target != "run.sh" {
+		t.Errorf("Expected symlink target run.sh, got %s", target)
+	}
+}
+
+// TestMaterializeEntryStaysInRoot checks tree entries that would write
+// outside the working tree or into .gitclone/ are refused, including a path
+// that escapes only once cleaned and one under a symlinked directory
+func TestMaterializeEntryStaysInRoot(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-worktree-escape-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	root := filepath.Join(tmpDir, "repo")
+	outside := filepath.Join(tmpDir, "outside")
+	for _, dir := range []string{root, outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	db := GitDb.NewMemDB()
+	content := []byte("owned")
+	if err := db.Put("objects/blob/"+blobIDOf(content), content); err != nil {
+		t.Fatalf("Failed to store blob: %v", err)
+	}
+
+	for _, path := range []string{
+		"../x",
+		"a/../../x",
+		"/abs/x",
+		".gitclone/db/log",
+		"link/passwd",
+		"link/nested/passwd",
+	} {
+		entry := TreeEntry{Path: path, BlobID: blobIDOf(content), Mode: ModeFile, Type: "blob"}
+		if err := materializeEntry(root, db, entry); err == nil {
+			t.Errorf("%s: expected the entry to be refused", path)
+		}
+	}
+
+	if found, _ := os.ReadDir(outside); len(found) != 0 {
+		t.Errorf("Expected nothing written outside the repository, found %v", found)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "x")); !os.IsNotExist(err) {
+		t.Errorf("Expected no file written next to the repository, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, RepoDir)); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing written into %s, got %v", RepoDir, err)
+	}
+
+	// A path that stays inside once cleaned is written where it points
+	entry := TreeEntry{Path: "a/../ok.txt", BlobID: blobIDOf(content), Mode: ModeFile, Type: "blob"}
+	if err := materializeEntry(root, db, entry); err != nil {
+		t.Fatalf("Expected a/../ok.txt to be written: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(root, "ok.txt")); err != nil || string(got) != "owned" {
+		t.Errorf("Expected ok.txt written, got %q, %v", got, err)
+	}
+}
@@ -0,0 +1,30 @@
+// Package timefmt is the one place the API's timestamps are shaped. Every
+// timestamp sent or stored is UTC to the second, and every one sent as text
+// is RFC3339, e.g. "2024-05-01T09:30:00Z". time.Time values in this shape
+// also marshal to JSON in exactly that form.
+package timefmt
+
+import "time"
+
+// Now returns the current time in UTC, truncated to the second
+func Now() time.Time {
+	return UTC(time.Now())
+}
+
+// UTC returns t in UTC, truncated to the second. The zero time stays zero.
+func UTC(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return t.UTC().Truncate(time.Second)
+}
+
+// Format formats t as RFC3339 in UTC
+func Format(t time.Time) string {
+	return UTC(t).Format(time.RFC3339)
+}
+
+// FormatUnix formats a Unix time in seconds as RFC3339 in UTC
+func FormatUnix(seconds int64) string {
+	return Format(time.Unix(seconds, 0))
+}
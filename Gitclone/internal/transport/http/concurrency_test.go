@@ -0,0 +1,336 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// watchWorkingDir polls the process working directory until stop is closed
+// and reports the first directory that differs from the starting one
+func watchWorkingDir(stop <-chan struct{}) <-chan string {
+	changed := make(chan string, 1)
+	start, _ := os.Getwd()
+	go func() {
+		defer close(changed)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if dir, _ := os.Getwd(); dir != start {
+				changed <- dir
+				return
+			}
+		}
+	}()
+	return changed
+}
+
+// runRepoWorkflow creates repoID and drives commit → branch → commit → merge →
+// push through the API, returning the first unexpected response
+func runRepoWorkflow(ts *testServer, repoID string) error {
+	type step struct {
+		method, path string
+		body         interface{}
+	}
+	base := "/api/repos/" + repoID
+	steps := []step{
+		{http.MethodPost, "/api/repos", CreateRepoRequest{Name: repoID}},
+		{http.MethodPost, base + "/files", FileRequest{Path: repoID + "-a.txt", Content: repoID}},
+		{http.MethodPost, base + "/add", AddRequest{Path: repoID + "-a.txt"}},
+		{http.MethodPost, base + "/commit", CommitRequest{Message: repoID + ": add a"}},
+		{http.MethodPost, base + "/checkout", CheckoutRequest{Branch: "feature"}},
+		{http.MethodPost, base + "/files", FileRequest{Path: repoID + "-b.txt", Content: repoID}},
+		{http.MethodPost, base + "/add", AddRequest{Path: repoID + "-b.txt"}},
+		{http.MethodPost, base + "/commit", CommitRequest{Message: repoID + ": add b"}},
+		{http.MethodPost, base + "/checkout", CheckoutRequest{Branch: "master"}},
+		{http.MethodPost, base + "/merge", MergeRequest{Branch: "feature"}},
+		{http.MethodPost, base + "/push", PushRequest{Remote: "origin", Branch: "master"}},
+	}
+	for _, s := range steps {
+		status, err := ts.send(s.method, s.path, s.body, nil)
+		if err != nil {
+			return err
+		}
+		if status != http.StatusOK && status != http.StatusCreated {
+			return fmt.Errorf("%s %s: unexpected status %d", s.method, s.path, status)
+		}
+	}
+	return nil
+}
+
+// TestConcurrentReposStayIsolated runs the same workflow against several repos
+// at once and checks that each repo ends up with only its own commits and
+// files. Handlers share the process, so none of them may change its working
+// directory.
+func TestConcurrentReposStayIsolated(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	const numRepos = 8
+	repoIDs := make([]string, numRepos)
+	for i := range repoIDs {
+		repoIDs[i] = fmt.Sprintf("repo%d", i)
+	}
+
+	stop := make(chan struct{})
+	cwdChanged := watchWorkingDir(stop)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, numRepos)
+	for _, repoID := range repoIDs {
+		wg.Add(1)
+		go func(repoID string) {
+			defer wg.Done()
+			if err := runRepoWorkflow(ts, repoID); err != nil {
+				errs <- fmt.Errorf("%s: %w", repoID, err)
+			}
+		}(repoID)
+	}
+	wg.Wait()
+	close(stop)
+	if dir, ok := <-cwdChanged; ok {
+		t.Errorf("A handler changed the process working directory to %s", dir)
+	}
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if t.Failed() {
+		return
+	}
+
+	for _, repoID := range repoIDs {
+		refs := ts.refs(repoID)
+		if refs["refs/heads/master"] == "" || refs["refs/heads/master"] != refs["refs/heads/feature"] {
+			t.Errorf("%s: expected master to fast-forward to feature, got refs %v", repoID, refs)
+		}
+
+		var commits []Commit
+		ts.expect(http.StatusOK, http.MethodGet, "/api/repos/"+repoID+"/commits", nil, &commits)
+		if len(commits) != 2 || commits[0].Message != repoID+": add b" || commits[1].Message != repoID+": add a" {
+			t.Errorf("%s: unexpected commits %+v", repoID, commits)
+		}
+
+		var tree []TreeEntry
+		ts.expect(http.StatusOK, http.MethodGet, "/api/repos/"+repoID+"/tree?recursive=true", nil, &tree)
+		if len(tree) != 2 || tree[0].Path != repoID+"-a.txt" || tree[1].Path != repoID+"-b.txt" {
+			t.Errorf("%s: unexpected tree %+v", repoID, tree)
+		}
+
+		var repo RepoListItem
+		ts.expect(http.StatusOK, http.MethodGet, "/api/repos/"+repoID, nil, &repo)
+		if repo.CurrentBranch != "master" {
+			t.Errorf("%s: expected current branch master, got %q", repoID, repo.CurrentBranch)
+		}
+	}
+}
+
+// TestConcurrentCommitAndMerge races a commit on master against merging
+// feature into master. Whichever runs first, the commit must survive: after a
+// merge it sits on top of feature, and a merge that lost the race is refused
+// as non-fast-forward rather than moving master back over the new commit.
+func TestConcurrentCommitAndMerge(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	const rounds = 10
+	for i := 0; i < rounds; i++ {
+		repoID := fmt.Sprintf("race%d", i)
+		base := "/api/repos/" + repoID
+		ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: repoID}, nil)
+		ts.commitFile(repoID, "a.txt", "a", "add a")
+		ts.expect(http.StatusOK, http.MethodPost, base+"/checkout", CheckoutRequest{Branch: "feature"}, nil)
+		ts.commitFile(repoID, "b.txt", "b", "add b")
+		ts.expect(http.StatusOK, http.MethodPost, base+"/checkout", CheckoutRequest{Branch: "master"}, nil)
+		ts.expect(http.StatusOK, http.MethodPost, base+"/files", FileRequest{Path: "c.txt", Content: "c", AutoStage: true}, nil)
+
+		var wg sync.WaitGroup
+		var commitStatus, mergeStatus int
+		var commitErr, mergeErr error
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			commitStatus, commitErr = ts.send(http.MethodPost, base+"/commit", CommitRequest{Message: "add c"}, nil)
+		}()
+		go func() {
+			defer wg.Done()
+			mergeStatus, mergeErr = ts.send(http.MethodPost, base+"/merge", MergeRequest{Branch: "feature"}, nil)
+		}()
+		wg.Wait()
+		if commitErr != nil || mergeErr != nil {
+			t.Fatalf("%s: requests failed: %v, %v", repoID, commitErr, mergeErr)
+		}
+		if commitStatus != http.StatusOK {
+			t.Fatalf("%s: expected the commit to succeed, got %d", repoID, commitStatus)
+		}
+		if mergeStatus != http.StatusOK && mergeStatus != http.StatusConflict {
+			t.Fatalf("%s: expected the merge to succeed or be refused, got %d", repoID, mergeStatus)
+		}
+
+		ts.expect(http.StatusOK, http.MethodPost, base+"/push", PushRequest{Remote: "origin", Branch: "master"}, nil)
+		var commits []Commit
+		ts.expect(http.StatusOK, http.MethodGet, base+"/commits", nil, &commits)
+		want := []string{"add c", "add a"}
+		if mergeStatus == http.StatusOK {
+			want = []string{"add c", "add b", "add a"}
+		}
+		got := make([]string, len(commits))
+		for j, c := range commits {
+			got[j] = c.Message
+		}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%s: merge returned %d, expected master history %v, got %v", repoID, mergeStatus, want, got)
+		}
+	}
+}
+
+// TestConcurrentCreateSameName fires two creates of the same name at once:
+// exactly one creates the repo and the other is refused as a conflict
+func TestConcurrentCreateSameName(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	const rounds = 10
+	for i := 0; i < rounds; i++ {
+		repoID := fmt.Sprintf("same%d", i)
+
+		var wg sync.WaitGroup
+		statuses := make([]int, 2)
+		errs := make([]error, 2)
+		for j := range statuses {
+			wg.Add(1)
+			go func(j int) {
+				defer wg.Done()
+				statuses[j], errs[j] = ts.send(http.MethodPost, "/api/repos", CreateRepoRequest{Name: repoID}, nil)
+			}(j)
+		}
+		wg.Wait()
+		if errs[0] != nil || errs[1] != nil {
+			t.Fatalf("%s: requests failed: %v, %v", repoID, errs[0], errs[1])
+		}
+		created, conflicts := 0, 0
+		for _, status := range statuses {
+			switch status {
+			case http.StatusCreated:
+				created++
+			case http.StatusConflict:
+				conflicts++
+			}
+		}
+		if created != 1 || conflicts != 1 {
+			t.Fatalf("%s: expected one 201 and one 409, got %v", repoID, statuses)
+		}
+	}
+
+	var repos []RepoListItem
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos", nil, &repos)
+	if len(repos) != rounds {
+		t.Errorf("Expected %d repos listed, got %d", rounds, len(repos))
+	}
+}
+
+// TestWritersHoldRepoLock checks every handler that writes to a repository's
+// log waits for the repo lock, so background compaction holding it can't
+// drop their records
+func TestWritersHoldRepoLock(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	base := "/api/repos/demo"
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	ts.expect(http.StatusOK, http.MethodPost, base+"/files", FileRequest{Path: "a.txt", Content: "a", AutoStage: true}, nil)
+	ts.expect(http.StatusOK, http.MethodPost, base+"/commit", CommitRequest{Message: "add a"}, nil)
+
+	writes := []struct {
+		method, path string
+		body         interface{}
+	}{
+		{http.MethodPost, base + "/files", FileRequest{Path: "b.txt", Content: "b"}},
+		{http.MethodPost, base + "/files/bulk", []FileRequest{{Path: "c.txt", Content: "c"}}},
+		{http.MethodPost, base + "/add", AddRequest{Path: "b.txt"}},
+		{http.MethodPost, base + "/checkout", CheckoutRequest{Branch: "feature"}},
+		{http.MethodPut, base + "/default-branch", DefaultBranchRequest{Branch: "master"}},
+		{http.MethodPut, base + "/branches/master/protection", BranchProtection{Protected: true}},
+	}
+	for _, write := range writes {
+		unlock := ts.server.repoLocks.Lock("demo")
+		done := make(chan int, 1)
+		go func() {
+			status, _ := ts.send(write.method, write.path, write.body, nil)
+			done <- status
+		}()
+
+		select {
+		case status := <-done:
+			t.Errorf("%s %s: finished with %d while the repo lock was held", write.method, write.path, status)
+		case <-time.After(50 * time.Millisecond):
+		}
+		unlock()
+
+		select {
+		case status := <-done:
+			if status != http.StatusOK {
+				t.Errorf("%s %s: expected 200, got %d", write.method, write.path, status)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s %s: still waiting after the repo lock was released", write.method, write.path)
+		}
+	}
+}
+
+// TestBackupHoldsRepoLock checks a backup waits for the repo lock, so it
+// can't stream a log that is being written or compacted, and that its body
+// matches its Content-Length
+func TestBackupHoldsRepoLock(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	ts.commitFile("demo", "a.txt", "a", "Add a")
+
+	type result struct {
+		status int
+		length int64
+		body   []byte
+		err    error
+	}
+	unlock := ts.server.repoLocks.Lock("demo")
+	done := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(ts.url + "/api/repos/demo/backup")
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		done <- result{status: resp.StatusCode, length: resp.ContentLength, body: body, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		t.Errorf("Backup finished with %d while the repo lock was held", res.status)
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+
+	select {
+	case res := <-done:
+		if res.err != nil || res.status != http.StatusOK {
+			t.Fatalf("Backup: status %d, %v", res.status, res.err)
+		}
+		if res.length != int64(len(res.body)) {
+			t.Errorf("Expected a %d-byte body as declared, got %d bytes", res.length, len(res.body))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Backup still waiting after the repo lock was released")
+	}
+}
@@ -0,0 +1,58 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"gitclone/internal/app/branches"
+	"gitclone/internal/app/commits"
+	"gitclone/internal/app/files"
+	"gitclone/internal/app/repos"
+	repostorage "gitclone/internal/storage"
+)
+
+// errorStatuses maps the errors services return for bad requests, and for
+// requests they gave up on, to the status reported for them, checked in
+// order with errors.Is
+var errorStatuses = []struct {
+	err    error
+	status int
+}{
+	{repos.ErrRepoNotFound, http.StatusNotFound},
+	{branches.ErrBranchNotFound, http.StatusNotFound},
+	{files.ErrCommitNotFound, http.StatusNotFound},
+	{files.ErrFileNotFound, http.StatusNotFound},
+	{repostorage.ErrCommitNotFound, http.StatusNotFound},
+	{repos.ErrInvalidRepoID, http.StatusBadRequest},
+	{repostorage.ErrInvalidBackup, http.StatusBadRequest},
+	{files.ErrInvalidPath, http.StatusBadRequest},
+	{commits.ErrNothingToCommit, http.StatusBadRequest},
+	{commits.ErrNothingToPush, http.StatusBadRequest},
+	{repostorage.ErrProtectedBranch, http.StatusForbidden},
+	{files.ErrQuotaExceeded, http.StatusForbidden},
+	{repos.ErrRepoExists, http.StatusConflict},
+	{repos.ErrNamespaceIsRepo, http.StatusConflict},
+	{commits.ErrNonFastForward, http.StatusConflict},
+	{commits.ErrNoPushToRollback, http.StatusConflict},
+	{commits.ErrAlreadyPushed, http.StatusConflict},
+	{repos.ErrNotARepo, http.StatusUnprocessableEntity},
+	{context.DeadlineExceeded, http.StatusServiceUnavailable},
+	{context.Canceled, http.StatusServiceUnavailable},
+}
+
+// errorStatus returns the status for an error a service returned: the
+// status of the first error in errorStatuses it wraps, or 500
+func errorStatus(err error) int {
+	for _, e := range errorStatuses {
+		if errors.Is(err, e.err) {
+			return e.status
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// respondError writes err with the status errorStatus picks for it
+func respondError(w http.ResponseWriter, err error) {
+	RespondJSON(w, errorStatus(err), ErrorResponse{Error: err.Error()})
+}
@@ -0,0 +1,52 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"gitclone/internal/app/branches"
+	"gitclone/internal/app/commits"
+	"gitclone/internal/app/files"
+	"gitclone/internal/app/repos"
+	repostorage "gitclone/internal/storage"
+)
+
+// TestErrorStatus checks each service error maps to its status when wrapped
+// the way services return it, and anything else to 500
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{repos.ErrRepoNotFound, http.StatusNotFound},
+		{branches.ErrBranchNotFound, http.StatusNotFound},
+		{files.ErrCommitNotFound, http.StatusNotFound},
+		{files.ErrFileNotFound, http.StatusNotFound},
+		{repostorage.ErrCommitNotFound, http.StatusNotFound},
+		{repos.ErrInvalidRepoID, http.StatusBadRequest},
+		{repostorage.ErrInvalidBackup, http.StatusBadRequest},
+		{files.ErrInvalidPath, http.StatusBadRequest},
+		{commits.ErrNothingToCommit, http.StatusBadRequest},
+		{commits.ErrNothingToPush, http.StatusBadRequest},
+		{repostorage.ErrProtectedBranch, http.StatusForbidden},
+		{files.ErrQuotaExceeded, http.StatusForbidden},
+		{repos.ErrRepoExists, http.StatusConflict},
+		{repos.ErrNamespaceIsRepo, http.StatusConflict},
+		{commits.ErrNonFastForward, http.StatusConflict},
+		{commits.ErrNoPushToRollback, http.StatusConflict},
+		{commits.ErrAlreadyPushed, http.StatusConflict},
+		{repos.ErrNotARepo, http.StatusUnprocessableEntity},
+		{context.DeadlineExceeded, http.StatusServiceUnavailable},
+		{context.Canceled, http.StatusServiceUnavailable},
+		{errors.New("disk full"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		err := fmt.Errorf("operation failed: %w", tt.err)
+		if got := errorStatus(err); got != tt.want {
+			t.Errorf("errorStatus(%v) = %d, want %d", err, got, tt.want)
+		}
+	}
+}
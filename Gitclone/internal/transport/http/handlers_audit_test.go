@@ -0,0 +1,96 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"gitclone/internal/metadata"
+)
+
+// TestAuditCommitAndMerge verifies that a commit and a merge each leave an
+// audit entry with the method, path, repo, actor and status, and that reads
+// are not audited
+func TestAuditCommitAndMerge(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "other"}, nil)
+	ts.commitFile("demo", "a.txt", "a", "Add a")
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/checkout", CheckoutRequest{Branch: "feature"}, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/files", FileRequest{Path: "b.txt", Content: "b"}, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/add", AddRequest{Path: "b.txt"}, nil)
+
+	send := func(path string, body interface{}, setActor func(*http.Request)) int {
+		t.Helper()
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("Failed to encode request body: %v", err)
+		}
+		req, err := http.NewRequest(http.MethodPost, ts.url+path, bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Failed to build request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		setActor(req)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := send("/api/repos/demo/commit", CommitRequest{Message: "Add b"}, func(req *http.Request) {
+		req.SetBasicAuth("alice", "")
+	}); status != http.StatusOK {
+		t.Fatalf("Expected commit to succeed, got %d", status)
+	}
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/checkout", CheckoutRequest{Branch: "master"}, nil)
+	if status := send("/api/repos/demo/merge", MergeRequest{Branch: "feature"}, func(req *http.Request) {
+		req.Header.Set("X-Actor", "bob")
+	}); status != http.StatusOK {
+		t.Fatalf("Expected merge to succeed, got %d", status)
+	}
+	// A refused merge is audited with its status
+	ts.expect(http.StatusNotFound, http.MethodPost, "/api/repos/demo/merge", MergeRequest{Branch: "nope"}, nil)
+
+	var entries []metadata.AuditEntry
+	ts.expect(http.StatusOK, http.MethodGet, "/api/audit?repo=demo", nil, &entries)
+
+	find := func(path, actor string, status int) {
+		t.Helper()
+		for _, entry := range entries {
+			if entry.Path == path && entry.Actor == actor && entry.Status == status {
+				if entry.Method != http.MethodPost || entry.RepoID != "demo" || entry.Time.IsZero() {
+					t.Errorf("Unexpected audit entry %+v", entry)
+				}
+				return
+			}
+		}
+		t.Errorf("No audit entry for %s by %q with status %d in %+v", path, actor, status, entries)
+	}
+	find("/api/repos/demo/commit", "alice", http.StatusOK)
+	find("/api/repos/demo/merge", "bob", http.StatusOK)
+	find("/api/repos/demo/merge", "", http.StatusNotFound)
+
+	for i, entry := range entries {
+		if entry.RepoID != "demo" {
+			t.Errorf("Expected only demo entries, got %+v", entry)
+		}
+		if entry.Method == http.MethodGet {
+			t.Errorf("Expected reads not to be audited, got %+v", entry)
+		}
+		if i > 0 && entry.Time.Before(entries[i-1].Time) {
+			t.Errorf("Expected entries oldest first, got %v after %v", entry.Time, entries[i-1].Time)
+		}
+	}
+
+	var all []metadata.AuditEntry
+	ts.expect(http.StatusOK, http.MethodGet, "/api/audit", nil, &all)
+	if len(all) <= len(entries) {
+		t.Errorf("Expected the unfiltered log to include other calls, got %d entries (demo has %d)", len(all), len(entries))
+	}
+}
@@ -0,0 +1,116 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"gitclone/internal/app/repos"
+	"gitclone/internal/metadata"
+	"gitclone/internal/storage"
+)
+
+// handleRepoBackup handles GET /api/repos/:id/backup
+// The repo lock is held while the log is copied, so no write or compaction
+// can change it mid-stream, and exactly the size sent as Content-Length is
+// copied.
+func (s *Server) handleRepoBackup(w http.ResponseWriter, r *http.Request, repoID string) {
+	defer s.repoLocks.Lock(repoID)()
+
+	f, err := repos.OpenBackup(s.repoBase, repoID)
+	if err != nil {
+		log.Printf("handleRepoBackup: repoID=%s open backup: %v", repoID, err)
+		respondError(w, err)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		log.Printf("handleRepoBackup: repoID=%s stat log: %v", repoID, err)
+		respondError(w, err)
+		return
+	}
+	size := info.Size()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", strings.ReplaceAll(repoID, "/", "-")+".gitdb"))
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", size))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.CopyN(w, f, size); err != nil {
+		log.Printf("handleRepoBackup: repoID=%s stream log: %v", repoID, err)
+	}
+}
+
+// DefaultMaxRestoreBytes caps the size of a backup restore accepts when no
+// repository size quota is set
+const DefaultMaxRestoreBytes int64 = 1 << 30
+
+// handleRepoRestore handles POST /api/repos/:id/restore
+// The request body is a raw GitDb log as produced by the backup endpoint. It
+// is read into memory, so it is capped at the repository size quota, or
+// DefaultMaxRestoreBytes without one; a larger body gets a 413. Like a create,
+// a restore is refused once the repository count quota is reached.
+func (s *Server) handleRepoRestore(w http.ResponseWriter, r *http.Request, repoID string) {
+	maxBytes := s.quotas.MaxRepoBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxRestoreBytes
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			RespondJSON(w, http.StatusRequestEntityTooLarge, ErrorResponse{Error: fmt.Sprintf("Backup exceeds %d bytes", maxBytes)})
+			return
+		}
+		RespondJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+
+	// Hold the repo lock so a create, compaction or other writer of the same
+	// ID can't interleave with the restore
+	defer s.repoLocks.Lock(repoID)()
+
+	if !s.checkRepoQuota(w) {
+		return
+	}
+
+	if err := repos.Restore(s.repoBase, repoID, data); err != nil {
+		log.Printf("handleRepoRestore: repoID=%s restore: %v", repoID, err)
+		respondError(w, err)
+		return
+	}
+
+	repoPath, err := repos.ResolveRepoPath(s.repoBase, repoID)
+	if err != nil {
+		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	// The backup is restored, so the repository is registered even if the
+	// client has gone
+	summary, err := s.LoadRepoSummary(context.WithoutCancel(r.Context()), repoPath, repoID)
+	if err != nil {
+		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	currentBranch, _ := storage.ReadHEADBranch(repoPath, storage.InitOptions{Bare: false})
+
+	meta := metadata.RepoMeta{
+		ID:            repoID,
+		Name:          repoID,
+		CurrentBranch: currentBranch,
+		BranchCount:   summary.BranchCount,
+		CommitCount:   summary.CommitCount,
+	}
+	if err := s.metaStore.CreateRepo(meta); err != nil {
+		log.Printf("handleRepoRestore: repoID=%s save metadata: %v", repoID, err)
+	} else if saved, err := s.metaStore.GetRepo(repoID); err == nil {
+		meta = *saved
+	}
+
+	RespondJSON(w, http.StatusCreated, repoListItemFromMeta(meta))
+}
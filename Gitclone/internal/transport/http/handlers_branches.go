@@ -10,16 +10,11 @@ import (
 
 // handleRepoBranches handles GET /api/repos/:id/branches
 func (s *Server) handleRepoBranches(w http.ResponseWriter, r *http.Request, repoID string) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Validate repo exists
 	_, err := repos.ResolveRepoPath(s.repoBase, repoID)
 	if err != nil {
 		log.Printf("handleRepoBranches: repoID=%s resolve repo path: %v", repoID, err)
-		RespondJSON(w, http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		respondError(w, err)
 		return
 	}
 
@@ -34,8 +29,11 @@ func (s *Server) handleRepoBranches(w http.ResponseWriter, r *http.Request, repo
 	httpBranches := make([]Branch, len(branches))
 	for i, b := range branches {
 		httpBranches[i] = Branch{
-			Name:      b.Name,
-			CreatedAt: b.CreatedAt,
+			Name:        b.Name,
+			CreatedAt:   b.CreatedAt,
+			TipCommitID: b.TipCommitID,
+			TipMessage:  b.TipMessage,
+			TipDate:     b.TipDate,
 		}
 	}
 
@@ -43,13 +41,29 @@ func (s *Server) handleRepoBranches(w http.ResponseWriter, r *http.Request, repo
 	RespondJSON(w, http.StatusOK, httpBranches)
 }
 
-// handleRepoCheckout handles POST /api/repos/:id/checkout
-func (s *Server) handleRepoCheckout(w http.ResponseWriter, r *http.Request, repoID string) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// handleRepoRefs handles GET /api/repos/:id/refs
+func (s *Server) handleRepoRefs(w http.ResponseWriter, r *http.Request, repoID string) {
+	// Validate repo exists
+	_, err := repos.ResolveRepoPath(s.repoBase, repoID)
+	if err != nil {
+		log.Printf("handleRepoRefs: repoID=%s resolve repo path: %v", repoID, err)
+		respondError(w, err)
+		return
+	}
+
+	// Call service
+	refs, err := s.branchSvc.ListRefs(repoID)
+	if err != nil {
+		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
+	// Write output
+	RespondJSON(w, http.StatusOK, refs)
+}
+
+// handleRepoCheckout handles POST /api/repos/:id/checkout
+func (s *Server) handleRepoCheckout(w http.ResponseWriter, r *http.Request, repoID string) {
 	// Parse input
 	var req CheckoutRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -61,16 +75,83 @@ func (s *Server) handleRepoCheckout(w http.ResponseWriter, r *http.Request, repo
 	_, err := repos.ResolveRepoPath(s.repoBase, repoID)
 	if err != nil {
 		log.Printf("handleRepoCheckout: repoID=%s resolve repo path: %v", repoID, err)
-		RespondJSON(w, http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		respondError(w, err)
 		return
 	}
 
+	// Hold the repo lock so compaction can't drop the HEAD update
+	defer s.repoLocks.Lock(repoID)()
+
 	// Call service
 	if err := s.branchSvc.Checkout(repoID, req.Branch); err != nil {
-		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		respondError(w, err)
 		return
 	}
 
 	// Write output
 	RespondJSON(w, http.StatusOK, map[string]string{"message": "Branch checked out successfully"})
 }
+
+// handleRepoDefaultBranch handles PUT /api/repos/:id/default-branch
+func (s *Server) handleRepoDefaultBranch(w http.ResponseWriter, r *http.Request, repoID string) {
+	// Parse input
+	var req DefaultBranchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Branch == "" {
+		RespondJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+
+	// Validate repo exists
+	_, err := repos.ResolveRepoPath(s.repoBase, repoID)
+	if err != nil {
+		log.Printf("handleRepoDefaultBranch: repoID=%s resolve repo path: %v", repoID, err)
+		respondError(w, err)
+		return
+	}
+
+	// Hold the repo lock so compaction can't drop the update
+	defer s.repoLocks.Lock(repoID)()
+
+	// Call service
+	if err := s.branchSvc.SetDefaultBranch(repoID, req.Branch); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	// Write output
+	RespondJSON(w, http.StatusOK, map[string]string{"message": "Default branch updated", "defaultBranch": req.Branch})
+}
+
+// handleBranchProtection handles GET and PUT
+// /api/repos/:id/branches/:name/protection
+func (s *Server) handleBranchProtection(w http.ResponseWriter, r *http.Request, repoID, branch string) {
+	// Validate repo exists
+	if _, err := repos.ResolveRepoPath(s.repoBase, repoID); err != nil {
+		log.Printf("handleBranchProtection: repoID=%s resolve repo path: %v", repoID, err)
+		respondError(w, err)
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		var req BranchProtection
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			RespondJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+			return
+		}
+		// Hold the repo lock so compaction can't drop the update
+		unlock := s.repoLocks.Lock(repoID)
+		err := s.branchSvc.SetBranchProtection(repoID, branch, req.Protected)
+		unlock()
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+	}
+
+	protected, err := s.branchSvc.BranchProtection(repoID, branch)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	RespondJSON(w, http.StatusOK, BranchProtection{Branch: branch, Protected: protected})
+}
@@ -1,70 +1,219 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
-	"strings"
 
+	"gitclone/internal/app/commits"
 	"gitclone/internal/app/repos"
 )
 
+const (
+	defaultCommitLimit = 10   // commits listed without a positive limit
+	maxCommitLimit     = 1000 // larger limits are clamped to this
+)
+
+// commitLimit parses the limit query parameter of GET /api/repos/:id/commits.
+// A missing, invalid, zero or negative limit means the default; a limit over
+// maxCommitLimit, even one too large for an int, is clamped to it.
+func commitLimit(value string) int {
+	limit, err := strconv.Atoi(value)
+	if errors.Is(err, strconv.ErrRange) && limit > 0 {
+		return maxCommitLimit
+	}
+	if err != nil || limit <= 0 {
+		return defaultCommitLimit
+	}
+	return min(limit, maxCommitLimit)
+}
+
 // handleRepoCommits handles GET /api/repos/:id/commits
 func (s *Server) handleRepoCommits(w http.ResponseWriter, r *http.Request, repoID string) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	// Validate repo exists
+	_, err := repos.ResolveRepoPath(s.repoBase, repoID)
+	if err != nil {
+		log.Printf("handleRepoCommits: repoID=%s resolve repo path: %v", repoID, err)
+		respondError(w, err)
 		return
 	}
 
+	// Parse query parameters
+	branch := r.URL.Query().Get("branch")
+	limit := commitLimit(r.URL.Query().Get("limit"))
+
+	// stream=ndjson writes one commit per line as the history is walked
+	if r.URL.Query().Get("stream") == "ndjson" {
+		s.streamCommits(w, r, repoID, branch, limit)
+		return
+	}
+
+	// order=date sorts by commit timestamp; default is parent-chain (topological) order
+	listCommits := s.commitSvc.ListCommits
+	if r.URL.Query().Get("order") == "date" {
+		listCommits = s.commitSvc.ListCommitsByTimestamp
+	}
+
+	// Call service
+	commits, err := listCommits(r.Context(), repoID, branch, limit)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	// Convert to HTTP types
+	httpCommits := make([]Commit, len(commits))
+	for i, c := range commits {
+		httpCommits[i] = toHTTPCommit(c)
+	}
+
+	// Write output
+	RespondJSON(w, http.StatusOK, httpCommits)
+}
+
+// streamCommits writes the commits for GET /api/repos/:id/commits?stream=ndjson
+// as JSON lines, flushing each one as it is read. Errors before the first line
+// get the usual JSON error response; after it the stream just ends.
+func (s *Server) streamCommits(w http.ResponseWriter, r *http.Request, repoID, branch string, limit int) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Streaming not supported"})
+		return
+	}
+
+	walk := s.commitSvc.WalkCommits
+	if r.URL.Query().Get("order") == "date" {
+		// Sorting by date needs the whole list before the first line
+		walk = func(ctx context.Context, repoID, branch string, limit int, fn func(commits.Commit) error) error {
+			list, err := s.commitSvc.ListCommitsByTimestamp(ctx, repoID, branch, limit)
+			if err != nil {
+				return err
+			}
+			for _, c := range list {
+				if err := fn(c); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	started := false
+	encoder := json.NewEncoder(w)
+	err := walk(r.Context(), repoID, branch, limit, func(c commits.Commit) error {
+		if !started {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		if err := encoder.Encode(toHTTPCommit(c)); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+	if err != nil {
+		if !started {
+			respondError(w, err)
+			return
+		}
+		log.Printf("streamCommits: repoID=%s: %v", repoID, err)
+		return
+	}
+	if !started {
+		// No commits: an empty stream
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// toHTTPCommit converts a service commit to its API representation
+func toHTTPCommit(c commits.Commit) Commit {
+	return Commit{
+		Hash:          c.Hash,
+		Message:       c.Message,
+		Author:        c.Author,
+		Date:          c.Date,
+		Committer:     c.Committer,
+		CommitterDate: c.CommitterDate,
+	}
+}
+
+// handleRepoGraph handles GET /api/repos/:id/graph?branch=<b>&limit=<n>. Without
+// a branch the graph covers every branch.
+func (s *Server) handleRepoGraph(w http.ResponseWriter, r *http.Request, repoID string) {
 	// Validate repo exists
 	_, err := repos.ResolveRepoPath(s.repoBase, repoID)
 	if err != nil {
-		log.Printf("handleRepoCommits: repoID=%s resolve repo path: %v", repoID, err)
-		RespondJSON(w, http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		log.Printf("handleRepoGraph: repoID=%s resolve repo path: %v", repoID, err)
+		respondError(w, err)
 		return
 	}
 
 	// Parse query parameters
-	branch := r.URL.Query().Get("branch")
-	limitStr := r.URL.Query().Get("limit")
-	limit := 10
-	if limitStr != "" {
+	limit := 100
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
 		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
 			limit = parsedLimit
 		}
 	}
 
 	// Call service
-	commits, err := s.commitSvc.ListCommits(repoID, branch, limit)
+	graph, err := s.commitSvc.Graph(r.Context(), repoID, r.URL.Query().Get("branch"), limit)
 	if err != nil {
-		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		respondError(w, err)
 		return
 	}
 
 	// Convert to HTTP types
-	httpCommits := make([]Commit, len(commits))
-	for i, c := range commits {
-		httpCommits[i] = Commit{
-			Hash:    c.Hash,
-			Message: c.Message,
-			Author:  c.Author,
-			Date:    c.Date,
-		}
+	resp := GraphResponse{
+		Nodes: make([]GraphNode, len(graph.Nodes)),
+		Edges: make([]GraphEdge, len(graph.Edges)),
+	}
+	for i, n := range graph.Nodes {
+		resp.Nodes[i] = GraphNode{ID: n.ID, Message: n.Message, Date: n.Date, Branch: n.Branch}
+	}
+	for i, e := range graph.Edges {
+		resp.Edges[i] = GraphEdge{From: e.From, To: e.To}
 	}
 
 	// Write output
-	RespondJSON(w, http.StatusOK, httpCommits)
+	RespondJSON(w, http.StatusOK, resp)
 }
 
-// handleRepoCommit handles POST /api/repos/:id/commit
-func (s *Server) handleRepoCommit(w http.ResponseWriter, r *http.Request, repoID string) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// handleRepoHead handles GET /api/repos/:id/head?branch=<b>: the pushed tip
+// and commit count of a branch (the current branch by default) without
+// listing its commits
+func (s *Server) handleRepoHead(w http.ResponseWriter, r *http.Request, repoID string) {
+	// Validate repo exists
+	_, err := repos.ResolveRepoPath(s.repoBase, repoID)
+	if err != nil {
+		log.Printf("handleRepoHead: repoID=%s resolve repo path: %v", repoID, err)
+		respondError(w, err)
+		return
+	}
+
+	head, err := s.commitSvc.Head(r.Context(), repoID, r.URL.Query().Get("branch"))
+	if err != nil {
+		respondError(w, err)
 		return
 	}
 
+	RespondJSON(w, http.StatusOK, HeadResponse{
+		Branch:      head.Branch,
+		TipCommitID: head.TipCommitID,
+		TipMessage:  head.TipMessage,
+		TipDate:     head.TipDate,
+		CommitCount: head.CommitCount,
+	})
+}
+
+// handleRepoCommit handles POST /api/repos/:id/commit
+func (s *Server) handleRepoCommit(w http.ResponseWriter, r *http.Request, repoID string) {
 	// Parse input
 	var req CommitRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -76,38 +225,45 @@ func (s *Server) handleRepoCommit(w http.ResponseWriter, r *http.Request, repoID
 	_, err := repos.ResolveRepoPath(s.repoBase, repoID)
 	if err != nil {
 		log.Printf("handleRepoCommit: repoID=%s resolve repo path: %v", repoID, err)
-		RespondJSON(w, http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		respondError(w, err)
 		return
 	}
 
-	// Call service
-	if err := s.commitSvc.CreateCommit(repoID, req.Message); err != nil {
-		// Check if it's a business logic error (no staged files)
-		// Return 400 (Bad Request) instead of 500 for user errors
-		errMsg := err.Error()
-		if strings.Contains(errMsg, "Nothing to commit") || strings.Contains(errMsg, "Stage changes first") {
-			RespondJSON(w, http.StatusBadRequest, ErrorResponse{Error: errMsg})
+	options := commits.CommitOptions{KeepIndex: req.KeepIndex, Paths: req.Paths}
+	if req.Parent != "" {
+		parent, err := strconv.Atoi(req.Parent)
+		if err != nil {
+			RespondJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Parent must be a commit hash"})
 			return
 		}
-		// Other errors are server errors
-		log.Printf("ERROR handleRepoCommit: repoID=%s, error=%v", repoID, err)
-		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: errMsg})
+		options.Parent = &parent
+	}
+
+	// Call service
+	stats, err := s.commitSvc.CreateCommitWithOptions(r.Context(), repoID, req.Message, options)
+	if err != nil {
+		// Nothing staged is the caller's error; log the rest
+		if errorStatus(err) == http.StatusInternalServerError {
+			log.Printf("ERROR handleRepoCommit: repoID=%s, error=%v", repoID, err)
+		}
+		respondError(w, err)
 		return
 	}
 
 	// Write output
-	RespondJSON(w, http.StatusOK, map[string]string{
-		"message": "Commit created successfully (local only)",
+	RespondJSON(w, http.StatusOK, CommitResponse{
+		Message:      "Commit created successfully (local only)",
+		Hash:         strconv.Itoa(stats.CommitID),
+		FilesChanged: stats.FilesChanged,
+		Insertions:   stats.Insertions,
+		Deletions:    stats.Deletions,
 	})
 }
 
-// handleRepoPush handles POST /api/repos/:id/push
+// handleRepoPush handles POST /api/repos/:id/push. ?force=true overwrites a
+// remote branch the local one has diverged from, and needs ?override=true as
+// well if the branch is protected.
 func (s *Server) handleRepoPush(w http.ResponseWriter, r *http.Request, repoID string) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Parse input
 	var req PushRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -119,29 +275,58 @@ func (s *Server) handleRepoPush(w http.ResponseWriter, r *http.Request, repoID s
 	_, err := repos.ResolveRepoPath(s.repoBase, repoID)
 	if err != nil {
 		log.Printf("handleRepoPush: repoID=%s resolve repo path: %v", repoID, err)
-		RespondJSON(w, http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		respondError(w, err)
 		return
 	}
 
 	// Call service
-	count, err := s.commitSvc.PushCommits(repoID, req.Branch)
+	options := commits.PushOptions{
+		Force:    r.URL.Query().Get("force") == "true",
+		Override: r.URL.Query().Get("override") == "true",
+	}
+	pushed, err := s.commitSvc.PushCommitsWithInfo(r.Context(), repoID, req.Branch, options)
 	if err != nil {
-		// Check if it's "no commits to push" or "already up to date"
-		if err.Error() == "no commits to push" {
-			RespondJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
-			return
-		}
-		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		respondError(w, err)
 		return
 	}
 
 	// Write output
-	if count == 0 {
-		RespondJSON(w, http.StatusOK, map[string]string{"message": "Already up to date"})
+	hashes := make([]string, len(pushed))
+	for i, id := range pushed {
+		hashes[i] = strconv.Itoa(id)
+	}
+	message := fmt.Sprintf("Pushed %d commit(s) to remote successfully", len(pushed))
+	if len(pushed) == 0 {
+		message = "Already up to date"
+	}
+
+	RespondJSON(w, http.StatusOK, PushResponse{
+		Message:       message,
+		CommitsPushed: len(pushed),
+		Commits:       hashes,
+	})
+}
+
+// handleRepoPushRollback handles POST /api/repos/:id/push/rollback?branch=<b>,
+// resetting origin/<branch> to the tip it had before the latest push. A
+// protected branch needs ?override=true.
+func (s *Server) handleRepoPushRollback(w http.ResponseWriter, r *http.Request, repoID string) {
+	// Validate repo exists
+	if _, err := repos.ResolveRepoPath(s.repoBase, repoID); err != nil {
+		log.Printf("handleRepoPushRollback: repoID=%s resolve repo path: %v", repoID, err)
+		respondError(w, err)
+		return
+	}
+
+	override := r.URL.Query().Get("override") == "true"
+	tip, err := s.commitSvc.RollbackPush(repoID, r.URL.Query().Get("branch"), override)
+	if err != nil {
+		respondError(w, err)
 		return
 	}
 
-	RespondJSON(w, http.StatusOK, map[string]string{
-		"message": fmt.Sprintf("Pushed %d commit(s) to remote successfully", count),
+	RespondJSON(w, http.StatusOK, PushRollbackResponse{
+		Message: fmt.Sprintf("Rolled back the remote branch to %d", tip),
+		Hash:    strconv.Itoa(tip),
 	})
 }
@@ -0,0 +1,69 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"gitclone/internal/app/repos"
+)
+
+// sseHeartbeatInterval is how often an idle event stream sends a comment line
+// so proxies don't time the connection out
+var sseHeartbeatInterval = 30 * time.Second
+
+// handleRepoEvents handles GET /api/repos/:id/events as a Server-Sent Events stream
+func (s *Server) handleRepoEvents(w http.ResponseWriter, r *http.Request, repoID string) {
+	// Validate repo exists
+	if _, err := repos.ResolveRepoPath(s.repoBase, repoID); err != nil {
+		log.Printf("handleRepoEvents: repoID=%s resolve repo path: %v", repoID, err)
+		respondError(w, err)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Streaming not supported"})
+		return
+	}
+
+	eventsCh, unsubscribe := s.broker.Subscribe(repoID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			// Client disconnected
+			return
+		case event, ok := <-eventsCh:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("handleRepoEvents: repoID=%s marshal event: %v", repoID, err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gitclone/internal/metadata"
+	"gitclone/internal/storage"
+)
+
+// TestRepoEventsStreamReceivesPush verifies that a client connected to the SSE
+// stream receives a push event when the repo is pushed
+func TestRepoEventsStreamReceivesPush(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-sse-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repoBase := filepath.Join(tmpDir, "repos")
+	repoID := "test-repo"
+	repoPath := filepath.Join(repoBase, repoID)
+	if err := os.MkdirAll(repoPath, 0755); err != nil {
+		t.Fatalf("Failed to create repo dir: %v", err)
+	}
+	if err := storage.InitRepo(repoPath, storage.InitOptions{Bare: false}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	metaStore, err := metadata.NewStore(filepath.Join(tmpDir, "db"))
+	if err != nil {
+		t.Fatalf("Failed to create metadata store: %v", err)
+	}
+	defer metaStore.Close()
+
+	server := NewServer(repoBase, metaStore)
+	ts := httptest.NewServer(NewRouter(server))
+	defer ts.Close()
+
+	// One local commit, ready to push
+	if err := os.WriteFile(filepath.Join(repoPath, "file1.txt"), []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := server.fileSvc.StageFiles(context.Background(), repoID, "file1.txt"); err != nil {
+		t.Fatalf("Failed to stage file: %v", err)
+	}
+	if err := server.commitSvc.CreateCommit(context.Background(), repoID, "Initial commit"); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	resp, err := http.Get(ts.URL + "/api/repos/" + repoID + "/events")
+	if err != nil {
+		t.Fatalf("Failed to connect to event stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected text/event-stream, got %q", ct)
+	}
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	pushResp, err := http.Post(ts.URL+"/api/repos/"+repoID+"/push", "application/json", strings.NewReader(`{"branch":"master"}`))
+	if err != nil {
+		t.Fatalf("Push request failed: %v", err)
+	}
+	pushResp.Body.Close()
+	if pushResp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected push status 200, got %d", pushResp.StatusCode)
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("Event stream closed before push event arrived")
+			}
+			if line == "event: push" {
+				data := <-lines
+				if !strings.HasPrefix(data, "data: ") || !strings.Contains(data, `"repoID":"test-repo"`) {
+					t.Errorf("Unexpected event data: %q", data)
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatal("Timed out waiting for push event")
+		}
+	}
+}
@@ -1,21 +1,20 @@
 package http
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"unicode/utf8"
 
 	"gitclone/internal/app/repos"
 )
 
 // handleRepoAdd handles POST /api/repos/:id/add
 func (s *Server) handleRepoAdd(w http.ResponseWriter, r *http.Request, repoID string) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Parse input
 	var req AddRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -27,7 +26,7 @@ func (s *Server) handleRepoAdd(w http.ResponseWriter, r *http.Request, repoID st
 	_, err := repos.ResolveRepoPath(s.repoBase, repoID)
 	if err != nil {
 		log.Printf("handleRepoAdd: repoID=%s resolve repo path: %v", repoID, err)
-		RespondJSON(w, http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		respondError(w, err)
 		return
 	}
 
@@ -37,10 +36,13 @@ func (s *Server) handleRepoAdd(w http.ResponseWriter, r *http.Request, repoID st
 		path = "."
 	}
 
+	// Hold the repo lock so compaction can't drop a staged entry
+	defer s.repoLocks.Lock(repoID)()
+
 	// Stage files and get staged entries info
-	stagedCount, stagedPaths, err := s.fileSvc.StageFilesWithInfo(repoID, path)
+	stagedCount, stagedPaths, err := s.fileSvc.StageFilesWithInfo(r.Context(), repoID, path)
 	if err != nil {
-		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		respondError(w, err)
 		return
 	}
 
@@ -54,11 +56,6 @@ func (s *Server) handleRepoAdd(w http.ResponseWriter, r *http.Request, repoID st
 
 // handleRepoFiles handles POST /api/repos/:id/files
 func (s *Server) handleRepoFiles(w http.ResponseWriter, r *http.Request, repoID string) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Parse input
 	var req FileRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -76,19 +73,258 @@ func (s *Server) handleRepoFiles(w http.ResponseWriter, r *http.Request, repoID
 	_, err := repos.ResolveRepoPath(s.repoBase, repoID)
 	if err != nil {
 		log.Printf("handleRepoFiles: repoID=%s resolve repo path: %v", repoID, err)
-		RespondJSON(w, http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		respondError(w, err)
 		return
 	}
 
+	// Hold the repo lock so compaction can't drop a staged entry
+	defer s.repoLocks.Lock(repoID)()
+
 	// Call service
-	if err := s.fileSvc.WriteFile(repoID, req.Path, []byte(req.Content)); err != nil {
-		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	staged, err := s.fileSvc.WriteFileWithInfo(repoID, req.Path, []byte(req.Content), req.AutoStage)
+	if err != nil {
+		respondError(w, err)
 		return
 	}
 
 	// Write output
-	RespondJSON(w, http.StatusOK, map[string]string{
-		"message": "File created/updated successfully",
-		"path":    req.Path,
+	RespondJSON(w, http.StatusOK, FileResponse{
+		Message: "File created/updated successfully",
+		Path:    req.Path,
+		Staged:  staged,
 	})
 }
+
+// handleGetFile handles GET /api/repos/:id/files?path=<p>&commit=<hash>&staged=true&raw=true:
+// a file's content in a commit (HEAD's by default) or, with staged=true, in
+// the index. With raw=true the content is streamed as the response body;
+// otherwise it is sent in JSON, base64-encoded if it isn't valid UTF-8.
+func (s *Server) handleGetFile(w http.ResponseWriter, r *http.Request, repoID string) {
+	// Parse query parameters
+	query := r.URL.Query()
+	path := query.Get("path")
+	if path == "" {
+		RespondJSON(w, http.StatusBadRequest, ErrorResponse{Error: "File path is required"})
+		return
+	}
+	staged := query.Get("staged") == "true"
+	var commitID *int
+	if commitStr := query.Get("commit"); commitStr != "" {
+		if staged {
+			RespondJSON(w, http.StatusBadRequest, ErrorResponse{Error: "commit and staged=true can't be combined"})
+			return
+		}
+		id, err := strconv.Atoi(commitStr)
+		if err != nil {
+			RespondJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid commit ID"})
+			return
+		}
+		commitID = &id
+	}
+
+	// Validate repo exists
+	_, err := repos.ResolveRepoPath(s.repoBase, repoID)
+	if err != nil {
+		log.Printf("handleGetFile: repoID=%s resolve repo path: %v", repoID, err)
+		respondError(w, err)
+		return
+	}
+
+	if query.Get("raw") == "true" {
+		s.streamFile(w, repoID, path, commitID, staged)
+		return
+	}
+
+	// Call service
+	content, blobID, err := s.fileSvc.ReadFile(repoID, path, commitID, staged)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	// Write output
+	resp := FileContentResponse{
+		Path:     path,
+		BlobID:   blobID,
+		Content:  string(content),
+		Encoding: "utf-8",
+		Staged:   staged,
+	}
+	if !utf8.Valid(content) {
+		resp.Content = base64.StdEncoding.EncodeToString(content)
+		resp.Encoding = "base64"
+	}
+	RespondJSON(w, http.StatusOK, resp)
+}
+
+// streamFile writes a file's content as the response body, without holding
+// it in memory. The blob ID is sent as the ETag.
+func (s *Server) streamFile(w http.ResponseWriter, repoID, path string, commitID *int, staged bool) {
+	reader, size, blobID, err := s.fileSvc.OpenFile(repoID, path, commitID, staged)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	defer reader.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("ETag", strconv.Quote(blobID))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, reader); err != nil {
+		log.Printf("handleGetFile: repoID=%s stream %s: %v", repoID, path, err)
+	}
+}
+
+// handleRepoFilesBulk handles POST /api/repos/:id/files/bulk, which takes an
+// array of file requests. Each file is validated and written on its own, so an
+// invalid path fails only that entry; the response lists every file's outcome.
+func (s *Server) handleRepoFilesBulk(w http.ResponseWriter, r *http.Request, repoID string) {
+	// Parse input
+	var req []FileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	if len(req) == 0 {
+		RespondJSON(w, http.StatusBadRequest, ErrorResponse{Error: "At least one file is required"})
+		return
+	}
+
+	// Validate repo exists
+	_, err := repos.ResolveRepoPath(s.repoBase, repoID)
+	if err != nil {
+		log.Printf("handleRepoFilesBulk: repoID=%s resolve repo path: %v", repoID, err)
+		respondError(w, err)
+		return
+	}
+
+	// Hold the repo lock so compaction can't drop a staged entry
+	defer s.repoLocks.Lock(repoID)()
+
+	// Call service once per file
+	results := make([]BulkFileResult, len(req))
+	for i, file := range req {
+		results[i].Path = file.Path
+		if file.Path == "" {
+			results[i].Error = "File path is required"
+			continue
+		}
+		staged, err := s.fileSvc.WriteFileWithInfo(repoID, file.Path, []byte(file.Content), file.AutoStage)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].OK = true
+		results[i].Staged = staged
+	}
+
+	// Write output
+	RespondJSON(w, http.StatusOK, results)
+}
+
+// handleRepoTree handles GET /api/repos/:id/tree?commit=<id>&path=<dir>&recursive=true
+func (s *Server) handleRepoTree(w http.ResponseWriter, r *http.Request, repoID string) {
+	// Validate repo exists
+	_, err := repos.ResolveRepoPath(s.repoBase, repoID)
+	if err != nil {
+		log.Printf("handleRepoTree: repoID=%s resolve repo path: %v", repoID, err)
+		respondError(w, err)
+		return
+	}
+
+	// Parse query parameters; commit defaults to the current branch tip
+	query := r.URL.Query()
+	var commitID *int
+	if commitStr := query.Get("commit"); commitStr != "" {
+		id, err := strconv.Atoi(commitStr)
+		if err != nil {
+			RespondJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid commit ID"})
+			return
+		}
+		commitID = &id
+	}
+	recursive := query.Get("recursive") == "true"
+
+	// Call service
+	entries, err := s.fileSvc.ListTree(repoID, commitID, query.Get("path"), recursive)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	// Convert to HTTP types
+	httpEntries := make([]TreeEntry, len(entries))
+	for i, e := range entries {
+		httpEntries[i] = TreeEntry{
+			Path:   e.Path,
+			BlobID: e.BlobID,
+			Mode:   e.Mode,
+			Type:   e.Type,
+		}
+	}
+
+	// Write output
+	RespondJSON(w, http.StatusOK, httpEntries)
+}
+
+// handleFileHistory handles GET /api/repos/:id/files/history?path=<p>&branch=<b>&limit=<n>&offset=<n>
+func (s *Server) handleFileHistory(w http.ResponseWriter, r *http.Request, repoID string) {
+	// Validate repo exists
+	_, err := repos.ResolveRepoPath(s.repoBase, repoID)
+	if err != nil {
+		log.Printf("handleFileHistory: repoID=%s resolve repo path: %v", repoID, err)
+		respondError(w, err)
+		return
+	}
+
+	// Parse query parameters
+	query := r.URL.Query()
+	path := query.Get("path")
+	if path == "" {
+		RespondJSON(w, http.StatusBadRequest, ErrorResponse{Error: "File path is required"})
+		return
+	}
+	limit := 10
+	if parsedLimit, err := strconv.Atoi(query.Get("limit")); err == nil && parsedLimit > 0 {
+		limit = parsedLimit
+	}
+	offset := 0
+	if parsedOffset, err := strconv.Atoi(query.Get("offset")); err == nil && parsedOffset > 0 {
+		offset = parsedOffset
+	}
+
+	// Call service
+	commits, err := s.commitSvc.FileHistory(r.Context(), repoID, query.Get("branch"), path, limit, offset)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	// Convert to HTTP types
+	httpCommits := make([]Commit, len(commits))
+	for i, c := range commits {
+		httpCommits[i] = toHTTPCommit(c)
+	}
+
+	// Write output
+	RespondJSON(w, http.StatusOK, httpCommits)
+}
+
+// handleStagedDiff handles GET /api/repos/:id/diff/staged: the paths staged
+// for the next commit, compared with the HEAD commit
+func (s *Server) handleStagedDiff(w http.ResponseWriter, r *http.Request, repoID string) {
+	// Validate repo exists
+	if _, err := repos.ResolveRepoPath(s.repoBase, repoID); err != nil {
+		log.Printf("handleStagedDiff: repoID=%s resolve repo path: %v", repoID, err)
+		respondError(w, err)
+		return
+	}
+
+	diff, err := s.fileSvc.StagedDiff(repoID)
+	if err != nil {
+		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	RespondJSON(w, http.StatusOK, StagedDiffResponse{Added: diff.Added, Modified: diff.Modified, Deleted: diff.Deleted})
+}
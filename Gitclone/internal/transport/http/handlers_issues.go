@@ -5,15 +5,18 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"gitclone/internal/app/repos"
+	"gitclone/internal/timefmt"
 )
 
 // handleRepoIssues handles GET/POST /api/repos/:id/issues
 func (s *Server) handleRepoIssues(w http.ResponseWriter, r *http.Request, repoID string) {
 	if _, err := repos.ResolveRepoPath(s.repoBase, repoID); err != nil {
-		RespondJSON(w, http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		respondError(w, err)
 		return
 	}
 
@@ -36,6 +39,10 @@ func (s *Server) handleRepoIssues(w http.ResponseWriter, r *http.Request, repoID
 			return
 		}
 
+		if req.Labels == nil {
+			req.Labels = []Label{}
+		}
+
 		authorEmail := req.Author
 		if authorEmail == "" {
 			authorEmail = "system"
@@ -43,7 +50,6 @@ func (s *Server) handleRepoIssues(w http.ResponseWriter, r *http.Request, repoID
 		avatarURL := fmt.Sprintf("https://api.dicebear.com/7.x/initials/svg?seed=%s", url.QueryEscape(authorEmail))
 
 		issue := Issue{
-			ID:           fmt.Sprintf("%s-%d", repoID, time.Now().UnixNano()),
 			Title:        req.Title,
 			Body:         req.Body,
 			Status:       "open",
@@ -51,25 +57,24 @@ func (s *Server) handleRepoIssues(w http.ResponseWriter, r *http.Request, repoID
 			Labels:       req.Labels,
 			Author:       authorEmail,
 			AuthorAvatar: avatarURL,
-			CreatedAt:    time.Now(),
+			CreatedAt:    timefmt.Now(),
 			CommentCount: 0,
 		}
 
-		if err := s.SaveIssue(repoID, issue); err != nil {
+		issue, err := s.CreateIssue(repoID, issue)
+		if err != nil {
 			RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 			return
 		}
 
 		RespondJSON(w, http.StatusCreated, issue)
-	} else {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
 // handleIssue handles GET/PATCH /api/repos/:id/issues/:issueId
 func (s *Server) handleIssue(w http.ResponseWriter, r *http.Request, repoID, issueID string) {
 	if _, err := repos.ResolveRepoPath(s.repoBase, repoID); err != nil {
-		RespondJSON(w, http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		respondError(w, err)
 		return
 	}
 
@@ -81,7 +86,8 @@ func (s *Server) handleIssue(w http.ResponseWriter, r *http.Request, repoID, iss
 		}
 
 		for _, issue := range issues {
-			if issue.ID == issueID {
+			if issueMatches(issue, issueID) {
+				w.Header().Set("ETag", issueETag(issue))
 				RespondJSON(w, http.StatusOK, issue)
 				return
 			}
@@ -89,69 +95,113 @@ func (s *Server) handleIssue(w http.ResponseWriter, r *http.Request, repoID, iss
 
 		RespondJSON(w, http.StatusNotFound, ErrorResponse{Error: "Issue not found"})
 	} else if r.Method == http.MethodPatch || r.Method == http.MethodPut {
+		var updateReq UpdateIssueRequest
+		_ = json.NewDecoder(r.Body).Decode(&updateReq)
+
+		// Updates must name the version they were based on
+		expected, ok, err := expectedIssueVersion(r, updateReq)
+		if err != nil {
+			RespondJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		if !ok {
+			RespondJSON(w, http.StatusPreconditionRequired, ErrorResponse{Error: "If-Match header or version is required"})
+			return
+		}
+
+		s.issuesMu.Lock()
+		defer s.issuesMu.Unlock()
+
 		issues, err := s.LoadIssues(repoID)
 		if err != nil {
 			RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 			return
 		}
 
-		var found bool
+		found := -1
 		for i := range issues {
-			if issues[i].ID == issueID {
-				found = true
-				var updateReq struct {
-					Status string `json:"status,omitempty"`
-					Body   string `json:"body,omitempty"`
-				}
-				_ = json.NewDecoder(r.Body).Decode(&updateReq)
-
-				if updateReq.Status != "" {
-					issues[i].Status = updateReq.Status
-				} else {
-					if issues[i].Status == "open" {
-						issues[i].Status = "closed"
-					} else {
-						issues[i].Status = "open"
-					}
-				}
-
-				if updateReq.Body != "" {
-					issues[i].Body = updateReq.Body
-				}
+			if issueMatches(issues[i], issueID) {
+				found = i
 				break
 			}
 		}
 
-		if !found {
+		if found < 0 {
 			RespondJSON(w, http.StatusNotFound, ErrorResponse{Error: "Issue not found"})
 			return
 		}
 
-		db := s.metaStore.GetDB()
-		if db == nil {
-			RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Database not available"})
+		if issues[found].Version != expected {
+			RespondJSON(w, http.StatusConflict, ErrorResponse{
+				Error: fmt.Sprintf("Issue was modified: version is %d, update was based on %d", issues[found].Version, expected),
+			})
 			return
 		}
 
-		key := fmt.Sprintf("repo:%s:issues", repoID)
-		data, err := json.Marshal(issues)
-		if err != nil {
+		applyIssueUpdate(&issues[found], updateReq, timefmt.Now())
+		issues[found].Version++
+
+		if err := s.storeIssues(repoID, issues); err != nil {
 			RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 			return
 		}
 
-		if err := db.Put(key, data); err != nil {
-			RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
-			return
+		w.Header().Set("ETag", issueETag(issues[found]))
+		RespondJSON(w, http.StatusOK, issues[found])
+	}
+}
+
+// applyIssueUpdate applies a PATCH to an issue. An empty status toggles it.
+// Closing records when and by whom; reopening clears both.
+func applyIssueUpdate(issue *Issue, req UpdateIssueRequest, now time.Time) {
+	wasClosed := issue.Status == "closed"
+
+	if req.Status != "" {
+		issue.Status = req.Status
+	} else {
+		if issue.Status == "open" {
+			issue.Status = "closed"
+		} else {
+			issue.Status = "open"
 		}
+	}
 
-		for _, issue := range issues {
-			if issue.ID == issueID {
-				RespondJSON(w, http.StatusOK, issue)
-				return
-			}
+	switch isClosed := issue.Status == "closed"; {
+	case isClosed && !wasClosed:
+		closedBy := req.Actor
+		if closedBy == "" {
+			closedBy = "system"
 		}
-	} else {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		issue.ClosedAt = &now
+		issue.ClosedBy = closedBy
+	case !isClosed:
+		issue.ClosedAt = nil
+		issue.ClosedBy = ""
+	}
+
+	if req.Body != "" {
+		issue.Body = req.Body
+	}
+}
+
+// issueETag returns the entity tag for an issue's current version
+func issueETag(issue Issue) string {
+	return strconv.Quote(strconv.Itoa(issue.Version))
+}
+
+// expectedIssueVersion returns the version an update was based on, taken from
+// the If-Match header ("3", "\"3\"" or W/"3") or else the request body
+func expectedIssueVersion(r *http.Request, req UpdateIssueRequest) (int, bool, error) {
+	if ifMatch := strings.TrimSpace(r.Header.Get("If-Match")); ifMatch != "" {
+		tag := strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`)
+		version, err := strconv.Atoi(tag)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid If-Match version %q", ifMatch)
+		}
+		return version, true, nil
+	}
+	if req.Version != nil {
+		return *req.Version, true, nil
 	}
+	return 0, false, nil
 }
@@ -0,0 +1,261 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"gitclone/internal/metadata"
+	"gitclone/internal/storage"
+)
+
+// newIssueTestServer starts a test server with one initialized repo
+func newIssueTestServer(t *testing.T, repoID string) (*Server, *httptest.Server, func()) {
+	t.Helper()
+	tmpDir, err := os.MkdirTemp("", "gitstore-issues-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+
+	repoBase := filepath.Join(tmpDir, "repos")
+	repoPath := filepath.Join(repoBase, repoID)
+	if err := os.MkdirAll(repoPath, 0755); err != nil {
+		t.Fatalf("Failed to create repo dir: %v", err)
+	}
+	if err := storage.InitRepo(repoPath, storage.InitOptions{Bare: false}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	metaStore, err := metadata.NewStore(filepath.Join(tmpDir, "db"))
+	if err != nil {
+		t.Fatalf("Failed to create metadata store: %v", err)
+	}
+
+	server := NewServer(repoBase, metaStore)
+	ts := httptest.NewServer(NewRouter(server))
+	return server, ts, func() {
+		ts.Close()
+		metaStore.Close()
+		os.RemoveAll(tmpDir)
+	}
+}
+
+// TestCreateIssuesInParallel verifies that concurrently created issues get
+// unique, gap-free sequential numbers
+func TestCreateIssuesInParallel(t *testing.T) {
+	repoID := "test-repo"
+	server, ts, cleanup := newIssueTestServer(t, repoID)
+	defer cleanup()
+
+	const count = 20
+	ids := make([]string, count)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := http.Post(ts.URL+"/api/repos/"+repoID+"/issues", "application/json",
+				strings.NewReader(`{"title":"issue `+strconv.Itoa(i)+`"}`))
+			if err != nil {
+				t.Errorf("Create issue failed: %v", err)
+				return
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusCreated {
+				t.Errorf("Expected 201, got %d", resp.StatusCode)
+				return
+			}
+			var issue Issue
+			if err := json.NewDecoder(resp.Body).Decode(&issue); err != nil {
+				t.Errorf("Failed to decode issue: %v", err)
+				return
+			}
+			ids[i] = issue.ID
+		}(i)
+	}
+	wg.Wait()
+
+	numbers := make([]int, 0, count)
+	for _, id := range ids {
+		n, err := strconv.Atoi(id)
+		if err != nil {
+			t.Fatalf("Expected numeric issue ID, got %q", id)
+		}
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	for i, n := range numbers {
+		if n != i+1 {
+			t.Fatalf("Expected issue numbers 1..%d, got %v", count, numbers)
+		}
+	}
+
+	issues, err := server.LoadIssues(repoID)
+	if err != nil {
+		t.Fatalf("LoadIssues failed: %v", err)
+	}
+	if len(issues) != count {
+		t.Errorf("Expected %d stored issues, got %d", count, len(issues))
+	}
+}
+
+// TestGetIssueByNumberAndLegacyID verifies that issues resolve by number, by
+// #number, and that issues stored with the old ID format still resolve
+func TestGetIssueByNumberAndLegacyID(t *testing.T) {
+	repoID := "test-repo"
+	server, ts, cleanup := newIssueTestServer(t, repoID)
+	defer cleanup()
+
+	legacy := Issue{ID: repoID + "-1700000000000000000", Title: "old", Status: "open"}
+	if err := server.SaveIssue(repoID, legacy); err != nil {
+		t.Fatalf("Failed to save legacy issue: %v", err)
+	}
+	created, err := server.CreateIssue(repoID, Issue{Title: "new", Status: "open"})
+	if err != nil {
+		t.Fatalf("CreateIssue failed: %v", err)
+	}
+	if created.ID != "1" || created.Number != 1 {
+		t.Fatalf("Expected first issue to be #1, got ID=%q number=%d", created.ID, created.Number)
+	}
+
+	for _, id := range []string{"1", "%231", legacy.ID} {
+		resp, err := http.Get(ts.URL + "/api/repos/" + repoID + "/issues/" + id)
+		if err != nil {
+			t.Fatalf("Get issue %s failed: %v", id, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected 200 for issue %s, got %d", id, resp.StatusCode)
+		}
+	}
+}
+
+// TestIssueCloseReopenRecordsActor verifies that closing sets closedAt and
+// closedBy, and reopening clears them
+func TestIssueCloseReopenRecordsActor(t *testing.T) {
+	repoID := "test-repo"
+	server, ts, cleanup := newIssueTestServer(t, repoID)
+	defer cleanup()
+
+	created, err := server.CreateIssue(repoID, Issue{Title: "bug", Status: "open"})
+	if err != nil {
+		t.Fatalf("CreateIssue failed: %v", err)
+	}
+
+	version := created.Version
+	patch := func(body string) Issue {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPatch, ts.URL+"/api/repos/"+repoID+"/issues/"+created.ID, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to build request: %v", err)
+		}
+		req.Header.Set("If-Match", strconv.Itoa(version))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("PATCH failed: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", resp.StatusCode)
+		}
+		var issue Issue
+		if err := json.NewDecoder(resp.Body).Decode(&issue); err != nil {
+			t.Fatalf("Failed to decode issue: %v", err)
+		}
+		version = issue.Version
+		return issue
+	}
+
+	closed := patch(`{"actor":"alice@example.com"}`)
+	if closed.Status != "closed" {
+		t.Fatalf("Expected toggle to close the issue, got %q", closed.Status)
+	}
+	if closed.ClosedAt == nil || closed.ClosedAt.IsZero() {
+		t.Errorf("Expected closedAt to be set")
+	}
+	if closed.ClosedBy != "alice@example.com" {
+		t.Errorf("Expected closedBy alice@example.com, got %q", closed.ClosedBy)
+	}
+
+	// Closing an already closed issue keeps the original record
+	again := patch(`{"status":"closed","actor":"bob@example.com"}`)
+	if again.ClosedBy != "alice@example.com" || !again.ClosedAt.Equal(*closed.ClosedAt) {
+		t.Errorf("Expected original close record to be kept, got %q at %v", again.ClosedBy, again.ClosedAt)
+	}
+
+	reopened := patch(`{"status":"open"}`)
+	if reopened.Status != "open" {
+		t.Fatalf("Expected issue to reopen, got %q", reopened.Status)
+	}
+	if reopened.ClosedAt != nil || reopened.ClosedBy != "" {
+		t.Errorf("Expected close record to be cleared, got %q at %v", reopened.ClosedBy, reopened.ClosedAt)
+	}
+}
+
+// TestConcurrentIssueUpdatesSameVersion verifies that of two updates based on
+// the same version exactly one succeeds and the other gets 409
+func TestConcurrentIssueUpdatesSameVersion(t *testing.T) {
+	repoID := "test-repo"
+	server, ts, cleanup := newIssueTestServer(t, repoID)
+	defer cleanup()
+
+	created, err := server.CreateIssue(repoID, Issue{Title: "bug", Status: "open"})
+	if err != nil {
+		t.Fatalf("CreateIssue failed: %v", err)
+	}
+
+	bodies := []string{`{"body":"first edit","status":"open"}`, `{"body":"second edit","status":"open"}`}
+	statuses := make([]int, len(bodies))
+	var wg sync.WaitGroup
+	for i, body := range bodies {
+		wg.Add(1)
+		go func(i int, body string) {
+			defer wg.Done()
+			req, err := http.NewRequest(http.MethodPatch, ts.URL+"/api/repos/"+repoID+"/issues/"+created.ID, strings.NewReader(body))
+			if err != nil {
+				t.Errorf("Failed to build request: %v", err)
+				return
+			}
+			req.Header.Set("If-Match", `"`+strconv.Itoa(created.Version)+`"`)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Errorf("PATCH failed: %v", err)
+				return
+			}
+			resp.Body.Close()
+			statuses[i] = resp.StatusCode
+		}(i, body)
+	}
+	wg.Wait()
+
+	sort.Ints(statuses)
+	if statuses[0] != http.StatusOK || statuses[1] != http.StatusConflict {
+		t.Fatalf("Expected one 200 and one 409, got %v", statuses)
+	}
+
+	issues, err := server.LoadIssues(repoID)
+	if err != nil {
+		t.Fatalf("LoadIssues failed: %v", err)
+	}
+	if len(issues) != 1 || issues[0].Version != created.Version+1 {
+		t.Errorf("Expected a single issue at version %d, got %+v", created.Version+1, issues)
+	}
+
+	// Updates without a version are refused
+	req, _ := http.NewRequest(http.MethodPatch, ts.URL+"/api/repos/"+repoID+"/issues/"+created.ID, strings.NewReader(`{"body":"blind"}`))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("PATCH failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPreconditionRequired {
+		t.Errorf("Expected 428 without a version, got %d", resp.StatusCode)
+	}
+}
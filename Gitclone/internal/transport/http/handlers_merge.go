@@ -1,47 +1,50 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
+	"strconv"
 	"time"
 
-	"gitclone/internal/commands"
+	"gitclone/internal/app/events"
 	"gitclone/internal/infra/storage"
 	repostorage "gitclone/internal/storage"
+	"gitclone/internal/timefmt"
 )
 
 // handleRepoMerge handles POST /api/repos/:id/merge
 func (s *Server) handleRepoMerge(w http.ResponseWriter, r *http.Request, repoID string) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	var req MergeRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		RespondJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
 		return
 	}
 
+	// Hold the repo lock so a commit or push can't move refs mid-merge
+	defer s.repoLocks.Lock(repoID)()
+
 	// Open per-repo store
 	repoStore, err := storage.NewRepoStore(s.repoBase, repoID)
 	if err != nil {
 		log.Printf("handleRepoMerge: repoID=%s open store: %v", repoID, err)
-		RespondJSON(w, http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		respondError(w, err)
 		return
 	}
 	defer repoStore.Close()
 
-	repoPath := repoStore.RepoPath()
-
-	currentBranch, err := repostorage.ReadHEADBranchFromStore(repoStore)
+	currentTip, currentBranch, err := repostorage.ResolveHead(repoStore)
 	if err != nil {
 		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
+	if currentBranch == "" {
+		RespondJSON(w, http.StatusConflict, ErrorResponse{Error: "Cannot merge: HEAD is detached"})
+		return
+	}
 
 	if currentBranch == req.Branch {
 		RespondJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Cannot merge a branch into itself"})
@@ -52,16 +55,13 @@ func (s *Server) handleRepoMerge(w http.ResponseWriter, r *http.Request, repoID
 		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
-	if err := repostorage.EnsureHeadRefExistsFromStore(repoStore, req.Branch); err != nil {
-		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	// A misspelled branch is an error, not a new empty branch: only the
+	// current branch's ref is created if missing
+	if !repostorage.HeadRefExistsFromStore(repoStore, req.Branch) {
+		RespondJSON(w, http.StatusNotFound, ErrorResponse{Error: fmt.Sprintf("Branch %s does not exist", req.Branch)})
 		return
 	}
 
-	currentTip, err := repostorage.ReadHeadRefMaybeFromStore(repoStore, currentBranch)
-	if err != nil {
-		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
-		return
-	}
 	otherTip, err := repostorage.ReadHeadRefMaybeFromStore(repoStore, req.Branch)
 	if err != nil {
 		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
@@ -73,9 +73,18 @@ func (s *Server) handleRepoMerge(w http.ResponseWriter, r *http.Request, repoID
 		return
 	}
 
-	if currentTip == nil {
-		// Fast-forward merge - proceed
-	} else {
+	ff, err := repostorage.ReadConfigFromStore(repoStore, "merge.ff")
+	if err != nil {
+		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if currentTip != nil {
+		// Nothing to do if the other branch is already contained in this one
+		if s.IsAncestorFromStore(repoStore, *otherTip, *currentTip) {
+			RespondJSON(w, http.StatusOK, map[string]string{"message": "Already up to date", "type": "up-to-date"})
+			return
+		}
 		isFastForward := s.IsAncestorFromStore(repoStore, *currentTip, *otherTip)
 		if !isFastForward {
 			RespondJSON(w, http.StatusConflict, ErrorResponse{Error: "Non-fast-forward merge is not allowed"})
@@ -83,33 +92,152 @@ func (s *Server) handleRepoMerge(w http.ResponseWriter, r *http.Request, repoID
 		}
 	}
 
-	oldDir, err := os.Getwd()
-	if err != nil {
-		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
-		return
+	batch := repoStore.NewWriteBatch()
+	newTip := *otherTip
+	resp := map[string]string{"message": "Fast-forward merge completed successfully", "type": "fast-forward"}
+	if ff == repostorage.MergeFFNever && currentTip != nil {
+		// merge.ff=false records the merge as a commit even though the
+		// branch could simply move
+		newTip, err = s.writeMergeCommit(batch, repoStore, currentBranch, req.Branch, *currentTip, *otherTip, requestActor(r))
+		if err != nil {
+			RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		resp = map[string]string{"message": "Merge commit created", "type": "merge", "hash": strconv.Itoa(newTip)}
+	} else {
+		// Fast-forward: move the current branch to the other branch's tip
+		if err := repostorage.WriteHeadRefToBatch(batch, currentBranch, *otherTip); err != nil {
+			RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
 	}
-	defer os.Chdir(oldDir)
-
-	if err := os.Chdir(repoPath); err != nil {
+	if err := batch.Commit(); err != nil {
 		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	commands.Merge([]string{req.Branch})
+	s.publishEvent(events.TypeMerge, repoID, currentBranch, newTip)
 
 	// Update metadata (using global store for repo registry)
 	meta, err := s.metaStore.GetRepo(repoID)
 	if err == nil {
 		branches, _ := s.branchSvc.ListBranches(repoID)
 		currentBranch, _ := repostorage.ReadHEADBranchFromStore(repoStore)
-		commits, _ := s.commitSvc.ListCommits(repoID, currentBranch, 100)
+		// The merge is written, so the count is refreshed even if the
+		// client has gone
+		commits, _ := s.commitSvc.ListCommits(context.WithoutCancel(r.Context()), repoID, currentBranch, 100)
 		meta.BranchCount = len(branches)
 		meta.CommitCount = len(commits)
-		meta.UpdatedAt = time.Now()
+		meta.UpdatedAt = timefmt.Now()
 		if err := s.metaStore.UpdateRepo(*meta); err != nil {
 			log.Printf("Warning: failed to update metadata after merge: %v", err)
 		}
 	}
 
-	RespondJSON(w, http.StatusOK, map[string]string{"message": "Fast-forward merge completed successfully", "type": "fast-forward"})
+	RespondJSON(w, http.StatusOK, resp)
+}
+
+// writeMergeCommit adds to batch a commit on branch with parents ours and
+// theirs, its tree and the branch ref moved to it, and returns the commit's
+// ID. Ours is an ancestor of theirs, so the tree is exactly theirs: files the
+// other branch deleted stay deleted. The commit is authored and committed
+// now by author, the request's actor, or DefaultAuthor if it has none.
+func (s *Server) writeMergeCommit(batch *storage.WriteBatch, repoStore *storage.RepoStore, branch, otherBranch string, ours, theirs int, author string) (int, error) {
+	theirTree, err := repostorage.ReadTreeMaybeFromStore(repoStore, theirs)
+	if err != nil {
+		return 0, err
+	}
+
+	mergeID, err := repostorage.NextCommitIDFromStore(repoStore)
+	if err != nil {
+		return 0, err
+	}
+	if author == "" {
+		author = repostorage.DefaultAuthor
+	}
+	now := time.Now().Unix()
+	commit := repostorage.Commit{
+		ID:            mergeID,
+		Message:       fmt.Sprintf("Merge branch %s into %s", otherBranch, branch),
+		Author:        author,
+		Committer:     author,
+		CommitterDate: now,
+		Branch:        branch,
+		Timestamp:     now,
+		Parent:        &ours,
+		Parent2:       &theirs,
+	}
+	if err := repostorage.WriteCommitObjectToBatch(batch, commit, theirTree); err != nil {
+		return 0, err
+	}
+	if err := repostorage.WriteTreeToBatch(batch, mergeID, theirTree); err != nil {
+		return 0, err
+	}
+	if err := repostorage.WriteHeadRefToBatch(batch, branch, mergeID); err != nil {
+		return 0, err
+	}
+	return mergeID, nil
+}
+
+// handleRepoMergeBase handles GET /api/repos/:id/merge-base?a=<x>&b=<y>
+func (s *Server) handleRepoMergeBase(w http.ResponseWriter, r *http.Request, repoID string) {
+	a, errA := strconv.Atoi(r.URL.Query().Get("a"))
+	b, errB := strconv.Atoi(r.URL.Query().Get("b"))
+	if errA != nil || errB != nil {
+		RespondJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Query parameters a and b must be commit hashes"})
+		return
+	}
+
+	// Open per-repo store
+	repoStore, err := storage.NewRepoStore(s.repoBase, repoID)
+	if err != nil {
+		log.Printf("handleRepoMergeBase: repoID=%s open store: %v", repoID, err)
+		respondError(w, err)
+		return
+	}
+	defer repoStore.Close()
+
+	base, err := repostorage.MergeBase(repoStore, a, b)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	var resp MergeBaseResponse
+	if base != nil {
+		hash := strconv.Itoa(*base)
+		resp.MergeBase = &hash
+	}
+	RespondJSON(w, http.StatusOK, resp)
+}
+
+// handleCommitBranches handles GET /api/repos/:id/commits/:commitID/branches:
+// the branches whose history contains the commit
+func (s *Server) handleCommitBranches(w http.ResponseWriter, r *http.Request, repoID, commitID string) {
+	id, err := strconv.Atoi(commitID)
+	if err != nil {
+		RespondJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Commit hash must be a number"})
+		return
+	}
+
+	// Open per-repo store
+	repoStore, err := storage.NewRepoStore(s.repoBase, repoID)
+	if err != nil {
+		log.Printf("handleCommitBranches: repoID=%s open store: %v", repoID, err)
+		respondError(w, err)
+		return
+	}
+	defer repoStore.Close()
+
+	branches, err := repostorage.BranchesContaining(repoStore, id)
+	if err != nil {
+		if errors.Is(err, repostorage.ErrCommitNotFound) {
+			RespondJSON(w, http.StatusNotFound, ErrorResponse{Error: err.Error()})
+			return
+		}
+		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	RespondJSON(w, http.StatusOK, CommitBranchesResponse{Branches: branches})
 }
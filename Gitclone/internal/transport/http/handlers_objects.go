@@ -0,0 +1,45 @@
+package http
+
+import (
+	"log"
+	"net/http"
+
+	"gitclone/internal/infra/storage"
+	repostorage "gitclone/internal/storage"
+)
+
+// handleRepoObjects handles GET /api/repos/:id/objects?type=blob|tree|commit:
+// the keys and sizes of the repository's objects of one type, for debugging.
+// Only requests with the admin token may use it.
+func (s *Server) handleRepoObjects(w http.ResponseWriter, r *http.Request, repoID string) {
+	if !s.isAdmin(r) {
+		RespondJSON(w, http.StatusForbidden, ErrorResponse{Error: "Admin access required"})
+		return
+	}
+	objectType := r.URL.Query().Get("type")
+	if _, ok := repostorage.ObjectTypes[objectType]; !ok {
+		RespondJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Query parameter type must be blob, tree or commit"})
+		return
+	}
+
+	// Open per-repo store
+	repoStore, err := storage.NewRepoStore(s.repoBase, repoID)
+	if err != nil {
+		log.Printf("handleRepoObjects: repoID=%s open store: %v", repoID, err)
+		respondError(w, err)
+		return
+	}
+	defer repoStore.Close()
+
+	objects, err := repostorage.ListObjects(repoStore, objectType)
+	if err != nil {
+		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	resp := make([]Object, 0, len(objects))
+	for _, object := range objects {
+		resp = append(resp, Object{Key: object.Key, Size: object.Size})
+	}
+	RespondJSON(w, http.StatusOK, resp)
+}
@@ -1,18 +1,22 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
 
 	"gitclone/internal/app/repos"
-	"gitclone/internal/commands"
+	infrastorage "gitclone/internal/infra/storage"
 	"gitclone/internal/metadata"
 	"gitclone/internal/storage"
+	"gitclone/internal/timefmt"
 )
 
 // handleListRepos handles GET /api/repos
@@ -26,58 +30,209 @@ func (s *Server) handleListRepos(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	repoList := make([]RepoListItem, 0, len(metaRepos))
-	for _, meta := range metaRepos {
-		_, err := repos.ResolveRepoPath(s.repoBase, meta.ID)
-		missing := err != nil
+	for i := range metaRepos {
+		// Only a repo whose folder is gone is missing; a damaged or briefly
+		// unreadable one is still listed as present
+		_, err := repos.ResolveRepoPath(s.repoBase, metaRepos[i].ID)
+		missing := errors.Is(err, repos.ErrRepoNotFound)
 
-		if missing != meta.Missing {
-			meta.Missing = missing
-			if err := s.metaStore.UpdateRepo(meta); err != nil {
-				log.Printf("GET /api/repos - Warning: failed to update missing flag for %s: %v", meta.ID, err)
+		if missing != metaRepos[i].Missing {
+			metaRepos[i].Missing = missing
+			if err := s.metaStore.SetMissing(metaRepos[i].ID, missing); err != nil {
+				log.Printf("GET /api/repos - Warning: failed to update missing flag for %s: %v", metaRepos[i].ID, err)
 			}
 		}
-
-		lastUpdated := ""
-		if !meta.UpdatedAt.IsZero() {
-			lastUpdated = meta.UpdatedAt.Format(time.RFC3339)
+		if !missing {
+			metaRepos[i].CurrentBranch = s.currentBranch(metaRepos[i].ID)
 		}
-		repoList = append(repoList, RepoListItem{
-			ID:            meta.ID,
-			Name:          meta.Name,
-			Description:   meta.Description,
-			CurrentBranch: meta.CurrentBranch,
-			BranchCount:   meta.BranchCount,
-			CommitCount:   meta.CommitCount,
-			CreatedAt:     meta.CreatedAt,
-			UpdatedAt:     meta.UpdatedAt,
-			LastUpdated:   lastUpdated,
-			Missing:       missing,
-		})
+	}
+
+	// Optional filters: ?q=<text> matches name/description, ?missing=false hides
+	// missing repos and ?missing=true lists only them
+	metaRepos = metadata.FilterRepos(metaRepos, metadata.RepoFilter{
+		Query:       r.URL.Query().Get("q"),
+		HideMissing: r.URL.Query().Get("missing") == "false",
+		OnlyMissing: r.URL.Query().Get("missing") == "true",
+	})
+
+	repoList := make([]RepoListItem, 0, len(metaRepos))
+	for _, meta := range metaRepos {
+		repoList = append(repoList, repoListItemFromMeta(meta))
 	}
 
 	log.Printf("GET /api/repos - Found %d repositories (from metadata store)", len(repoList))
 	RespondJSON(w, http.StatusOK, repoList)
 }
 
+// handlePruneRepos handles POST /api/repos/prune, removing the metadata of
+// every repo whose folder no longer exists
+func (s *Server) handlePruneRepos(w http.ResponseWriter, r *http.Request) {
+	metaRepos, err := s.metaStore.ListRepos()
+	if err != nil {
+		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	pruned := make([]string, 0)
+	for _, meta := range metaRepos {
+		ok, err := s.pruneRepo(meta.ID)
+		if err != nil {
+			RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		if ok {
+			pruned = append(pruned, meta.ID)
+		}
+	}
+
+	log.Printf("POST /api/repos/prune - Pruned %d missing repositories", len(pruned))
+	RespondJSON(w, http.StatusOK, PruneResponse{Pruned: pruned})
+}
+
+// pruneRepo deletes the metadata of repoID if its folder no longer exists,
+// and reports whether it did. Any other failure to resolve the folder, such
+// as a missing .gitclone/ or a stat error, leaves the metadata alone. The
+// repo lock keeps a create or restore of the same ID from racing the check.
+func (s *Server) pruneRepo(repoID string) (bool, error) {
+	defer s.repoLocks.Lock(repoID)()
+
+	if _, err := repos.ResolveRepoPath(s.repoBase, repoID); !errors.Is(err, repos.ErrRepoNotFound) {
+		return false, nil
+	}
+	if err := s.metaStore.DeleteRepo(repoID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// handleScanRepos handles POST /api/repos/scan, registering every repository
+// under the repo base that isn't listed, e.g. one whose metadata was pruned or
+// lost, with its current branch and commit counts
+func (s *Server) handleScanRepos(w http.ResponseWriter, r *http.Request) {
+	discovered, failed, err := repos.Discover(s.repoBase)
+	if err != nil {
+		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	metaRepos, err := s.metaStore.ListRepos()
+	if err != nil {
+		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	listed := make(map[string]bool, len(metaRepos))
+	for _, meta := range metaRepos {
+		listed[meta.ID] = true
+	}
+
+	registered := make([]string, 0)
+	for _, id := range discovered {
+		if listed[id] {
+			continue
+		}
+		repoPath, err := repos.ResolveRepoPath(s.repoBase, id)
+		if err != nil {
+			log.Printf("POST /api/repos/scan - Skipping %s: %v", id, err)
+			failed++
+			continue
+		}
+		summary, err := s.LoadRepoSummary(r.Context(), repoPath, id)
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+		meta := metadata.RepoMeta{
+			ID:            id,
+			Name:          id,
+			CurrentBranch: summary.CurrentBranch,
+			DefaultBranch: summary.DefaultBranch,
+			BranchCount:   summary.BranchCount,
+			CommitCount:   summary.CommitCount,
+		}
+		if err := s.metaStore.CreateRepo(meta); err != nil {
+			RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		registered = append(registered, id)
+	}
+
+	log.Printf("POST /api/repos/scan - Registered %d repositories found on disk, %d entries unreadable", len(registered), failed)
+	RespondJSON(w, http.StatusOK, ScanResponse{Registered: registered, Errors: failed})
+}
+
+// repoListItemFromMeta converts stored metadata to the API list item
+func repoListItemFromMeta(meta metadata.RepoMeta) RepoListItem {
+	lastUpdated := ""
+	if !meta.UpdatedAt.IsZero() {
+		lastUpdated = timefmt.Format(meta.UpdatedAt)
+	}
+	return RepoListItem{
+		ID:            meta.ID,
+		Name:          meta.Name,
+		Description:   meta.Description,
+		CurrentBranch: meta.CurrentBranch,
+		DefaultBranch: meta.DefaultBranch,
+		BranchCount:   meta.BranchCount,
+		CommitCount:   meta.CommitCount,
+		CreatedAt:     timefmt.UTC(meta.CreatedAt),
+		UpdatedAt:     timefmt.UTC(meta.UpdatedAt),
+		LastUpdated:   lastUpdated,
+		Missing:       meta.Missing,
+	}
+}
+
 // handleGetRepo handles GET /api/repos/:id
 func (s *Server) handleGetRepo(w http.ResponseWriter, r *http.Request, repoID string) {
 	repoPath, err := repos.ResolveRepoPath(s.repoBase, repoID)
 	if err != nil {
 		log.Printf("handleGetRepo: repoID=%s resolve repo path: %v", repoID, err)
-		RespondJSON(w, http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		respondError(w, err)
 		return
 	}
 
-	repo, err := s.LoadRepo(repoPath, repoID)
+	repo, err := s.LoadRepo(r.Context(), repoPath, repoID)
 	if err != nil {
-		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		respondError(w, err)
 		return
 	}
 
 	RespondJSON(w, http.StatusOK, repo)
 }
 
+// handleRepoRefresh handles POST /api/repos/:id/refresh, recomputing one
+// registered repo's current branch and branch and commit counts from disk
+func (s *Server) handleRepoRefresh(w http.ResponseWriter, r *http.Request, repoID string) {
+	if _, err := repos.ResolveRepoPath(s.repoBase, repoID); err != nil {
+		log.Printf("handleRepoRefresh: repoID=%s resolve repo path: %v", repoID, err)
+		respondError(w, err)
+		return
+	}
+	if _, err := s.metaStore.GetRepo(repoID); err != nil {
+		RespondJSON(w, http.StatusNotFound, ErrorResponse{Error: "Repository is not registered; POST /api/repos/scan registers it"})
+		return
+	}
+
+	// Don't count while a push or merge is moving refs
+	defer s.repoLocks.Lock(repoID)()
+
+	branches, err := s.branchSvc.ListBranches(repoID)
+	if err != nil {
+		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	commitCount, err := s.commitSvc.CountCommits(r.Context(), repoID, s.defaultBranch(repoID))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	meta, err := s.metaStore.Reconcile(repoID, s.currentBranch(repoID), len(branches), commitCount)
+	if err != nil {
+		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	RespondJSON(w, http.StatusOK, repoListItemFromMeta(*meta))
+}
+
 // handleCreateRepo handles POST /api/repos
 func (s *Server) handleCreateRepo(w http.ResponseWriter, r *http.Request) {
 	var req CreateRepoRequest
@@ -89,15 +244,38 @@ func (s *Server) handleCreateRepo(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("POST /api/repos - Creating repo: name=%s, description=%s", req.Name, req.Description)
 
-	if req.Name == "" {
-		log.Printf("POST /api/repos - Error: Repository name is required")
-		RespondJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Repository name is required"})
+	if err := validateCreateRepoRequest(req); err != nil {
+		log.Printf("POST /api/repos - Error: %v", err)
+		RespondJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	if strings.Contains(req.Name, "/") || strings.Contains(req.Name, "\\") || strings.Contains(req.Name, "..") {
-		log.Printf("POST /api/repos - Error: Invalid characters in name: %s", req.Name)
-		RespondJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Repository name contains invalid characters"})
+	// Creates of one name are serialized, so of two concurrent requests only
+	// one finds the name available; a retry with the same idempotency key
+	// waits and replays the first
+	defer s.repoLocks.Lock(req.Name)()
+
+	// A retried create with the same idempotency key returns the repo it created.
+	// Keys whose repo has since been deleted are ignored.
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	if idempotencyKey == "" {
+		idempotencyKey = req.ID
+	}
+	if idempotencyKey != "" {
+		existingID, ok := s.metaStore.GetIdempotencyKey(idempotencyKey)
+		if existing, err := s.metaStore.GetRepo(existingID); ok && err == nil {
+			if existing.Name != req.Name {
+				log.Printf("POST /api/repos - Error: Idempotency key reused for a different repository: %s", req.Name)
+				RespondJSON(w, http.StatusConflict, ErrorResponse{Error: "Idempotency key was already used for a different repository"})
+				return
+			}
+			log.Printf("POST /api/repos - Idempotent replay: returning existing repo %s", existing.ID)
+			RespondJSON(w, http.StatusOK, repoListItemFromMeta(*existing))
+			return
+		}
+	}
+
+	if !s.checkRepoQuota(w) {
 		return
 	}
 
@@ -110,44 +288,45 @@ func (s *Server) handleCreateRepo(w http.ResponseWriter, r *http.Request) {
 	repoPath := filepath.Join(repoBaseAbs, req.Name)
 	log.Printf("POST /api/repos - Repo path: %s (base: %s)", repoPath, repoBaseAbs)
 
-	if _, err := os.Stat(repoPath); err == nil {
-		log.Printf("POST /api/repos - Error: Repository already exists: %s", repoPath)
-		RespondJSON(w, http.StatusConflict, ErrorResponse{Error: "Repository already exists"})
+	if err := checkRepoAvailable(repoBaseAbs, req.Name); err != nil {
+		log.Printf("POST /api/repos - Error: %v: %s", err, repoPath)
+		RespondJSON(w, http.StatusConflict, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	if err := os.MkdirAll(repoPath, 0755); err != nil {
+	// The repo directory itself is created with Mkdir, which fails if
+	// another process created it since the check
+	if err := os.MkdirAll(filepath.Dir(repoPath), 0755); err != nil {
 		log.Printf("POST /api/repos - Error creating directory: %v", err)
 		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
-	log.Printf("POST /api/repos - Directory created: %s", repoPath)
-
-	oldDir, err := os.Getwd()
-	if err != nil {
-		log.Printf("POST /api/repos - Error getting working directory: %v", err)
+	if err := os.Mkdir(repoPath, 0755); err != nil {
+		if os.IsExist(err) {
+			log.Printf("POST /api/repos - Error: Repository already exists: %s", repoPath)
+			RespondJSON(w, http.StatusConflict, ErrorResponse{Error: "Repository already exists"})
+			return
+		}
+		log.Printf("POST /api/repos - Error creating directory: %v", err)
 		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
-	defer os.Chdir(oldDir)
+	log.Printf("POST /api/repos - Directory created: %s", repoPath)
 
-	if err := os.Chdir(repoPath); err != nil {
-		log.Printf("POST /api/repos - Error changing directory: %v", err)
+	// Initialize by path: handlers run concurrently, so they must not
+	// change the process working directory
+	log.Printf("POST /api/repos - Initializing GitClone repository in: %s", repoPath)
+	if err := storage.InitRepo(repoPath, storage.InitOptions{Bare: false, InitialBranch: req.InitialBranch}); err != nil {
+		log.Printf("POST /api/repos - Error initializing repository: %v", err)
+		os.RemoveAll(repoPath)
 		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
+	log.Printf("POST /api/repos - Repository initialized successfully: %s", filepath.Join(repoPath, storage.RepoDir))
 
-	log.Printf("POST /api/repos - Initializing GitClone repository in: %s", repoPath)
-	commands.Init([]string{})
-
-	gitclonePath := filepath.Join(repoPath, storage.RepoDir)
-	if _, err := os.Stat(gitclonePath); err != nil {
-		log.Printf("POST /api/repos - WARNING: .gitclone directory not found after init: %s", gitclonePath)
-	} else {
-		log.Printf("POST /api/repos - Repository initialized successfully: %s", gitclonePath)
-	}
-
-	repoSummary, err := s.LoadRepoSummary(repoPath, req.Name)
+	// The repository is on disk now, so it is registered even if the client
+	// has gone
+	repoSummary, err := s.LoadRepoSummary(context.WithoutCancel(r.Context()), repoPath, req.Name)
 	if err != nil {
 		log.Printf("POST /api/repos - Error loading repo summary: %v", err)
 		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
@@ -159,6 +338,7 @@ func (s *Server) handleCreateRepo(w http.ResponseWriter, r *http.Request) {
 		Name:          req.Name,
 		Description:   req.Description,
 		CurrentBranch: repoSummary.CurrentBranch,
+		DefaultBranch: repoSummary.DefaultBranch,
 		BranchCount:   repoSummary.BranchCount,
 		CommitCount:   repoSummary.CommitCount,
 		Missing:       false,
@@ -166,33 +346,112 @@ func (s *Server) handleCreateRepo(w http.ResponseWriter, r *http.Request) {
 
 	if err := s.metaStore.CreateRepo(meta); err != nil {
 		log.Printf("POST /api/repos - Error saving metadata: %v", err)
+	} else if saved, err := s.metaStore.GetRepo(meta.ID); err == nil {
+		meta = *saved
 	}
 
-	lastUpdated := ""
-	if !meta.UpdatedAt.IsZero() {
-		lastUpdated = meta.UpdatedAt.Format(time.RFC3339)
-	}
-	repoItem := RepoListItem{
-		ID:            meta.ID,
-		Name:          meta.Name,
-		Description:   meta.Description,
-		CurrentBranch: meta.CurrentBranch,
-		BranchCount:   meta.BranchCount,
-		CommitCount:   meta.CommitCount,
-		CreatedAt:     meta.CreatedAt,
-		UpdatedAt:     meta.UpdatedAt,
-		LastUpdated:   lastUpdated,
-		Missing:       false,
+	if idempotencyKey != "" {
+		if err := s.metaStore.SetIdempotencyKey(idempotencyKey, meta.ID); err != nil {
+			log.Printf("POST /api/repos - Warning: failed to record idempotency key: %v", err)
+		}
 	}
 
+	repoItem := repoListItemFromMeta(meta)
+
 	log.Printf("POST /api/repos - Repository created successfully: id=%s, name=%s", repoItem.ID, repoItem.Name)
 	RespondJSON(w, http.StatusCreated, repoItem)
 }
 
+// validateCreateRepoRequest checks a create request's name and initial
+// branch, without looking at what already exists
+func validateCreateRepoRequest(req CreateRepoRequest) error {
+	if req.Name == "" {
+		return errors.New("Repository name is required")
+	}
+	if infrastorage.IsReservedRepoID(req.Name) {
+		return errors.New("Repository name is reserved")
+	}
+	if err := infrastorage.ValidateRepoID(req.Name); err != nil {
+		return errors.New("Repository name contains invalid characters")
+	}
+	if req.InitialBranch != "" {
+		if err := storage.ValidateBranch(req.InitialBranch); err != nil {
+			return errors.New("Invalid initial branch: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// checkRepoAvailable reports whether a valid repo name can be created under
+// repoBase: nothing exists at its path and its namespace isn't a repository
+func checkRepoAvailable(repoBase, name string) error {
+	if _, err := os.Stat(filepath.Join(repoBase, name)); err == nil {
+		return errors.New("Repository already exists")
+	}
+	return repos.CheckNamespace(repoBase, name)
+}
+
+// checkRepoQuota reports whether one more repository fits in the MaxRepos
+// quota, writing the error response if it doesn't
+func (s *Server) checkRepoQuota(w http.ResponseWriter) bool {
+	if s.quotas.MaxRepos <= 0 {
+		return true
+	}
+	existing, err := s.metaStore.ListRepos()
+	if err != nil {
+		log.Printf("checkRepoQuota: list repositories: %v", err)
+		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return false
+	}
+	if len(existing) >= s.quotas.MaxRepos {
+		log.Printf("checkRepoQuota: repository quota of %d reached", s.quotas.MaxRepos)
+		RespondJSON(w, http.StatusForbidden, ErrorResponse{Error: fmt.Sprintf("Repository quota reached: at most %d repositories", s.quotas.MaxRepos)})
+		return false
+	}
+	return true
+}
+
+// handleValidateRepo handles POST /api/repos/validate, a dry run of
+// handleCreateRepo's name checks that creates nothing
+func (s *Server) handleValidateRepo(w http.ResponseWriter, r *http.Request) {
+	var req CreateRepoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+
+	if err := validateCreateRepoRequest(req); err != nil {
+		RespondJSON(w, http.StatusOK, ValidateRepoResponse{Error: err.Error()})
+		return
+	}
+
+	repoBaseAbs, err := filepath.Abs(s.repoBase)
+	if err != nil {
+		RespondJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := checkRepoAvailable(repoBaseAbs, req.Name); err != nil {
+		RespondJSON(w, http.StatusOK, ValidateRepoResponse{Valid: true, Error: err.Error()})
+		return
+	}
+
+	RespondJSON(w, http.StatusOK, ValidateRepoResponse{Valid: true, Available: true})
+}
+
 // handleRepoRoutes routes requests to specific repo endpoints
 func (s *Server) handleRepoRoutes(w http.ResponseWriter, r *http.Request) {
-	path := strings.TrimPrefix(r.URL.Path, "/api/repos/")
+	// Split the escaped path so a namespaced repo ID sent as one segment
+	// (org%2Fname) stays one part
+	path := strings.TrimPrefix(r.URL.EscapedPath(), "/api/repos/")
 	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i, part := range parts {
+		unescaped, err := url.PathUnescape(part)
+		if err != nil {
+			RespondJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid path encoding"})
+			return
+		}
+		parts[i] = unescaped
+	}
 
 	if len(parts) < 1 || parts[0] == "" {
 		http.Error(w, "Repository ID required", http.StatusBadRequest)
@@ -200,41 +459,78 @@ func (s *Server) handleRepoRoutes(w http.ResponseWriter, r *http.Request) {
 	}
 
 	repoID := parts[0]
+	setAuditRepo(w, repoID)
 
-	if len(parts) == 1 {
-		if r.Method == http.MethodGet {
-			s.handleGetRepo(w, r, repoID)
-			return
-		}
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	action := parts[1]
-	switch action {
-	case "branches":
-		s.handleRepoBranches(w, r, repoID)
-	case "commits":
-		s.handleRepoCommits(w, r, repoID)
-	case "checkout":
-		s.handleRepoCheckout(w, r, repoID)
-	case "add":
-		s.handleRepoAdd(w, r, repoID)
-	case "commit":
-		s.handleRepoCommit(w, r, repoID)
-	case "push":
-		s.handleRepoPush(w, r, repoID)
-	case "merge":
-		s.handleRepoMerge(w, r, repoID)
-	case "files":
-		s.handleRepoFiles(w, r, repoID)
-	case "issues":
-		if len(parts) >= 3 && parts[2] != "" {
-			s.handleIssue(w, r, repoID, parts[2])
-		} else {
-			s.handleRepoIssues(w, r, repoID)
-		}
-	default:
+	route, params, ok := matchRepoRoute(s.repoRoutes(), parts[1:])
+	if !ok {
 		http.Error(w, "Invalid endpoint", http.StatusNotFound)
+		return
+	}
+	setMetricsRoute(r, strings.TrimSuffix("/api/repos/:id/"+route.pattern, "/"))
+	dispatch(w, r, repoID, route.handlers(params))
+}
+
+// repoRoutes lists the endpoints under /api/repos/:id. The debug routes are
+// only listed once an admin token is set.
+func (s *Server) repoRoutes() []repoRoute {
+	routes := []repoRoute{
+		routeTo("", methods{http.MethodGet: s.handleGetRepo}),
+		routeTo("branches", methods{http.MethodGet: s.handleRepoBranches}),
+		{pattern: "branches/:branch/protection", handlers: func(params map[string]string) methods {
+			handleProtection := func(w http.ResponseWriter, r *http.Request, repoID string) {
+				s.handleBranchProtection(w, r, repoID, params["branch"])
+			}
+			return methods{
+				http.MethodGet: handleProtection,
+				http.MethodPut: handleProtection,
+			}
+		}},
+		routeTo("refs", methods{http.MethodGet: s.handleRepoRefs}),
+		routeTo("commits", methods{http.MethodGet: s.handleRepoCommits}),
+		routeTo("head", methods{http.MethodGet: s.handleRepoHead}),
+		{pattern: "commits/:commitID/branches", handlers: func(params map[string]string) methods {
+			return methods{http.MethodGet: func(w http.ResponseWriter, r *http.Request, repoID string) {
+				s.handleCommitBranches(w, r, repoID, params["commitID"])
+			}}
+		}},
+		routeTo("graph", methods{http.MethodGet: s.handleRepoGraph}),
+		routeTo("default-branch", methods{http.MethodPut: s.handleRepoDefaultBranch}),
+		routeTo("refresh", methods{http.MethodPost: s.handleRepoRefresh}),
+		routeTo("checkout", methods{http.MethodPost: s.handleRepoCheckout}),
+		routeTo("add", methods{http.MethodPost: s.handleRepoAdd}),
+		routeTo("commit", methods{http.MethodPost: s.handleRepoCommit}),
+		routeTo("push", methods{http.MethodPost: s.handleRepoPush}),
+		routeTo("push/rollback", methods{http.MethodPost: s.handleRepoPushRollback}),
+		routeTo("merge", methods{http.MethodPost: s.handleRepoMerge}),
+		routeTo("merge-base", methods{http.MethodGet: s.handleRepoMergeBase}),
+		routeTo("files", methods{
+			http.MethodGet:  s.handleGetFile,
+			http.MethodPost: s.handleRepoFiles,
+		}),
+		routeTo("files/history", methods{http.MethodGet: s.handleFileHistory}),
+		routeTo("files/bulk", methods{http.MethodPost: s.handleRepoFilesBulk}),
+		routeTo("tree", methods{http.MethodGet: s.handleRepoTree}),
+		routeTo("diff/staged", methods{http.MethodGet: s.handleStagedDiff}),
+		routeTo("events", methods{http.MethodGet: s.handleRepoEvents}),
+		routeTo("backup", methods{http.MethodGet: s.handleRepoBackup}),
+		routeTo("restore", methods{http.MethodPost: s.handleRepoRestore}),
+		routeTo("issues", methods{
+			http.MethodGet:  s.handleRepoIssues,
+			http.MethodPost: s.handleRepoIssues,
+		}),
+		{pattern: "issues/:issueID", handlers: func(params map[string]string) methods {
+			handleIssue := func(w http.ResponseWriter, r *http.Request, repoID string) {
+				s.handleIssue(w, r, repoID, params["issueID"])
+			}
+			return methods{
+				http.MethodGet:   handleIssue,
+				http.MethodPatch: handleIssue,
+				http.MethodPut:   handleIssue,
+			}
+		}},
+	}
+	if s.adminToken != "" {
+		routes = append(routes, routeTo("objects", methods{http.MethodGet: s.handleRepoObjects}))
 	}
+	return routes
 }
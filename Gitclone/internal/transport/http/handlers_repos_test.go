@@ -0,0 +1,90 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gitclone/internal/metadata"
+)
+
+// TestCreateRepoIdempotencyKey verifies that repeating a create with the same
+// idempotency key returns the existing repo, while a different key still conflicts
+func TestCreateRepoIdempotencyKey(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-create-idempotency-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repoBase := filepath.Join(tmpDir, "repos")
+	if err := os.MkdirAll(repoBase, 0755); err != nil {
+		t.Fatalf("Failed to create repo base: %v", err)
+	}
+
+	metaStore, err := metadata.NewStore(filepath.Join(tmpDir, "db"))
+	if err != nil {
+		t.Fatalf("Failed to create metadata store: %v", err)
+	}
+	defer metaStore.Close()
+
+	ts := httptest.NewServer(NewRouter(NewServer(repoBase, metaStore)))
+	defer ts.Close()
+
+	create := func(key, body string) (int, RepoListItem) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/repos", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to build request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Create request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var item RepoListItem
+		if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
+			if err := json.NewDecoder(resp.Body).Decode(&item); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+		}
+		return resp.StatusCode, item
+	}
+
+	status, first := create("key-1", `{"name":"demo"}`)
+	if status != http.StatusCreated {
+		t.Fatalf("Expected 201 on first create, got %d", status)
+	}
+
+	status, again := create("key-1", `{"name":"demo"}`)
+	if status != http.StatusOK {
+		t.Fatalf("Expected 200 on repeated create, got %d", status)
+	}
+	if again.ID != first.ID || !again.CreatedAt.Equal(first.CreatedAt) {
+		t.Errorf("Expected the same repo, got %+v and %+v", first, again)
+	}
+
+	// The key can also be supplied in the body
+	status, fromBody := create("", `{"id":"key-1","name":"demo"}`)
+	if status != http.StatusOK || fromBody.ID != first.ID {
+		t.Errorf("Expected 200 with repo %s for body key, got %d (%+v)", first.ID, status, fromBody)
+	}
+
+	if status, _ := create("key-2", `{"name":"demo"}`); status != http.StatusConflict {
+		t.Errorf("Expected 409 for a different key, got %d", status)
+	}
+	if status, _ := create("", `{"name":"demo"}`); status != http.StatusConflict {
+		t.Errorf("Expected 409 without a key, got %d", status)
+	}
+	if status, _ := create("key-1", `{"name":"other"}`); status != http.StatusConflict {
+		t.Errorf("Expected 409 when a key is reused for another name, got %d", status)
+	}
+}
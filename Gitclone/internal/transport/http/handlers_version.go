@@ -0,0 +1,62 @@
+package http
+
+import (
+	"net/http"
+	"sort"
+
+	storage "gitclone/internal/infra/storage"
+)
+
+// Version is the server version reported by GET /api/version. Release builds
+// set it with -ldflags "-X gitclone/internal/transport/http.Version=<version>".
+var Version = "dev"
+
+// serverFeatures are the features of the top-level routes NewRouter registers
+var serverFeatures = []string{"audit", "idempotent-create", "repo-prune", "repo-scan", "repo-validate"}
+
+// routeFeatures names the features each repo route provides. A feature is
+// listed by GET /api/version only while a route providing it is registered.
+var routeFeatures = map[string][]string{
+	"backup":                      {"backup"},
+	"branches/:branch/protection": {"branch-protection"},
+	"commits":                     {"commits-ndjson"},
+	"commits/:commitID/branches":  {"commit-branches"},
+	"default-branch":              {"default-branch"},
+	"diff/staged":                 {"staged-diff"},
+	"events":                      {"events"},
+	"files":                       {"file-content", "file-content:raw", "file-content:staged"},
+	"files/bulk":                  {"bulk-files"},
+	"files/history":               {"file-history"},
+	"graph":                       {"graph"},
+	"issues":                      {"issues"},
+	"merge":                       {"merge", "merge:fast-forward", "merge:merge-commit"},
+	"merge-base":                  {"merge-base"},
+	"objects":                     {"objects"},
+	"push":                        {"push"},
+	"push/rollback":               {"push-rollback"},
+	"refresh":                     {"repo-refresh"},
+	"restore":                     {"restore"},
+}
+
+// features returns the features of the routes this server registers, sorted
+func (s *Server) features() []string {
+	features := append([]string(nil), serverFeatures...)
+	if s.metrics != nil {
+		features = append(features, "metrics")
+	}
+	for _, route := range s.repoRoutes() {
+		features = append(features, routeFeatures[route.pattern]...)
+	}
+	sort.Strings(features)
+	return features
+}
+
+// handleVersion handles GET /api/version: the server version, its features
+// and the repository schema version it reads and writes
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	RespondJSON(w, http.StatusOK, VersionResponse{
+		Version:       Version,
+		Features:      s.features(),
+		SchemaVersion: storage.SchemaVersion,
+	})
+}
@@ -0,0 +1,207 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"gitclone/internal/app/events"
+)
+
+// Metrics
+//
+// With metrics enabled the server counts requests by method, route and
+// status, times them per route, and counts the commit, push and merge events
+// the services publish. GET /metrics serves the counts in the Prometheus text
+// format. Routes are labelled by pattern ("/api/repos/:id/commits"), never by
+// the requested path, so repository IDs don't become label values.
+
+// durationBuckets are the upper bounds, in seconds, of the request duration
+// histogram buckets
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// requestKey identifies a request counter
+type requestKey struct {
+	method, route string
+	status        int
+}
+
+// histogram is one route's request durations
+type histogram struct {
+	buckets []uint64 // cumulative counts per durationBuckets bound
+	sum     float64
+	count   uint64
+}
+
+// metrics holds the counters served by GET /metrics
+type metrics struct {
+	mu         sync.Mutex
+	requests   map[requestKey]uint64
+	durations  map[string]*histogram
+	operations map[string]uint64 // repository events by type
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests:   make(map[requestKey]uint64),
+		durations:  make(map[string]*histogram),
+		operations: make(map[string]uint64),
+	}
+}
+
+// observeRequest records a handled request
+func (m *metrics) observeRequest(method, route string, status int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestKey{method: method, route: route, status: status}]++
+	h := m.durations[route]
+	if h == nil {
+		h = &histogram{buckets: make([]uint64, len(durationBuckets))}
+		m.durations[route] = h
+	}
+	seconds := duration.Seconds()
+	for i, bound := range durationBuckets {
+		if seconds <= bound {
+			h.buckets[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// Publish counts a repository event, making metrics an events.Publisher
+func (m *metrics) Publish(event events.Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.operations[event.Type]++
+}
+
+// writeTo writes the metrics in the Prometheus text exposition format,
+// sorted so scrapes are stable
+func (m *metrics) writeTo(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP gitstore_http_requests_total HTTP requests handled, by method, route and status.")
+	fmt.Fprintln(w, "# TYPE gitstore_http_requests_total counter")
+	keys := make([]requestKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].status < keys[j].status
+	})
+	for _, key := range keys {
+		fmt.Fprintf(w, "gitstore_http_requests_total{method=%q,route=%q,status=\"%d\"} %d\n", key.method, key.route, key.status, m.requests[key])
+	}
+
+	fmt.Fprintln(w, "# HELP gitstore_http_request_duration_seconds HTTP request durations, by route.")
+	fmt.Fprintln(w, "# TYPE gitstore_http_request_duration_seconds histogram")
+	routes := make([]string, 0, len(m.durations))
+	for route := range m.durations {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	for _, route := range routes {
+		h := m.durations[route]
+		for i, bound := range durationBuckets {
+			fmt.Fprintf(w, "gitstore_http_request_duration_seconds_bucket{route=%q,le=%q} %d\n", route, strconv.FormatFloat(bound, 'g', -1, 64), h.buckets[i])
+		}
+		fmt.Fprintf(w, "gitstore_http_request_duration_seconds_bucket{route=%q,le=\"+Inf\"} %d\n", route, h.count)
+		fmt.Fprintf(w, "gitstore_http_request_duration_seconds_sum{route=%q} %s\n", route, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "gitstore_http_request_duration_seconds_count{route=%q} %d\n", route, h.count)
+	}
+
+	fmt.Fprintln(w, "# HELP gitstore_repo_operations_total Commits, pushes and merges made through the server.")
+	fmt.Fprintln(w, "# TYPE gitstore_repo_operations_total counter")
+	for _, op := range []string{events.TypeCommit, events.TypePush, events.TypeMerge} {
+		fmt.Fprintf(w, "gitstore_repo_operations_total{operation=%q} %d\n", op, m.operations[op])
+	}
+}
+
+// handleMetrics handles GET /metrics
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	s.metrics.writeTo(w)
+}
+
+// routeKey is the context key of a request's *metricsRoute
+type routeKey struct{}
+
+// metricsRoute is the route label of a request, set by the handler that
+// matched it
+type metricsRoute struct {
+	pattern string
+}
+
+// setMetricsRoute labels the request with route, if it is being measured
+func setMetricsRoute(r *http.Request, route string) {
+	if mr, ok := r.Context().Value(routeKey{}).(*metricsRoute); ok {
+		mr.pattern = route
+	}
+}
+
+// metricsWriter records the status a handler responds with
+type metricsWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *metricsWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *metricsWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush lets streaming handlers flush through the wrapper
+func (w *metricsWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// metricsMiddleware records every request next handles. The route label is
+// the one set with setMetricsRoute, else the mux pattern that matched, else
+// "other" for paths no route serves.
+func metricsMiddleware(next http.Handler, m *metrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		route := &metricsRoute{}
+		r = r.WithContext(context.WithValue(r.Context(), routeKey{}, route))
+		mw := &metricsWriter{ResponseWriter: w}
+		next.ServeHTTP(mw, r)
+
+		if mw.status == 0 {
+			mw.status = http.StatusOK
+		}
+		label := route.pattern
+		if label == "" {
+			label = r.Pattern
+		}
+		if label == "" {
+			label = "other"
+		}
+		m.observeRequest(r.Method, label, mw.status, time.Since(start))
+	})
+}
@@ -0,0 +1,75 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestMetrics scrapes /metrics around API calls: request counters increment
+// by route pattern and status, durations are observed, and commits and
+// pushes are counted. Without EnableMetrics there is no /metrics.
+func TestMetrics(t *testing.T) {
+	ts, cleanup := newConfiguredTestServer(t, (*Server).EnableMetrics)
+	defer cleanup()
+
+	scrape := func() string {
+		t.Helper()
+		resp, err := http.Get(ts.url + "/metrics")
+		if err != nil {
+			t.Fatalf("GET /metrics: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+			t.Fatalf("GET /metrics: status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("Failed to read /metrics: %v", err)
+		}
+		return string(body)
+	}
+	expectLine := func(metrics, line string, want bool) {
+		t.Helper()
+		if strings.Contains(metrics, line+"\n") != want {
+			t.Errorf("Expected line %q present=%v in:\n%s", line, want, metrics)
+		}
+	}
+
+	const listRepos = `gitstore_http_requests_total{method="GET",route="/api/repos",status="200"}`
+	expectLine(scrape(), listRepos+" 1", false)
+
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos", nil, nil)
+	expectLine(scrape(), listRepos+" 1", true)
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos", nil, nil)
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	ts.commitFile("demo", "a.txt", "a", "Add a")
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/push", PushRequest{Remote: "origin", Branch: "master"}, nil)
+	ts.expect(http.StatusNotFound, http.MethodGet, "/api/repos/missing/commits", nil, nil)
+
+	metrics := scrape()
+	expectLine(metrics, listRepos+" 2", true)
+	expectLine(metrics, `gitstore_http_requests_total{method="POST",route="/api/repos",status="201"} 1`, true)
+	expectLine(metrics, `gitstore_http_requests_total{method="POST",route="/api/repos/:id/push",status="200"} 1`, true)
+	expectLine(metrics, `gitstore_http_requests_total{method="GET",route="/api/repos/:id/commits",status="404"} 1`, true)
+	expectLine(metrics, `gitstore_http_request_duration_seconds_count{route="/api/repos"} 3`, true)
+	expectLine(metrics, `gitstore_http_request_duration_seconds_bucket{route="/api/repos",le="+Inf"} 3`, true)
+	expectLine(metrics, `gitstore_repo_operations_total{operation="commit"} 1`, true)
+	expectLine(metrics, `gitstore_repo_operations_total{operation="push"} 1`, true)
+	expectLine(metrics, `gitstore_repo_operations_total{operation="merge"} 0`, true)
+	if strings.Contains(metrics, `route="/api/repos/demo`) {
+		t.Errorf("Expected repo IDs kept out of route labels:\n%s", metrics)
+	}
+
+	var version VersionResponse
+	ts.expect(http.StatusOK, http.MethodGet, "/api/version", nil, &version)
+	if !strings.Contains(strings.Join(version.Features, ","), "metrics") {
+		t.Errorf("Expected the metrics feature listed, got %v", version.Features)
+	}
+
+	plain, cleanupPlain := newTestServer(t)
+	defer cleanupPlain()
+	plain.expect(http.StatusNotFound, http.MethodGet, "/metrics", nil, nil)
+}
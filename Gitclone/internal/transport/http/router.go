@@ -1,7 +1,11 @@
 package http
 
 import (
+	"context"
 	"net/http"
+	"sort"
+	"strings"
+	"time"
 )
 
 // NewRouter configures all routes and returns the mux
@@ -10,27 +14,173 @@ func NewRouter(s *Server) http.Handler {
 
 	// Repo list and creation
 	mux.HandleFunc("/api/repos", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodGet {
-			s.handleListRepos(w, r)
-		} else if r.Method == http.MethodPost {
-			s.handleCreateRepo(w, r)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
+		dispatch(w, r, "", methods{
+			http.MethodGet:  func(w http.ResponseWriter, r *http.Request, _ string) { s.handleListRepos(w, r) },
+			http.MethodPost: func(w http.ResponseWriter, r *http.Request, _ string) { s.handleCreateRepo(w, r) },
+		})
+	})
+
+	// Metadata cleanup for repos whose folder is gone
+	mux.HandleFunc("/api/repos/prune", func(w http.ResponseWriter, r *http.Request) {
+		dispatch(w, r, "", methods{
+			http.MethodPost: func(w http.ResponseWriter, r *http.Request, _ string) { s.handlePruneRepos(w, r) },
+		})
+	})
+
+	// Registration of repos found on disk without metadata
+	mux.HandleFunc("/api/repos/scan", func(w http.ResponseWriter, r *http.Request) {
+		dispatch(w, r, "", methods{
+			http.MethodPost: func(w http.ResponseWriter, r *http.Request, _ string) { s.handleScanRepos(w, r) },
+		})
+	})
+
+	// Dry run of repo creation
+	mux.HandleFunc("/api/repos/validate", func(w http.ResponseWriter, r *http.Request) {
+		dispatch(w, r, "", methods{
+			http.MethodPost: func(w http.ResponseWriter, r *http.Request, _ string) { s.handleValidateRepo(w, r) },
+		})
 	})
 
 	// Repo-specific routes
 	mux.HandleFunc("/api/repos/", s.handleRepoRoutes)
 
-	return corsMiddleware(mux)
+	// Audit log of mutating calls
+	mux.HandleFunc("/api/audit", func(w http.ResponseWriter, r *http.Request) {
+		dispatch(w, r, "", methods{
+			http.MethodGet: func(w http.ResponseWriter, r *http.Request, _ string) { s.handleListAudit(w, r) },
+		})
+	})
+
+	// Server version and supported features
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		dispatch(w, r, "", methods{
+			http.MethodGet: func(w http.ResponseWriter, r *http.Request, _ string) { s.handleVersion(w, r) },
+		})
+	})
+
+	var handler http.Handler = mux
+	if s.requestTimeout > 0 {
+		handler = timeoutMiddleware(handler, s.requestTimeout)
+	}
+	handler = auditMiddleware(handler, s.metaStore)
+	if s.metrics != nil {
+		// Prometheus scrape endpoint
+		mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+			dispatch(w, r, "", methods{
+				http.MethodGet: func(w http.ResponseWriter, r *http.Request, _ string) { s.handleMetrics(w, r) },
+			})
+		})
+		handler = metricsMiddleware(handler, s.metrics)
+	}
+	return corsMiddleware(handler, s.allowedOrigins)
+}
+
+// repoHandler handles a request for one repository
+type repoHandler func(w http.ResponseWriter, r *http.Request, repoID string)
+
+// methods maps the HTTP methods a route accepts to their handlers
+type methods map[string]repoHandler
+
+// dispatch calls the handler registered for the request method. Other methods
+// get a 405 with an Allow header listing the accepted ones.
+func dispatch(w http.ResponseWriter, r *http.Request, repoID string, routes methods) {
+	if handler, ok := routes[r.Method]; ok {
+		handler(w, r, repoID)
+		return
+	}
+
+	allowed := make([]string, 0, len(routes))
+	for method := range routes {
+		allowed = append(allowed, method)
+	}
+	sort.Strings(allowed)
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	RespondJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+}
+
+// repoRoute is an endpoint under /api/repos/:id. Its pattern is the path
+// after the repo ID, one segment per "/": a literal, or ":name" to capture that
+// segment as a parameter (e.g. "issues/:issueID"). The empty pattern is the
+// repo itself. handlers returns the methods it accepts given the parameters.
+type repoRoute struct {
+	pattern  string
+	handlers func(params map[string]string) methods
+}
+
+// routeTo is a repoRoute whose handlers take no path parameters
+func routeTo(pattern string, handlers methods) repoRoute {
+	return repoRoute{pattern: pattern, handlers: func(map[string]string) methods { return handlers }}
+}
+
+// matchRepoRoute returns the first route whose pattern matches segments, the
+// path after the repo ID split on "/", with the parameters it captured. A
+// pattern matches only the same number of segments, and a parameter never
+// matches an empty segment.
+func matchRepoRoute(routes []repoRoute, segments []string) (repoRoute, map[string]string, bool) {
+	for _, route := range routes {
+		var pattern []string
+		if route.pattern != "" {
+			pattern = strings.Split(route.pattern, "/")
+		}
+		if len(pattern) != len(segments) {
+			continue
+		}
+
+		params := make(map[string]string)
+		matched := true
+		for i, want := range pattern {
+			if name, ok := strings.CutPrefix(want, ":"); ok && segments[i] != "" {
+				params[name] = segments[i]
+			} else if want != segments[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return route, params, true
+		}
+	}
+	return repoRoute{}, nil, false
 }
 
-// corsMiddleware adds CORS headers to all responses
-func corsMiddleware(next http.Handler) http.Handler {
+// ParseAllowedOrigins splits a comma-separated origin list, dropping blanks
+// and trailing slashes
+func ParseAllowedOrigins(value string) []string {
+	origins := make([]string, 0)
+	for _, origin := range strings.Split(value, ",") {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		if origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// corsMiddleware adds CORS headers to all responses. With no allowed origins
+// configured any origin is accepted (development); otherwise only a request
+// Origin on the allowlist is echoed back and other origins get no CORS headers.
+func corsMiddleware(next http.Handler, allowedOrigins []string) http.Handler {
+	allowed := make(map[string]bool, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		allowed[origin] = true
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		allowOrigin := ""
+		if len(allowed) == 0 {
+			allowOrigin = "*"
+		} else {
+			w.Header().Add("Vary", "Origin")
+			if origin := r.Header.Get("Origin"); allowed[origin] {
+				allowOrigin = origin
+			}
+		}
+
+		if allowOrigin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match, Idempotency-Key, X-Actor")
+		}
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
 			return
@@ -38,3 +188,29 @@ func corsMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// timeoutMiddleware cancels each request's context once timeout has passed,
+// so the services it calls stop working for a client that has stopped
+// waiting. The live event stream is meant to stay open and has no timeout.
+func timeoutMiddleware(next http.Handler, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isEventStream(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// isEventStream reports whether r is for GET /api/repos/:id/events, split
+// like handleRepoRoutes splits it
+func isEventStream(r *http.Request) bool {
+	path, ok := strings.CutPrefix(r.URL.EscapedPath(), "/api/repos/")
+	if !ok {
+		return false
+	}
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	return len(parts) == 2 && parts[1] == "events"
+}
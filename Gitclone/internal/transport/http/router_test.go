@@ -0,0 +1,209 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	storage "gitclone/internal/infra/storage"
+	"gitclone/internal/metadata"
+)
+
+// TestMatchRepoRoute matches each route shape: the repo itself, a resource, a
+// nested resource and a captured sub-ID, with and without trailing slashes
+func TestMatchRepoRoute(t *testing.T) {
+	routes := []repoRoute{
+		routeTo("", nil),
+		routeTo("commits", nil),
+		routeTo("files/history", nil),
+		routeTo("issues", nil),
+		routeTo("issues/:issueID", nil),
+		routeTo("branches/:name/:action", nil),
+	}
+
+	tests := []struct {
+		path    string // after /api/repos/
+		pattern string
+		params  map[string]string
+		ok      bool // false for paths no route matches
+	}{
+		{path: "demo", pattern: "", ok: true},
+		{path: "demo/", pattern: "", ok: true},
+		{path: "demo/commits", pattern: "commits", ok: true},
+		{path: "demo/commits/", pattern: "commits", ok: true},
+		{path: "demo/files/history", pattern: "files/history", ok: true},
+		{path: "demo/files/history/", pattern: "files/history", ok: true},
+		{path: "demo/issues", pattern: "issues", ok: true},
+		{path: "demo/issues/", pattern: "issues", ok: true},
+		{path: "demo/issues/7", pattern: "issues/:issueID", params: map[string]string{"issueID": "7"}, ok: true},
+		{path: "demo/issues/7/", pattern: "issues/:issueID", params: map[string]string{"issueID": "7"}, ok: true},
+		{path: "demo/branches/feature/rename", pattern: "branches/:name/:action", params: map[string]string{"name": "feature", "action": "rename"}, ok: true},
+		{path: "demo/unknown", ok: false},
+		{path: "demo/files/unknown", ok: false},
+		{path: "demo/issues/7/extra", ok: false},
+		{path: "demo//issues", ok: false},
+	}
+	for _, tt := range tests {
+		parts := strings.Split(strings.Trim(tt.path, "/"), "/")
+		route, params, ok := matchRepoRoute(routes, parts[1:])
+		if ok != tt.ok {
+			t.Errorf("%s: expected match %v, got %v", tt.path, tt.ok, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if route.pattern != tt.pattern {
+			t.Errorf("%s: expected pattern %q, got %q", tt.path, tt.pattern, route.pattern)
+		}
+		for name, want := range tt.params {
+			if params[name] != want {
+				t.Errorf("%s: expected %s=%q, got %q", tt.path, name, want, params[name])
+			}
+		}
+	}
+}
+
+// TestRepoRoutesTrailingSlash checks trailing slashes reach the same handlers
+// through the router, and unknown paths get a 404
+func TestRepoRoutesTrailingSlash(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/", nil, nil)
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/branches/", nil, nil)
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/files/history/?path=a.txt", nil, nil)
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/issues/", nil, nil)
+	ts.expect(http.StatusNotFound, http.MethodGet, "/api/repos/demo/nope", nil, nil)
+	ts.expect(http.StatusNotFound, http.MethodGet, "/api/repos/demo/branches/extra/segments", nil, nil)
+	ts.expect(http.StatusMethodNotAllowed, http.MethodDelete, "/api/repos/demo/issues/", nil, nil)
+}
+
+// TestMethodNotAllowedListsAllowedMethods verifies that unsupported methods get
+// a 405 with an Allow header and a JSON error body
+func TestMethodNotAllowedListsAllowedMethods(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitstore-router-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	metaStore, err := metadata.NewStore(filepath.Join(tmpDir, "db"))
+	if err != nil {
+		t.Fatalf("Failed to create metadata store: %v", err)
+	}
+	defer metaStore.Close()
+
+	router := NewRouter(NewServer(filepath.Join(tmpDir, "repos"), metaStore))
+
+	tests := []struct {
+		method string
+		path   string
+		allow  string
+	}{
+		{http.MethodDelete, "/api/repos/demo/commits", "GET"},
+		{http.MethodGet, "/api/repos/demo/commit", "POST"},
+		{http.MethodPut, "/api/repos", "GET, POST"},
+		{http.MethodDelete, "/api/repos/demo", "GET"},
+		{http.MethodDelete, "/api/repos/demo/issues", "GET, POST"},
+		{http.MethodDelete, "/api/repos/demo/issues/1", "GET, PATCH, PUT"},
+		{http.MethodPost, "/api/repos/demo/files/history", "GET"},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s %s: expected 405, got %d", tt.method, tt.path, rec.Code)
+			continue
+		}
+		if got := rec.Header().Get("Allow"); got != tt.allow {
+			t.Errorf("%s %s: expected Allow %q, got %q", tt.method, tt.path, tt.allow, got)
+		}
+		var body ErrorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Error == "" {
+			t.Errorf("%s %s: expected JSON error body, got %q", tt.method, tt.path, rec.Body.String())
+		}
+	}
+}
+
+// TestCORSAllowlist verifies that only allowlisted origins are echoed back and
+// that an empty allowlist keeps the development wildcard
+func TestCORSAllowlist(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	origins := ParseAllowedOrigins(" https://app.example.com/ ,, http://localhost:5173")
+	if len(origins) != 2 || origins[0] != "https://app.example.com" || origins[1] != "http://localhost:5173" {
+		t.Fatalf("Unexpected parsed origins: %v", origins)
+	}
+	handler := corsMiddleware(ok, origins)
+
+	tests := []struct {
+		origin string
+		want   string
+	}{
+		{"https://app.example.com", "https://app.example.com"},
+		{"http://localhost:5173", "http://localhost:5173"},
+		{"https://evil.example.com", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		for _, method := range []string{http.MethodGet, http.MethodOptions} {
+			req := httptest.NewRequest(method, "/api/repos", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.want {
+				t.Errorf("%s from %q: expected Allow-Origin %q, got %q", method, tt.origin, tt.want, got)
+			}
+			if got := rec.Header().Get("Vary"); got != "Origin" {
+				t.Errorf("%s from %q: expected Vary: Origin, got %q", method, tt.origin, got)
+			}
+		}
+	}
+
+	// No allowlist: any origin, via the wildcard
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/repos", nil)
+	req.Header.Set("Origin", "https://anything.example.com")
+	corsMiddleware(ok, nil).ServeHTTP(rec, req)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Expected wildcard without an allowlist, got %q", got)
+	}
+}
+
+// TestVersion checks GET /api/version reports the build version, the schema
+// version and the features of the routes the server registers
+func TestVersion(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	var got VersionResponse
+	ts.expect(http.StatusOK, http.MethodGet, "/api/version", nil, &got)
+
+	want := []string{
+		"audit", "backup", "branch-protection", "bulk-files", "commit-branches", "commits-ndjson",
+		"default-branch", "events", "file-content", "file-content:raw", "file-content:staged", "file-history", "graph", "idempotent-create",
+		"issues", "merge", "merge-base", "merge:fast-forward", "merge:merge-commit",
+		"push", "push-rollback", "repo-prune", "repo-refresh", "repo-scan", "repo-validate", "restore",
+		"staged-diff",
+	}
+	if strings.Join(got.Features, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected features %v, got %v", want, got.Features)
+	}
+	if got.Version != Version || got.SchemaVersion != storage.SchemaVersion {
+		t.Errorf("Expected version %s and schema version %d, got %+v", Version, storage.SchemaVersion, got)
+	}
+	ts.expect(http.StatusMethodNotAllowed, http.MethodPost, "/api/version", nil, nil)
+}
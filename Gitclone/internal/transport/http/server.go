@@ -1,17 +1,26 @@
 package http
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"gitclone/internal/app/branches"
 	"gitclone/internal/app/commits"
+	"gitclone/internal/app/events"
 	"gitclone/internal/app/files"
 	"gitclone/internal/infra/storage"
 	"gitclone/internal/metadata"
 	repostorage "gitclone/internal/storage"
+	"gitclone/internal/timefmt"
 )
 
 // Server holds the server dependencies
@@ -21,16 +30,105 @@ type Server struct {
 	branchSvc *branches.Service
 	commitSvc *commits.Service
 	fileSvc   *files.Service
+	broker    *events.Broker
+	publisher events.Publisher   // the broker, metrics and extra, combined
+	extra     events.Publisher   // set with SetEventPublisher
+	metrics   *metrics           // nil unless EnableMetrics was called
+	issuesMu  sync.Mutex         // serializes read-modify-write of a repo's issue list
+	repoLocks *storage.RepoLocks // serializes every repo write and compaction per repo
+
+	allowedOrigins []string // CORS allowlist; empty allows any origin
+	quotas         Quotas
+	adminToken     string        // secret the debug routes require; empty registers no debug routes
+	requestTimeout time.Duration // cancels a request's work after this long; zero never does
+}
+
+// Quotas bounds what clients can store. Zero fields are unlimited.
+type Quotas struct {
+	MaxRepos     int   // repositories in the registry, checked on create
+	MaxRepoBytes int64 // size of one repository on disk, checked on file writes
 }
 
 // NewServer creates a new server instance
 func NewServer(repoBase string, metaStore *metadata.Store) *Server {
-	return &Server{
+	s := &Server{
 		repoBase:  repoBase,
 		metaStore: metaStore,
 		branchSvc: branches.NewService(repoBase, metaStore),
 		commitSvc: commits.NewService(repoBase, metaStore),
 		fileSvc:   files.NewService(repoBase),
+		broker:    events.NewBroker(),
+		repoLocks: storage.NewRepoLocks(),
+	}
+	s.commitSvc.SetLocks(s.repoLocks)
+	// The live event stream is always fed; SetEventPublisher can add more sinks
+	s.SetEventPublisher(nil)
+	return s
+}
+
+// SetEventPublisher sets an additional destination (e.g. a webhook) for
+// repository events (commit, push, merge), alongside the live event stream
+func (s *Server) SetEventPublisher(publisher events.Publisher) {
+	s.extra = publisher
+	sinks := []events.Publisher{s.broker, publisher}
+	if s.metrics != nil {
+		sinks = append(sinks, s.metrics)
+	}
+	s.publisher = events.Multi(sinks...)
+	s.commitSvc.SetPublisher(s.publisher)
+}
+
+// EnableMetrics turns on request and repository operation metrics, served at
+// GET /metrics. It must be called before NewRouter.
+func (s *Server) EnableMetrics() {
+	s.metrics = newMetrics()
+	s.SetEventPublisher(s.extra)
+}
+
+// SetAllowedOrigins restricts CORS to the given origins. It must be called
+// before NewRouter; an empty list allows any origin.
+func (s *Server) SetAllowedOrigins(origins []string) {
+	s.allowedOrigins = origins
+}
+
+// SetAdminToken sets the secret that grants use of the debug routes, such as
+// GET /api/repos/:id/objects. The routes are only registered once a token is
+// set. It must be called before NewRouter.
+func (s *Server) SetAdminToken(token string) {
+	s.adminToken = token
+}
+
+// isAdmin reports whether the request carries the admin token, as a bearer
+// token or as the Basic auth password. The X-Actor header and the Basic auth
+// username are never enough.
+func (s *Server) isAdmin(r *http.Request) bool {
+	if s.adminToken == "" {
+		return false
+	}
+	secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		_, secret, ok = r.BasicAuth()
+	}
+	return ok && subtle.ConstantTimeCompare([]byte(secret), []byte(s.adminToken)) == 1
+}
+
+// SetRequestTimeout sets how long a request may run before its context is
+// cancelled, stopping the walks, commits and pushes it started; zero, the
+// default, never cancels. It must be called before NewRouter.
+func (s *Server) SetRequestTimeout(timeout time.Duration) {
+	s.requestTimeout = timeout
+}
+
+// SetQuotas sets the repository count and size quotas
+func (s *Server) SetQuotas(quotas Quotas) {
+	s.quotas = quotas
+	s.fileSvc.SetMaxRepoBytes(quotas.MaxRepoBytes)
+}
+
+// publishEvent sends an event for changes made directly by handlers
+func (s *Server) publishEvent(eventType, repoID, branch string, commitID int) {
+	if s.publisher != nil {
+		s.publisher.Publish(events.NewEvent(eventType, repoID, branch, commitID))
 	}
 }
 
@@ -44,64 +142,127 @@ func (s *Server) MetaStore() *metadata.Store {
 	return s.metaStore
 }
 
+// RepoLocks returns the per-repository locks the server's writers share, for
+// background work such as compaction that must not interleave with them
+func (s *Server) RepoLocks() *storage.RepoLocks {
+	return s.repoLocks
+}
+
 // Helper functions for loading data
 
-// LoadRepoSummary loads a repository summary
-func (s *Server) LoadRepoSummary(repoPath, repoID string) (RepoListItem, error) {
+// LoadRepoSummary loads a repository summary. It fails with ctx's error if ctx
+// is done before the commits are counted.
+func (s *Server) LoadRepoSummary(ctx context.Context, repoPath, repoID string) (RepoListItem, error) {
+	// The summary describes the repo's default branch
+	defaultBranch := s.defaultBranch(repoID)
+
 	// Use services with RepoStore
 	branches, _ := s.branchSvc.ListBranches(repoID)
-	commits, _ := s.commitSvc.ListCommits(repoID, "", 100)
-
-	currentBranch := ""
-	if len(branches) > 0 {
-		// Try to get current branch from metadata
-		meta, err := s.metaStore.GetRepo(repoID)
-		if err == nil {
-			currentBranch = meta.CurrentBranch
-		}
+	commits, _ := s.commitSvc.ListCommits(ctx, repoID, defaultBranch, 100)
+	if err := ctx.Err(); err != nil {
+		return RepoListItem{}, err
 	}
 
+	currentBranch := s.currentBranch(repoID)
+
 	return RepoListItem{
 		ID:            repoID,
 		Name:          filepath.Base(repoID),
 		CurrentBranch: currentBranch,
+		DefaultBranch: defaultBranch,
 		BranchCount:   len(branches),
 		CommitCount:   len(commits),
 	}, nil
 }
 
-// LoadRepo loads a full repository with all details
-func (s *Server) LoadRepo(repoPath, repoID string) (Repository, error) {
-	// Use services with RepoStore
-	branches, _ := s.branchSvc.ListBranches(repoID)
-	commits, _ := s.commitSvc.ListCommits(repoID, "", 100)
+// currentBranch returns the branch HEAD of repoID is on, "" if it is detached.
+// HEAD is the source of truth, since the CLI moves it without touching the
+// registry; the registry's copy is refreshed from it, and only returned if
+// the repository can't be read.
+func (s *Server) currentBranch(repoID string) string {
+	repoStore, err := storage.NewRepoStore(s.repoBase, repoID)
+	if err == nil {
+		defer repoStore.Close()
+		if branch, ok := s.headBranch(repoStore); ok {
+			return branch
+		}
+	}
+	if meta, err := s.metaStore.GetRepo(repoID); err == nil {
+		return meta.CurrentBranch
+	}
+	return ""
+}
+
+// headBranch reads the branch HEAD is on from repoStore, "" if it is
+// detached, and refreshes the copy in the registry if it has drifted. It
+// returns false if HEAD can't be read.
+func (s *Server) headBranch(repoStore *storage.RepoStore) (string, bool) {
+	_, branch, err := repostorage.ResolveHead(repoStore)
+	if err != nil {
+		return "", false
+	}
+	repoID := repoStore.RepoID()
+	if meta, err := s.metaStore.GetRepo(repoID); err == nil && meta.CurrentBranch != branch {
+		if err := s.metaStore.SetCurrentBranch(repoID, branch); err != nil {
+			log.Printf("Warning: failed to refresh current branch of %s: %v", repoID, err)
+		}
+	}
+	return branch, true
+}
+
+// defaultBranch reads a repo's default branch, or "" if the repo can't be opened
+func (s *Server) defaultBranch(repoID string) string {
+	repoStore, err := storage.NewRepoStore(s.repoBase, repoID)
+	if err != nil {
+		return ""
+	}
+	defer repoStore.Close()
+
+	return repostorage.ReadDefaultBranchFromStore(repoStore)
+}
+
+// LoadRepo loads a full repository with all details. Branches, commits and
+// the default branch are read from one snapshot of the repo's store, so a
+// write landing between those reads can't produce a mixed view. It fails with
+// ctx's error if ctx is done before the commits are listed.
+func (s *Server) LoadRepo(ctx context.Context, repoPath, repoID string) (Repository, error) {
+	repoStore, err := storage.NewRepoStore(s.repoBase, repoID)
+	if err != nil {
+		return Repository{}, err
+	}
+	snapshot := repoStore.Snapshot()
+	repoStore.Close()
+
+	branches, _ := s.branchSvc.ListBranchesFromStore(snapshot)
+	commits, _ := s.commitSvc.ListCommitsFromStore(ctx, snapshot, "", 100)
+	if err := ctx.Err(); err != nil {
+		return Repository{}, err
+	}
 	issues, _ := s.LoadIssues(repoID)
 
-	// Get current branch from metadata
-	currentBranch := ""
-	meta, err := s.metaStore.GetRepo(repoID)
-	if err == nil {
-		currentBranch = meta.CurrentBranch
+	currentBranch, ok := s.headBranch(snapshot)
+	if !ok {
+		if meta, err := s.metaStore.GetRepo(repoID); err == nil {
+			currentBranch = meta.CurrentBranch
+		}
 	}
 
 	// Convert branches to HTTP types
 	httpBranches := make([]Branch, len(branches))
 	for i, b := range branches {
 		httpBranches[i] = Branch{
-			Name:      b.Name,
-			CreatedAt: b.CreatedAt,
+			Name:        b.Name,
+			CreatedAt:   b.CreatedAt,
+			TipCommitID: b.TipCommitID,
+			TipMessage:  b.TipMessage,
+			TipDate:     b.TipDate,
 		}
 	}
 
 	// Convert commits to HTTP types
 	httpCommits := make([]Commit, len(commits))
 	for i, c := range commits {
-		httpCommits[i] = Commit{
-			Hash:    c.Hash,
-			Message: c.Message,
-			Author:  c.Author,
-			Date:    c.Date,
-		}
+		httpCommits[i] = toHTTPCommit(c)
 	}
 
 	// Convert issues to []interface{} for Repository struct
@@ -114,6 +275,7 @@ func (s *Server) LoadRepo(repoPath, repoID string) (Repository, error) {
 		ID:            repoID,
 		Name:          filepath.Base(repoID),
 		CurrentBranch: currentBranch,
+		DefaultBranch: repostorage.ReadDefaultBranchFromStore(snapshot),
 		Branches:      httpBranches,
 		Commits:       httpCommits,
 		Issues:        issuesInterface,
@@ -140,11 +302,62 @@ func (s *Server) LoadIssues(repoID string) ([]Issue, error) {
 		return nil, fmt.Errorf("failed to unmarshal issues: %w", err)
 	}
 
+	// Lists are sent as [] rather than null, including issues stored before
+	// labels were always set
+	if issues == nil {
+		issues = []Issue{}
+	}
+	for i := range issues {
+		if issues[i].Labels == nil {
+			issues[i].Labels = []Label{}
+		}
+		// Issues stored before timestamps were normalized may carry a local
+		// offset and fractional seconds
+		issues[i].CreatedAt = timefmt.UTC(issues[i].CreatedAt)
+		if issues[i].ClosedAt != nil {
+			closedAt := timefmt.UTC(*issues[i].ClosedAt)
+			issues[i].ClosedAt = &closedAt
+		}
+	}
+
 	return issues, nil
 }
 
 // SaveIssue saves an issue to a repository
 func (s *Server) SaveIssue(repoID string, issue Issue) error {
+	s.issuesMu.Lock()
+	defer s.issuesMu.Unlock()
+
+	return s.appendIssue(repoID, issue)
+}
+
+// CreateIssue assigns the next issue number to issue and saves it at version 1
+func (s *Server) CreateIssue(repoID string, issue Issue) (Issue, error) {
+	s.issuesMu.Lock()
+	defer s.issuesMu.Unlock()
+
+	number, err := s.metaStore.NextIssueNumber(repoID)
+	if err != nil {
+		return Issue{}, err
+	}
+	issue.Number = number
+	issue.ID = strconv.Itoa(number)
+	issue.Version = 1
+
+	if err := s.appendIssue(repoID, issue); err != nil {
+		return Issue{}, err
+	}
+	return issue, nil
+}
+
+// issueMatches reports whether id refers to issue. New issues are addressed by
+// number, with or without a leading '#'; older issues by their original ID.
+func issueMatches(issue Issue, id string) bool {
+	return issue.ID == id || issue.ID == strings.TrimPrefix(id, "#")
+}
+
+// appendIssue adds an issue to the stored list; callers hold issuesMu
+func (s *Server) appendIssue(repoID string, issue Issue) error {
 	// Load existing issues
 	issues, err := s.LoadIssues(repoID)
 	if err != nil {
@@ -154,6 +367,11 @@ func (s *Server) SaveIssue(repoID string, issue Issue) error {
 	// Add new issue
 	issues = append(issues, issue)
 
+	return s.storeIssues(repoID, issues)
+}
+
+// storeIssues writes a repo's full issue list; callers hold issuesMu
+func (s *Server) storeIssues(repoID string, issues []Issue) error {
 	// Save back using metadata store's db
 	db := s.metaStore.GetDB()
 	if db == nil {
@@ -173,49 +391,11 @@ func (s *Server) SaveIssue(repoID string, issue Issue) error {
 	return nil
 }
 
-// IsAncestorFromStore checks if commitA is an ancestor of commitB using RepoStore
+// IsAncestorFromStore reports whether commitA is commitB or one of its
+// ancestors, following both parents of merge commits
 func (s *Server) IsAncestorFromStore(repoStore *storage.RepoStore, commitA, commitB int) bool {
-	// If they're the same, it's trivially an ancestor
-	if commitA == commitB {
-		return true
-	}
-
-	// Walk backwards from commitB following parent pointers
-	// If we reach commitA, then commitA is an ancestor of commitB
-	visited := make(map[int]bool)
-	queue := []int{commitB}
-	maxDepth := 1000 // Safety limit to prevent infinite loops
-	depth := 0
-
-	for len(queue) > 0 && depth < maxDepth {
-		current := queue[0]
-		queue = queue[1:]
-
-		if visited[current] {
-			continue
-		}
-		visited[current] = true
-		depth++
-
-		if current == commitA {
-			return true
-		}
-
-		// Read commit and add parents to queue
-		commit, err := repostorage.ReadCommitObjectFromStore(repoStore, current)
-		if err != nil {
-			// If we can't read the commit, stop searching
-			break
-		}
-
-		if commit.Parent != nil {
-			queue = append(queue, *commit.Parent)
-		}
-		// Note: We only follow Parent, not Parent2, for fast-forward detection
-		// Parent2 would be from a previous merge, which breaks the linear history
-	}
-
-	return false
+	isAncestor, err := repostorage.IsAncestor(repoStore, commitA, commitB)
+	return err == nil && isAncestor
 }
 
 // RespondJSON is a helper to send JSON responses
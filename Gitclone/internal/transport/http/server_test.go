@@ -0,0 +1,1806 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gitclone/internal/infra/storage"
+	"gitclone/internal/metadata"
+	repostorage "gitclone/internal/storage"
+)
+
+// testServer runs the full router over a temp repo base and metadata store
+type testServer struct {
+	t      *testing.T
+	server *Server
+	url    string
+}
+
+// newTestServer starts a Server on an httptest listener; call the returned
+// func to shut it down and remove its data
+func newTestServer(t *testing.T) (*testServer, func()) {
+	t.Helper()
+	return newConfiguredTestServer(t, nil)
+}
+
+// newConfiguredTestServer is newTestServer with configure, if not nil,
+// applied to the Server before its router is built
+func newConfiguredTestServer(t *testing.T, configure func(*Server)) (*testServer, func()) {
+	t.Helper()
+	tmpDir, err := os.MkdirTemp("", "gitstore-transport-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+
+	repoBase := filepath.Join(tmpDir, "repos")
+	if err := os.MkdirAll(repoBase, 0755); err != nil {
+		t.Fatalf("Failed to create repo base: %v", err)
+	}
+
+	metaStore, err := metadata.NewStore(filepath.Join(tmpDir, "db"))
+	if err != nil {
+		t.Fatalf("Failed to create metadata store: %v", err)
+	}
+
+	server := NewServer(repoBase, metaStore)
+	if configure != nil {
+		configure(server)
+	}
+	ts := httptest.NewServer(NewRouter(server))
+	return &testServer{t: t, server: server, url: ts.URL}, func() {
+		ts.Close()
+		metaStore.Close()
+		os.RemoveAll(tmpDir)
+	}
+}
+
+// do sends a request with an optional JSON body and returns the status and
+// decodes the response into out when out is non-nil
+func (ts *testServer) do(method, path string, body interface{}, out interface{}) int {
+	ts.t.Helper()
+	status, err := ts.send(method, path, body, out)
+	if err != nil {
+		ts.t.Fatalf("%v", err)
+	}
+	return status
+}
+
+// send is do without failing the test, for use from other goroutines
+func (ts *testServer) send(method, path string, body interface{}, out interface{}) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode request body: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, ts.url+path, reader)
+	if err != nil {
+		return 0, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("%s %s failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("%s %s: failed to decode response: %w", method, path, err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// expect sends a request and fails the test unless it returns want
+func (ts *testServer) expect(want int, method, path string, body interface{}, out interface{}) {
+	ts.t.Helper()
+	if got := ts.do(method, path, body, out); got != want {
+		ts.t.Fatalf("%s %s: expected %d, got %d", method, path, want, got)
+	}
+}
+
+// commitFile writes, stages and commits one file through the API
+func (ts *testServer) commitFile(repoID, path, content, message string) {
+	ts.t.Helper()
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/"+repoID+"/files", FileRequest{Path: path, Content: content}, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/"+repoID+"/add", AddRequest{Path: path}, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/"+repoID+"/commit", CommitRequest{Message: message}, nil)
+}
+
+// refs returns the repo's refs as reported by the API
+func (ts *testServer) refs(repoID string) map[string]string {
+	ts.t.Helper()
+	var refs map[string]string
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/"+repoID+"/refs", nil, &refs)
+	return refs
+}
+
+// TestCreateCommitPushList drives create → add → commit → push → list commits
+func TestCreateCommitPushList(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	var created RepoListItem
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, &created)
+	if created.ID != "demo" || created.CurrentBranch != "master" {
+		t.Fatalf("Unexpected created repo: %+v", created)
+	}
+
+	ts.commitFile("demo", "README.md", "# demo", "Initial commit")
+
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/files", FileRequest{Path: "main.go", Content: "package main\n\nfunc main() {}\n"}, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/add", AddRequest{Path: "main.go"}, nil)
+	var committed CommitResponse
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/commit", CommitRequest{Message: "Add main"}, &committed)
+	if committed.FilesChanged != 1 || committed.Insertions != 3 || committed.Deletions != 0 {
+		t.Errorf("Unexpected commit stats: %+v", committed)
+	}
+
+	// Nothing is listed until pushed
+	var commits []Commit
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/commits", nil, &commits)
+	if len(commits) != 0 {
+		t.Fatalf("Expected no pushed commits before push, got %d", len(commits))
+	}
+
+	var pushed PushResponse
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/push", PushRequest{Remote: "origin", Branch: "master"}, &pushed)
+	if pushed.CommitsPushed != 2 || len(pushed.Commits) != 2 || pushed.Commits[0] != committed.Hash {
+		t.Errorf("Unexpected push response: %+v", pushed)
+	}
+
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/commits", nil, &commits)
+	if len(commits) != 2 || commits[0].Message != "Add main" || commits[1].Message != "Initial commit" {
+		t.Fatalf("Unexpected commits after push: %+v", commits)
+	}
+
+	var tree []TreeEntry
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/tree?recursive=true", nil, &tree)
+	if len(tree) != 2 || tree[0].Path != "README.md" || tree[1].Path != "main.go" {
+		t.Errorf("Unexpected tree: %+v", tree)
+	}
+}
+
+// TestBranchAndMerge drives branch → commit → merge and checks that a
+// fast-forward merge moves the branch instead of creating a merge commit, and
+// that diverged branches are refused
+func TestBranchAndMerge(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	ts.commitFile("demo", "a.txt", "a", "Add a")
+
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/checkout", CheckoutRequest{Branch: "feature"}, nil)
+	ts.commitFile("demo", "b.txt", "b", "Add b")
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/checkout", CheckoutRequest{Branch: "master"}, nil)
+
+	var merged map[string]string
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/merge", MergeRequest{Branch: "feature"}, &merged)
+	if merged["type"] != "fast-forward" {
+		t.Errorf("Expected fast-forward merge, got %v", merged)
+	}
+	refs := ts.refs("demo")
+	if refs["refs/heads/master"] != refs["refs/heads/feature"] {
+		t.Fatalf("Expected master to fast-forward to feature (%s), got %s", refs["refs/heads/feature"], refs["refs/heads/master"])
+	}
+
+	// Merging again changes nothing
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/merge", MergeRequest{Branch: "feature"}, &merged)
+	if merged["type"] != "up-to-date" {
+		t.Errorf("Expected up-to-date, got %v", merged)
+	}
+
+	// Diverge the branches: a fast-forward is no longer possible
+	ts.commitFile("demo", "c.txt", "c", "Add c on master")
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/checkout", CheckoutRequest{Branch: "feature"}, nil)
+	ts.commitFile("demo", "d.txt", "d", "Add d on feature")
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/checkout", CheckoutRequest{Branch: "master"}, nil)
+
+	before := ts.refs("demo")["refs/heads/master"]
+	ts.expect(http.StatusConflict, http.MethodPost, "/api/repos/demo/merge", MergeRequest{Branch: "feature"}, nil)
+	if after := ts.refs("demo")["refs/heads/master"]; after != before {
+		t.Errorf("Expected refused merge to leave master at %s, got %s", before, after)
+	}
+}
+
+// TestMergeNoFastForward checks that with merge.ff=false a merge that could
+// fast-forward creates a merge commit with both tips as parents and the other
+// branch's tree, so a file it deleted stays deleted
+func TestMergeNoFastForward(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	ts.commitFile("demo", "a.txt", "a", "Add a")
+	ts.commitFile("demo", "old.txt", "old", "Add old")
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/checkout", CheckoutRequest{Branch: "feature"}, nil)
+	ts.commitFile("demo", "b.txt", "b", "Add b")
+	if err := os.Remove(filepath.Join(ts.server.repoBase, "demo", "old.txt")); err != nil {
+		t.Fatalf("Failed to delete old.txt: %v", err)
+	}
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/add", AddRequest{Path: "old.txt"}, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/commit", CommitRequest{Message: "Drop old"}, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/checkout", CheckoutRequest{Branch: "master"}, nil)
+
+	repoStore, err := storage.NewRepoStore(ts.server.repoBase, "demo")
+	if err != nil {
+		t.Fatalf("Failed to open repo: %v", err)
+	}
+	batch := repoStore.NewWriteBatch()
+	if err := repostorage.WriteConfigToBatch(batch, "merge.ff", repostorage.MergeFFNever); err != nil {
+		t.Fatalf("Failed to set merge.ff: %v", err)
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("Failed to commit batch: %v", err)
+	}
+	repoStore.Close()
+
+	before := ts.refs("demo")
+	body, _ := json.Marshal(MergeRequest{Branch: "feature"})
+	req, err := http.NewRequest(http.MethodPost, ts.url+"/api/repos/demo/merge", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to build request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Actor", "alice")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST merge failed: %v", err)
+	}
+	var merged map[string]string
+	err = json.NewDecoder(resp.Body).Decode(&merged)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST merge: status %d, %v", resp.StatusCode, err)
+	}
+	if merged["type"] != "merge" {
+		t.Fatalf("Expected a merge commit, got %v", merged)
+	}
+	after := ts.refs("demo")
+	if after["refs/heads/master"] != merged["hash"] || after["refs/heads/master"] == before["refs/heads/feature"] {
+		t.Fatalf("Expected master at the new merge commit %s, got %s", merged["hash"], after["refs/heads/master"])
+	}
+	var tree []TreeEntry
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/tree?recursive=true&commit="+merged["hash"], nil, &tree)
+	paths := make(map[string]bool)
+	for _, entry := range tree {
+		paths[entry.Path] = true
+	}
+	if !paths["a.txt"] || !paths["b.txt"] || paths["old.txt"] {
+		t.Errorf("Expected the merge tree to be feature's, without old.txt, got %+v", tree)
+	}
+
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/push", PushRequest{Remote: "origin", Branch: "master"}, nil)
+	var graph GraphResponse
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/graph?branch=master", nil, &graph)
+	parents := 0
+	for _, edge := range graph.Edges {
+		if edge.To == merged["hash"] {
+			parents++
+		}
+	}
+	if parents != 2 {
+		t.Errorf("Expected the merge commit to have two parents, got graph %+v", graph)
+	}
+	var list []Commit
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/commits?branch=master&limit=1", nil, &list)
+	if len(list) != 1 || list[0].Author != "alice" || list[0].Committer != "alice" || list[0].CommitterDate == "" {
+		t.Errorf("Expected the merge commit authored and committed by the actor alice, got %+v", list)
+	}
+}
+
+// TestMergeShowsInCommits checks that after a merge and push, the commit
+// brought in from the other branch is the tip of the branch's commit list
+func TestMergeShowsInCommits(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	ts.commitFile("demo", "a.txt", "a", "Add a")
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/push", PushRequest{Remote: "origin", Branch: "master"}, nil)
+
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/checkout", CheckoutRequest{Branch: "feature"}, nil)
+	ts.commitFile("demo", "b.txt", "b", "Add b on feature")
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/checkout", CheckoutRequest{Branch: "master"}, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/merge", MergeRequest{Branch: "feature"}, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/push", PushRequest{Remote: "origin", Branch: "master"}, nil)
+
+	var commits []Commit
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/commits?branch=master", nil, &commits)
+	if len(commits) != 2 || commits[0].Message != "Add b on feature" || commits[1].Message != "Add a" {
+		t.Fatalf("Expected the merged commit on top of master's history, got %+v", commits)
+	}
+	if refs := ts.refs("demo"); refs["refs/remotes/origin/master"] != refs["refs/heads/feature"] {
+		t.Errorf("Expected origin/master at feature's tip %s, got %s", refs["refs/heads/feature"], refs["refs/remotes/origin/master"])
+	}
+}
+
+// TestTransportErrors covers unknown repos, directories that aren't repos,
+// empty commits and empty pushes
+func TestTransportErrors(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	for _, path := range []string{"/api/repos/missing/commits", "/api/repos/missing/branches", "/api/repos/missing/refs"} {
+		var errResp ErrorResponse
+		ts.expect(http.StatusNotFound, http.MethodGet, path, nil, &errResp)
+		if errResp.Error == "" {
+			t.Errorf("GET %s: expected an error message", path)
+		}
+	}
+	ts.expect(http.StatusNotFound, http.MethodPost, "/api/repos/missing/commit", CommitRequest{Message: "x"}, nil)
+
+	// A directory without .gitclone/ exists but can't be served
+	if err := os.MkdirAll(filepath.Join(ts.server.repoBase, "plain"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	for _, path := range []string{"/api/repos/plain", "/api/repos/plain/commits", "/api/repos/plain/merge-base?a=1&b=1"} {
+		var errResp ErrorResponse
+		ts.expect(http.StatusUnprocessableEntity, http.MethodGet, path, nil, &errResp)
+		if !strings.Contains(errResp.Error, "not a gitclone repository") {
+			t.Errorf("GET %s: expected a not-a-repository error, got %q", path, errResp.Error)
+		}
+	}
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	var errResp ErrorResponse
+	ts.expect(http.StatusBadRequest, http.MethodPost, "/api/repos/demo/commit", CommitRequest{Message: "nothing staged"}, &errResp)
+	if errResp.Error == "" {
+		t.Errorf("Expected an error message for an empty commit")
+	}
+	ts.expect(http.StatusBadRequest, http.MethodPost, "/api/repos/demo/push", PushRequest{Remote: "origin", Branch: "master"}, nil)
+}
+
+// TestNamespacedRepo creates and operates on an org/name repo, addressed in
+// URLs as a single escaped segment
+func TestNamespacedRepo(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	const repoID = "acme/demo"
+	escaped := url.PathEscape(repoID)
+
+	var created RepoListItem
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: repoID}, &created)
+	if created.ID != repoID {
+		t.Fatalf("Expected ID %q, got %+v", repoID, created)
+	}
+	if _, err := os.Stat(filepath.Join(ts.server.RepoBase(), "acme", "demo", ".gitclone")); err != nil {
+		t.Fatalf("Expected repo stored under its namespace: %v", err)
+	}
+
+	ts.commitFile(escaped, "README.md", "# demo", "Initial commit")
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/"+escaped+"/push", PushRequest{Remote: "origin", Branch: "master"}, nil)
+
+	var commits []Commit
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/"+escaped+"/commits", nil, &commits)
+	if len(commits) != 1 || commits[0].Message != "Initial commit" {
+		t.Fatalf("Unexpected commits: %+v", commits)
+	}
+
+	var repo Repository
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/"+escaped, nil, &repo)
+	if repo.ID != repoID || repo.Name != "demo" {
+		t.Errorf("Unexpected repo: id=%q name=%q", repo.ID, repo.Name)
+	}
+
+	var list []RepoListItem
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos", nil, &list)
+	if len(list) != 1 || list[0].ID != repoID || list[0].Missing {
+		t.Errorf("Unexpected repo list: %+v", list)
+	}
+
+	// An unescaped slash is not a repo ID; the second segment is an action
+	ts.expect(http.StatusNotFound, http.MethodGet, "/api/repos/acme/demo", nil, nil)
+
+	// A namespace can't also be a repository, in either order
+	ts.expect(http.StatusConflict, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "acme"}, nil)
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "solo"}, nil)
+	ts.expect(http.StatusConflict, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "solo/nested"}, nil)
+	ts.expect(http.StatusBadRequest, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "a/b/c"}, nil)
+}
+
+// TestEmptyRefBranch covers branches whose ref is empty: they are listed,
+// have no commits, stay empty on checkout, and take a parentless first commit
+func TestEmptyRefBranch(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/checkout", CheckoutRequest{Branch: "feature"}, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/checkout", CheckoutRequest{Branch: "master"}, nil)
+
+	var branches []Branch
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/branches", nil, &branches)
+	if len(branches) != 2 {
+		t.Fatalf("Expected master and feature to be listed, got %+v", branches)
+	}
+	for _, b := range branches {
+		if b.TipCommitID != nil {
+			t.Errorf("Expected no tip on empty branch %s, got %d", b.Name, *b.TipCommitID)
+		}
+	}
+	var commits []Commit
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/commits?branch=feature", nil, &commits)
+	if len(commits) != 0 {
+		t.Fatalf("Expected no commits on an empty branch, got %+v", commits)
+	}
+
+	// master moves on; checking out feature must not copy master's tip into it
+	ts.commitFile("demo", "a.txt", "a", "Add a on master")
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/checkout", CheckoutRequest{Branch: "feature"}, nil)
+	if refs := ts.refs("demo"); refs["refs/heads/feature"] != "" {
+		t.Fatalf("Expected feature to stay empty, got %q", refs["refs/heads/feature"])
+	}
+
+	ts.commitFile("demo", "b.txt", "b", "First commit on feature")
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/push", PushRequest{Remote: "origin", Branch: "feature"}, nil)
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/commits?branch=feature", nil, &commits)
+	if len(commits) != 1 || commits[0].Message != "First commit on feature" {
+		t.Errorf("Expected a single parentless commit on feature, got %+v", commits)
+	}
+}
+
+// TestDefaultBranch sets the default branch to main and checks that it is
+// reported, survives checkouts, and is the branch repo summaries describe
+func TestDefaultBranch(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	var created RepoListItem
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, &created)
+	if created.DefaultBranch != "master" {
+		t.Fatalf("Expected new repo to default to master, got %q", created.DefaultBranch)
+	}
+
+	ts.commitFile("demo", "a.txt", "a", "Add a")
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/push", PushRequest{Remote: "origin", Branch: "master"}, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/checkout", CheckoutRequest{Branch: "main"}, nil)
+	ts.commitFile("demo", "b.txt", "b", "Add b on main")
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/push", PushRequest{Remote: "origin", Branch: "main"}, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/checkout", CheckoutRequest{Branch: "master"}, nil)
+
+	ts.expect(http.StatusNotFound, http.MethodPut, "/api/repos/demo/default-branch", DefaultBranchRequest{Branch: "missing"}, nil)
+	ts.expect(http.StatusBadRequest, http.MethodPut, "/api/repos/demo/default-branch", DefaultBranchRequest{}, nil)
+	ts.expect(http.StatusOK, http.MethodPut, "/api/repos/demo/default-branch", DefaultBranchRequest{Branch: "main"}, nil)
+
+	var repo Repository
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo", nil, &repo)
+	if repo.DefaultBranch != "main" || repo.CurrentBranch != "master" {
+		t.Errorf("Expected default main and current master, got default %q current %q", repo.DefaultBranch, repo.CurrentBranch)
+	}
+
+	var list []RepoListItem
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos", nil, &list)
+	if len(list) != 1 || list[0].DefaultBranch != "main" {
+		t.Errorf("Expected the listing to report default branch main, got %+v", list)
+	}
+
+	summary, err := ts.server.LoadRepoSummary(context.Background(), "", "demo")
+	if err != nil {
+		t.Fatalf("Failed to load repo summary: %v", err)
+	}
+	if summary.DefaultBranch != "main" || summary.CommitCount != 2 {
+		t.Errorf("Expected the summary to count main's 2 commits, got %+v", summary)
+	}
+}
+
+// TestCreateWithInitialBranch creates a repo on main and checks HEAD, its
+// refs and the default branch use it and that commits land on it
+func TestCreateWithInitialBranch(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusBadRequest, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "bad", InitialBranch: "a..b"}, nil)
+
+	var created RepoListItem
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo", InitialBranch: "main"}, &created)
+	if created.CurrentBranch != "main" || created.DefaultBranch != "main" {
+		t.Fatalf("Expected current and default branch main, got %+v", created)
+	}
+
+	refs := ts.refs("demo")
+	if _, ok := refs["refs/heads/main"]; !ok {
+		t.Fatalf("Expected refs/heads/main, got %v", refs)
+	}
+	if _, ok := refs["refs/heads/master"]; ok {
+		t.Fatalf("Expected no master branch, got %v", refs)
+	}
+
+	ts.commitFile("demo", "a.txt", "a", "Add a")
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/push", PushRequest{Remote: "origin", Branch: "main"}, nil)
+	var commits []Commit
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/commits", nil, &commits)
+	if len(commits) != 1 || commits[0].Message != "Add a" {
+		t.Errorf("Expected the commit on main, got %+v", commits)
+	}
+}
+
+// TestPruneMissingRepos deletes one repo's folder, lists it as missing and
+// prunes it from the listing while the other repos stay, including one whose
+// folder is there but damaged
+func TestPruneMissingRepos(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "keep"}, nil)
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "gone"}, nil)
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "damaged"}, nil)
+	if err := os.RemoveAll(filepath.Join(ts.server.repoBase, "gone")); err != nil {
+		t.Fatalf("Failed to remove repo folder: %v", err)
+	}
+	if err := os.RemoveAll(filepath.Join(ts.server.repoBase, "damaged", ".gitclone")); err != nil {
+		t.Fatalf("Failed to remove .gitclone: %v", err)
+	}
+
+	var missing []RepoListItem
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos?missing=true", nil, &missing)
+	if len(missing) != 1 || missing[0].ID != "gone" || !missing[0].Missing {
+		t.Fatalf("Expected only gone listed as missing, got %+v", missing)
+	}
+
+	ts.expect(http.StatusMethodNotAllowed, http.MethodGet, "/api/repos/prune", nil, nil)
+	var pruned PruneResponse
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/prune", nil, &pruned)
+	if len(pruned.Pruned) != 1 || pruned.Pruned[0] != "gone" {
+		t.Errorf("Expected gone pruned, got %v", pruned.Pruned)
+	}
+
+	var repos []RepoListItem
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos", nil, &repos)
+	if len(repos) != 2 {
+		t.Errorf("Expected keep and damaged after prune, got %+v", repos)
+	}
+	for _, repo := range repos {
+		if repo.ID == "gone" || repo.Missing {
+			t.Errorf("Expected only present repos after prune, got %+v", repo)
+		}
+	}
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/prune", nil, &pruned)
+	if len(pruned.Pruned) != 0 {
+		t.Errorf("Expected nothing left to prune, got %v", pruned.Pruned)
+	}
+}
+
+// TestWriteFileRejectsUnsafePaths checks traversal, absolute and .gitclone
+// paths get a 400 from the files endpoint
+func TestWriteFileRejectsUnsafePaths(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	for _, path := range []string{"../other/file.txt", "/etc/passwd", ".gitclone/db/log"} {
+		ts.expect(http.StatusBadRequest, http.MethodPost, "/api/repos/demo/files", FileRequest{Path: path, Content: "x"}, nil)
+	}
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/files", FileRequest{Path: "src/main.go", Content: "x"}, nil)
+}
+
+// TestWriteFileRejectsSymlinks checks a write through a symlinked directory,
+// or onto a symlink, in the worktree is refused and leaves the target alone,
+// both one file at a time and in bulk
+func TestWriteFileRejectsSymlinks(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	outside := t.TempDir()
+	target := filepath.Join(outside, "target.txt")
+	if err := os.WriteFile(target, []byte("outside"), 0644); err != nil {
+		t.Fatalf("Failed to write target: %v", err)
+	}
+	repoPath := filepath.Join(ts.server.repoBase, "demo")
+	if err := os.Symlink(outside, filepath.Join(repoPath, "dirlink")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if err := os.Symlink(target, filepath.Join(repoPath, "filelink")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	ts.expect(http.StatusBadRequest, http.MethodPost, "/api/repos/demo/files", FileRequest{Path: "dirlink/x.txt", Content: "x"}, nil)
+	ts.expect(http.StatusBadRequest, http.MethodPost, "/api/repos/demo/files", FileRequest{Path: "filelink", Content: "x"}, nil)
+	var results []BulkFileResult
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/files/bulk", []FileRequest{{Path: "dirlink/y.txt", Content: "y"}}, &results)
+	if len(results) != 1 || results[0].OK {
+		t.Errorf("Expected the bulk write through a symlink refused, got %+v", results)
+	}
+
+	if data, _ := os.ReadFile(target); string(data) != "outside" {
+		t.Errorf("Expected the symlink target untouched, got %q", data)
+	}
+	for _, name := range []string{"x.txt", "y.txt"} {
+		if _, err := os.Stat(filepath.Join(outside, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected no %s written outside the repo, got %v", name, err)
+		}
+	}
+}
+
+// TestWriteFileAutoStage writes one file with autoStage and commits it without
+// a separate add, while a plain write stays unstaged
+func TestWriteFileAutoStage(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+
+	var resp FileResponse
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/files", FileRequest{Path: "plain.txt", Content: "plain"}, &resp)
+	if resp.Staged {
+		t.Errorf("Expected plain.txt unstaged, got %+v", resp)
+	}
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/files", FileRequest{Path: "a.txt", Content: "a", AutoStage: true}, &resp)
+	if !resp.Staged {
+		t.Errorf("Expected a.txt staged, got %+v", resp)
+	}
+
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/commit", CommitRequest{Message: "Add a"}, nil)
+	var tree []TreeEntry
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/tree", nil, &tree)
+	if len(tree) != 1 || tree[0].Path != "a.txt" {
+		t.Errorf("Expected only a.txt committed, got %+v", tree)
+	}
+}
+
+// TestWriteFilesBulk writes three files in one request: the one with an unsafe
+// path is rejected while the other two are written and staged
+func TestWriteFilesBulk(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+
+	var results []BulkFileResult
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/files/bulk", []FileRequest{
+		{Path: "a.txt", Content: "a", AutoStage: true},
+		{Path: "../escape.txt", Content: "x", AutoStage: true},
+		{Path: "dir/b.txt", Content: "b", AutoStage: true},
+	}, &results)
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %+v", results)
+	}
+	if !results[0].OK || !results[0].Staged || !results[2].OK || !results[2].Staged {
+		t.Errorf("Expected the valid paths written and staged, got %+v", results)
+	}
+	if results[1].OK || results[1].Error == "" {
+		t.Errorf("Expected ../escape.txt rejected, got %+v", results[1])
+	}
+
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/commit", CommitRequest{Message: "Add files"}, nil)
+	var tree []TreeEntry
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/tree?recursive=true", nil, &tree)
+	paths := map[string]bool{}
+	for _, e := range tree {
+		paths[e.Path] = true
+	}
+	if !paths["a.txt"] || !paths["dir/b.txt"] || paths["../escape.txt"] {
+		t.Errorf("Expected a.txt and dir/b.txt committed, got %+v", tree)
+	}
+
+	ts.expect(http.StatusBadRequest, http.MethodPost, "/api/repos/demo/files/bulk", []FileRequest{}, nil)
+}
+
+// TestEmptyListsAreArrays checks every list endpoint sends [] rather than null
+// for an empty repo, and an issue created without labels lists them as []
+func TestEmptyListsAreArrays(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+
+	for _, path := range []string{
+		"/api/repos?q=nothing",
+		"/api/repos?missing=true",
+		"/api/repos/demo/commits",
+		"/api/repos/demo/commits?order=date",
+		"/api/repos/demo/issues",
+		"/api/repos/demo/tree",
+		"/api/repos/demo/files/history?path=a.txt",
+	} {
+		var body json.RawMessage
+		ts.expect(http.StatusOK, http.MethodGet, path, nil, &body)
+		if string(body) != "[]" {
+			t.Errorf("GET %s: expected [], got %s", path, body)
+		}
+	}
+
+	var repo map[string]json.RawMessage
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo", nil, &repo)
+	for _, field := range []string{"commits", "issues"} {
+		if string(repo[field]) != "[]" {
+			t.Errorf("GET /api/repos/demo: expected %s to be [], got %s", field, repo[field])
+		}
+	}
+
+	var issue map[string]json.RawMessage
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos/demo/issues", CreateIssueRequest{Title: "No labels"}, &issue)
+	if string(issue["labels"]) != "[]" {
+		t.Errorf("Expected an issue without labels to have labels [], got %s", issue["labels"])
+	}
+	var issues []map[string]json.RawMessage
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/issues", nil, &issues)
+	if len(issues) != 1 || string(issues[0]["labels"]) != "[]" {
+		t.Errorf("Expected the listed issue to have labels [], got %v", issues)
+	}
+}
+
+// TestMergeBaseEndpoint checks GET /merge-base on diverged branches and its
+// errors
+func TestMergeBaseEndpoint(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	ts.commitFile("demo", "a.txt", "a", "Add a")
+	fork := ts.refs("demo")["refs/heads/master"]
+
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/checkout", CheckoutRequest{Branch: "feature"}, nil)
+	ts.commitFile("demo", "b.txt", "b", "Add b on feature")
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/checkout", CheckoutRequest{Branch: "master"}, nil)
+	ts.commitFile("demo", "c.txt", "c", "Add c on master")
+
+	refs := ts.refs("demo")
+	var resp MergeBaseResponse
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/merge-base?a="+refs["refs/heads/master"]+"&b="+refs["refs/heads/feature"], nil, &resp)
+	if resp.MergeBase == nil || *resp.MergeBase != fork {
+		t.Errorf("Expected merge base %s, got %v", fork, resp.MergeBase)
+	}
+
+	ts.expect(http.StatusBadRequest, http.MethodGet, "/api/repos/demo/merge-base?a="+fork, nil, nil)
+	ts.expect(http.StatusNotFound, http.MethodGet, "/api/repos/demo/merge-base?a="+fork+"&b=999", nil, nil)
+	ts.expect(http.StatusNotFound, http.MethodGet, "/api/repos/nope/merge-base?a=1&b=1", nil, nil)
+}
+
+// TestCommitBranchesEndpoint checks GET /commits/:id/branches for a commit
+// made before branching and for a feature-only commit
+func TestCommitBranchesEndpoint(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	ts.commitFile("demo", "a.txt", "a", "Add a")
+	shared := ts.refs("demo")["refs/heads/master"]
+
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/checkout", CheckoutRequest{Branch: "feature"}, nil)
+	ts.commitFile("demo", "b.txt", "b", "Add b on feature")
+	featureOnly := ts.refs("demo")["refs/heads/feature"]
+
+	var resp CommitBranchesResponse
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/commits/"+shared+"/branches", nil, &resp)
+	if strings.Join(resp.Branches, ",") != "master,feature" {
+		t.Errorf("Expected %s on master and feature, got %v", shared, resp.Branches)
+	}
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/commits/"+featureOnly+"/branches", nil, &resp)
+	if strings.Join(resp.Branches, ",") != "feature" {
+		t.Errorf("Expected %s only on feature, got %v", featureOnly, resp.Branches)
+	}
+
+	ts.expect(http.StatusBadRequest, http.MethodGet, "/api/repos/demo/commits/abc/branches", nil, nil)
+	ts.expect(http.StatusNotFound, http.MethodGet, "/api/repos/demo/commits/999/branches", nil, nil)
+	ts.expect(http.StatusNotFound, http.MethodGet, "/api/repos/nope/commits/1/branches", nil, nil)
+}
+
+// TestQuotas checks the repository count quota on create and the size quota
+// on file writes
+func TestQuotas(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+	ts.server.SetQuotas(Quotas{MaxRepos: 2, MaxRepoBytes: 64 * 1024})
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "one"}, nil)
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "two"}, nil)
+	ts.expect(http.StatusForbidden, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "three"}, nil)
+	if _, err := os.Stat(filepath.Join(ts.server.repoBase, "three")); !os.IsNotExist(err) {
+		t.Errorf("Expected no directory for the refused repo, got %v", err)
+	}
+
+	// Writes that would take a repo past MaxRepoBytes are refused
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/one/files", FileRequest{Path: "small.txt", Content: "small"}, nil)
+	ts.expect(http.StatusForbidden, http.MethodPost, "/api/repos/one/files", FileRequest{Path: "big.txt", Content: strings.Repeat("x", 64*1024)}, nil)
+}
+
+// TestMissingFlagKeepsUpdatedAt checks that a listing noticing a deleted repo
+// folder doesn't move the repo's updatedAt, while a push does
+func TestMissingFlagKeepsUpdatedAt(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "kept"}, nil)
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "gone"}, nil)
+	listed := func(id string) (RepoListItem, bool) {
+		var list []RepoListItem
+		ts.expect(http.StatusOK, http.MethodGet, "/api/repos", nil, &list)
+		for _, repo := range list {
+			if repo.ID == id {
+				return repo, true
+			}
+		}
+		return RepoListItem{}, false
+	}
+
+	before, _ := listed("gone")
+	if err := os.RemoveAll(filepath.Join(ts.server.repoBase, "gone")); err != nil {
+		t.Fatalf("Failed to remove repo folder: %v", err)
+	}
+	after, ok := listed("gone")
+	if !ok || !after.Missing {
+		t.Fatalf("Expected gone to be listed as missing, got %+v", after)
+	}
+	if !after.UpdatedAt.Equal(before.UpdatedAt) {
+		t.Errorf("Flagging gone missing moved updatedAt from %v to %v", before.UpdatedAt, after.UpdatedAt)
+	}
+
+	before, _ = listed("kept")
+	// Timestamps have one-second resolution
+	time.Sleep(time.Second)
+	ts.commitFile("kept", "a.txt", "a", "Add a")
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/kept/push", PushRequest{Remote: "origin", Branch: "master"}, nil)
+	if after, _ := listed("kept"); !after.UpdatedAt.After(before.UpdatedAt) {
+		t.Errorf("Expected a push to move updatedAt past %v, got %v", before.UpdatedAt, after.UpdatedAt)
+	}
+}
+
+// TestCurrentBranchFollowsHEAD moves HEAD the way the CLI does, behind the
+// registry's back: the repo, its summary and the listing report the new
+// branch, and the registry's cached copy catches up without moving updatedAt
+func TestCurrentBranchFollowsHEAD(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	ts.commitFile("demo", "a.txt", "a", "Add a")
+	before, err := ts.server.metaStore.GetRepo("demo")
+	if err != nil {
+		t.Fatalf("Failed to read metadata: %v", err)
+	}
+
+	// As `gitclone checkout feature` does in the repository directory
+	repoPath := filepath.Join(ts.server.repoBase, "demo")
+	options := repostorage.InitOptions{Bare: false}
+	if err := repostorage.EnsureHeadRefExists(repoPath, options, "feature"); err != nil {
+		t.Fatalf("Failed to create branch: %v", err)
+	}
+	if err := repostorage.WriteHEADBranch(repoPath, options, "feature"); err != nil {
+		t.Fatalf("Failed to move HEAD: %v", err)
+	}
+
+	var repo Repository
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo", nil, &repo)
+	if repo.CurrentBranch != "feature" {
+		t.Errorf("Expected the repo on feature, got %q", repo.CurrentBranch)
+	}
+	var list []RepoListItem
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos", nil, &list)
+	if len(list) != 1 || list[0].CurrentBranch != "feature" {
+		t.Errorf("Expected the listing to show feature, got %+v", list)
+	}
+	summary, err := ts.server.LoadRepoSummary(context.Background(), repoPath, "demo")
+	if err != nil || summary.CurrentBranch != "feature" {
+		t.Errorf("Expected the summary on feature, got %+v, %v", summary, err)
+	}
+
+	after, err := ts.server.metaStore.GetRepo("demo")
+	if err != nil {
+		t.Fatalf("Failed to read metadata: %v", err)
+	}
+	if after.CurrentBranch != "feature" {
+		t.Errorf("Expected the cached current branch refreshed to feature, got %q", after.CurrentBranch)
+	}
+	if !after.UpdatedAt.Equal(before.UpdatedAt) {
+		t.Errorf("Refreshing the current branch moved updatedAt from %v to %v", before.UpdatedAt, after.UpdatedAt)
+	}
+}
+
+// TestForcePushEndpoint pushes over a diverged origin/master: 409 without
+// ?force=true, then 200 with it
+func TestForcePushEndpoint(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	ts.commitFile("demo", "a.txt", "a\n", "Initial commit")
+	ts.commitFile("demo", "b.txt", "b\n", "Add b")
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/push", PushRequest{Remote: "origin", Branch: "master"}, nil)
+
+	// Rewriting the pushed tip diverges master from origin/master
+	if _, err := ts.server.commitSvc.AmendCommit("demo", "Add b, reworded", true); err != nil {
+		t.Fatalf("Failed to amend: %v", err)
+	}
+
+	var errResp ErrorResponse
+	ts.expect(http.StatusConflict, http.MethodPost, "/api/repos/demo/push", PushRequest{Remote: "origin", Branch: "master"}, &errResp)
+	if !strings.Contains(errResp.Error, "non-fast-forward") {
+		t.Errorf("Expected a non-fast-forward error, got %q", errResp.Error)
+	}
+
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/push?force=true", PushRequest{Remote: "origin", Branch: "master"}, nil)
+	refs := ts.refs("demo")
+	if refs["refs/heads/master"] == "" || refs["refs/remotes/origin/master"] != refs["refs/heads/master"] {
+		t.Errorf("Expected origin/master to match master after a forced push, got %v", refs)
+	}
+}
+
+// TestBranchProtection protects master: force-pushing it and rolling back
+// its push are refused with 403 unless overridden, while a force-push of an
+// unprotected branch goes through
+func TestBranchProtection(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	push := func(status int, branch, query string) {
+		t.Helper()
+		ts.expect(status, http.MethodPost, "/api/repos/demo/push"+query, PushRequest{Remote: "origin", Branch: branch}, nil)
+	}
+	amend := func() {
+		t.Helper()
+		if _, err := ts.server.commitSvc.AmendCommit("demo", "Reworded", true); err != nil {
+			t.Fatalf("Failed to amend: %v", err)
+		}
+	}
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	ts.commitFile("demo", "a.txt", "a\n", "Initial commit")
+	push(http.StatusOK, "master", "")
+	ts.commitFile("demo", "b.txt", "b\n", "Add b")
+	push(http.StatusOK, "master", "")
+
+	var protection BranchProtection
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/branches/master/protection", nil, &protection)
+	if protection.Protected {
+		t.Fatalf("Expected master unprotected by default, got %+v", protection)
+	}
+	ts.expect(http.StatusOK, http.MethodPut, "/api/repos/demo/branches/master/protection", BranchProtection{Protected: true}, &protection)
+	if !protection.Protected || protection.Branch != "master" {
+		t.Fatalf("Expected master protected, got %+v", protection)
+	}
+	ts.expect(http.StatusNotFound, http.MethodPut, "/api/repos/demo/branches/nope/protection", BranchProtection{Protected: true}, nil)
+
+	// A fast-forward push of a protected branch is still allowed
+	ts.commitFile("demo", "c.txt", "c\n", "Add c")
+	push(http.StatusOK, "master", "")
+
+	amend()
+	pushed := ts.refs("demo")["refs/remotes/origin/master"]
+	push(http.StatusForbidden, "master", "?force=true")
+	ts.expect(http.StatusForbidden, http.MethodPost, "/api/repos/demo/push/rollback?branch=master", nil, nil)
+	if remote := ts.refs("demo")["refs/remotes/origin/master"]; remote != pushed {
+		t.Fatalf("Expected refused rewrites to leave origin/master at %s, got %s", pushed, remote)
+	}
+	push(http.StatusOK, "master", "?force=true&override=true")
+
+	// Unprotecting lifts the restriction
+	ts.expect(http.StatusOK, http.MethodPut, "/api/repos/demo/branches/master/protection", BranchProtection{Protected: false}, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/push/rollback?branch=master", nil, nil)
+
+	// An unprotected branch can be force-pushed
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/checkout", CheckoutRequest{Branch: "feature"}, nil)
+	ts.commitFile("demo", "d.txt", "d\n", "Add d")
+	push(http.StatusOK, "feature", "")
+	amend()
+	push(http.StatusOK, "feature", "?force=true")
+}
+
+// TestStagedDiff stages an edit of a committed file and a new file, leaves
+// another file unstaged, and checks the staged diff lists exactly the first two
+func TestStagedDiff(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+
+	// Before the first commit every staged file is new
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/files", FileRequest{Path: "a.txt", Content: "a\n", AutoStage: true}, nil)
+	var diff StagedDiffResponse
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/diff/staged", nil, &diff)
+	if strings.Join(diff.Added, ",") != "a.txt" || len(diff.Modified) != 0 || len(diff.Deleted) != 0 {
+		t.Fatalf("Expected a.txt added before the first commit, got %+v", diff)
+	}
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/commit", CommitRequest{Message: "Add a"}, nil)
+
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/diff/staged", nil, &diff)
+	if len(diff.Added)+len(diff.Modified)+len(diff.Deleted) != 0 {
+		t.Fatalf("Expected nothing staged after committing, got %+v", diff)
+	}
+
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/files", FileRequest{Path: "a.txt", Content: "a, edited\n", AutoStage: true}, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/files", FileRequest{Path: "dir/b.txt", Content: "b\n", AutoStage: true}, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/files", FileRequest{Path: "c.txt", Content: "unstaged\n"}, nil)
+
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/diff/staged", nil, &diff)
+	if strings.Join(diff.Added, ",") != "dir/b.txt" || strings.Join(diff.Modified, ",") != "a.txt" || len(diff.Deleted) != 0 {
+		t.Errorf("Expected dir/b.txt added and a.txt modified, got %+v", diff)
+	}
+	ts.expect(http.StatusNotFound, http.MethodGet, "/api/repos/nope/diff/staged", nil, nil)
+}
+
+// TestMergeMissingOrEmptyBranch merges a branch that doesn't exist (404, and
+// no ref is created for it) and one that exists without commits (400)
+func TestMergeMissingOrEmptyBranch(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/checkout", CheckoutRequest{Branch: "empty"}, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/checkout", CheckoutRequest{Branch: "master"}, nil)
+	ts.commitFile("demo", "a.txt", "a\n", "Initial commit")
+
+	ts.expect(http.StatusNotFound, http.MethodPost, "/api/repos/demo/merge", MergeRequest{Branch: "featrue"}, nil)
+	if _, ok := ts.refs("demo")["refs/heads/featrue"]; ok {
+		t.Errorf("Expected merging a missing branch not to create it")
+	}
+
+	var errResp ErrorResponse
+	ts.expect(http.StatusBadRequest, http.MethodPost, "/api/repos/demo/merge", MergeRequest{Branch: "empty"}, &errResp)
+	if !strings.Contains(errResp.Error, "has no commits") {
+		t.Errorf("Expected a no-commits error, got %q", errResp.Error)
+	}
+}
+
+// TestGraphEndpoint checks the graph of a pushed two-commit branch, and that
+// an unpushed repo's graph is empty rather than null
+func TestGraphEndpoint(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	var graph GraphResponse
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/graph", nil, &graph)
+	if graph.Nodes == nil || graph.Edges == nil || len(graph.Nodes) != 0 {
+		t.Fatalf("Expected an empty graph, got %+v", graph)
+	}
+
+	ts.commitFile("demo", "a.txt", "a\n", "Initial commit")
+	ts.commitFile("demo", "b.txt", "b\n", "Add b")
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/push", PushRequest{Remote: "origin", Branch: "master"}, nil)
+
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/graph?branch=master", nil, &graph)
+	if len(graph.Nodes) != 2 || graph.Nodes[0].Message != "Add b" || graph.Nodes[0].Branch != "master" {
+		t.Fatalf("Unexpected graph nodes: %+v", graph.Nodes)
+	}
+	if len(graph.Edges) != 1 || graph.Edges[0].From != graph.Nodes[1].ID || graph.Edges[0].To != graph.Nodes[0].ID {
+		t.Errorf("Expected one edge from the first commit to the second, got %+v", graph.Edges)
+	}
+
+	ts.expect(http.StatusNotFound, http.MethodGet, "/api/repos/missing/graph", nil, nil)
+}
+
+// TestValidateRepo checks the create dry run for an available name, a name
+// with invalid characters and a taken name, and that it creates nothing
+func TestValidateRepo(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "taken"}, nil)
+
+	var resp ValidateRepoResponse
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/validate", CreateRepoRequest{Name: "fresh"}, &resp)
+	if !resp.Valid || !resp.Available || resp.Error != "" {
+		t.Errorf("Expected fresh to be valid and available, got %+v", resp)
+	}
+	ts.expect(http.StatusNotFound, http.MethodGet, "/api/repos/fresh", nil, nil)
+
+	resp = ValidateRepoResponse{}
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/validate", CreateRepoRequest{Name: `bad\name`}, &resp)
+	if resp.Valid || resp.Available || !strings.Contains(resp.Error, "invalid characters") {
+		t.Errorf("Expected an invalid name to be rejected, got %+v", resp)
+	}
+
+	for _, name := range []string{"prune", "scan", "validate"} {
+		resp = ValidateRepoResponse{}
+		ts.expect(http.StatusOK, http.MethodPost, "/api/repos/validate", CreateRepoRequest{Name: name}, &resp)
+		if resp.Valid || resp.Available || !strings.Contains(resp.Error, "reserved") {
+			t.Errorf("Expected reserved name %s to be rejected, got %+v", name, resp)
+		}
+	}
+	ts.expect(http.StatusBadRequest, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "scan"}, nil)
+
+	resp = ValidateRepoResponse{}
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/validate", CreateRepoRequest{Name: "taken"}, &resp)
+	if !resp.Valid || resp.Available || !strings.Contains(resp.Error, "already exists") {
+		t.Errorf("Expected a taken name to be unavailable, got %+v", resp)
+	}
+}
+
+// TestHeadEndpoint checks GET /head against the commit list and count of a
+// pushed branch
+func TestHeadEndpoint(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	var head HeadResponse
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/head", nil, &head)
+	if head.Branch != "master" || head.TipCommitID != nil || head.CommitCount != 0 {
+		t.Fatalf("Expected an empty master, got %+v", head)
+	}
+
+	ts.commitFile("demo", "a.txt", "a\n", "Initial commit")
+	ts.commitFile("demo", "b.txt", "b\n", "Add b")
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/push", PushRequest{Remote: "origin", Branch: "master"}, nil)
+
+	var commits []Commit
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/commits?branch=master", nil, &commits)
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/head?branch=master", nil, &head)
+	if head.TipCommitID == nil || fmt.Sprint(*head.TipCommitID) != commits[0].Hash || head.TipMessage != "Add b" || head.TipDate != commits[0].Date {
+		t.Errorf("Expected head to match the first commit %+v, got %+v", commits[0], head)
+	}
+	if head.CommitCount != len(commits) {
+		t.Errorf("Expected commitCount %d, got %d", len(commits), head.CommitCount)
+	}
+
+	ts.expect(http.StatusNotFound, http.MethodGet, "/api/repos/nope/head", nil, nil)
+}
+
+// TestCommitsNDJSONStream verifies that ?stream=ndjson returns the same
+// commits as the JSON array, one object per line, honoring limit and branch
+func TestCommitsNDJSONStream(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	for i := 1; i <= 4; i++ {
+		ts.commitFile("demo", fmt.Sprintf("f%d.txt", i), "x", fmt.Sprintf("Commit %d", i))
+	}
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/push", PushRequest{Remote: "origin", Branch: "master"}, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/checkout", CheckoutRequest{Branch: "feature"}, nil)
+	ts.commitFile("demo", "g.txt", "y", "Feature commit")
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/push", PushRequest{Remote: "origin", Branch: "feature"}, nil)
+
+	stream := func(query string) []Commit {
+		t.Helper()
+		resp, err := http.Get(ts.url + "/api/repos/demo/commits?stream=ndjson&" + query)
+		if err != nil {
+			t.Fatalf("Stream request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", resp.StatusCode)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Errorf("Expected Content-Type application/x-ndjson, got %q", ct)
+		}
+
+		var commits []Commit
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			var commit Commit
+			if err := json.Unmarshal(scanner.Bytes(), &commit); err != nil {
+				t.Fatalf("Failed to parse line %q: %v", scanner.Text(), err)
+			}
+			commits = append(commits, commit)
+		}
+		if err := scanner.Err(); err != nil {
+			t.Fatalf("Failed to read stream: %v", err)
+		}
+		return commits
+	}
+
+	for _, query := range []string{"branch=master&limit=3", "branch=master&limit=50", "branch=feature&limit=2"} {
+		var want []Commit
+		ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/commits?"+query, nil, &want)
+		got := stream(query)
+		if len(got) != len(want) {
+			t.Fatalf("%s: expected %d streamed commits, got %d", query, len(want), len(got))
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s: commit %d: expected %+v, got %+v", query, i, want[i], got[i])
+			}
+		}
+	}
+	if got := stream("branch=feature&limit=2"); got[0].Message != "Feature commit" {
+		t.Errorf("Expected the feature tip first, got %q", got[0].Message)
+	}
+	if got := stream("branch=nothing"); len(got) != 0 {
+		t.Errorf("Expected an empty stream for an unpushed branch, got %d commits", len(got))
+	}
+}
+
+// TestPushRollbackEndpoint pushes twice, rolls the second push back and checks
+// that origin/master returns to the first push's tip; rolling back again is
+// refused because the first push created the remote branch
+func TestPushRollbackEndpoint(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	ts.commitFile("demo", "a.txt", "a", "Add a")
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/push", PushRequest{Remote: "origin", Branch: "master"}, nil)
+	first := ts.refs("demo")["refs/remotes/origin/master"]
+	ts.commitFile("demo", "b.txt", "b", "Add b")
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/push", PushRequest{Remote: "origin", Branch: "master"}, nil)
+	if second := ts.refs("demo")["refs/remotes/origin/master"]; second == first {
+		t.Fatalf("Expected the second push to move origin/master from %s", first)
+	}
+
+	var rolledBack PushRollbackResponse
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/push/rollback?branch=master", nil, &rolledBack)
+	if rolledBack.Hash != first {
+		t.Errorf("Expected rollback to %s, got %+v", first, rolledBack)
+	}
+	refs := ts.refs("demo")
+	if refs["refs/remotes/origin/master"] != first {
+		t.Errorf("Expected origin/master back at %s, got %s", first, refs["refs/remotes/origin/master"])
+	}
+	if refs["refs/heads/master"] == first {
+		t.Errorf("Expected the local branch to keep its commit")
+	}
+
+	var commits []Commit
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/commits?branch=master", nil, &commits)
+	if len(commits) != 1 || commits[0].Hash != first {
+		t.Errorf("Expected only the first push's commit listed, got %+v", commits)
+	}
+
+	ts.expect(http.StatusConflict, http.MethodPost, "/api/repos/demo/push/rollback?branch=master", nil, nil)
+	ts.expect(http.StatusNotFound, http.MethodPost, "/api/repos/nope/push/rollback?branch=master", nil, nil)
+	ts.expect(http.StatusMethodNotAllowed, http.MethodGet, "/api/repos/demo/push/rollback", nil, nil)
+}
+
+// TestTimestampsAreUTCRFC3339 runs the server in a non-UTC local zone and
+// checks that commit, branch, issue and repo timestamps all come back in the
+// same shape: RFC3339 in UTC, to the second
+func TestTimestampsAreUTCRFC3339(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("UTC+5:30", 5*3600+1800)
+	defer func() { time.Local = local }()
+
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	ts.commitFile("demo", "a.txt", "a", "Add a")
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/push", PushRequest{Remote: "origin", Branch: "master"}, nil)
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos/demo/issues", CreateIssueRequest{Title: "Dates"}, nil)
+	version := 1
+	ts.expect(http.StatusOK, http.MethodPatch, "/api/repos/demo/issues/1", UpdateIssueRequest{Status: "closed", Version: &version}, nil)
+
+	shape := regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}Z$`)
+	check := func(what string, object map[string]interface{}, fields ...string) {
+		t.Helper()
+		for _, field := range fields {
+			value, _ := object[field].(string)
+			if !shape.MatchString(value) {
+				t.Errorf("%s %s: expected an RFC3339 UTC timestamp, got %q", what, field, value)
+			}
+		}
+	}
+
+	var commits []map[string]interface{}
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/commits", nil, &commits)
+	var branches []map[string]interface{}
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/branches", nil, &branches)
+	var issues []map[string]interface{}
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/issues", nil, &issues)
+	var repos []map[string]interface{}
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos", nil, &repos)
+	var head map[string]interface{}
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/head", nil, &head)
+	if len(commits) == 0 || len(branches) == 0 || len(issues) == 0 || len(repos) == 0 {
+		t.Fatalf("Expected a commit, branch, issue and repo, got %d, %d, %d, %d", len(commits), len(branches), len(issues), len(repos))
+	}
+
+	check("commit", commits[0], "date", "committerDate")
+	check("branch", branches[0], "createdAt", "tipDate")
+	check("issue", issues[0], "createdAt", "closedAt")
+	check("repo", repos[0], "createdAt", "updatedAt", "lastUpdated")
+	check("head", head, "tipDate")
+}
+
+// TestScanRepos places repos on disk without metadata, one fresh and one
+// whose metadata was lost after a push, and checks that a scan lists both with
+// their live counts and that a second scan registers nothing
+func TestScanRepos(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "listed"}, nil)
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "org/lost"}, nil)
+	ts.commitFile("org%2Flost", "a.txt", "a", "Add a")
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/org%2Flost/push", PushRequest{Remote: "origin", Branch: "master"}, nil)
+	if err := ts.server.metaStore.DeleteRepo("org/lost"); err != nil {
+		t.Fatalf("Failed to drop metadata: %v", err)
+	}
+
+	freshPath := filepath.Join(ts.server.repoBase, "fresh")
+	if err := os.MkdirAll(freshPath, 0755); err != nil {
+		t.Fatalf("Failed to create repo dir: %v", err)
+	}
+	if err := repostorage.InitRepo(freshPath, repostorage.InitOptions{Bare: false, InitialBranch: "main"}); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+	// A plain directory is neither a repo nor a namespace holding one
+	if err := os.MkdirAll(filepath.Join(ts.server.repoBase, "notes", "drafts"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	listed := func() map[string]RepoListItem {
+		t.Helper()
+		var items []RepoListItem
+		ts.expect(http.StatusOK, http.MethodGet, "/api/repos", nil, &items)
+		byID := make(map[string]RepoListItem)
+		for _, item := range items {
+			byID[item.ID] = item
+		}
+		return byID
+	}
+	if before := listed(); len(before) != 1 {
+		t.Fatalf("Expected only the listed repo before scanning, got %v", before)
+	}
+
+	var scanned ScanResponse
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/scan", nil, &scanned)
+	if strings.Join(scanned.Registered, ",") != "fresh,org/lost" {
+		t.Errorf("Expected fresh and org/lost registered, got %v", scanned.Registered)
+	}
+	if scanned.Errors != 0 {
+		t.Errorf("Expected no unreadable entries, got %d", scanned.Errors)
+	}
+
+	after := listed()
+	if len(after) != 3 {
+		t.Fatalf("Expected three repos after scanning, got %v", after)
+	}
+	if lost := after["org/lost"]; lost.CommitCount != 1 || lost.BranchCount != 1 || lost.CurrentBranch != "master" {
+		t.Errorf("Expected org/lost with its pushed commit, got %+v", lost)
+	}
+	if fresh := after["fresh"]; fresh.CurrentBranch != "main" || fresh.CommitCount != 0 || fresh.Missing {
+		t.Errorf("Expected fresh on main with no commits, got %+v", fresh)
+	}
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/org%2Flost/commits", nil, nil)
+
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/scan", nil, &scanned)
+	if len(scanned.Registered) != 0 {
+		t.Errorf("Expected a second scan to register nothing, got %v", scanned.Registered)
+	}
+}
+
+// TestObjectsEndpoint checks that GET /objects lists one commit object per
+// commit for a request with the admin token, refuses requests without it,
+// whatever actor they claim, and isn't registered without a token
+func TestObjectsEndpoint(t *testing.T) {
+	ts, cleanup := newConfiguredTestServer(t, func(s *Server) {
+		s.SetAdminToken("s3cret")
+	})
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	ts.commitFile("demo", "a.txt", "a", "Add a")
+	ts.commitFile("demo", "b.txt", "b", "Add b")
+	ts.commitFile("demo", "a.txt", "a2", "Change a")
+
+	// Each of these sets a request's credentials
+	bearer := func(token string) func(*http.Request) {
+		return func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+token) }
+	}
+	basic := func(user, password string) func(*http.Request) {
+		return func(req *http.Request) { req.SetBasicAuth(user, password) }
+	}
+	actor := func(name string) func(*http.Request) {
+		return func(req *http.Request) { req.Header.Set("X-Actor", name) }
+	}
+	list := func(objectType string, auth func(*http.Request), want int) []Object {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, ts.url+"/api/repos/demo/objects?type="+objectType, nil)
+		if err != nil {
+			t.Fatalf("Failed to build request: %v", err)
+		}
+		auth(req)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET objects failed: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Fatalf("GET objects?type=%s: expected %d, got %d", objectType, want, resp.StatusCode)
+		}
+		var objects []Object
+		if want == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&objects); err != nil {
+				t.Fatalf("Failed to decode objects: %v", err)
+			}
+		}
+		return objects
+	}
+
+	commits := list("commit", bearer("s3cret"), http.StatusOK)
+	if len(commits) != 3 {
+		t.Fatalf("Expected 3 commit objects, got %+v", commits)
+	}
+	for _, object := range commits {
+		if !strings.HasPrefix(object.Key, "objects/commit/") || object.Size == 0 {
+			t.Errorf("Unexpected commit object %+v", object)
+		}
+	}
+	if blobs := list("blob", basic("root", "s3cret"), http.StatusOK); len(blobs) != 3 {
+		t.Errorf("Expected 3 blobs, got %+v", blobs)
+	}
+	list("ref", bearer("s3cret"), http.StatusBadRequest)
+	list("commit", func(*http.Request) {}, http.StatusForbidden)
+	list("commit", actor("root"), http.StatusForbidden)
+	list("commit", basic("root", "guess"), http.StatusForbidden)
+	list("commit", bearer("s3cre"), http.StatusForbidden)
+
+	plain, cleanupPlain := newTestServer(t)
+	defer cleanupPlain()
+	plain.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	plain.expect(http.StatusNotFound, http.MethodGet, "/api/repos/demo/objects?type=commit", nil, nil)
+}
+
+// TestCommitsLimit checks that GET /commits treats a zero or negative limit as
+// the default and clamps huge limits
+func TestCommitsLimit(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	for i := 1; i <= defaultCommitLimit+2; i++ {
+		ts.commitFile("demo", fmt.Sprintf("f%d.txt", i), "x", fmt.Sprintf("Commit %d", i))
+	}
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/push", PushRequest{Remote: "origin", Branch: "master"}, nil)
+
+	for query, want := range map[string]int{
+		"":             defaultCommitLimit,
+		"limit=0":      defaultCommitLimit,
+		"limit=-5":     defaultCommitLimit,
+		"limit=abc":    defaultCommitLimit,
+		"limit=3":      3,
+		"limit=999999": defaultCommitLimit + 2,
+	} {
+		var commits []Commit
+		ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/commits?"+query, nil, &commits)
+		if len(commits) != want {
+			t.Errorf("%q: expected %d commits, got %d", query, want, len(commits))
+		}
+	}
+
+	for value, want := range map[string]int{
+		"0":                      defaultCommitLimit,
+		"-5":                     defaultCommitLimit,
+		"1000":                   maxCommitLimit,
+		"999999":                 maxCommitLimit,
+		"1000000000000000000000": maxCommitLimit, // out of range for an int
+	} {
+		if got := commitLimit(value); got != want {
+			t.Errorf("commitLimit(%q) = %d, want %d", value, got, want)
+		}
+	}
+}
+
+// TestPushedCommitsMatchRemoteRef checks that the pushed commits the storage
+// package reports are the ones GET /commits lists from origin/master, after a
+// push and after rolling it back
+func TestPushedCommitsMatchRemoteRef(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	ts.commitFile("demo", "a.txt", "a", "Add a")
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/push", PushRequest{Remote: "origin", Branch: "master"}, nil)
+	ts.commitFile("demo", "b.txt", "b", "Add b")
+	ts.commitFile("demo", "c.txt", "c", "Add c")
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/push", PushRequest{Remote: "origin", Branch: "master"}, nil)
+	ts.commitFile("demo", "d.txt", "d", "Add d, unpushed")
+
+	repoPath := filepath.Join(ts.server.repoBase, "demo")
+	agree := func(wantCount int) {
+		t.Helper()
+		var commits []Commit
+		ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/commits?branch=master", nil, &commits)
+		listed := make([]string, len(commits))
+		for i, c := range commits {
+			listed[len(commits)-1-i] = c.Hash // oldest first
+		}
+
+		pushed, err := repostorage.GetPushedCommits(repoPath, repostorage.InitOptions{Bare: false}, "master")
+		if err != nil {
+			t.Fatalf("GetPushedCommits failed: %v", err)
+		}
+		reported := make([]string, len(pushed))
+		for i, id := range pushed {
+			reported[i] = fmt.Sprint(id)
+		}
+		if len(listed) != wantCount || strings.Join(reported, ",") != strings.Join(listed, ",") {
+			t.Errorf("Expected %d pushed commits, listed %v, reported %v", wantCount, listed, reported)
+		}
+		for _, id := range pushed {
+			if ok, err := repostorage.IsCommitPushed(repoPath, repostorage.InitOptions{Bare: false}, "master", id); err != nil || !ok {
+				t.Errorf("Expected commit %d pushed, got %v, %v", id, ok, err)
+			}
+		}
+	}
+	agree(3)
+
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/push/rollback?branch=master", nil, nil)
+	agree(1)
+}
+
+// TestRefreshRepo changes a repo on disk behind the registry's back, as the
+// CLI does, and checks that POST /refresh reconciles its metadata and leaves
+// other repos' metadata alone
+func TestRefreshRepo(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "other"}, nil)
+	ts.commitFile("demo", "a.txt", "a", "Add a")
+	ts.commitFile("demo", "b.txt", "b", "Add b")
+
+	// As `gitclone push` and `gitclone checkout feature` do
+	repoPath := filepath.Join(ts.server.repoBase, "demo")
+	options := repostorage.InitOptions{Bare: false}
+	tip, err := repostorage.ReadHeadRefMaybe(repoPath, options, "master")
+	if err != nil || tip == nil {
+		t.Fatalf("Failed to read master: %v, %v", tip, err)
+	}
+	if err := repostorage.WriteRemoteRef(repoPath, options, "master", *tip); err != nil {
+		t.Fatalf("Failed to push: %v", err)
+	}
+	if err := repostorage.EnsureHeadRefExists(repoPath, options, "feature"); err != nil {
+		t.Fatalf("Failed to create branch: %v", err)
+	}
+	if err := repostorage.WriteHEADBranch(repoPath, options, "feature"); err != nil {
+		t.Fatalf("Failed to move HEAD: %v", err)
+	}
+
+	before, err := ts.server.metaStore.GetRepo("demo")
+	if err != nil {
+		t.Fatalf("Failed to read metadata: %v", err)
+	}
+	if before.CurrentBranch != "master" || before.BranchCount != 1 || before.CommitCount != 0 {
+		t.Fatalf("Expected stale metadata before refreshing, got %+v", before)
+	}
+	otherBefore, err := ts.server.metaStore.GetRepo("other")
+	if err != nil {
+		t.Fatalf("Failed to read metadata: %v", err)
+	}
+
+	var item RepoListItem
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/refresh", nil, &item)
+	if item.ID != "demo" || item.CurrentBranch != "feature" || item.BranchCount != 2 || item.CommitCount != 2 {
+		t.Errorf("Expected demo on feature with 2 branches and 2 commits, got %+v", item)
+	}
+	after, err := ts.server.metaStore.GetRepo("demo")
+	if err != nil {
+		t.Fatalf("Failed to read metadata: %v", err)
+	}
+	if after.CurrentBranch != "feature" || after.BranchCount != 2 || after.CommitCount != 2 {
+		t.Errorf("Expected the refreshed counts persisted, got %+v", after)
+	}
+	if !after.UpdatedAt.Equal(before.UpdatedAt) {
+		t.Errorf("Refreshing moved updatedAt from %v to %v", before.UpdatedAt, after.UpdatedAt)
+	}
+	if otherAfter, err := ts.server.metaStore.GetRepo("other"); err != nil || *otherAfter != *otherBefore {
+		t.Errorf("Expected other's metadata untouched, got %+v, %v", otherAfter, err)
+	}
+
+	ts.expect(http.StatusNotFound, http.MethodPost, "/api/repos/nope/refresh", nil, nil)
+	ts.expect(http.StatusMethodNotAllowed, http.MethodGet, "/api/repos/demo/refresh", nil, nil)
+}
+
+// TestGetFile stages an edit to a committed file and checks that GET /files
+// returns the committed content by default and the staged content with
+// staged=true
+func TestGetFile(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	ts.commitFile("demo", "docs/a.txt", "committed", "Add a")
+	first := ts.refs("demo")["refs/heads/master"]
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/files", FileRequest{Path: "docs/a.txt", Content: "staged", AutoStage: true}, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/files", FileRequest{Path: "b.txt", Content: "unstaged"}, nil)
+
+	var committed, staged FileContentResponse
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/files?path=docs/a.txt", nil, &committed)
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/files?path=docs/a.txt&staged=true", nil, &staged)
+	if committed.Content != "committed" || committed.Staged {
+		t.Errorf("Expected the committed content, got %+v", committed)
+	}
+	if staged.Content != "staged" || !staged.Staged || staged.BlobID == committed.BlobID {
+		t.Errorf("Expected the staged content with its own blob, got %+v (committed %+v)", staged, committed)
+	}
+	var atCommit FileContentResponse
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/files?path=docs/a.txt&commit="+first, nil, &atCommit)
+	if atCommit != committed {
+		t.Errorf("Expected commit %s's content %+v, got %+v", first, committed, atCommit)
+	}
+
+	ts.expect(http.StatusNotFound, http.MethodGet, "/api/repos/demo/files?path=b.txt&staged=true", nil, nil)
+	ts.expect(http.StatusNotFound, http.MethodGet, "/api/repos/demo/files?path=b.txt", nil, nil)
+	ts.expect(http.StatusNotFound, http.MethodGet, "/api/repos/demo/files?path=docs/a.txt&commit=999", nil, nil)
+	ts.expect(http.StatusBadRequest, http.MethodGet, "/api/repos/demo/files", nil, nil)
+	ts.expect(http.StatusBadRequest, http.MethodGet, "/api/repos/demo/files?path=../escape.txt", nil, nil)
+	ts.expect(http.StatusBadRequest, http.MethodGet, "/api/repos/demo/files?path=docs/a.txt&staged=true&commit="+first, nil, nil)
+}
+
+// TestGetBinaryFile commits a file that isn't valid UTF-8 and checks it comes
+// back intact: base64-encoded in JSON, and byte for byte with raw=true
+func TestGetBinaryFile(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	content := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff, 0xfe, '\n'}
+	if err := os.WriteFile(filepath.Join(ts.server.repoBase, "demo", "logo.png"), content, 0644); err != nil {
+		t.Fatalf("Failed to write logo.png: %v", err)
+	}
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/add", AddRequest{Path: "logo.png"}, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/commit", CommitRequest{Message: "Add logo"}, nil)
+
+	var file FileContentResponse
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/files?path=logo.png", nil, &file)
+	decoded, err := base64.StdEncoding.DecodeString(file.Content)
+	if file.Encoding != "base64" || err != nil || !bytes.Equal(decoded, content) {
+		t.Errorf("Expected base64 of %v, got %+v", content, file)
+	}
+
+	resp, err := http.Get(ts.url + "/api/repos/demo/files?path=logo.png&raw=true")
+	if err != nil {
+		t.Fatalf("Raw GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read raw body: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, content) {
+		t.Errorf("Expected the raw bytes %v, got %d %v", content, resp.StatusCode, body)
+	}
+	if resp.ContentLength != int64(len(content)) || resp.Header.Get("ETag") != strconv.Quote(file.BlobID) {
+		t.Errorf("Expected Content-Length %d and ETag %q, got %d and %q", len(content), file.BlobID, resp.ContentLength, resp.Header.Get("ETag"))
+	}
+	ts.expect(http.StatusNotFound, http.MethodGet, "/api/repos/demo/files?path=missing.png&raw=true", nil, nil)
+
+	var text FileContentResponse
+	ts.commitFile("demo", "a.txt", "héllo", "Add a")
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/demo/files?path=a.txt", nil, &text)
+	if text.Encoding != "utf-8" || text.Content != "héllo" {
+		t.Errorf("Expected UTF-8 text returned as is, got %+v", text)
+	}
+}
+
+// TestRequestTimeout checks that work a request runs past the request
+// timeout is stopped with a 503 and writes nothing, and that the event stream
+// isn't cut off
+func TestRequestTimeout(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	ts.commitFile("demo", "README.md", "# demo", "Initial commit")
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/push", PushRequest{Remote: "origin", Branch: "master"}, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/files", FileRequest{Path: "notes.txt", Content: "notes", AutoStage: true}, nil)
+	refs := ts.refs("demo")
+
+	// A second router over the same server, whose requests time out at once
+	ts.server.SetRequestTimeout(time.Nanosecond)
+	timedServer := httptest.NewServer(NewRouter(ts.server))
+	defer timedServer.Close()
+	timed := &testServer{t: t, server: ts.server, url: timedServer.URL}
+
+	timed.expect(http.StatusServiceUnavailable, http.MethodGet, "/api/repos/demo/commits", nil, nil)
+	timed.expect(http.StatusServiceUnavailable, http.MethodGet, "/api/repos/demo/commits?stream=ndjson", nil, nil)
+	timed.expect(http.StatusServiceUnavailable, http.MethodPost, "/api/repos/demo/add", AddRequest{Path: "."}, nil)
+	timed.expect(http.StatusServiceUnavailable, http.MethodPost, "/api/repos/demo/commit", CommitRequest{Message: "Timed out"}, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/commit", CommitRequest{Message: "Add notes"}, nil)
+	timed.expect(http.StatusServiceUnavailable, http.MethodPost, "/api/repos/demo/push", PushRequest{Remote: "origin", Branch: "master"}, nil)
+	if got := ts.refs("demo")["refs/remotes/origin/master"]; got != refs["refs/remotes/origin/master"] {
+		t.Errorf("Expected origin/master to stay at %s after a timed-out push, got %s", refs["refs/remotes/origin/master"], got)
+	}
+
+	resp, err := http.Get(timedServer.URL + "/api/repos/demo/events")
+	if err != nil {
+		t.Fatalf("Failed to open the event stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected the event stream to open, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	// Events still arrive once the timeout has long passed
+	time.Sleep(10 * time.Millisecond)
+	ts.expect(http.StatusOK, http.MethodPost, "/api/repos/demo/push", PushRequest{Remote: "origin", Branch: "master"}, nil)
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "event: ") {
+		t.Errorf("Expected an event on the stream, got %q (err %v)", line, err)
+	}
+}
+
+// backup returns the repo's backup from GET /backup
+func (ts *testServer) backup(repoID string) []byte {
+	ts.t.Helper()
+	resp, err := http.Get(ts.url + "/api/repos/" + repoID + "/backup")
+	if err != nil {
+		ts.t.Fatalf("GET backup failed: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		ts.t.Fatalf("GET backup: status %d, %v", resp.StatusCode, err)
+	}
+	return data
+}
+
+// restore posts data to POST /restore of repoID and returns the status
+func (ts *testServer) restore(repoID string, data []byte) int {
+	ts.t.Helper()
+	resp, err := http.Post(ts.url+"/api/repos/"+repoID+"/restore", "application/octet-stream", bytes.NewReader(data))
+	if err != nil {
+		ts.t.Fatalf("POST restore failed: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// TestRestoreBodyLimit checks a restore larger than the repository size
+// quota is refused with a 413 without creating the repo, and one within it
+// is restored
+func TestRestoreBodyLimit(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	ts.commitFile("demo", "a.txt", strings.Repeat("a", 4096), "Add a")
+	backup := ts.backup("demo")
+
+	ts.server.SetQuotas(Quotas{MaxRepoBytes: int64(len(backup)) - 1})
+	if status := ts.restore("copy", backup); status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected 413 for a backup over the limit, got %d", status)
+	}
+	ts.expect(http.StatusNotFound, http.MethodGet, "/api/repos/copy", nil, nil)
+
+	ts.server.SetQuotas(Quotas{MaxRepoBytes: int64(len(backup))})
+	if status := ts.restore("copy", backup); status != http.StatusCreated {
+		t.Fatalf("Expected 201 for a backup within the limit, got %d", status)
+	}
+	var file FileContentResponse
+	ts.expect(http.StatusOK, http.MethodGet, "/api/repos/copy/files?path=a.txt", nil, &file)
+	if len(file.Content) != 4096 {
+		t.Errorf("Expected a.txt restored, got %d bytes", len(file.Content))
+	}
+}
+
+// TestRestoreRepoQuota checks a restore counts against the repository count
+// quota like a create
+func TestRestoreRepoQuota(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ts.expect(http.StatusCreated, http.MethodPost, "/api/repos", CreateRepoRequest{Name: "demo"}, nil)
+	ts.commitFile("demo", "a.txt", "a", "Add a")
+	backup := ts.backup("demo")
+
+	ts.server.SetQuotas(Quotas{MaxRepos: 1})
+	if status := ts.restore("copy", backup); status != http.StatusForbidden {
+		t.Fatalf("Expected 403 at the repository quota, got %d", status)
+	}
+	ts.expect(http.StatusNotFound, http.MethodGet, "/api/repos/copy", nil, nil)
+	if _, err := os.Stat(filepath.Join(ts.server.repoBase, "copy")); !os.IsNotExist(err) {
+		t.Errorf("Expected no directory for the refused restore, got %v", err)
+	}
+
+	ts.server.SetQuotas(Quotas{MaxRepos: 2})
+	if status := ts.restore("copy", backup); status != http.StatusCreated {
+		t.Fatalf("Expected 201 within the repository quota, got %d", status)
+	}
+}
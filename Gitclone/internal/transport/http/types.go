@@ -9,6 +9,7 @@ type RepoListItem struct {
 	Name          string    `json:"name"`
 	Description   string    `json:"description,omitempty"`
 	CurrentBranch string    `json:"currentBranch"`
+	DefaultBranch string    `json:"defaultBranch,omitempty"`
 	BranchCount   int       `json:"branchCount"`
 	CommitCount   int       `json:"commitCount"`
 	CreatedAt     time.Time `json:"createdAt,omitempty"`
@@ -18,15 +19,57 @@ type RepoListItem struct {
 }
 
 type Branch struct {
-	Name      string `json:"name"`
-	CreatedAt string `json:"createdAt"`
+	Name        string `json:"name"`
+	CreatedAt   string `json:"createdAt"`
+	TipCommitID *int   `json:"tipCommitId"` // null for a branch with no commits
+	TipMessage  string `json:"tipMessage,omitempty"`
+	TipDate     string `json:"tipDate,omitempty"`
+}
+
+type BranchProtection struct {
+	Branch    string `json:"branch"`
+	Protected bool   `json:"protected"` // Force-push and push rollback need ?override=true
+}
+
+type TreeEntry struct {
+	Path   string `json:"path"`
+	BlobID string `json:"blobId,omitempty"`
+	Mode   string `json:"mode"`
+	Type   string `json:"type"`
 }
 
 type Commit struct {
-	Hash    string `json:"hash"`
+	Hash          string `json:"hash"`
+	Message       string `json:"message"`
+	Author        string `json:"author"`
+	Date          string `json:"date"` // Author date
+	Committer     string `json:"committer"`
+	CommitterDate string `json:"committerDate"`
+}
+
+type HeadResponse struct {
+	Branch      string `json:"branch"`
+	TipCommitID *int   `json:"tipCommitId"` // null until the branch is pushed
+	TipMessage  string `json:"tipMessage,omitempty"`
+	TipDate     string `json:"tipDate,omitempty"`
+	CommitCount int    `json:"commitCount"`
+}
+
+type GraphNode struct {
+	ID      string `json:"id"`
 	Message string `json:"message"`
-	Author  string `json:"author"`
 	Date    string `json:"date"`
+	Branch  string `json:"branch"` // First branch whose history contains the commit
+}
+
+type GraphEdge struct {
+	From string `json:"from"` // Parent commit
+	To   string `json:"to"`   // Child commit
+}
+
+type GraphResponse struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
 }
 
 type Repository struct {
@@ -34,6 +77,7 @@ type Repository struct {
 	Name          string        `json:"name"`
 	Description   string        `json:"description,omitempty"`
 	CurrentBranch string        `json:"currentBranch"`
+	DefaultBranch string        `json:"defaultBranch"`
 	Branches      []Branch      `json:"branches"`
 	Commits       []Commit      `json:"commits"`
 	Issues        []interface{} `json:"issues"`
@@ -43,12 +87,27 @@ type CheckoutRequest struct {
 	Branch string `json:"branch"`
 }
 
+type DefaultBranchRequest struct {
+	Branch string `json:"branch"`
+}
+
 type AddRequest struct {
 	Path string `json:"path"`
 }
 
 type CommitRequest struct {
-	Message string `json:"message"`
+	Message   string   `json:"message"`
+	KeepIndex bool     `json:"keepIndex,omitempty"` // Leave the committed files staged; the index is cleared by default
+	Paths     []string `json:"paths,omitempty"`     // Commit only the staged files at or under these paths
+	Parent    string   `json:"parent,omitempty"`    // Hash of the commit to graft onto instead of the branch tip
+}
+
+type CommitResponse struct {
+	Message      string `json:"message"`
+	Hash         string `json:"hash"`
+	FilesChanged int    `json:"filesChanged"`
+	Insertions   int    `json:"insertions"`
+	Deletions    int    `json:"deletions"`
 }
 
 type PushRequest struct {
@@ -56,13 +115,61 @@ type PushRequest struct {
 	Branch string `json:"branch"`
 }
 
+type PushResponse struct {
+	Message       string   `json:"message"`
+	CommitsPushed int      `json:"commitsPushed"`
+	Commits       []string `json:"commits"` // Hashes of the pushed commits, newest first
+}
+
+type PushRollbackResponse struct {
+	Message string `json:"message"`
+	Hash    string `json:"hash"` // The remote tip after the rollback
+}
+
 type MergeRequest struct {
 	Branch string `json:"branch"`
 }
 
 type CreateRepoRequest struct {
-	Name        string `json:"name"`
-	Description string `json:"description,omitempty"`
+	ID            string `json:"id,omitempty"` // Optional idempotency key; the Idempotency-Key header takes precedence
+	Name          string `json:"name"`
+	Description   string `json:"description,omitempty"`
+	InitialBranch string `json:"initialBranch,omitempty"` // Defaults to master
+}
+
+type ValidateRepoResponse struct {
+	Valid     bool   `json:"valid"`           // The name (and initial branch, if sent) is well-formed
+	Available bool   `json:"available"`       // A repository can be created under the name
+	Error     string `json:"error,omitempty"` // Why the name is invalid or unavailable
+}
+
+type PruneResponse struct {
+	Pruned []string `json:"pruned"` // IDs of the repos removed from the listing
+}
+
+type ScanResponse struct {
+	Registered []string `json:"registered"` // IDs of the repos found on disk and added to the listing
+	Errors     int      `json:"errors"`     // Entries under the repo base that couldn't be read, e.g. broken symlinks
+}
+
+type MergeBaseResponse struct {
+	MergeBase *string `json:"mergeBase"` // Hash of the nearest common ancestor; null if the histories are unrelated
+}
+
+type CommitBranchesResponse struct {
+	Branches []string `json:"branches"` // Local branches whose history contains the commit
+}
+
+type VersionResponse struct {
+	Version       string   `json:"version"`
+	Features      []string `json:"features"`      // Sorted; see GET /api/version in the README
+	SchemaVersion int      `json:"schemaVersion"` // Repository schema version the server reads and writes
+}
+
+// Object is a stored object listed by GET /api/repos/:id/objects
+type Object struct {
+	Key  string `json:"key"`
+	Size int    `json:"size"` // Bytes, uncompressed
 }
 
 type ErrorResponse struct {
@@ -70,16 +177,20 @@ type ErrorResponse struct {
 }
 
 type Issue struct {
-	ID           string    `json:"id"`
-	Title        string    `json:"title"`
-	Body         string    `json:"body"`
-	Status       string    `json:"status"`   // "open" or "closed"
-	Priority     string    `json:"priority"` // "low", "medium", "high"
-	Labels       []Label   `json:"labels"`
-	Author       string    `json:"author"`
-	AuthorAvatar string    `json:"authorAvatar"`
-	CreatedAt    time.Time `json:"createdAt"`
-	CommentCount int       `json:"commentCount"`
+	ID           string     `json:"id"`               // Issue number as a string; older issues keep their original IDs
+	Number       int        `json:"number,omitempty"` // Sequential per repo, shown as #<number>
+	Title        string     `json:"title"`
+	Body         string     `json:"body"`
+	Status       string     `json:"status"`   // "open" or "closed"
+	Priority     string     `json:"priority"` // "low", "medium", "high"
+	Labels       []Label    `json:"labels"`
+	Author       string     `json:"author"`
+	AuthorAvatar string     `json:"authorAvatar"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	ClosedAt     *time.Time `json:"closedAt,omitempty"` // Set while the issue is closed
+	ClosedBy     string     `json:"closedBy,omitempty"` // Actor that closed the issue
+	CommentCount int        `json:"commentCount"`
+	Version      int        `json:"version"` // Incremented on every update; updates must match it
 }
 
 type Label struct {
@@ -96,7 +207,43 @@ type CreateIssueRequest struct {
 	Author   string  `json:"author,omitempty"` // Optional: email from frontend
 }
 
+type UpdateIssueRequest struct {
+	Status  string `json:"status,omitempty"` // "open" or "closed"; empty toggles
+	Body    string `json:"body,omitempty"`
+	Actor   string `json:"actor,omitempty"`   // Optional: who made the change, recorded as ClosedBy
+	Version *int   `json:"version,omitempty"` // Version the update is based on, if not sent as If-Match
+}
+
+type StagedDiffResponse struct {
+	Added    []string `json:"added"`    // Staged files HEAD doesn't have
+	Modified []string `json:"modified"` // Staged files whose content or mode differs from HEAD
+	Deleted  []string `json:"deleted"`  // HEAD files staged for removal
+}
+
 type FileRequest struct {
+	Path      string `json:"path"`
+	Content   string `json:"content"`
+	AutoStage bool   `json:"autoStage,omitempty"` // Stage the file after writing it
+}
+
+type FileResponse struct {
+	Message string `json:"message"`
 	Path    string `json:"path"`
-	Content string `json:"content"`
+	Staged  bool   `json:"staged"` // Whether the file is in the index after the write
+}
+
+type FileContentResponse struct {
+	Path     string `json:"path"`
+	BlobID   string `json:"blobId"`
+	Content  string `json:"content"`
+	Encoding string `json:"encoding"` // "utf-8", or "base64" for content that isn't valid UTF-8
+	Staged   bool   `json:"staged"`   // Whether Content is the version staged in the index
+}
+
+// BulkFileResult reports the outcome of one file of a bulk write
+type BulkFileResult struct {
+	Path   string `json:"path"`
+	OK     bool   `json:"ok"`
+	Staged bool   `json:"staged"`          // Whether the file is in the index after the write
+	Error  string `json:"error,omitempty"` // Why the file wasn't written
 }
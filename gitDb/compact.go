@@ -0,0 +1,240 @@
+package GitDb
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// compactTempName is the file Compact writes before renaming it over the log.
+// A leftover one means Compact was interrupted before the rename, so the log
+// is still complete and the temp file can be discarded.
+const compactTempName = "log.compact"
+
+// ErrLogChanged is returned by Compact when another handle appended to the
+// log while it ran. The log is left as it was; compacting again picks the
+// new records up.
+var ErrLogChanged = errors.New("log changed during compaction")
+
+// Stats describes how much of the log Compact would keep
+type Stats struct {
+	Keys             int   // live keys
+	LogBytes         int64 // size of the log as this handle sees it
+	LiveBytes        int64 // size of the latest record of each live key
+	ReclaimableBytes int64 // overwritten records and tombstones, which Compact drops
+}
+
+// Stats returns the size of the log and how much of it Compact would free.
+// It reads the header of each live key's record, from the log file in
+// on-demand mode.
+func (db *DB) Stats() (Stats, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	view := db.view()
+	stats := Stats{Keys: len(db.index.latest), LogBytes: view.size}
+	for _, offset := range db.index.latest {
+		size, err := view.sizeAt(offset, db.maxRecordSize)
+		if err != nil {
+			return Stats{}, err
+		}
+		stats.LiveBytes += size
+	}
+	stats.ReclaimableBytes = stats.LogBytes - stats.LiveBytes
+	return stats, nil
+}
+
+// compactStep names the points in Compact where a test can simulate a crash
+type compactStep int
+
+const (
+	compactBeforeRename compactStep = iota // temp file written and synced
+	compactAfterRename                     // temp file renamed over the log
+)
+
+// Compact rewrites the log keeping only the latest record of each key, in the
+// order those records were written, so Get and Scan-then-take-latest results
+// are unchanged. Deleted keys are dropped along with their tombstones.
+//
+// The original log is never modified: the compacted log is written to a temp
+// file, which is synced along with the directory before being renamed over
+// the log, and the directory is synced again after. A crash at any point
+// leaves either the original or the compacted log in place.
+//
+// Compact is coordinated with this handle's Put, Get and Scan, but not with
+// other handles on the same path. It returns ErrLogChanged rather than
+// replace a log that holds records this handle hasn't seen, but a record
+// appended in the instant before the rename is still lost, so callers must
+// make sure no other handle writes concurrently.
+func (db *DB) Compact() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	dir := filepath.Dir(db.logPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+	tmpPath := filepath.Join(dir, compactTempName)
+	// The log file as this handle last saw it, a torn final record included
+	expectedSize := db.view().size + db.torn
+
+	// In memory the compacted log is kept as it is written; on demand it is
+	// only written, and read back through a handle opened before the rename
+	var compacted *bytes.Buffer
+	if db.file == nil {
+		compacted = bytes.NewBuffer(make([]byte, 0, len(db.log)))
+	}
+	index, size, err := db.writeCompacted(tmpPath, compacted)
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	var file *os.File
+	if db.file != nil {
+		if file, err = os.Open(tmpPath); err != nil {
+			os.Remove(tmpPath)
+			return fmt.Errorf("failed to open %s: %w", compactTempName, err)
+		}
+	}
+	if err := syncDir(dir); err != nil {
+		closeFile(file)
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := db.compactCrashPoint(compactBeforeRename); err != nil {
+		closeFile(file)
+		return err
+	}
+
+	if err := checkLogSize(db.logPath, expectedSize); err != nil {
+		closeFile(file)
+		os.Remove(tmpPath)
+		return err
+	}
+	if db.torn > 0 {
+		if err := db.saveTornRecord(db.view().size); err != nil {
+			closeFile(file)
+			os.Remove(tmpPath)
+			return err
+		}
+	}
+	if err := os.Rename(tmpPath, db.logPath); err != nil {
+		closeFile(file)
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace log: %w", err)
+	}
+	if err := db.compactCrashPoint(compactAfterRename); err != nil {
+		closeFile(file)
+		return err
+	}
+	if err := syncDir(dir); err != nil {
+		closeFile(file)
+		return err
+	}
+
+	if file != nil {
+		// Snapshots may still read the old log through the old handle
+		db.retired = append(db.retired, db.file)
+		db.file = file
+		db.fileSize = size
+	} else {
+		db.log = compacted.Bytes()
+	}
+	db.index = index
+	// The compacted log ends with a complete record
+	db.torn = 0
+	return nil
+}
+
+// writeCompacted writes the latest record of each key, in log order, to path
+// and syncs it, also copying them to compacted if it isn't nil. It returns an
+// index over them and their total size. Callers hold db.mu.
+func (db *DB) writeCompacted(path string, compacted *bytes.Buffer) (*Index, int64, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create %s: %w", filepath.Base(path), err)
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	var out io.Writer = writer
+	if compacted != nil {
+		out = io.MultiWriter(writer, compacted)
+	}
+
+	index := newIndex()
+	size := int64(0)
+	err = db.view().each(db.maxRecordSize, func(offset int64, raw rawRecord) error {
+		// Deleted keys aren't indexed, so neither they nor their tombstone
+		// survive
+		if latest, ok := db.index.Get(raw.record.Key); !ok || latest != offset {
+			return nil
+		}
+		// Records are copied as stored, compressed or not
+		if _, err := out.Write(raw.encoded); err != nil {
+			return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+		}
+		index.Set(raw.record.Key, size)
+		size += raw.size
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := writer.Flush(); err != nil {
+		return nil, 0, fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	if err := file.Sync(); err != nil {
+		return nil, 0, fmt.Errorf("failed to sync %s: %w", filepath.Base(path), err)
+	}
+	if err := file.Close(); err != nil {
+		return nil, 0, fmt.Errorf("failed to close %s: %w", filepath.Base(path), err)
+	}
+	return index, size, nil
+}
+
+// checkLogSize returns ErrLogChanged if the log at path isn't size bytes
+// long, as when another handle appended to it
+func checkLogSize(path string, size int64) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) && size == 0 {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+	if info.Size() != size {
+		return fmt.Errorf("%w: %d bytes, expected %d", ErrLogChanged, info.Size(), size)
+	}
+	return nil
+}
+
+// closeFile closes file if it isn't nil
+func closeFile(file *os.File) {
+	if file != nil {
+		file.Close()
+	}
+}
+
+// compactCrashPoint lets tests stop Compact at step as if the process died
+func (db *DB) compactCrashPoint(step compactStep) error {
+	if db.compactHook == nil {
+		return nil
+	}
+	return db.compactHook(step)
+}
+
+// syncDir syncs a directory so a file created or renamed in it is durable
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open directory: %w", err)
+	}
+	defer file.Close()
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync directory: %w", err)
+	}
+	return nil
+}
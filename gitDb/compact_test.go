@@ -0,0 +1,219 @@
+package GitDb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// errCrash stands in for the process dying at a compaction step
+var errCrash = errors.New("simulated crash")
+
+// writeOverwrittenKeys opens a DB in dir and writes each of n keys three times
+func writeOverwrittenKeys(t *testing.T, dir string, n int) *DB {
+	t.Helper()
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	for round := 0; round < 3; round++ {
+		for i := 0; i < n; i++ {
+			if err := db.Put(fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("value%d-%d", i, round))); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+		}
+	}
+	return db
+}
+
+// assertLatestValues checks every key written by writeOverwrittenKeys
+func assertLatestValues(t *testing.T, db *DB, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		got, err := db.Get(fmt.Sprintf("key%d", i))
+		if want := fmt.Sprintf("value%d-2", i); err != nil || string(got) != want {
+			t.Fatalf("Get(key%d) = %q, %v; want %q", i, got, err, want)
+		}
+	}
+}
+
+func TestCompact(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitdb-compact-*")
+	if err != nil {
+		t.Fatalf("MkdirTemp: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	db := writeOverwrittenKeys(t, tmpDir, 5)
+	logPath := filepath.Join(tmpDir, "log")
+	before, _ := os.ReadFile(logPath)
+
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	after, _ := os.ReadFile(logPath)
+	if len(after)*3 != len(before) {
+		t.Errorf("Expected the log to shrink to a third (%d bytes), got %d", len(before)/3, len(after))
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, compactTempName)); !os.IsNotExist(err) {
+		t.Errorf("Expected no temp file after Compact, got %v", err)
+	}
+	assertLatestValues(t, db, 5)
+
+	// Writes after compaction append to the new log
+	if err := db.Put("key0", []byte("value0-3")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	reopened, err := Open(tmpDir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if got, _ := reopened.Get("key0"); string(got) != "value0-3" {
+		t.Errorf("Expected value0-3 after reopen, got %q", got)
+	}
+	if got, _ := reopened.Get("key4"); string(got) != "value4-2" {
+		t.Errorf("Expected value4-2 after reopen, got %q", got)
+	}
+}
+
+// TestCompactCrashSafety stops Compact either side of the rename and checks
+// the log on disk is always complete: untouched before the rename, compacted
+// after it
+func TestCompactCrashSafety(t *testing.T) {
+	tests := []struct {
+		name      string
+		step      compactStep
+		compacted bool
+	}{
+		{"before rename", compactBeforeRename, false},
+		{"after rename", compactAfterRename, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir, err := os.MkdirTemp("", "gitdb-compact-crash-*")
+			if err != nil {
+				t.Fatalf("MkdirTemp: %v", err)
+			}
+			defer os.RemoveAll(tmpDir)
+
+			db := writeOverwrittenKeys(t, tmpDir, 5)
+			logPath := filepath.Join(tmpDir, "log")
+			original, _ := os.ReadFile(logPath)
+
+			db.compactHook = func(step compactStep) error {
+				if step == compactBeforeRename {
+					// The temp file is complete before the log is touched
+					tmp, err := os.ReadFile(filepath.Join(tmpDir, compactTempName))
+					if err != nil || ValidateLog(tmp) != nil || len(tmp)*3 != len(original) {
+						t.Errorf("Expected a complete compacted temp file before the rename, got %d bytes (err %v)", len(tmp), err)
+					}
+					if onDisk, _ := os.ReadFile(logPath); !bytes.Equal(onDisk, original) {
+						t.Errorf("Expected the log to be untouched before the rename")
+					}
+				}
+				if step == tt.step {
+					return errCrash
+				}
+				return nil
+			}
+			if err := db.Compact(); !errors.Is(err, errCrash) {
+				t.Fatalf("Expected the simulated crash, got %v", err)
+			}
+
+			onDisk, _ := os.ReadFile(logPath)
+			if tt.compacted && len(onDisk)*3 != len(original) {
+				t.Errorf("Expected the compacted log after the rename, got %d bytes", len(onDisk))
+			}
+			if !tt.compacted && !bytes.Equal(onDisk, original) {
+				t.Errorf("Expected the original log before the rename, got %d bytes", len(onDisk))
+			}
+
+			// Recovery: reopening discards any leftover temp file and sees every key
+			reopened, err := Open(tmpDir)
+			if err != nil {
+				t.Fatalf("Open after crash: %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(tmpDir, compactTempName)); !os.IsNotExist(err) {
+				t.Errorf("Expected the temp file to be removed on open, got %v", err)
+			}
+			assertLatestValues(t, reopened, 5)
+		})
+	}
+}
+
+// TestStats checks the reclaimable bytes are what Compact frees, in both
+// modes
+func TestStats(t *testing.T) {
+	for _, onDemand := range []bool{false, true} {
+		t.Run(fmt.Sprintf("OnDemand=%v", onDemand), func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeOverwrittenKeys(t, tmpDir, 5).Close()
+			db, err := OpenWithOptions(tmpDir, Options{OnDemand: onDemand})
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			defer db.Close()
+			if err := db.Delete("key4"); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+
+			stats, err := db.Stats()
+			if err != nil {
+				t.Fatalf("Stats: %v", err)
+			}
+			info, _ := os.Stat(filepath.Join(tmpDir, "log"))
+			if stats.Keys != 4 || stats.LogBytes != info.Size() || stats.ReclaimableBytes != stats.LogBytes-stats.LiveBytes {
+				t.Fatalf("Unexpected stats for a %d-byte log: %+v", info.Size(), stats)
+			}
+
+			if err := db.Compact(); err != nil {
+				t.Fatalf("Compact: %v", err)
+			}
+			info, _ = os.Stat(filepath.Join(tmpDir, "log"))
+			if info.Size() != stats.LiveBytes {
+				t.Errorf("Expected Compact to keep %d bytes, got %d", stats.LiveBytes, info.Size())
+			}
+			after, err := db.Stats()
+			if err != nil || after.ReclaimableBytes != 0 || after.LiveBytes != stats.LiveBytes {
+				t.Errorf("Expected nothing reclaimable after Compact, got %+v, %v", after, err)
+			}
+		})
+	}
+}
+
+// TestCompactLogChanged checks Compact leaves the log alone when another
+// handle has appended records it hasn't seen
+func TestCompactLogChanged(t *testing.T) {
+	tmpDir := t.TempDir()
+	db := writeOverwrittenKeys(t, tmpDir, 5)
+	other, err := Open(tmpDir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := other.Put("other", []byte("handle")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	logPath := filepath.Join(tmpDir, "log")
+	before, _ := os.ReadFile(logPath)
+
+	if err := db.Compact(); !errors.Is(err, ErrLogChanged) {
+		t.Fatalf("Expected ErrLogChanged, got %v", err)
+	}
+	if after, _ := os.ReadFile(logPath); !bytes.Equal(after, before) {
+		t.Errorf("Expected the log to be untouched")
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, compactTempName)); !os.IsNotExist(err) {
+		t.Errorf("Expected no temp file after a refused Compact, got %v", err)
+	}
+
+	// A handle that has seen every record can compact
+	if err := other.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if got, err := other.Get("other"); err != nil || string(got) != "handle" {
+		t.Errorf("Get(other) after Compact: %q, %v", got, err)
+	}
+}
@@ -1,24 +1,80 @@
 package GitDb
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"math"
 	"os"
 	"path/filepath"
+	"sync"
 )
 
+// DB is safe for concurrent use by multiple goroutines. Separate DB handles
+// on the same path are not coordinated with each other.
 type DB struct {
-	log     []byte
-	index   *Index
-	logPath string
+	mu            sync.RWMutex // guards log, file, fileSize, retired, index and torn
+	log           []byte
+	file          *os.File   // read handle on the log in on-demand mode; log is then unused
+	fileSize      int64      // length of the log in on-demand mode
+	retired       []*os.File // handles replaced by Compact, still read by snapshots
+	index         *Index
+	logPath       string
+	maxRecordSize int64
+	torn          int64 // bytes of a truncated final record past the end of the log, still in the file
+
+	compactHook func(compactStep) error // test hook; see compactCrashPoint
 }
 
-// Open initializes a new database instance
+// tornFileName is the file, next to the log, that truncated final records
+// cut from the log are saved to
+const tornFileName = "log.torn"
+
+// Options configures a DB opened with OpenWithOptions
+type Options struct {
+	// MaxRecordSize caps the size of a record (8-byte header, key and value,
+	// before compression). Larger Puts fail, and so does opening a log that
+	// declares one.
+	// Zero means DefaultMaxRecordSize.
+	MaxRecordSize int64
+
+	// OnDemand keeps only the index in memory and reads each record from the
+	// log file at its offset when it is needed, instead of loading the whole
+	// log. Every Get then reads the file, and reads fail once the DB is
+	// closed. The default holds the log in memory.
+	OnDemand bool
+}
+
+// Open initializes a new database instance with default options
 func Open(path string) (*DB, error) {
+	return OpenWithOptions(path, Options{})
+}
+
+// OpenWithOptions initializes a new database instance
+func OpenWithOptions(path string, options Options) (*DB, error) {
+	if options.MaxRecordSize <= 0 {
+		options.MaxRecordSize = DefaultMaxRecordSize
+	}
 	logPath := filepath.Join(path, "log")
 	db := &DB{
-		log:     make([]byte, 0, 4096),
-		index:   newIndex(),
-		logPath: logPath,
+		log:           make([]byte, 0, 4096),
+		index:         newIndex(),
+		logPath:       logPath,
+		maxRecordSize: options.MaxRecordSize,
+	}
+
+	// A leftover compaction temp file is from a Compact that stopped before
+	// replacing the log, which is therefore still complete
+	if err := os.Remove(filepath.Join(path, compactTempName)); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale compaction file: %w", err)
+	}
+
+	if options.OnDemand {
+		if err := db.openOnDemand(); err != nil {
+			return nil, err
+		}
+		return db, nil
 	}
 
 	// Load existing log file if it exists
@@ -35,21 +91,165 @@ func Open(path string) (*DB, error) {
 	return db, nil
 }
 
-// rebuildIndex reconstructs the index by reading all records from the log
+// openOnDemand opens the read handle of an on-demand DB, creating the log if
+// it doesn't exist yet, and rebuilds the index from it
+func (db *DB) openOnDemand() error {
+	if err := os.MkdirAll(filepath.Dir(db.logPath), 0755); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+	file, err := os.OpenFile(db.logPath, os.O_RDONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+	db.file = file
+	db.fileSize = info.Size()
+	if err := db.rebuildIndex(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to rebuild index: %w", err)
+	}
+	return nil
+}
+
+// view returns the log as it is now. Callers hold db.mu.
+func (db *DB) view() logView {
+	if db.file != nil {
+		return logView{file: db.file, size: db.fileSize}
+	}
+	return logView{data: db.log, size: int64(len(db.log))}
+}
+
+// rebuildIndex reconstructs the index by reading all records from the log.
+// A final record cut short, as a crash during its append leaves it, is
+// dropped with a warning: the log is cut back to the last complete record,
+// and the file is too before the next append, with the cut bytes saved to
+// tornFileName. The log has no checksums, so a record whose length was
+// corrupted looks the same; it is only taken for a torn final record if no
+// complete records follow it, and otherwise opening the log fails.
 func (db *DB) rebuildIndex() error {
+	view := db.view()
+	end := int64(0)
+	err := view.each(db.maxRecordSize, func(offset int64, raw rawRecord) error {
+		// Update index with latest offset for this key
+		if raw.record.Deleted {
+			db.index.Delete(raw.record.Key)
+		} else {
+			db.index.Set(raw.record.Key, offset)
+		}
+		end = offset + raw.size
+		return nil
+	})
+	if !errors.Is(err, errTruncatedRecord) {
+		return err
+	}
+	tail, err := view.readRange(end, view.size)
+	if err != nil {
+		return err
+	}
+	if recordsFollow(tail, db.maxRecordSize) {
+		return fmt.Errorf("corrupt record at offset %d of %s: it runs past the end of the log, but complete records follow it", end, db.logPath)
+	}
+	log.Printf("WARNING: GitDb: ignoring truncated record at offset %d of %s (%d bytes)", end, db.logPath, view.size-end)
+	db.torn = view.size - end
+	if db.file != nil {
+		db.fileSize = end
+	} else {
+		db.log = db.log[:end]
+	}
+	return nil
+}
+
+// recordsFollow reports whether tail, the bytes from a record that runs past
+// the end of the log, holds complete records ending exactly at the end of the
+// log, starting anywhere after its first byte. Only corruption leaves those
+// behind a truncated record; a crash cuts off the final record alone.
+func recordsFollow(tail []byte, maxSize int64) bool {
+	for start := 1; start+recordHeaderSize <= len(tail); start++ {
+		if decodesToEnd(tail[start:], maxSize) {
+			return true
+		}
+	}
+	return false
+}
+
+// decodesToEnd reports whether log is one or more complete records with
+// non-empty keys, as Encode writes them
+func decodesToEnd(log []byte, maxSize int64) bool {
 	offset := int64(0)
-	for offset < int64(len(db.log)) {
-		record, size, err := DecodeRecord(db.log, offset)
-		if err != nil {
+	for offset < int64(len(log)) {
+		raw, err := decodeRawRecord(log, offset, maxSize)
+		if err != nil || raw.record.Key == "" {
+			return false
+		}
+		offset += raw.size
+	}
+	return true
+}
+
+// dropTornRecord cuts the truncated record rebuildIndex ignored off the log
+// file, so appends don't land after it, after saving it with saveTornRecord.
+// The file is left alone if another handle has appended since. Callers hold
+// db.mu, before appending anything.
+func (db *DB) dropTornRecord() error {
+	end := db.view().size
+	info, err := os.Stat(db.logPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+	if err == nil && info.Size() == end+db.torn {
+		if err := db.saveTornRecord(end); err != nil {
 			return err
 		}
-		// Update index with latest offset for this key
-		db.index.Set(record.Key, offset)
-		offset += size
+		if err := os.Truncate(db.logPath, end); err != nil {
+			return fmt.Errorf("failed to drop truncated record: %w", err)
+		}
 	}
+	db.torn = 0
 	return nil
 }
 
+// saveTornRecord appends the db.torn bytes at end of the log file to
+// tornFileName next to it, and syncs them, so nothing dropped as a torn
+// record is lost for good. Callers hold db.mu.
+func (db *DB) saveTornRecord(end int64) error {
+	logFile, err := os.Open(db.logPath)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer logFile.Close()
+	torn := make([]byte, db.torn)
+	if _, err := logFile.ReadAt(torn, end); err != nil {
+		return fmt.Errorf("failed to read truncated record: %w", err)
+	}
+
+	tornPath := filepath.Join(filepath.Dir(db.logPath), tornFileName)
+	file, err := os.OpenFile(tornPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", tornFileName, err)
+	}
+	if _, err := file.Write(torn); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to save truncated record: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to sync %s: %w", tornFileName, err)
+	}
+	return file.Close()
+}
+
+// Size returns the size of the log in bytes as this handle sees it. Compact
+// shrinks it.
+func (db *DB) Size() int64 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.view().size
+}
+
 // Close shuts down the database
 // Since Put() already appends to the log file, Close() ensures the in-memory log
 // matches the file by writing it (which should be identical if no errors occurred).
@@ -59,7 +259,29 @@ func (db *DB) Close() error {
 	// Rewriting from an in-memory snapshot is unsafe if multiple DB handles exist:
 	// a stale handle could drop records appended by a newer handle.
 	// Since Put() already appends to the log file and syncs, Close() only needs to flush.
-	return db.Flush()
+	if err := db.Flush(); err != nil {
+		return err
+	}
+	return db.closeFiles()
+}
+
+// closeFiles closes the read handles of an on-demand DB
+func (db *DB) closeFiles() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var firstErr error
+	for _, file := range append(db.retired, db.file) {
+		if file == nil {
+			continue
+		}
+		// Closing twice is harmless, as it is for the default mode
+		if err := file.Close(); err != nil && !errors.Is(err, os.ErrClosed) && firstErr == nil {
+			firstErr = fmt.Errorf("failed to close log file: %w", err)
+		}
+	}
+	db.retired = nil
+	return firstErr
 }
 
 // Flush ensures any previously written log data is persisted to disk.
@@ -82,15 +304,48 @@ func (db *DB) Flush() error {
 
 // Append record to the log and update the index
 func (db *DB) Put(key string, value []byte) error {
-	record := Record{Key: key, Value: value}
+	return db.append(Record{Key: key, Value: value})
+}
+
+// Delete appends a tombstone for key, so Get no longer finds it. Deleting a
+// missing key is not an error.
+func (db *DB) Delete(key string) error {
+	return db.append(Record{Key: key, Deleted: true})
+}
+
+// append writes record to the log file and the in-memory log and index
+func (db *DB) append(record Record) error {
+	key := record.Key
+	// The cap applies to the record before compression, which is what
+	// reading it back allocates
+	if size := int64(recordHeaderSize + len(key) + len(record.Value)); size > db.maxRecordSize {
+		return fmt.Errorf("%w: %d bytes, limit is %d", ErrRecordTooLarge, size, db.maxRecordSize)
+	}
 	encoded, err := record.Encode()
 	if err != nil {
 		return err
 	}
 
-	offset := int64(len(db.log))
-	db.log = append(db.log, encoded...)
-	db.index.Set(key, offset)
+	// Hold the lock through the file append so the on-disk order matches
+	// the in-memory log
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.torn > 0 {
+		if err := db.dropTornRecord(); err != nil {
+			return err
+		}
+	}
+
+	if db.file == nil {
+		// The in-memory log is a single slice, so it can't outgrow int
+		offset := int64(len(db.log))
+		if offset > int64(math.MaxInt)-int64(len(encoded)) {
+			return fmt.Errorf("log is full: %d bytes", offset)
+		}
+		db.log = append(db.log, encoded...)
+		db.indexRecord(record, offset)
+	}
 
 	// Append to log file for persistence
 	if err := os.MkdirAll(filepath.Dir(db.logPath), 0755); err != nil {
@@ -110,37 +365,57 @@ func (db *DB) Put(key string, value []byte) error {
 		file.Close()
 		return fmt.Errorf("failed to sync log file: %w", err)
 	}
+	if db.file != nil {
+		// Reads go to the file, so the record is indexed where it landed,
+		// which is past records other handles appended meanwhile
+		end, err := file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("failed to locate end of log file: %w", err)
+		}
+		db.fileSize = end
+		db.indexRecord(record, end-int64(len(encoded)))
+	}
 	if err := file.Close(); err != nil {
 		return fmt.Errorf("failed to close log file: %w", err)
 	}
 	return nil
 }
 
+// indexRecord points the index at record, written at offset. Callers hold
+// db.mu.
+func (db *DB) indexRecord(record Record, offset int64) {
+	if record.Deleted {
+		db.index.Delete(record.Key)
+	} else {
+		db.index.Set(record.Key, offset)
+	}
+}
+
 // Get retrieves a value by key from the database
 func (db *DB) Get(key string) ([]byte, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
 	offset, ok := db.index.Get(key)
 	if !ok {
-		return nil, fmt.Errorf("key not found: %s", key)
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
 	}
-	record, _, err := DecodeRecord(db.log, offset)
+	record, err := db.view().recordAt(offset, db.maxRecordSize)
 	if err != nil {
 		return nil, err
 	}
 	return record.Value, nil
 }
 
-// Scan iterates through all records in the log, calling fn for each record.
+// Scan iterates through all records in the log, calling fn for each record,
+// including tombstones written by Delete. It sees the records present when it
+// starts; fn may call Put.
 func (db *DB) Scan(fn func(Record) error) error {
-	offset := int64(0)
-	for offset < int64(len(db.log)) {
-		record, bytesConsumed, err := DecodeRecord(db.log, offset)
-		if err != nil {
-			return err
-		}
-		if err := fn(record); err != nil {
-			return err
-		}
-		offset += bytesConsumed
-	}
-	return nil
+	// Appends never modify existing bytes, so the view stays valid
+	db.mu.RLock()
+	log := db.view()
+	db.mu.RUnlock()
+
+	return log.scan(db.maxRecordSize, fn)
 }
@@ -1,8 +1,12 @@
 package GitDb
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 )
 
@@ -173,5 +177,194 @@ func TestGitDbDurability_RemoteRef_CloseReopen(t *testing.T) {
 	}
 }
 
+// Concurrent Put/Get/Scan on one handle must not race or lose writes
+func TestGitDbConcurrentPutGet(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitdb-concurrent-*")
+	if err != nil {
+		t.Fatalf("MkdirTemp: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	db, err := Open(tmpDir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
 
+	const writers, perWriter = 8, 25
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				key := fmt.Sprintf("w%d/k%d", w, i)
+				if err := db.Put(key, []byte(key)); err != nil {
+					t.Errorf("Put(%s): %v", key, err)
+					return
+				}
+				if v, err := db.Get(key); err != nil || string(v) != key {
+					t.Errorf("Get(%s) = %q, %v", key, v, err)
+					return
+				}
+				db.Scan(func(Record) error { return nil })
+			}
+		}(w)
+	}
+	wg.Wait()
 
+	db2, err := Open(tmpDir)
+	if err != nil {
+		t.Fatalf("Open(db2): %v", err)
+	}
+	count := 0
+	if err := db2.Scan(func(Record) error { count++; return nil }); err != nil {
+		t.Fatalf("Scan(db2): %v", err)
+	}
+	if count != writers*perWriter {
+		t.Fatalf("expected %d records on disk, got %d", writers*perWriter, count)
+	}
+}
+
+// A crash during an append can leave the log ending in part of a record.
+// Opening it must keep every complete record, and appends after it must land
+// where the next open finds them.
+func TestGitDbDurability_TruncatedFinalRecord(t *testing.T) {
+	for _, onDemand := range []bool{false, true} {
+		t.Run(fmt.Sprintf("OnDemand=%v", onDemand), func(t *testing.T) {
+			tmpDir, err := os.MkdirTemp("", "gitdb-durability-*")
+			if err != nil {
+				t.Fatalf("MkdirTemp: %v", err)
+			}
+			defer os.RemoveAll(tmpDir)
+			options := Options{OnDemand: onDemand}
+
+			db1, err := OpenWithOptions(tmpDir, options)
+			if err != nil {
+				t.Fatalf("Open(db1): %v", err)
+			}
+			for i := 0; i < 3; i++ {
+				if err := db1.Put(fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("value%d", i))); err != nil {
+					t.Fatalf("Put(key%d): %v", i, err)
+				}
+			}
+			if err := db1.Close(); err != nil {
+				t.Fatalf("Close(db1): %v", err)
+			}
+
+			// Half of a record's bytes, as an interrupted append leaves them
+			logPath := filepath.Join(tmpDir, "log")
+			info, err := os.Stat(logPath)
+			if err != nil {
+				t.Fatalf("Stat(log): %v", err)
+			}
+			complete := info.Size()
+			encoded, err := Record{Key: "torn", Value: []byte("never written")}.Encode()
+			if err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			file, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0644)
+			if err != nil {
+				t.Fatalf("OpenFile(log): %v", err)
+			}
+			if _, err := file.Write(encoded[:len(encoded)/2]); err != nil {
+				t.Fatalf("Write(log): %v", err)
+			}
+			file.Close()
+
+			db2, err := OpenWithOptions(tmpDir, options)
+			if err != nil {
+				t.Fatalf("Open(db2) with a truncated final record: %v", err)
+			}
+			for i := 0; i < 3; i++ {
+				v, err := db2.Get(fmt.Sprintf("key%d", i))
+				if err != nil || string(v) != fmt.Sprintf("value%d", i) {
+					t.Fatalf("Get(key%d) after reopen: %q, %v", i, v, err)
+				}
+			}
+			if _, err := db2.Get("torn"); err == nil {
+				t.Fatalf("Get(torn): expected the truncated record to be ignored")
+			}
+			if err := db2.Put("after", []byte("crash")); err != nil {
+				t.Fatalf("Put(after): %v", err)
+			}
+			if err := db2.Close(); err != nil {
+				t.Fatalf("Close(db2): %v", err)
+			}
+			after, err := Record{Key: "after", Value: []byte("crash")}.Encode()
+			if err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			if info, err := os.Stat(logPath); err != nil || info.Size() != complete+int64(len(after)) {
+				t.Fatalf("Expected the truncated record cut from the log before appending, got %v, %v", info, err)
+			}
+			if saved, err := os.ReadFile(filepath.Join(tmpDir, tornFileName)); err != nil || !bytes.Equal(saved, encoded[:len(encoded)/2]) {
+				t.Fatalf("Expected the cut bytes saved to %s, got %q, %v", tornFileName, saved, err)
+			}
+
+			db3, err := OpenWithOptions(tmpDir, options)
+			if err != nil {
+				t.Fatalf("Open(db3): %v", err)
+			}
+			defer db3.Close()
+			if v, err := db3.Get("after"); err != nil || string(v) != "crash" {
+				t.Fatalf("Get(after) after reopen: %q, %v", v, err)
+			}
+			if v, err := db3.Get("key2"); err != nil || string(v) != "value2" {
+				t.Fatalf("Get(key2) after reopen: %q, %v", v, err)
+			}
+		})
+	}
+}
+
+// A corrupted length field in the middle of the log makes that record run
+// past the end, like a torn final record, but complete records follow it.
+// Opening must fail rather than drop them, and leave the log untouched.
+func TestGitDbDurability_CorruptLengthMidLog(t *testing.T) {
+	for _, onDemand := range []bool{false, true} {
+		t.Run(fmt.Sprintf("OnDemand=%v", onDemand), func(t *testing.T) {
+			tmpDir, err := os.MkdirTemp("", "gitdb-durability-*")
+			if err != nil {
+				t.Fatalf("MkdirTemp: %v", err)
+			}
+			defer os.RemoveAll(tmpDir)
+			options := Options{OnDemand: onDemand}
+
+			db1, err := OpenWithOptions(tmpDir, options)
+			if err != nil {
+				t.Fatalf("Open(db1): %v", err)
+			}
+			for i := 0; i < 5; i++ {
+				if err := db1.Put(fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("value%d", i))); err != nil {
+					t.Fatalf("Put(key%d): %v", i, err)
+				}
+			}
+			if err := db1.Close(); err != nil {
+				t.Fatalf("Close(db1): %v", err)
+			}
+
+			// Raise the second record's value length past the end of the log
+			logPath := filepath.Join(tmpDir, "log")
+			data, err := os.ReadFile(logPath)
+			if err != nil {
+				t.Fatalf("ReadFile(log): %v", err)
+			}
+			first, err := Record{Key: "key0", Value: []byte("value0")}.Encode()
+			if err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			corrupted := append([]byte(nil), data...)
+			binary.LittleEndian.PutUint32(corrupted[len(first)+4:], uint32(len(data)))
+			if err := os.WriteFile(logPath, corrupted, 0644); err != nil {
+				t.Fatalf("WriteFile(log): %v", err)
+			}
+
+			if db, err := OpenWithOptions(tmpDir, options); err == nil {
+				db.Close()
+				t.Fatalf("Expected opening a log with a corrupt length mid-log to fail")
+			}
+			if after, err := os.ReadFile(logPath); err != nil || !bytes.Equal(after, corrupted) {
+				t.Fatalf("Expected the corrupt log left as it was, got %d bytes, %v", len(after), err)
+			}
+		})
+	}
+}
@@ -20,3 +20,17 @@ func (index *Index) Get(key string) (int64, bool) {
 	off, ok := index.latest[key]
 	return off, ok
 }
+
+// Delete removes a key from the index
+func (index *Index) Delete(key string) {
+	delete(index.latest, key)
+}
+
+// clone returns a copy of the index that later changes don't affect
+func (index *Index) clone() *Index {
+	latest := make(map[string]int64, len(index.latest))
+	for key, offset := range index.latest {
+		latest[key] = offset
+	}
+	return &Index{latest: latest}
+}
@@ -0,0 +1,39 @@
+package GitDb
+
+import "errors"
+
+// ErrNotFound is returned by Get for a key that was never written or has
+// been deleted
+var ErrNotFound = errors.New("key not found")
+
+// KV is the key-value store the rest of the system is written against. DB
+// implements it over an append-only log file and MemDB in memory.
+//
+// Scan visits every record in write order, including overwritten values and
+// Delete tombstones, so callers can replay history; the last record of a key
+// is its current value.
+//
+// Snapshot returns a read-only KV fixed at the current state: later writes
+// aren't visible in it, and its Put and Delete fail with ErrReadOnly. Reads
+// that must agree with each other should all go through one snapshot.
+type KV interface {
+	Get(key string) ([]byte, error)
+	Put(key string, value []byte) error
+	Delete(key string) error
+	Scan(fn func(Record) error) error
+	Snapshot() KV
+}
+
+// Sizer is implemented by KVs that report the size of their log. Every Put
+// and Delete grows it, so a caller holding a value derived from the log can
+// tell whether it was written to since.
+type Sizer interface {
+	Size() int64
+}
+
+var (
+	_ KV    = (*DB)(nil)
+	_ KV    = (*MemDB)(nil)
+	_ Sizer = (*DB)(nil)
+	_ Sizer = (*MemDB)(nil)
+)
@@ -0,0 +1,135 @@
+package GitDb
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+// TestKV runs the same Put/Get/Delete/Scan checks against DB and MemDB
+func TestKV(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitdb-kv-*")
+	if err != nil {
+		t.Fatalf("MkdirTemp: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	db, err := Open(tmpDir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	backends := []struct {
+		name string
+		kv   KV
+	}{
+		{"DB", db},
+		{"MemDB", NewMemDB()},
+	}
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			kv := backend.kv
+			if _, err := kv.Get("a"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Get(a) on an empty store: expected ErrNotFound, got %v", err)
+			}
+			for _, put := range []struct{ key, value string }{{"a", "1"}, {"b", "2"}, {"a", "3"}} {
+				if err := kv.Put(put.key, []byte(put.value)); err != nil {
+					t.Fatalf("Put(%s): %v", put.key, err)
+				}
+			}
+			if got, err := kv.Get("a"); err != nil || string(got) != "3" {
+				t.Fatalf("Get(a) = %q, %v; want 3", got, err)
+			}
+
+			if err := kv.Delete("a"); err != nil {
+				t.Fatalf("Delete(a): %v", err)
+			}
+			if err := kv.Delete("missing"); err != nil {
+				t.Fatalf("Delete(missing): %v", err)
+			}
+			if _, err := kv.Get("a"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Get(a) after Delete: expected ErrNotFound, got %v", err)
+			}
+			if got, err := kv.Get("b"); err != nil || string(got) != "2" {
+				t.Fatalf("Get(b) = %q, %v; want 2", got, err)
+			}
+
+			// Scan replays history, tombstones included
+			var seen []string
+			kv.Scan(func(record Record) error {
+				if record.Deleted {
+					seen = append(seen, record.Key+"-")
+				} else {
+					seen = append(seen, record.Key+"="+string(record.Value))
+				}
+				return nil
+			})
+			want := []string{"a=1", "b=2", "a=3", "a-", "missing-"}
+			if len(seen) != len(want) {
+				t.Fatalf("Scan saw %v, want %v", seen, want)
+			}
+			for i := range want {
+				if seen[i] != want[i] {
+					t.Fatalf("Scan saw %v, want %v", seen, want)
+				}
+			}
+
+			before := kv.(Sizer).Size()
+			if err := kv.Put("a", []byte("4")); err != nil {
+				t.Fatalf("Put(a) after Delete: %v", err)
+			}
+			if after := kv.(Sizer).Size(); after <= before {
+				t.Fatalf("Size() = %d after Put, want more than %d", after, before)
+			}
+			if got, err := kv.Get("a"); err != nil || string(got) != "4" {
+				t.Fatalf("Get(a) = %q, %v; want 4", got, err)
+			}
+		})
+	}
+}
+
+// TestDeletePersists checks a deleted key stays deleted after reopening and
+// is dropped by Compact
+func TestDeletePersists(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitdb-delete-*")
+	if err != nil {
+		t.Fatalf("MkdirTemp: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	db, err := Open(tmpDir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	for _, key := range []string{"gone", "kept"} {
+		if err := db.Put(key, []byte(key)); err != nil {
+			t.Fatalf("Put(%s): %v", key, err)
+		}
+	}
+	if err := db.Delete("gone"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	reopened, err := Open(tmpDir)
+	if err != nil {
+		t.Fatalf("Open after Delete: %v", err)
+	}
+	if _, err := reopened.Get("gone"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get(gone) after reopen: expected ErrNotFound, got %v", err)
+	}
+
+	if err := reopened.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	records := 0
+	reopened.Scan(func(record Record) error {
+		records++
+		if record.Key != "kept" {
+			t.Errorf("Expected only kept after Compact, got %+v", record)
+		}
+		return nil
+	})
+	if records != 1 {
+		t.Errorf("Expected 1 record after Compact, got %d", records)
+	}
+}
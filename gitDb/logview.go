@@ -0,0 +1,181 @@
+package GitDb
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+// logView is the log as a DB or snapshot sees it: its first size bytes, held
+// in memory (data) or, in on-demand mode, read from the log file (file) as
+// records are needed. Appends never modify existing bytes and Compact
+// replaces the log rather than rewriting it, so a view never changes.
+type logView struct {
+	data []byte
+	file *os.File // set in on-demand mode, when data is unused
+	size int64
+}
+
+// rawAt decodes the record at offset like decodeRawRecord. In on-demand mode
+// the record is read from the file, so its Value aliases a fresh buffer.
+func (v logView) rawAt(offset, maxSize int64) (rawRecord, error) {
+	if v.file == nil {
+		return decodeRawRecord(v.data[:v.size], offset, maxSize)
+	}
+	if offset < 0 || offset >= v.size {
+		return rawRecord{}, fmt.Errorf("offset out of range")
+	}
+	if v.size-offset < recordHeaderSize {
+		return rawRecord{}, fmt.Errorf("%w: not enough bytes for header", errTruncatedRecord)
+	}
+	headerBytes := make([]byte, recordHeaderSize)
+	if _, err := v.file.ReadAt(headerBytes, offset); err != nil {
+		return rawRecord{}, fmt.Errorf("failed to read record header: %w", err)
+	}
+	header, err := parseRecordHeader(headerBytes, maxSize)
+	if err != nil {
+		return rawRecord{}, err
+	}
+	if v.size-offset < header.size() {
+		return rawRecord{}, fmt.Errorf("%w: not enough bytes for record", errTruncatedRecord)
+	}
+	encoded := make([]byte, header.size())
+	copy(encoded, headerBytes)
+	if _, err := v.file.ReadAt(encoded[recordHeaderSize:], offset+recordHeaderSize); err != nil {
+		return rawRecord{}, fmt.Errorf("failed to read record: %w", err)
+	}
+	return decodeRawRecord(encoded, 0, maxSize)
+}
+
+// sizeAt returns the encoded size of the record at offset, reading only its
+// header
+func (v logView) sizeAt(offset, maxSize int64) (int64, error) {
+	if offset < 0 || offset >= v.size {
+		return 0, fmt.Errorf("offset out of range")
+	}
+	if v.size-offset < recordHeaderSize {
+		return 0, fmt.Errorf("%w: not enough bytes for header", errTruncatedRecord)
+	}
+	headerBytes := make([]byte, recordHeaderSize)
+	if v.file == nil {
+		copy(headerBytes, v.data[offset:])
+	} else if _, err := v.file.ReadAt(headerBytes, offset); err != nil {
+		return 0, fmt.Errorf("failed to read record header: %w", err)
+	}
+	header, err := parseRecordHeader(headerBytes, maxSize)
+	if err != nil {
+		return 0, err
+	}
+	return header.size(), nil
+}
+
+// recordAt decodes the record at offset, with its value copied and
+// decompressed
+func (v logView) recordAt(offset, maxSize int64) (Record, error) {
+	raw, err := v.rawAt(offset, maxSize)
+	if err != nil {
+		return Record{}, err
+	}
+	return raw.decoded()
+}
+
+// each calls fn with the offset of each record in the view and the record
+// undecoded. raw's Value is only valid until fn returns. In on-demand mode
+// the file is read sequentially, one record in memory at a time.
+func (v logView) each(maxSize int64, fn func(offset int64, raw rawRecord) error) error {
+	if v.file == nil {
+		log := v.data[:v.size]
+		offset := int64(0)
+		for offset < v.size {
+			raw, err := decodeRawRecord(log, offset, maxSize)
+			if err != nil {
+				return err
+			}
+			if err := fn(offset, raw); err != nil {
+				return err
+			}
+			offset += raw.size
+		}
+		return nil
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(v.file, 0, v.size))
+	var encoded []byte
+	offset := int64(0)
+	for offset < v.size {
+		if v.size-offset < recordHeaderSize {
+			return fmt.Errorf("%w: not enough bytes for header", errTruncatedRecord)
+		}
+		headerBytes := make([]byte, recordHeaderSize)
+		if _, err := io.ReadFull(reader, headerBytes); err != nil {
+			return fmt.Errorf("failed to read record header: %w", err)
+		}
+		header, err := parseRecordHeader(headerBytes, maxSize)
+		if err != nil {
+			return err
+		}
+		if v.size-offset < header.size() {
+			return fmt.Errorf("%w: not enough bytes for record", errTruncatedRecord)
+		}
+		// Reuse the buffer; raw doesn't outlive fn
+		if int64(cap(encoded)) < header.size() {
+			encoded = make([]byte, header.size())
+		}
+		encoded = encoded[:header.size()]
+		copy(encoded, headerBytes)
+		if _, err := io.ReadFull(reader, encoded[recordHeaderSize:]); err != nil {
+			return fmt.Errorf("failed to read record: %w", err)
+		}
+		raw, err := decodeRawRecord(encoded, 0, maxSize)
+		if err != nil {
+			return err
+		}
+		if err := fn(offset, raw); err != nil {
+			return err
+		}
+		offset += raw.size
+	}
+	return nil
+}
+
+// scan calls fn for each record in the view, in write order
+func (v logView) scan(maxSize int64, fn func(Record) error) error {
+	return v.each(maxSize, func(_ int64, raw rawRecord) error {
+		record, err := raw.decoded()
+		if err != nil {
+			return err
+		}
+		return fn(record)
+	})
+}
+
+// openValue returns a reader over the value of the record at offset, like
+// the package-level openValue. In on-demand mode the stored value is read
+// into memory first and decompressed as it is read.
+func (v logView) openValue(offset, maxSize int64) (io.ReadCloser, int64, error) {
+	if v.file == nil {
+		return openValue(v.data[:v.size], offset, maxSize)
+	}
+	raw, err := v.rawAt(offset, maxSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	return openRawValue(raw)
+}
+
+// readRange returns a copy of the view's bytes from start to end
+func (v logView) readRange(start, end int64) ([]byte, error) {
+	if start < 0 || start > end || end > v.size {
+		return nil, fmt.Errorf("range out of bounds")
+	}
+	b := make([]byte, end-start)
+	if v.file == nil {
+		copy(b, v.data[start:end])
+		return b, nil
+	}
+	if _, err := v.file.ReadAt(b, start); err != nil {
+		return nil, fmt.Errorf("failed to read log: %w", err)
+	}
+	return b, nil
+}
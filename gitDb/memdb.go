@@ -0,0 +1,110 @@
+package GitDb
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MemDB is a KV kept entirely in memory, for tests that don't need the log
+// on disk. It has DB's semantics, including Scan replaying every record, and
+// is safe for concurrent use.
+type MemDB struct {
+	mu       sync.RWMutex // guards records and latest
+	records  []Record
+	latest   map[string]int // key -> index of its latest record in records
+	readOnly bool           // set on snapshots
+}
+
+// NewMemDB creates an empty in-memory KV
+func NewMemDB() *MemDB {
+	return &MemDB{latest: make(map[string]int)}
+}
+
+// Put appends a record for key
+func (m *MemDB) Put(key string, value []byte) error {
+	return m.append(Record{Key: key, Value: append([]byte(nil), value...)})
+}
+
+// Delete appends a tombstone for key. Deleting a missing key is not an error.
+func (m *MemDB) Delete(key string) error {
+	return m.append(Record{Key: key, Deleted: true})
+}
+
+// append adds record and points the key at it
+func (m *MemDB) append(record Record) error {
+	if m.readOnly {
+		return ErrReadOnly
+	}
+	if record.Key == "" {
+		return fmt.Errorf("empty key")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.records = append(m.records, record)
+	if record.Deleted {
+		delete(m.latest, record.Key)
+	} else {
+		m.latest[record.Key] = len(m.records) - 1
+	}
+	return nil
+}
+
+// Get returns a copy of key's latest value
+func (m *MemDB) Get(key string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i, ok := m.latest[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return append([]byte(nil), m.records[i].Value...), nil
+}
+
+// Scan calls fn for every record in write order. Like DB.Scan it sees the
+// records present when it starts; fn may call Put.
+func (m *MemDB) Scan(fn func(Record) error) error {
+	// Records are never modified once appended, so the snapshot stays valid
+	m.mu.RLock()
+	records := m.records
+	m.mu.RUnlock()
+
+	for _, record := range records {
+		record.Value = append([]byte(nil), record.Value...)
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Snapshot returns a read-only MemDB holding the records written so far
+func (m *MemDB) Snapshot() KV {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	latest := make(map[string]int, len(m.latest))
+	for key, i := range m.latest {
+		latest[key] = i
+	}
+	return &MemDB{
+		records:  m.records[:len(m.records):len(m.records)],
+		latest:   latest,
+		readOnly: true,
+	}
+}
+
+// Size returns the number of records written, which grows with every write
+// as a DB's log does
+func (m *MemDB) Size() int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return int64(len(m.records))
+}
+
+// Close does nothing; it lets MemDB stand in where a DB would be closed
+func (m *MemDB) Close() error {
+	return nil
+}
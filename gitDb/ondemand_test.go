@@ -0,0 +1,170 @@
+package GitDb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"runtime"
+	"testing"
+)
+
+// heapGrowth returns how much the live heap grows while open runs, with what
+// open returns kept alive
+func heapGrowth(t *testing.T, open func() (*DB, error)) (*DB, int64) {
+	t.Helper()
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	db, err := open()
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	return db, int64(after.HeapAlloc) - int64(before.HeapAlloc)
+}
+
+// An on-demand DB reads a large log without holding it in memory: Get and
+// GetReader return every value, and opening it grows the heap far less than
+// opening the same log in the default mode
+func TestOnDemandLargeLog(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitdb-ondemand-large-*")
+	if err != nil {
+		t.Fatalf("MkdirTemp: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Random values don't compress, so the log is as large as they are
+	const count, valueSize = 64, 512 << 10
+	random := rand.New(rand.NewSource(1))
+	values := make([][]byte, count)
+	writer, err := Open(tmpDir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	for i := range values {
+		values[i] = make([]byte, valueSize)
+		random.Read(values[i])
+		if err := writer.Put(fmt.Sprintf("blob%d", i), values[i]); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+	writer.Close()
+
+	inMemory, inMemoryGrowth := heapGrowth(t, func() (*DB, error) { return Open(tmpDir) })
+	runtime.KeepAlive(inMemory)
+	inMemory.Close()
+
+	db, onDemandGrowth := heapGrowth(t, func() (*DB, error) {
+		return OpenWithOptions(tmpDir, Options{OnDemand: true})
+	})
+	defer db.Close()
+
+	if inMemoryGrowth < count*valueSize {
+		t.Fatalf("Expected the default mode to hold the %d-byte log, heap grew %d bytes", count*valueSize, inMemoryGrowth)
+	}
+	if onDemandGrowth > inMemoryGrowth/8 {
+		t.Errorf("Expected on-demand mode to use far less memory: heap grew %d bytes, %d in the default mode", onDemandGrowth, inMemoryGrowth)
+	}
+
+	for i, want := range values {
+		key := fmt.Sprintf("blob%d", i)
+		got, err := db.Get(key)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Fatalf("Get(%s): %d bytes, %v; want %d bytes", key, len(got), err, len(want))
+		}
+	}
+	r, size, err := db.GetReader("blob7")
+	if err != nil {
+		t.Fatalf("GetReader: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || size != valueSize || !bytes.Equal(got, values[7]) {
+		t.Errorf("GetReader(blob7): %d bytes (size %d), %v", len(got), size, err)
+	}
+}
+
+// An on-demand DB behaves like the default one through writes, deletes,
+// snapshots, Scan and Compact, and its writes are seen on reopen
+func TestOnDemand(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitdb-ondemand-*")
+	if err != nil {
+		t.Fatalf("MkdirTemp: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	db, err := OpenWithOptions(tmpDir, Options{OnDemand: true})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	large := bytes.Repeat([]byte("compressible "), 1024)
+	for _, put := range []struct{ key, value string }{
+		{"a", "1"}, {"b", "1"}, {"a", "2"}, {"large", string(large)},
+	} {
+		if err := db.Put(put.key, []byte(put.value)); err != nil {
+			t.Fatalf("Put(%s): %v", put.key, err)
+		}
+	}
+	if err := db.Delete("b"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	snapshot := db.Snapshot()
+	if err := db.Put("a", []byte("3")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	expect := func(kv KV, key, want string) {
+		t.Helper()
+		got, err := kv.Get(key)
+		if want == "" {
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get(%s): expected ErrNotFound, got %q, %v", key, got, err)
+			}
+			return
+		}
+		if err != nil || string(got) != want {
+			t.Errorf("Get(%s) = %q, %v; want %q", key, got, err, want)
+		}
+	}
+	expect(db, "a", "3")
+	expect(db, "b", "")
+	expect(db, "large", string(large))
+	expect(snapshot, "a", "2")
+
+	records := 0
+	if err := db.Scan(func(Record) error { records++; return nil }); err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if records != 6 {
+		t.Errorf("Expected Scan to see 6 records, got %d", records)
+	}
+
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	expect(db, "a", "3")
+	expect(db, "large", string(large))
+	// The snapshot still reads the log it was taken from
+	expect(snapshot, "a", "2")
+	expect(snapshot, "b", "")
+	if err := db.Put("c", []byte("1")); err != nil {
+		t.Fatalf("Put after Compact: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	reopened, err := OpenWithOptions(tmpDir, Options{OnDemand: true})
+	if err != nil {
+		t.Fatalf("Reopen: %v", err)
+	}
+	defer reopened.Close()
+	expect(reopened, "a", "3")
+	expect(reopened, "b", "")
+	expect(reopened, "c", "1")
+	expect(reopened, "large", string(large))
+}
@@ -0,0 +1,103 @@
+package GitDb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// ValueReader is implemented by KVs that can stream a value instead of
+// returning a copy of it. GetReader returns the value's reader and its size;
+// the caller must close the reader. DB and its snapshots implement it.
+type ValueReader interface {
+	GetReader(key string) (io.ReadCloser, int64, error)
+}
+
+var (
+	_ ValueReader = (*DB)(nil)
+	_ ValueReader = (*dbSnapshot)(nil)
+)
+
+// GetReader streams key's value from the log without copying it; a
+// compressed value is decompressed as it is read
+func (db *DB) GetReader(key string) (io.ReadCloser, int64, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	offset, ok := db.index.Get(key)
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return db.view().openValue(offset, db.maxRecordSize)
+}
+
+// GetReader streams key's value as of the snapshot
+func (s *dbSnapshot) GetReader(key string) (io.ReadCloser, int64, error) {
+	offset, ok := s.index.Get(key)
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return s.log.openValue(offset, s.maxRecordSize)
+}
+
+// openValue returns a reader over the value of the record at offset. The
+// reader aliases log, which is safe because appends never modify existing
+// bytes and Compact replaces the log rather than rewriting it.
+func openValue(log []byte, offset, maxSize int64) (io.ReadCloser, int64, error) {
+	raw, err := decodeRawRecord(log, offset, maxSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	return openRawValue(raw)
+}
+
+// openRawValue returns a reader over raw's value, decompressing it if needed
+func openRawValue(raw rawRecord) (io.ReadCloser, int64, error) {
+	if !raw.compressed {
+		return io.NopCloser(bytes.NewReader(raw.record.Value)), int64(len(raw.record.Value)), nil
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(raw.record.Value))
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid compressed value: %w", err)
+	}
+	return &gzipValueReader{reader: reader, remaining: raw.valueSize}, raw.valueSize, nil
+}
+
+// gzipValueReader decompresses a stored value, failing like gunzipValue if
+// the stream doesn't hold exactly the declared number of bytes. gzip checks
+// the CRC when the stream ends.
+type gzipValueReader struct {
+	reader    *gzip.Reader
+	remaining int64
+}
+
+func (r *gzipValueReader) Read(p []byte) (int, error) {
+	if r.remaining == 0 {
+		if n, err := r.reader.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+			if err != nil && err != io.EOF {
+				return 0, fmt.Errorf("invalid compressed value: %w", err)
+			}
+			return 0, fmt.Errorf("invalid compressed value: longer than its declared size")
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.reader.Read(p)
+	r.remaining -= int64(n)
+	if err == io.EOF {
+		if r.remaining > 0 {
+			return n, fmt.Errorf("invalid compressed value: %w", io.ErrUnexpectedEOF)
+		}
+		err = nil
+	} else if err != nil {
+		err = fmt.Errorf("invalid compressed value: %w", err)
+	}
+	return n, err
+}
+
+func (r *gzipValueReader) Close() error {
+	return r.reader.Close()
+}
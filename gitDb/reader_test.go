@@ -0,0 +1,58 @@
+package GitDb
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+// GetReader streams compressed and uncompressed values as written, from the
+// DB and from a snapshot, and reports their uncompressed size
+func TestGetReader(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitdb-reader-*")
+	if err != nil {
+		t.Fatalf("MkdirTemp: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	db, err := Open(tmpDir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	values := map[string][]byte{
+		"large": bytes.Repeat([]byte("package main\n\nfunc main() {}\n"), 4096),
+		"small": []byte("a short value"),
+		"empty": {},
+	}
+	for key, value := range values {
+		if err := db.Put(key, value); err != nil {
+			t.Fatalf("Put(%s): %v", key, err)
+		}
+	}
+
+	for _, kv := range []KV{db, db.Snapshot()} {
+		reader := kv.(ValueReader)
+		for key, want := range values {
+			r, size, err := reader.GetReader(key)
+			if err != nil {
+				t.Fatalf("GetReader(%s): %v", key, err)
+			}
+			got, err := io.ReadAll(r)
+			r.Close()
+			if err != nil {
+				t.Fatalf("GetReader(%s): read: %v", key, err)
+			}
+			if size != int64(len(want)) || !bytes.Equal(got, want) {
+				t.Errorf("GetReader(%s): %d bytes (size %d), want %d", key, len(got), size, len(want))
+			}
+		}
+
+		if _, _, err := reader.GetReader("missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetReader(missing): expected ErrNotFound, got %v", err)
+		}
+	}
+}
@@ -1,26 +1,84 @@
 package GitDb
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 )
 
 type Record struct {
-	Key   string
-	Value []byte
+	Key     string
+	Value   []byte
+	Deleted bool // a tombstone written by Delete; Value is empty
 }
 
-// Encode converts a Record into a byte slice.
+// recordHeaderSize is the encoded size of the key and value length headers
+const recordHeaderSize = 8
+
+// tombstoneValueLen is the value length header of a tombstone, which has no
+// value bytes. No value can be this long: Encode refuses it.
+const tombstoneValueLen = math.MaxUint32
+
+// compressedFlag marks, in the key length header, a record whose value is
+// stored gzip-compressed. Keys can't be long enough to set it: Encode refuses
+// them.
+const compressedFlag uint32 = 1 << 31
+
+// compressMinSize is the smallest value Encode tries to compress. Smaller
+// values gain little and would pay gzip's header and CPU on every read.
+const compressMinSize = 1024
+
+// DefaultMaxRecordSize is the largest encoded record (header, key and value)
+// a DB accepts unless opened with a different Options.MaxRecordSize.
+const DefaultMaxRecordSize int64 = 256 << 20
+
+// ErrRecordTooLarge is returned for records over the size cap, whether being
+// written or declared by a header in the log.
+var ErrRecordTooLarge = errors.New("record too large")
+
+// errTruncatedRecord is returned for a record that runs past the end of the
+// log, as the last record does when a crash interrupts its append
+var errTruncatedRecord = errors.New("truncated record")
+
+// Encode converts a Record into a byte slice. A value of at least
+// compressMinSize bytes is stored gzip-compressed, with compressedFlag set in
+// the key length header, if that makes it smaller.
 func (record Record) Encode() ([]byte, error) {
 	if record.Key == "" {
 		return nil, fmt.Errorf("empty key")
 	}
 	keyBytes := []byte(record.Key)
+	// Lengths are stored as uint32; refuse rather than silently truncate
+	if uint64(len(keyBytes)) >= uint64(compressedFlag) || int64(len(record.Value)) >= tombstoneValueLen {
+		return nil, fmt.Errorf("%w: key exceeds %d bytes or value exceeds %d bytes", ErrRecordTooLarge, compressedFlag-1, uint32(math.MaxUint32-1))
+	}
 	keyLen := uint32(len(keyBytes))
-	valLen := uint32(len(record.Value))
+	value := record.Value
+	if record.Deleted {
+		if len(record.Value) != 0 {
+			return nil, fmt.Errorf("tombstone with a value")
+		}
+	} else if len(value) >= compressMinSize {
+		compressed, err := gzipValue(value)
+		if err != nil {
+			return nil, err
+		}
+		if len(compressed) < len(value) {
+			value = compressed
+			keyLen |= compressedFlag
+		}
+	}
+	valLen := uint32(len(value))
+	if record.Deleted {
+		valLen = tombstoneValueLen
+	}
 
 	// 8 bytes header + payload
-	buf := make([]byte, 8+len(keyBytes)+len(record.Value))
+	buf := make([]byte, recordHeaderSize+len(keyBytes)+len(value))
 
 	// key length header
 	binary.LittleEndian.PutUint32(buf[0:4], keyLen)
@@ -31,43 +89,191 @@ func (record Record) Encode() ([]byte, error) {
 	copy(buf[8:8+len(keyBytes)], keyBytes)
 
 	// Copy value bytes immediately after the key
-	copy(buf[8+len(keyBytes):], record.Value)
+	copy(buf[8+len(keyBytes):], value)
 
 	return buf, nil
 }
 
-// DecodeRecord decodes a record and its size from bytes.
+// gzipValue returns value gzip-compressed
+func gzipValue(value []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(value); err != nil {
+		return nil, fmt.Errorf("failed to compress value: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress value: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// gunzipValue decompresses a stored value that decodes to size bytes
+func gunzipValue(stored []byte, size int64) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(stored))
+	if err != nil {
+		return nil, fmt.Errorf("invalid compressed value: %w", err)
+	}
+	value := make([]byte, size)
+	if _, err := io.ReadFull(reader, value); err != nil {
+		return nil, fmt.Errorf("invalid compressed value: %w", err)
+	}
+	// The stream must end exactly here; this also checks the CRC
+	if n, err := reader.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		return nil, fmt.Errorf("invalid compressed value: longer than its declared %d bytes", size)
+	}
+	return value, nil
+}
+
+// DecodeRecord decodes a record and its size from bytes, rejecting records
+// larger than DefaultMaxRecordSize.
 func DecodeRecord(log []byte, offset int64) (rec Record, size int64, err error) {
-	if offset < 0 || offset >= int64(len(log)) {
-		return Record{}, 0, fmt.Errorf("offset out of range")
+	return decodeRecord(log, offset, DefaultMaxRecordSize)
+}
+
+// decodeRecord decodes the record at offset, rejecting records whose size,
+// with the value decompressed, exceeds maxSize. Offsets and sizes are int64
+// throughout.
+func decodeRecord(log []byte, offset, maxSize int64) (rec Record, size int64, err error) {
+	raw, err := decodeRawRecord(log, offset, maxSize)
+	if err != nil {
+		return Record{}, 0, err
+	}
+	record, err := raw.decoded()
+	if err != nil {
+		return Record{}, 0, err
 	}
+	return record, raw.size, nil
+}
+
+// rawRecord is a record as stored in the log
+type rawRecord struct {
+	record     Record // Value aliases the log and is compressed if compressed is set
+	encoded    []byte // the whole record as stored, aliasing the log
+	size       int64  // encoded size in the log
+	compressed bool
+	valueSize  int64 // size of the value once decompressed
+}
 
-	if int64(len(log))-offset < 8 {
-		return Record{}, 0, fmt.Errorf("not enough bytes for header")
+// decoded returns the record with its value copied out of the log and
+// decompressed
+func (raw rawRecord) decoded() (Record, error) {
+	record := raw.record
+	if !raw.compressed {
+		record.Value = append([]byte(nil), record.Value...)
+		return record, nil
 	}
+	value, err := gunzipValue(record.Value, raw.valueSize)
+	if err != nil {
+		return Record{}, err
+	}
+	record.Value = value
+	return record, nil
+}
+
+// recordHeader is a record's decoded length header
+type recordHeader struct {
+	keyLen     int64
+	valLen     int64 // stored length; zero for a tombstone
+	compressed bool
+	deleted    bool
+}
+
+// size is the encoded size of the record, header included
+func (header recordHeader) size() int64 {
+	// Both lengths are at most MaxUint32, so this can't overflow int64
+	return recordHeaderSize + header.keyLen + header.valLen
+}
 
+// parseRecordHeader decodes the recordHeaderSize bytes of b, rejecting
+// records that declare more than maxSize bytes
+func parseRecordHeader(b []byte, maxSize int64) (recordHeader, error) {
 	// Reads key & value length from header
-	keyLen := int64(binary.LittleEndian.Uint32(log[offset : offset+4]))
-	valLen := int64(binary.LittleEndian.Uint32(log[offset+4 : offset+8]))
+	keyField := binary.LittleEndian.Uint32(b[0:4])
+	header := recordHeader{
+		keyLen:     int64(keyField &^ compressedFlag),
+		valLen:     int64(binary.LittleEndian.Uint32(b[4:8])),
+		compressed: keyField&compressedFlag != 0,
+	}
+	if header.valLen == tombstoneValueLen {
+		if header.compressed {
+			return recordHeader{}, fmt.Errorf("compressed tombstone")
+		}
+		header.deleted = true
+		header.valLen = 0
+	}
+	if total := header.size(); total > maxSize {
+		return recordHeader{}, fmt.Errorf("%w: %d bytes declared, limit is %d", ErrRecordTooLarge, total, maxSize)
+	}
+	return header, nil
+}
+
+// decodeRawRecord decodes the record at offset without copying or
+// decompressing its value, for callers that only need its key or bytes. It
+// checks the same size limit as decodeRecord: a compressed value's size is
+// read from the gzip trailer.
+func decodeRawRecord(log []byte, offset, maxSize int64) (rawRecord, error) {
+	if offset < 0 || offset >= int64(len(log)) {
+		return rawRecord{}, fmt.Errorf("offset out of range")
+	}
 
-	total := 8 + keyLen + valLen
-	if total < 8 {
-		return Record{}, 0, fmt.Errorf("invalid lengths")
+	if int64(len(log))-offset < recordHeaderSize {
+		return rawRecord{}, fmt.Errorf("%w: not enough bytes for header", errTruncatedRecord)
+	}
+	header, err := parseRecordHeader(log[offset:offset+recordHeaderSize], maxSize)
+	if err != nil {
+		return rawRecord{}, err
 	}
+	keyLen, valLen, compressed, deleted := header.keyLen, header.valLen, header.compressed, header.deleted
+	total := header.size()
 
 	if int64(len(log))-offset < total {
-		return Record{}, 0, fmt.Errorf("not enough bytes for record")
+		return rawRecord{}, fmt.Errorf("%w: not enough bytes for record", errTruncatedRecord)
 	}
 
-	keyStart := offset + 8
+	keyStart := offset + recordHeaderSize
 	keyEnd := keyStart + keyLen
 	valStart := keyEnd
 	valEnd := valStart + valLen
 
-	key := string(log[keyStart:keyEnd])
-	val := make([]byte, valLen)
-	copy(val, log[valStart:valEnd])
+	raw := rawRecord{
+		record:     Record{Key: string(log[keyStart:keyEnd]), Deleted: deleted},
+		encoded:    log[offset : offset+total : offset+total],
+		size:       total,
+		compressed: compressed,
+		valueSize:  valLen,
+	}
+	if deleted {
+		return raw, nil
+	}
+	raw.record.Value = log[valStart:valEnd:valEnd]
 
-	return Record{Key: key, Value: val}, total, nil
+	if compressed {
+		// The gzip trailer ends with the decompressed size (mod 2^32, and
+		// values are smaller than that)
+		if valLen < gzipTrailerSize {
+			return rawRecord{}, fmt.Errorf("compressed value too short")
+		}
+		raw.valueSize = int64(binary.LittleEndian.Uint32(log[valEnd-4 : valEnd]))
+		if decoded := recordHeaderSize + keyLen + raw.valueSize; decoded > maxSize {
+			return rawRecord{}, fmt.Errorf("%w: %d bytes decompressed, limit is %d", ErrRecordTooLarge, decoded, maxSize)
+		}
+	}
+	return raw, nil
+}
 
+// gzipTrailerSize is the CRC-32 and size that end a gzip stream
+const gzipTrailerSize = 8
+
+// ValidateLog checks that log is a sequence of complete, decodable records no
+// larger than DefaultMaxRecordSize.
+func ValidateLog(log []byte) error {
+	offset := int64(0)
+	for offset < int64(len(log)) {
+		_, size, err := decodeRecord(log, offset, DefaultMaxRecordSize)
+		if err != nil {
+			return fmt.Errorf("invalid record at offset %d: %w", offset, err)
+		}
+		offset += size
+	}
+	return nil
 }
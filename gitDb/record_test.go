@@ -0,0 +1,134 @@
+package GitDb
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// A record exactly at the size cap round-trips; one byte over is rejected on
+// Put, and a log declaring an oversized record fails to open
+func TestMaxRecordSize(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitdb-record-size-*")
+	if err != nil {
+		t.Fatalf("MkdirTemp: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	const maxSize = 4096
+	options := Options{MaxRecordSize: maxSize}
+	db, err := OpenWithOptions(tmpDir, options)
+	if err != nil {
+		t.Fatalf("OpenWithOptions: %v", err)
+	}
+
+	key := "big"
+	atCap := bytes.Repeat([]byte("x"), maxSize-recordHeaderSize-len(key))
+	if err := db.Put(key, atCap); err != nil {
+		t.Fatalf("Put at cap: %v", err)
+	}
+	if err := db.Put("over", append(atCap, 'x', 'x')); !errors.Is(err, ErrRecordTooLarge) {
+		t.Fatalf("Put over cap: expected ErrRecordTooLarge, got %v", err)
+	}
+
+	reopened, err := OpenWithOptions(tmpDir, options)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	got, err := reopened.Get(key)
+	if err != nil || !bytes.Equal(got, atCap) {
+		t.Fatalf("Get(%s) after reopen: %d bytes, err=%v", key, len(got), err)
+	}
+	if _, err := reopened.Get("over"); err == nil {
+		t.Fatalf("rejected record should not have been written")
+	}
+
+	// A smaller cap refuses the existing log rather than trusting its header
+	if _, err := OpenWithOptions(tmpDir, Options{MaxRecordSize: maxSize - 1}); !errors.Is(err, ErrRecordTooLarge) {
+		t.Fatalf("open with smaller cap: expected ErrRecordTooLarge, got %v", err)
+	}
+
+	// A corrupt header declaring ~4GB is rejected before any allocation
+	header := make([]byte, recordHeaderSize)
+	binary.LittleEndian.PutUint32(header[0:4], 1)
+	binary.LittleEndian.PutUint32(header[4:8], 0xFFFFFFF0)
+	if _, _, err := DecodeRecord(append(header, 'k'), 0); !errors.Is(err, ErrRecordTooLarge) {
+		t.Fatalf("DecodeRecord oversized header: expected ErrRecordTooLarge, got %v", err)
+	}
+}
+
+// Large compressible values are stored gzip-compressed and read back as
+// written, through Get, Scan and a reopen; small and incompressible values
+// are stored as is
+func TestCompression(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitdb-compress-*")
+	if err != nil {
+		t.Fatalf("MkdirTemp: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	large := bytes.Repeat([]byte("package main\n\nfunc main() {}\n"), 4096)
+	small := []byte("a short value")
+	random := make([]byte, 4*compressMinSize)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatalf("rand.Read: %v", err)
+	}
+	values := map[string][]byte{"large": large, "small": small, "random": random}
+
+	for _, tt := range []struct {
+		key        string
+		compressed bool
+	}{
+		{"large", true},
+		{"small", false},
+		{"random", false},
+	} {
+		encoded, err := Record{Key: tt.key, Value: values[tt.key]}.Encode()
+		if err != nil {
+			t.Fatalf("Encode(%s): %v", tt.key, err)
+		}
+		flagged := binary.LittleEndian.Uint32(encoded[0:4])&compressedFlag != 0
+		if flagged != tt.compressed {
+			t.Errorf("Encode(%s): compressed=%v, want %v", tt.key, flagged, tt.compressed)
+		}
+		if raw := recordHeaderSize + len(tt.key) + len(values[tt.key]); tt.compressed && len(encoded) >= raw/10 {
+			t.Errorf("Encode(%s): %d bytes, expected well under the %d uncompressed", tt.key, len(encoded), raw)
+		}
+	}
+
+	db, err := Open(tmpDir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	for _, key := range []string{"large", "small", "random"} {
+		if err := db.Put(key, values[key]); err != nil {
+			t.Fatalf("Put(%s): %v", key, err)
+		}
+	}
+	logData, _ := os.ReadFile(filepath.Join(tmpDir, "log"))
+	if len(logData) >= len(large) {
+		t.Errorf("Expected the log (%d bytes) to be smaller than the large value (%d bytes)", len(logData), len(large))
+	}
+
+	reopened, err := Open(tmpDir)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	for _, kv := range []KV{db, reopened} {
+		for key, want := range values {
+			if got, err := kv.Get(key); err != nil || !bytes.Equal(got, want) {
+				t.Errorf("Get(%s): %d bytes, err=%v; want %d bytes", key, len(got), err, len(want))
+			}
+		}
+		kv.Scan(func(record Record) error {
+			if !bytes.Equal(record.Value, values[record.Key]) {
+				t.Errorf("Scan: %s read back %d bytes, want %d", record.Key, len(record.Value), len(values[record.Key]))
+			}
+			return nil
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package GitDb
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrReadOnly is returned by Put and Delete on a snapshot
+var ErrReadOnly = errors.New("snapshot is read-only")
+
+// Snapshot returns a read-only view of the database as it is now. Records
+// appended afterwards, by this handle or after a Compact, aren't visible in it.
+// It holds the log prefix and a copy of the index, so it stays readable after
+// the DB is closed, except in on-demand mode, where it reads the DB's log file.
+func (db *DB) Snapshot() KV {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	// Appends never modify existing bytes, and Compact replaces the log
+	// rather than rewriting it, so the prefix never changes
+	return &dbSnapshot{
+		log:           db.view(),
+		index:         db.index.clone(),
+		maxRecordSize: db.maxRecordSize,
+	}
+}
+
+// dbSnapshot is the KV returned by DB.Snapshot
+type dbSnapshot struct {
+	log           logView
+	index         *Index
+	maxRecordSize int64
+}
+
+// Get returns key's value as of the snapshot
+func (s *dbSnapshot) Get(key string) ([]byte, error) {
+	offset, ok := s.index.Get(key)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	record, err := s.log.recordAt(offset, s.maxRecordSize)
+	if err != nil {
+		return nil, err
+	}
+	return record.Value, nil
+}
+
+// Scan calls fn for every record in the snapshot, in write order
+func (s *dbSnapshot) Scan(fn func(Record) error) error {
+	return s.log.scan(s.maxRecordSize, fn)
+}
+
+// Put fails: a snapshot can't be written
+func (s *dbSnapshot) Put(key string, value []byte) error {
+	return ErrReadOnly
+}
+
+// Delete fails: a snapshot can't be written
+func (s *dbSnapshot) Delete(key string) error {
+	return ErrReadOnly
+}
+
+// Snapshot returns the snapshot itself, which never changes
+func (s *dbSnapshot) Snapshot() KV {
+	return s
+}
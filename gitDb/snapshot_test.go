@@ -0,0 +1,91 @@
+package GitDb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+)
+
+// TestSnapshotIsolation reads from a snapshot of DB and MemDB while another
+// goroutine writes, and checks the snapshot keeps showing the state it was
+// taken at
+func TestSnapshotIsolation(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gitdb-snapshot-*")
+	if err != nil {
+		t.Fatalf("MkdirTemp: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	db, err := Open(tmpDir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	backends := []struct {
+		name string
+		kv   KV
+	}{
+		{"DB", db},
+		{"MemDB", NewMemDB()},
+	}
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			kv := backend.kv
+			for _, key := range []string{"a", "b"} {
+				if err := kv.Put(key, []byte(key+"0")); err != nil {
+					t.Fatalf("Put(%s): %v", key, err)
+				}
+			}
+
+			snap := kv.Snapshot()
+
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 1; i <= 200; i++ {
+					kv.Put("a", []byte(fmt.Sprintf("a%d", i)))
+					kv.Put(fmt.Sprintf("new%d", i), []byte("x"))
+				}
+				kv.Delete("b")
+			}()
+
+			// Every read against the snapshot sees the same state, whatever
+			// the writer has done so far
+			for i := 0; i < 200; i++ {
+				if got, err := snap.Get("a"); err != nil || string(got) != "a0" {
+					t.Fatalf("snapshot Get(a) = %q, %v; want a0", got, err)
+				}
+				if got, err := snap.Get("b"); err != nil || string(got) != "b0" {
+					t.Fatalf("snapshot Get(b) = %q, %v; want b0", got, err)
+				}
+				if _, err := snap.Get("new1"); !errors.Is(err, ErrNotFound) {
+					t.Fatalf("snapshot Get(new1): expected ErrNotFound, got %v", err)
+				}
+				records := 0
+				if err := snap.Scan(func(Record) error { records++; return nil }); err != nil {
+					t.Fatalf("snapshot Scan: %v", err)
+				}
+				if records != 2 {
+					t.Fatalf("snapshot Scan saw %d records, want 2", records)
+				}
+			}
+			wg.Wait()
+
+			if got, err := kv.Get("a"); err != nil || string(got) != "a200" {
+				t.Fatalf("Get(a) after writes = %q, %v; want a200", got, err)
+			}
+			if got, err := snap.Get("a"); err != nil || string(got) != "a0" {
+				t.Fatalf("snapshot Get(a) after writes = %q, %v; want a0", got, err)
+			}
+			if err := snap.Put("a", []byte("x")); !errors.Is(err, ErrReadOnly) {
+				t.Errorf("snapshot Put: expected ErrReadOnly, got %v", err)
+			}
+			if err := snap.Delete("a"); !errors.Is(err, ErrReadOnly) {
+				t.Errorf("snapshot Delete: expected ErrReadOnly, got %v", err)
+			}
+		})
+	}
+}